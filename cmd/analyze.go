@@ -2,60 +2,47 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"path" // *** 关键修改点1：引入 "path" 包 ***
+	"io"
+	"math"
+	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"code-prompt-core/pkg/churn"
 	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/depgraph"
+	"code-prompt-core/pkg/detect"
+	"code-prompt-core/pkg/docfiles"
+	"code-prompt-core/pkg/embeddings"
+	"code-prompt-core/pkg/entrypoints"
 	"code-prompt-core/pkg/filter"
+	"code-prompt-core/pkg/imageinfo"
+	"code-prompt-core/pkg/markdown"
+	"code-prompt-core/pkg/owners"
+	"code-prompt-core/pkg/packages"
+	"code-prompt-core/pkg/tokens"
+	"code-prompt-core/pkg/tree"
 
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-type TreeNode struct {
-	Name           string      `json:"name"`
-	Path           string      `json:"path"`
-	IsDir          bool        `json:"is_dir"`
-	Status         string      `json:"status,omitempty"`
-	SizeBytes      int64       `json:"size_bytes,omitempty"`       // 用于文件
-	TotalSizeBytes int64       `json:"total_size_bytes,omitempty"` // 用于目录
-	TotalFileCount int         `json:"total_file_count,omitempty"` // 用于目录
-	Children       []*TreeNode `json:"children"`
-}
-
-// calculateTreeAggregates 是一个新函数，用于递归计算目录的大小和文件数
-// 它从叶节点（文件）向上聚合到根节点。
-func calculateTreeAggregates(node *TreeNode) (size int64, count int) {
-	if !node.IsDir {
-		// 如果是文件，返回它自己的大小和 1 个计数
-		return node.SizeBytes, 1
-	}
-
-	var totalSize int64
-	var totalCount int
-
-	// 遍历所有子节点
-	for _, child := range node.Children {
-		// 递归调用
-		childSize, childCount := calculateTreeAggregates(child)
-		totalSize += childSize
-		totalCount += childCount
-	}
-
-	// 将聚合结果存回目录节点
-	node.TotalSizeBytes = totalSize
-	node.TotalFileCount = totalCount
-	return totalSize, totalCount
-}
-
 var analyzeCmd = &cobra.Command{
 	Use:   "analyze",
 	Short: "Analyze the cached data of a project",
-	Long:  `The "analyze" command group provides tools to query and generate insights from the cached project data without re-scanning the file system. All analysis commands operate on the existing data in the database, making them very fast.`,
+	Long: `The "analyze" command group provides tools to query and generate insights from the cached project data without re-scanning the file system. All analysis commands operate on the existing data in the database, making them very fast.
+
+With '--output result.json' a command writes its result to that file instead of stdout and prints only
+{"output": "<absolute path>", "bytes": N}. The file is written under a temporary name and renamed into place,
+so it never holds a partial result.`,
 }
 
 var analyzeFilterCmd = &cobra.Command{
@@ -71,8 +58,11 @@ The filter JSON supports both simple and advanced rules:
   "priority": "includes"
 }
 
+With '--base-path pkg/api', only the files under pkg/api are listed, with paths relative to it.
+
 Example:
-  code-prompt-core analyze filter --project-path /p/proj --filter-json '{"includeExts":[".go"]}'`,
+  code-prompt-core analyze filter --project-path /p/proj --filter-json '{"includeExts":[".go"]}'
+  code-prompt-core analyze filter --project-path /p/proj --base-path pkg/api`,
 	Run: func(cmd *cobra.Command, args []string) {
 		absProjectPath, err := getAbsoluteProjectPath("analyze.filter.project-path")
 		if err != nil {
@@ -80,54 +70,41 @@ Example:
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
+		defer database.Close(db)
 
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project: %w", err))
 			return
 		}
-
-		f, err := getFilter(
-			db,
-			projectID,
-			viper.GetString("analyze.filter.profile-name"),
-			viper.GetString("analyze.filter.filter-json"),
-		)
-		if err != nil {
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
 			printError(err)
 			return
 		}
+		tx := beginRead(db)
+		defer tx.Rollback()
 
-		paths, err := filter.GetFilteredFilePaths(db, projectID, f)
+		basePath, err := basePathPrefix("analyze.filter.base-path")
 		if err != nil {
 			printError(err)
 			return
 		}
-		if len(paths) == 0 {
-			printJSON([]interface{}{})
-			return
-		}
-		query := `
-			SELECT relative_path, filename, extension, size_bytes, line_count, is_text 
-			FROM file_metadata 
-			WHERE project_id = ? AND relative_path IN (?` + strings.Repeat(",?", len(paths)-1) + `)`
-		params := []interface{}{projectID}
-		for _, p := range paths {
-			params = append(params, p)
-		}
-		rows, err := db.Query(query, params...)
+		f, err := getFilter(
+			tx,
+			projectID,
+			viper.GetString("analyze.filter.profile-name"),
+			viper.GetString("analyze.filter.filter-json"),
+		)
 		if err != nil {
-			printError(fmt.Errorf("error fetching metadata: %w", err))
+			printError(err)
 			return
 		}
-		defer rows.Close()
+
 		type FileMetadata struct {
 			RelativePath string `json:"relative_path"`
 			Filename     string `json:"filename"`
@@ -135,16 +112,39 @@ Example:
 			SizeBytes    int64  `json:"size_bytes"`
 			LineCount    int    `json:"line_count"`
 			IsText       bool   `json:"is_text"`
+			IsGenerated  bool   `json:"is_generated"`
+			IsMinified   bool   `json:"is_minified"`
+			Mode         string `json:"mode"`
+			IsExecutable bool   `json:"is_executable"`
+			IsTest       bool   `json:"is_test"`
 		}
-		var files []FileMetadata
-		for rows.Next() {
-			var fileMeta FileMetadata
-			if err := rows.Scan(&fileMeta.RelativePath, &fileMeta.Filename, &fileMeta.Extension, &fileMeta.SizeBytes, &fileMeta.LineCount, &fileMeta.IsText); err != nil {
-				printError(fmt.Errorf("error scanning file metadata row: %w", err))
-				return
+		// The order of the filter result is kept, which may be sorted (e.g. "sortBy": "churn").
+		files := []FileMetadata{}
+		err = filter.IterateFilteredFiles(tx, projectID, f, func(m filter.FileMetadata) error {
+			relPath, ok := rebasePath(m.RelativePath, basePath)
+			if !ok {
+				return nil
 			}
-			files = append(files, fileMeta)
+			files = append(files, FileMetadata{
+				RelativePath: relPath,
+				Filename:     m.Filename,
+				Extension:    m.Extension,
+				SizeBytes:    m.SizeBytes,
+				LineCount:    m.LineCount,
+				IsText:       m.IsText,
+				IsGenerated:  m.IsGenerated,
+				IsMinified:   m.IsMinified,
+				Mode:         fmt.Sprintf("%04o", m.Mode),
+				IsExecutable: m.IsExecutable,
+				IsTest:       m.IsTest,
+			})
+			return nil
+		})
+		if err != nil {
+			printError(err)
+			return
 		}
+		warnIfNoMatch(len(files))
 		printJSON(files)
 	},
 }
@@ -159,6 +159,11 @@ This command is a high-performance way to 'preview' a filter.
 It calculates the total file count, total size, and returns the full metadata
 list for all matching files without reading their content.
 
+The summary also contains:
+- "totalTokens": an estimate of the prompt tokens of all text files (about 4 bytes per token).
+- "byExtension": file count, size, lines and tokens per extension, largest first.
+- "largestFiles": the --largest biggest files (default 10, -1 for all).
+
 This is ideal for an orchestration layer (like your MCP) to decide if a file set is
 too large for a subsequent 'content get' operation before calling the LLM.
 
@@ -171,22 +176,27 @@ Example:
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
+		defer database.Close(db)
 
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project: %w", err))
 			return
 		}
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
 
 		f, err := getFilter(
-			db,
+			tx,
 			projectID,
 			viper.GetString("analyze.summary.profile-name"),
 			viper.GetString("analyze.summary.filter-json"),
@@ -196,38 +206,6 @@ Example:
 			return
 		}
 
-		paths, err := filter.GetFilteredFilePaths(db, projectID, f)
-		if err != nil {
-			printError(err)
-			return
-		}
-
-		if len(paths) == 0 {
-			printJSON(map[string]interface{}{
-				"fileCount":      0,
-				"totalSizeBytes": 0,
-				"files":          []interface{}{},
-			})
-			return
-		}
-
-		// 这个查询与 analyze filter 相同
-		query := `
-			SELECT relative_path, filename, extension, size_bytes, line_count, is_text 
-			FROM file_metadata 
-			WHERE project_id = ? AND relative_path IN (?` + strings.Repeat(",?", len(paths)-1) + `)`
-		params := []interface{}{projectID}
-		for _, p := range paths {
-			params = append(params, p)
-		}
-		rows, err := db.Query(query, params...)
-		if err != nil {
-			printError(fmt.Errorf("error fetching metadata: %w", err))
-			return
-		}
-		defer rows.Close()
-
-		// (这是新部分：聚合)
 		type FileMetadata struct {
 			RelativePath string `json:"relative_path"`
 			Filename     string `json:"filename"`
@@ -236,23 +214,100 @@ Example:
 			LineCount    int    `json:"line_count"`
 			IsText       bool   `json:"is_text"`
 		}
-		var files []FileMetadata
-		var totalSize int64
+		type ExtensionSummary struct {
+			Extension      string `json:"extension"`
+			FileCount      int    `json:"fileCount"`
+			TotalSizeBytes int64  `json:"totalSizeBytes"`
+			TotalLines     int    `json:"totalLines"`
+			TotalTokens    int64  `json:"totalTokens"`
+		}
+		type LargeFile struct {
+			RelativePath string `json:"relative_path"`
+			SizeBytes    int64  `json:"size_bytes"`
+			Tokens       int64  `json:"tokens"`
+		}
+		files := []FileMetadata{}
+		var totalSize, totalTokens int64
+		byExtension := make(map[string]*ExtensionSummary)
 
-		for rows.Next() {
-			var fileMeta FileMetadata
-			if err := rows.Scan(&fileMeta.RelativePath, &fileMeta.Filename, &fileMeta.Extension, &fileMeta.SizeBytes, &fileMeta.LineCount, &fileMeta.IsText); err != nil {
-				printError(fmt.Errorf("error scanning file metadata row: %w", err))
-				return
+		err = filter.IterateFilteredFiles(tx, projectID, f, func(m filter.FileMetadata) error {
+			fileMeta := FileMetadata{
+				RelativePath: m.RelativePath,
+				Filename:     m.Filename,
+				Extension:    m.Extension,
+				SizeBytes:    m.SizeBytes,
+				LineCount:    m.LineCount,
+				IsText:       m.IsText,
 			}
 			files = append(files, fileMeta)
 			totalSize += fileMeta.SizeBytes // 聚合大小
+
+			// Binary files are never sent as text, so they do not count towards the token total.
+			var fileTokens int64
+			if fileMeta.IsText {
+				fileTokens = tokens.EstimateFromSize(fileMeta.SizeBytes)
+			}
+			totalTokens += fileTokens
+			ext := fileMeta.Extension
+			if ext == "" {
+				ext = "(no extension)"
+			}
+			summary, ok := byExtension[ext]
+			if !ok {
+				summary = &ExtensionSummary{Extension: ext}
+				byExtension[ext] = summary
+			}
+			summary.FileCount++
+			summary.TotalSizeBytes += fileMeta.SizeBytes
+			summary.TotalLines += fileMeta.LineCount
+			summary.TotalTokens += fileTokens
+			return nil
+		})
+		if err != nil {
+			printError(err)
+			return
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].RelativePath < files[j].RelativePath })
+
+		extensionList := make([]*ExtensionSummary, 0, len(byExtension))
+		for _, summary := range byExtension {
+			extensionList = append(extensionList, summary)
+		}
+		sort.Slice(extensionList, func(i, j int) bool {
+			if extensionList[i].TotalSizeBytes != extensionList[j].TotalSizeBytes {
+				return extensionList[i].TotalSizeBytes > extensionList[j].TotalSizeBytes
+			}
+			return extensionList[i].Extension < extensionList[j].Extension
+		})
+
+		bySize := make([]FileMetadata, len(files))
+		copy(bySize, files)
+		sort.Slice(bySize, func(i, j int) bool {
+			if bySize[i].SizeBytes != bySize[j].SizeBytes {
+				return bySize[i].SizeBytes > bySize[j].SizeBytes
+			}
+			return bySize[i].RelativePath < bySize[j].RelativePath
+		})
+		largestCount := viper.GetInt("analyze.summary.largest")
+		if largestCount < 0 || largestCount > len(bySize) {
+			largestCount = len(bySize)
+		}
+		largestFiles := make([]LargeFile, 0, largestCount)
+		for _, fileMeta := range bySize[:largestCount] {
+			lf := LargeFile{RelativePath: fileMeta.RelativePath, SizeBytes: fileMeta.SizeBytes}
+			if fileMeta.IsText {
+				lf.Tokens = tokens.EstimateFromSize(fileMeta.SizeBytes)
+			}
+			largestFiles = append(largestFiles, lf)
 		}
 
 		// (这是新的摘要对象)
 		printJSON(map[string]interface{}{
 			"fileCount":      len(files),
 			"totalSizeBytes": totalSize,
+			"totalTokens":    totalTokens,
+			"byExtension":    extensionList,
+			"largestFiles":   largestFiles,
 			"files":          files,
 		})
 	},
@@ -263,6 +318,7 @@ var analyzeStatsCmd = &cobra.Command{
 	Short: "Generate statistics about the project's cached files",
 	Long: `Generates statistical information about the project's current cache.
 It groups files by their extension and provides counts, total size, and total lines for each type, as well as overall totals. This command gives a high-level overview of the project's composition.
+"detected" lists the build systems and frameworks of the project, as 'analyze detect'.
 
 Example:
   code-prompt-core analyze stats --project-path /path/to/project`,
@@ -278,19 +334,24 @@ Example:
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project: %w", err))
 			return
 		}
-		rows, err := db.Query("SELECT extension, COUNT(*), SUM(size_bytes), SUM(line_count) FROM file_metadata WHERE project_id = ? GROUP BY extension", projectID)
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		rows, err := tx.Query("SELECT extension, COUNT(*), SUM(size_bytes), SUM(line_count) FROM file_metadata WHERE project_id = ? GROUP BY extension", projectID)
 		if err != nil {
 			printError(fmt.Errorf("error querying file metadata: %w", err))
 			return
@@ -320,216 +381,1918 @@ Example:
 			totalSize += s.TotalSize
 			totalLines += s.TotalLines
 		}
+		detected, err := projectDetections(tx, projectID, absProjectPath)
+		if err != nil {
+			printError(err)
+			return
+		}
 		printJSON(map[string]interface{}{
 			"totalFiles":  totalFiles,
 			"totalSize":   totalSize,
 			"totalLines":  totalLines,
 			"byExtension": stats,
+			"detected":    detected,
 		})
 	},
 }
 
-var analyzeTreeCmd = &cobra.Command{
-	Use:   "tree",
-	Short: "Generate a file structure tree from the cache",
-	Long: `Generates a file structure tree, optionally annotating it based on a filter.
-This command now also recursively calculates the total size and file count for each directory.
-
-The filter (from --filter-json or --profile-name) determines which files are marked as "included".
-The filter JSON supports both simple and advanced rules:
-{
-  "excludeExts": ["md"],
-  "includePaths": ["cmd/"]
-}
+var analyzeOnelineCmd = &cobra.Command{
+	Use:   "oneline",
+	Short: "Summarize the filtered files in one compact line",
+	Long: `Returns a single line such as "1,243 files · 18.4 MB · 412k LOC · ~1.2M tokens (Go 64%, TypeScript 22%)" for the
+files matching a filter, to put at the top of prompts or PR descriptions. The languages are the --top largest by bytes
+among the files of a known language, with their share of those bytes. Tokens are estimated for text files (about 4
+bytes per token). Report templates get the same line as {{oneline}}.
 
-Example (JSON output, annotated):
-  code-prompt-core analyze tree --project-path /p/proj --filter-json '{"excludeExts":["md"]}'`,
+Example:
+  code-prompt-core analyze oneline --project-path /p/proj --profile-name go-source`,
 	Run: func(cmd *cobra.Command, args []string) {
-		absProjectPath, err := getAbsoluteProjectPath("analyze.tree.project-path")
+		absProjectPath, err := getAbsoluteProjectPath("analyze.oneline.project-path")
 		if err != nil {
 			printError(err)
 			return
 		}
-		db, err := database.InitializeDB(viper.GetString("db"))
+
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project: %w", err))
 			return
 		}
-
-		f, err := getFilter(
-			db,
-			projectID,
-			viper.GetString("analyze.tree.profile-name"),
-			viper.GetString("analyze.tree.filter-json"),
-		)
-		if err != nil {
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
 			printError(err)
 			return
 		}
+		tx := beginRead(db)
+		defer tx.Rollback()
 
-		includedPaths, err := filter.GetFilteredFilePaths(db, projectID, f)
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.oneline.profile-name"), viper.GetString("analyze.oneline.filter-json"))
 		if err != nil {
-			printError(fmt.Errorf("error getting filtered file list: %w", err))
+			printError(err)
 			return
 		}
-		includedSet := make(map[string]struct{}, len(includedPaths))
-		for _, path := range includedPaths {
-			includedSet[path] = struct{}{}
-		}
-		// *** 修改：现在也查询 size_bytes ***
-		rows, err := db.Query("SELECT relative_path, size_bytes FROM file_metadata WHERE project_id = ? ORDER BY relative_path ASC", projectID)
+		line, err := projectOneline(tx, projectID, f, viper.GetInt("analyze.oneline.top"))
 		if err != nil {
-			printError(fmt.Errorf("error querying all file metadata for tree: %w", err))
+			printError(err)
 			return
 		}
-		defer rows.Close()
+		printJSON(line)
+	},
+}
 
-		// `filepath.Base` is safe here as it operates on the project's real path on disk
-		root := &TreeNode{Name: filepath.Base(absProjectPath), Path: ".", IsDir: true}
-		nodes := make(map[string]*TreeNode)
-		nodes["."] = root
+// projectOneline builds the one-line summary of the files passing the filter, naming the top
+// languages by bytes.
+func projectOneline(db database.Querier, projectID int64, f filter.Filter, top int) (string, error) {
+	var files int
+	var size, lines, tokenCount int64
+	languages := languageTally{}
+	err := filter.IterateFilteredFiles(db, projectID, f, func(m filter.FileMetadata) error {
+		files++
+		size += m.SizeBytes
+		lines += int64(m.LineCount)
+		if m.IsText {
+			tokenCount += tokens.EstimateFromSize(m.SizeBytes)
+		}
+		languages.add(m)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
 
-		for rows.Next() {
-			var dbPath string
-			var size int64 // *** 修改：接收 size_bytes ***
-			if err := rows.Scan(&dbPath, &size); err != nil {
-				printError(fmt.Errorf("error scanning row: %w", err))
-				return
-			}
+	line := fmt.Sprintf("%s files · %s · %s LOC · ~%s tokens", humanize.Comma(int64(files)), humanize.Bytes(uint64(size)), compactCount(lines), compactCount(tokenCount))
+	breakdown := languages.breakdown()
+	if top >= 0 && len(breakdown) > top {
+		breakdown = breakdown[:top]
+	}
+	shares := make([]string, 0, len(breakdown))
+	for _, l := range breakdown {
+		shares = append(shares, fmt.Sprintf("%s %.0f%%", l.Language, l.BytePercent))
+	}
+	if len(shares) > 0 {
+		line += " (" + strings.Join(shares, ", ") + ")"
+	}
+	return line, nil
+}
 
-			// *** 关键修改点2：总是使用'/'来分割从数据库读出的路径 ***
-			parts := strings.Split(dbPath, "/")
-			currentPath := ""
+// languageShare is one language of 'analyze languages'. The percentages are of the files
+// with a known language, like GitHub's language bar.
+type languageShare struct {
+	Language    string  `json:"language"`
+	FileCount   int     `json:"fileCount"`
+	SizeBytes   int64   `json:"sizeBytes"`
+	LineCount   int64   `json:"lineCount"`
+	BytePercent float64 `json:"bytePercent"`
+	LinePercent float64 `json:"linePercent"`
+}
 
-			for i, part := range parts {
-				isDir := i < len(parts)-1
-				if i > 0 {
-					// *** 关键修改点3：使用 path.Join 来构建标准化的路径 ***
-					currentPath = path.Join(currentPath, part)
-				} else {
-					currentPath = part
-				}
+// languageTally accumulates files by the display name of their language. Files of an unknown
+// language are not counted.
+type languageTally map[string]*languageShare
 
-				if _, exists := nodes[currentPath]; !exists {
-					newNode := &TreeNode{Name: part, Path: currentPath, IsDir: isDir, Children: []*TreeNode{}}
-					if !isDir {
-						// *** 修改：仅在文件节点上设置 SizeBytes ***
-						newNode.SizeBytes = size
-						if _, isIncluded := includedSet[currentPath]; isIncluded {
-							newNode.Status = "included"
-						} else {
-							newNode.Status = "excluded"
-						}
-					}
-
-					// *** 关键修改点4：使用 path.Dir 来查找父路径 ***
-					parentPath := path.Dir(currentPath)
-					if parent, ok := nodes[parentPath]; ok {
-						parent.Children = append(parent.Children, newNode)
-					}
-					nodes[currentPath] = newNode
-				}
+func (t languageTally) add(m filter.FileMetadata) {
+	name := markdown.LanguageName(m.RelativePath)
+	if name == "" {
+		return
+	}
+	share, ok := t[name]
+	if !ok {
+		share = &languageShare{Language: name}
+		t[name] = share
+	}
+	share.FileCount++
+	share.SizeBytes += m.SizeBytes
+	share.LineCount += int64(m.LineCount)
+}
+
+// breakdown returns the languages by decreasing size, with percentages rounded to 0.1.
+func (t languageTally) breakdown() []languageShare {
+	var totalBytes, totalLines int64
+	for _, share := range t {
+		totalBytes += share.SizeBytes
+		totalLines += share.LineCount
+	}
+	percent := func(n, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return math.Round(float64(n)*1000/float64(total)) / 10
+	}
+	result := make([]languageShare, 0, len(t))
+	for _, share := range t {
+		s := *share
+		s.BytePercent = percent(s.SizeBytes, totalBytes)
+		s.LinePercent = percent(s.LineCount, totalLines)
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SizeBytes != result[j].SizeBytes {
+			return result[i].SizeBytes > result[j].SizeBytes
+		}
+		return result[i].Language < result[j].Language
+	})
+	return result
+}
+
+// projectLanguages returns the language breakdown of the files passing the filter.
+func projectLanguages(db database.Querier, projectID int64, f filter.Filter) ([]languageShare, error) {
+	languages := languageTally{}
+	err := filter.IterateFilteredFiles(db, projectID, f, func(m filter.FileMetadata) error {
+		languages.add(m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return languages.breakdown(), nil
+}
+
+// compactCount abbreviates a count as 950, 1.2k, 412k or 3.4M.
+func compactCount(n int64) string {
+	units := []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "k"}}
+	for _, u := range units {
+		if float64(n) >= u.size {
+			v := float64(n) / u.size
+			if v >= 100 {
+				return fmt.Sprintf("%.0f%s", v, u.suffix)
 			}
+			return strings.TrimSuffix(fmt.Sprintf("%.1f", v), ".0") + u.suffix
 		}
+	}
+	return fmt.Sprint(n)
+}
 
-		// *** 新增：在排序前调用聚合函数 ***
-		calculateTreeAggregates(root)
+var analyzeLanguagesCmd = &cobra.Command{
+	Use:   "languages",
+	Short: "Break down the filtered files by language",
+	Long: `Returns the languages of the files matching a filter, by decreasing size, with their share of the bytes and
+lines of all files of a known language, like GitHub's language bar. Languages are detected from file names and
+extensions; other files are left out, as are dependency manifests and lock files (go.mod, go.sum,
+package-lock.json, yarn.lock, Cargo.lock, ...). Report templates get the same list as {{languages}}.
 
-		sortTree(root)
-		if viper.GetString("analyze.tree.format") == "text" {
-			fmt.Println(root.Name)
-			printPlainTextTree(root, "")
-		} else {
-			printJSON(root)
+Example:
+  code-prompt-core analyze languages --project-path /p/proj --filter-json '{"excludePrefixes":["vendor/"],"priority":"excludes"}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		absProjectPath, err := getAbsoluteProjectPath("analyze.languages.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.languages.profile-name"), viper.GetString("analyze.languages.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		languages, err := projectLanguages(tx, projectID, f)
+		if err != nil {
+			printError(err)
+			return
 		}
+		printJSON(languages)
 	},
 }
 
-func sortTree(node *TreeNode) {
-	if !node.IsDir || len(node.Children) == 0 {
-		return
-	}
-	sort.Slice(node.Children, func(i, j int) bool {
-		if node.Children[i].IsDir != node.Children[j].IsDir {
-			return node.Children[i].IsDir
-		}
-		return node.Children[i].Name < node.Children[j].Name
-	})
-	for _, child := range node.Children {
-		sortTree(child)
-	}
+// budgetStrategies are the orders in which 'analyze budget' drops files, by name.
+var budgetStrategies = map[string]func(a, b budgetFile) bool{
+	"largest-first": func(a, b budgetFile) bool { return a.Tokens > b.Tokens },
+	"oldest-first":  func(a, b budgetFile) bool { return a.modTime.Before(b.modTime) },
+}
+
+// budgetFile is a file dropped under a budget strategy.
+type budgetFile struct {
+	Path        string `json:"path"`
+	Tokens      int64  `json:"tokens"`
+	LastModTime string `json:"lastModTime"`
+
+	modTime time.Time
+}
+
+// tokenBucket is one bar of the per-file token histogram of 'analyze budget'.
+type tokenBucket struct {
+	Range     string `json:"range"`
+	FileCount int    `json:"fileCount"`
+	Tokens    int64  `json:"tokens"`
+}
+
+// budgetPlan is the outcome of one strategy: the files it drops to fit the budget and the
+// share of the files and tokens kept, in percent.
+type budgetPlan struct {
+	Strategy      string       `json:"strategy"`
+	Dropped       []budgetFile `json:"dropped"`
+	KeptFiles     int          `json:"keptFiles"`
+	KeptTokens    int64        `json:"keptTokens"`
+	FileCoverage  float64      `json:"fileCoverage"`
+	TokenCoverage float64      `json:"tokenCoverage"`
+}
+
+// budgetReport is the response of 'analyze budget'.
+type budgetReport struct {
+	MaxTokens   int64         `json:"maxTokens"`
+	TotalTokens int64         `json:"totalTokens"`
+	FileCount   int           `json:"fileCount"`
+	Fits        bool          `json:"fits"`
+	Histogram   []tokenBucket `json:"histogram"`
+	Strategies  []budgetPlan  `json:"strategies"`
 }
 
-func printPlainTextTree(node *TreeNode, prefix string) {
-	for i, child := range node.Children {
-		connector := "├── "
-		if i == len(node.Children)-1 {
-			connector = "└── "
+// tokenBucketBounds are the upper bounds (exclusive) of the histogram buckets; the last bucket is open.
+var tokenBucketBounds = []int64{1000, 4000, 16000, 64000}
+
+var analyzeBudgetCmd = &cobra.Command{
+	Use:   "budget",
+	Short: "Check whether the filtered files fit into a token budget",
+	Long: `Estimates the prompt tokens of the files matching a filter (` + fmt.Sprint(tokens.BytesPerToken) + ` bytes per token, binary files count as 0)
+and reports whether they fit into '--max-tokens', with a histogram of the tokens per file. For every strategy in
+'--strategies' it lists the files that would be dropped, in order, until the rest fits, and the resulting coverage:
+- largest-first: the files with the most tokens are dropped first.
+- oldest-first:  the files modified longest ago are dropped first.
+When everything fits, no file is dropped.
+
+Example:
+  code-prompt-core analyze budget --project-path /p/proj --max-tokens 128000
+  code-prompt-core analyze budget --project-path /p/proj --profile-name go-source --max-tokens 32000 --strategies oldest-first`,
+	Run: func(cmd *cobra.Command, args []string) {
+		absProjectPath, err := getAbsoluteProjectPath("analyze.budget.project-path")
+		if err != nil {
+			printError(err)
+			return
 		}
-		statusMarker := ""
-		if child.Status == "excluded" {
-			statusMarker = " [excluded]"
+		maxTokens := viper.GetInt64("analyze.budget.max-tokens")
+		if maxTokens <= 0 {
+			printError(fmt.Errorf("--max-tokens must be a positive number"))
+			return
 		}
-		// *** 修改：在文本树中也显示大小信息 ***
-		sizeInfo := ""
-		if child.IsDir {
-			sizeInfo = fmt.Sprintf(" (%d files, %d bytes)", child.TotalFileCount, child.TotalSizeBytes)
-		} else {
-			sizeInfo = fmt.Sprintf(" (%d bytes)", child.SizeBytes)
+		strategies := viper.GetStringSlice("analyze.budget.strategies")
+		for _, s := range strategies {
+			if _, ok := budgetStrategies[s]; !ok {
+				printError(fmt.Errorf("unknown strategy %q (valid: %s)", s, strings.Join(sortedKeys(budgetStrategies), ", ")))
+				return
+			}
 		}
 
-		fmt.Println(prefix + connector + child.Name + sizeInfo + statusMarker)
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
 
-		if child.IsDir {
-			newPrefix := prefix
-			if i == len(node.Children)-1 {
-				newPrefix += "    "
-			} else {
-				newPrefix += "│   "
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.budget.profile-name"), viper.GetString("analyze.budget.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		var files []budgetFile
+		err = filter.IterateFilteredFiles(tx, projectID, f, func(m filter.FileMetadata) error {
+			file := budgetFile{Path: m.RelativePath, LastModTime: m.LastModTime}
+			if m.IsText {
+				file.Tokens = tokens.EstimateFromSize(m.SizeBytes)
 			}
-			printPlainTextTree(child, newPrefix)
+			file.modTime, _ = time.Parse(time.RFC3339Nano, m.LastModTime)
+			files = append(files, file)
+			return nil
+		})
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
 		}
-	}
+		printJSON(planBudget(files, maxTokens, strategies))
+	},
 }
 
-func init() {
-	rootCmd.AddCommand(analyzeCmd)
+// planBudget builds the budget report of the files for each strategy.
+func planBudget(files []budgetFile, maxTokens int64, strategies []string) budgetReport {
+	report := budgetReport{MaxTokens: maxTokens, FileCount: len(files), Strategies: []budgetPlan{}}
+	for i, bound := range tokenBucketBounds {
+		from := "0"
+		if i > 0 {
+			from = compactCount(tokenBucketBounds[i-1])
+		}
+		report.Histogram = append(report.Histogram, tokenBucket{Range: from + "-" + compactCount(bound)})
+	}
+	report.Histogram = append(report.Histogram, tokenBucket{Range: compactCount(tokenBucketBounds[len(tokenBucketBounds)-1]) + "+"})
+	for _, file := range files {
+		report.TotalTokens += file.Tokens
+		bucket := sort.Search(len(tokenBucketBounds), func(i int) bool { return file.Tokens < tokenBucketBounds[i] })
+		report.Histogram[bucket].FileCount++
+		report.Histogram[bucket].Tokens += file.Tokens
+	}
+	report.Fits = report.TotalTokens <= maxTokens
 
-	analyzeCmd.AddCommand(analyzeFilterCmd)
-	analyzeFilterCmd.Flags().String("project-path", "", "Path to the project")
-	analyzeFilterCmd.Flags().String("filter-json", "", "JSON string with filter conditions")
-	analyzeFilterCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use") // 新增
-	viper.BindPFlag("analyze.filter.project-path", analyzeFilterCmd.Flags().Lookup("project-path"))
-	viper.BindPFlag("analyze.filter.filter-json", analyzeFilterCmd.Flags().Lookup("filter-json"))
-	viper.BindPFlag("analyze.filter.profile-name", analyzeFilterCmd.Flags().Lookup("profile-name")) // 新增
+	percent := func(n, total int64) float64 {
+		if total == 0 {
+			return 100
+		}
+		return math.Round(float64(n)*1000/float64(total)) / 10
+	}
+	for _, name := range strategies {
+		order := append([]budgetFile(nil), files...)
+		less := budgetStrategies[name]
+		sort.SliceStable(order, func(i, j int) bool { return less(order[i], order[j]) })
+		plan := budgetPlan{Strategy: name, Dropped: []budgetFile{}, KeptTokens: report.TotalTokens}
+		for _, file := range order {
+			if plan.KeptTokens <= maxTokens {
+				break
+			}
+			plan.Dropped = append(plan.Dropped, file)
+			plan.KeptTokens -= file.Tokens
+		}
+		plan.KeptFiles = len(files) - len(plan.Dropped)
+		plan.FileCoverage = percent(int64(plan.KeptFiles), int64(len(files)))
+		plan.TokenCoverage = percent(plan.KeptTokens, report.TotalTokens)
+		report.Strategies = append(report.Strategies, plan)
+	}
+	return report
+}
 
-	// *** 新增：注册 analyze summary 命令 ***
-	analyzeCmd.AddCommand(analyzeSummaryCmd)
-	analyzeSummaryCmd.Flags().String("project-path", "", "Path to the project")
-	analyzeSummaryCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
-	analyzeSummaryCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
-	viper.BindPFlag("analyze.summary.project-path", analyzeSummaryCmd.Flags().Lookup("project-path"))
-	viper.BindPFlag("analyze.summary.profile-name", analyzeSummaryCmd.Flags().Lookup("profile-name"))
-	viper.BindPFlag("analyze.summary.filter-json", analyzeSummaryCmd.Flags().Lookup("filter-json"))
+var analyzeExtensionsCmd = &cobra.Command{
+	Use:   "extensions",
+	Short: "List the distinct file extensions in the cache with sample paths",
+	Long: `Lists every distinct extension among the cached files of a project, with the number of files, their
+total size and a few sample paths (the first ones in path order), most frequent first. Use it to see which
+extensions exist, including unusual ones like .gotmpl or .proto, before writing the "includeExts" or
+"excludeExts" of a filter. Files without an extension are listed as "(no extension)".
 
-	analyzeCmd.AddCommand(analyzeStatsCmd)
-	analyzeStatsCmd.Flags().String("project-path", "", "Path to the project")
-	viper.BindPFlag("analyze.stats.project-path", analyzeStatsCmd.Flags().Lookup("project-path"))
+Example:
+  code-prompt-core analyze extensions --project-path /p/proj --samples 5`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.extensions.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		samples := viper.GetInt("analyze.extensions.samples")
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		rows, err := db.Query("SELECT COALESCE(extension, ''), relative_path, size_bytes FROM file_metadata WHERE project_id = ? ORDER BY relative_path", projectID)
+		if err != nil {
+			printError(fmt.Errorf("error querying file metadata: %w", err))
+			return
+		}
+		defer rows.Close()
+		type extensionInfo struct {
+			Extension      string   `json:"extension"`
+			FileCount      int      `json:"fileCount"`
+			TotalSizeBytes int64    `json:"totalSizeBytes"`
+			Samples        []string `json:"samples"`
+		}
+		byExtension := make(map[string]*extensionInfo)
+		for rows.Next() {
+			var ext, relPath string
+			var size int64
+			if err := rows.Scan(&ext, &relPath, &size); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			if ext == "" {
+				ext = "(no extension)"
+			}
+			info, ok := byExtension[ext]
+			if !ok {
+				info = &extensionInfo{Extension: ext, Samples: []string{}}
+				byExtension[ext] = info
+			}
+			info.FileCount++
+			info.TotalSizeBytes += size
+			if len(info.Samples) < samples {
+				info.Samples = append(info.Samples, relPath)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			printError(fmt.Errorf("error iterating rows: %w", err))
+			return
+		}
+		extensions := make([]*extensionInfo, 0, len(byExtension))
+		for _, info := range byExtension {
+			extensions = append(extensions, info)
+		}
+		sort.Slice(extensions, func(i, j int) bool {
+			if extensions[i].FileCount != extensions[j].FileCount {
+				return extensions[i].FileCount > extensions[j].FileCount
+			}
+			return extensions[i].Extension < extensions[j].Extension
+		})
+		printJSON(extensions)
+	},
+}
+
+var analyzeTreeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Generate a file structure tree from the cache",
+	Long: `Generates a file structure tree, optionally annotating it based on a filter.
+This command now also recursively calculates the total size and file count for each directory.
+
+The filter (from --filter-json or --profile-name) determines which files are marked as "included".
+The filter JSON supports both simple and advanced rules:
+{
+  "excludeExts": ["md"],
+  "includePaths": ["cmd/"]
+}
+
+Use --format to choose between JSON (default), an indented text tree, or a nested Markdown list.
+The text tree shows human-readable sizes ('--no-sizes' leaves them out) and, with '--tokens', the
+estimated prompt tokens; when a filter is given, files are marked ✓ (included) or ✗ (excluded).
+'--collapse-single-child' merges directory chains such as src/main/java/com/acme into one node, which
+shrinks the tree of deeply nested (Java, Kotlin) projects; the node's path is that of the deepest directory.
+With '--base-path pkg/api', the tree is the subtree of pkg/api and its paths are relative to it.
+
+Example (JSON output, annotated):
+  code-prompt-core analyze tree --project-path /p/proj --filter-json '{"excludeExts":["md"]}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		absProjectPath, err := getAbsoluteProjectPath("analyze.tree.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+
+		f, err := getFilter(
+			tx,
+			projectID,
+			viper.GetString("analyze.tree.profile-name"),
+			viper.GetString("analyze.tree.filter-json"),
+		)
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		basePath, err := basePathPrefix("analyze.tree.base-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		includedPaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error getting filtered file list: %w", err))
+			return
+		}
+		includedSet := make(map[string]struct{}, len(includedPaths))
+		for _, path := range includedPaths {
+			if rebased, ok := rebasePath(path, basePath); ok {
+				includedSet[rebased] = struct{}{}
+			}
+		}
+		root, err := buildFileTree(tx, projectID, absProjectPath, includedSet, basePath)
+		if err != nil {
+			printError(fmt.Errorf("error building tree: %w", err))
+			return
+		}
+		if viper.GetBool("analyze.tree.collapse-single-child") {
+			tree.CollapseSingleChild(root)
+		}
+
+		// In quiet mode the text renderings are wrapped in the JSON envelope as well; with
+		// --output they are written to the file as they are.
+		var out io.Writer = os.Stdout
+		var buf bytes.Buffer
+		if viper.GetBool("quiet") || responseOutput != "" {
+			out = &buf
+		}
+		switch viper.GetString("analyze.tree.format") {
+		case "text":
+			tree.RenderText(out, root, tree.TextOptions{
+				NoSizes: viper.GetBool("analyze.tree.no-sizes"),
+				Tokens:  viper.GetBool("analyze.tree.tokens"),
+			})
+		case "markdown", "md":
+			tree.RenderMarkdown(out, root)
+		default:
+			printJSON(root)
+			return
+		}
+		switch {
+		case viper.GetBool("quiet"):
+			printJSON(buf.String())
+		case responseOutput != "":
+			writeResponseOutput(buf.Bytes())
+		}
+	},
+}
+
+// buildFileTree builds the directory tree of all cached files of a project with
+// pkg/tree, which is shared with the report context builder. If includedSet is
+// not nil, file nodes are annotated as "included" or "excluded". With a basePath prefix
+// ("src/"), the tree is the subtree of that directory and its paths are relative to it.
+func buildFileTree(db database.Querier, projectID int64, absProjectPath string, includedSet map[string]struct{}, basePath string) (*tree.Node, error) {
+	rows, err := db.Query("SELECT relative_path, size_bytes, is_text FROM file_metadata WHERE project_id = ? ORDER BY relative_path ASC", projectID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying all file metadata for tree: %w", err)
+	}
+	defer rows.Close()
+
+	// `filepath.Base` is safe here as it operates on the project's real path on disk
+	rootName := filepath.Base(absProjectPath)
+	if basePath != "" {
+		rootName = path.Base(basePath)
+	}
+	builder := tree.NewBuilder(rootName, includedSet)
+	for rows.Next() {
+		var dbPath string
+		var size int64
+		var isText bool
+		if err := rows.Scan(&dbPath, &size, &isText); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		relPath, ok := rebasePath(dbPath, basePath)
+		if !ok {
+			continue
+		}
+		// Binary files are never sent as text, as in 'analyze summary'.
+		var fileTokens int64
+		if isText {
+			fileTokens = tokens.EstimateFromSize(size)
+		}
+		builder.AddFile(relPath, size, fileTokens)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating file metadata rows: %w", err)
+	}
+	return builder.Build(), nil
+}
+
+var analyzeEmbedCmd = &cobra.Command{
+	Use:         "embed",
+	Annotations: mutatingCommand,
+	Short:       "Compute and store embeddings of the filtered files",
+	Long: `Computes an embedding vector for every filtered text file with an embedding API and stores it in the database,
+keyed by the file's content hash and the provider/model. Files whose vector is already stored are skipped, so
+re-running the command after 'cache update' only embeds new and changed files. Use 'analyze similar' to search them.
+
+Providers:
+- ollama: POST <base-url>/api/embed (default base URL http://localhost:11434)
+- openai: POST <base-url>/v1/embeddings (default base URL https://api.openai.com), authenticated with the API key
+          read from the environment variable named by '--api-key-env' (default OPENAI_API_KEY)
+
+Files longer than '--max-tokens' are embedded by their beginning. Empty files, images and documents are skipped.
+
+Example:
+  code-prompt-core analyze embed --project-path /p/proj --provider ollama --model nomic-embed-text
+  code-prompt-core analyze embed --project-path /p/proj --provider openai --model text-embedding-3-small --profile-name "go-source"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.embed.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		provider, err := embeddingProviderFromConfig("analyze.embed")
+		if err != nil {
+			printError(err)
+			return
+		}
+		batchSize := viper.GetInt("analyze.embed.batch-size")
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		maxBytes := viper.GetInt64("analyze.embed.max-tokens") * tokens.BytesPerToken
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.embed.profile-name"), viper.GetString("analyze.embed.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		relativePaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		hashes, err := contentHashes(tx, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+		stored, err := loadEmbeddings(tx, provider.Name())
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		var textPaths []string
+		for _, p := range relativePaths {
+			if !imageinfo.IsImage(path.Ext(p)) {
+				textPaths = append(textPaths, p)
+			}
+		}
+		refresh := viper.GetBool("analyze.embed.refresh")
+		var pendingHashes, pendingTexts []string
+		queued := make(map[string]bool)
+		cached, skipped := 0, 0
+		contents := readFileContents(projectPath, textPaths, contentReadOptions{})
+		for relPath, content := range contents {
+			hash := contentKey(hashes[relPath], content)
+			switch {
+			case strings.TrimSpace(content) == "":
+				skipped++
+			case stored[hash] != nil && !refresh:
+				cached++
+			case !queued[hash]:
+				queued[hash] = true
+				if int64(len(content)) > maxBytes && maxBytes > 0 {
+					content = strings.ToValidUTF8(content[:maxBytes], "")
+				}
+				pendingHashes = append(pendingHashes, hash)
+				pendingTexts = append(pendingTexts, content)
+			}
+		}
+
+		dimensions := 0
+		now := time.Now().UTC().Format(time.RFC3339)
+		for start := 0; start < len(pendingTexts); start += batchSize {
+			end := start + batchSize
+			if end > len(pendingTexts) {
+				end = len(pendingTexts)
+			}
+			vectors, err := provider.Embed(context.Background(), pendingTexts[start:end])
+			if err != nil {
+				printError(fmt.Errorf("error computing embeddings (%d of %d stored): %w", start, len(pendingTexts), err))
+				return
+			}
+			for i, vector := range vectors {
+				dimensions = len(vector)
+				if _, err := db.Exec("INSERT OR REPLACE INTO embeddings (content_hash, model, dimensions, vector, created_at) VALUES (?, ?, ?, ?, ?)",
+					pendingHashes[start+i], provider.Name(), len(vector), embeddings.Encode(vector), now); err != nil {
+					printError(fmt.Errorf("error storing embedding: %w", err))
+					return
+				}
+			}
+		}
+		setResultCount(len(contents))
+		printJSON(map[string]interface{}{
+			"model":      provider.Name(),
+			"files":      len(contents),
+			"embedded":   len(pendingTexts),
+			"cached":     cached,
+			"skipped":    skipped,
+			"dimensions": dimensions,
+		})
+	},
+}
+
+var analyzeSimilarCmd = &cobra.Command{
+	Use:   "similar",
+	Short: "Find the files most similar to a query using stored embeddings",
+	Long: `Embeds '--query' with the same provider and model as 'analyze embed' and ranks the filtered files by the cosine
+similarity of their stored embeddings. Files without a stored embedding for the model are counted in "notEmbedded".
+
+Example:
+  code-prompt-core analyze similar --project-path /p/proj --provider ollama --model nomic-embed-text --query "payment retry logic" --limit 5`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.similar.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		query := viper.GetString("analyze.similar.query")
+		if strings.TrimSpace(query) == "" {
+			printError(fmt.Errorf("--query is required"))
+			return
+		}
+		provider, err := embeddingProviderFromConfig("analyze.similar")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.similar.profile-name"), viper.GetString("analyze.similar.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		relativePaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		hashes, err := contentHashes(tx, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+		stored, err := loadEmbeddings(tx, provider.Name())
+		if err != nil {
+			printError(err)
+			return
+		}
+		vectors, err := provider.Embed(context.Background(), []string{query})
+		if err != nil {
+			printError(fmt.Errorf("error embedding the query: %w", err))
+			return
+		}
+
+		type match struct {
+			Path  string  `json:"path"`
+			Score float64 `json:"score"`
+		}
+		// Without content hashes (--hash none), 'analyze embed' keys the vectors by the
+		// content itself, so those files are read to find their key.
+		var unhashed []string
+		for _, p := range relativePaths {
+			if hashes[p] == "" && !imageinfo.IsImage(path.Ext(p)) {
+				unhashed = append(unhashed, p)
+			}
+		}
+		contents := readFileContents(projectPath, unhashed, contentReadOptions{})
+		matches := []match{}
+		notEmbedded := 0
+		for _, p := range relativePaths {
+			key := hashes[p]
+			if content, ok := contents[p]; ok && key == "" {
+				key = contentKey(key, content)
+			}
+			vector := stored[key]
+			if vector == nil {
+				notEmbedded++
+				continue
+			}
+			matches = append(matches, match{Path: p, Score: embeddings.Cosine(vectors[0], vector)})
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+		if limit := viper.GetInt("analyze.similar.limit"); limit >= 0 && len(matches) > limit {
+			matches = matches[:limit]
+			markTruncated()
+		}
+		setResultCount(len(matches))
+		printJSON(map[string]interface{}{
+			"query":       query,
+			"model":       provider.Name(),
+			"results":     matches,
+			"notEmbedded": notEmbedded,
+		})
+	},
+}
+
+var analyzeExpandCmd = &cobra.Command{
+	Use:   "expand",
+	Short: "Expand seed files with the files they import and the files importing them",
+	Long: `Builds a file-level import graph of the cached project and returns the seed files together with every file
+within '--hops' import edges of them, so a prompt about one file can include the code it touches.
+
+Imports are parsed for Go (packages of the module declared in the root go.mod), JavaScript/TypeScript
+(relative imports and requires) and Python (relative imports, and absolute imports resolved from the project root).
+Imports of the standard library and third-party packages are ignored.
+
+'--direction' selects which edges are followed: "dependencies" (files the seeds import), "dependents"
+(files importing the seeds) or "both" (default). Each returned file carries its distance from the seeds and the
+file it was reached from.
+
+Example:
+  code-prompt-core analyze expand --project-path /p/proj --seed pkg/filter/filter.go --hops 1
+  code-prompt-core analyze expand --project-path /p/proj --seed src/api.ts --seed src/db.ts --hops 2 --direction dependencies`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.expand.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		seeds := viper.GetStringSlice("analyze.expand.seed")
+		if len(seeds) == 0 {
+			printError(fmt.Errorf("at least one --seed is required"))
+			return
+		}
+		direction := viper.GetString("analyze.expand.direction")
+		if direction != depgraph.Both && direction != depgraph.Dependencies && direction != depgraph.Dependents {
+			printError(fmt.Errorf("invalid --direction '%s' (expected both, dependencies or dependents)", direction))
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		hashes, err := contentHashes(tx, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+		for i, seed := range seeds {
+			seeds[i] = path.Clean(filepath.ToSlash(seed))
+			if _, ok := hashes[seeds[i]]; !ok {
+				printError(fmt.Errorf("seed '%s' is not in the cache of the project", seed))
+				return
+			}
+		}
+		files := make([]string, 0, len(hashes))
+		for relPath := range hashes {
+			files = append(files, relPath)
+		}
+		goModule := ""
+		if goMod, err := os.ReadFile(filepath.Join(projectPath, "go.mod")); err == nil {
+			goModule = depgraph.GoModulePath(goMod)
+		}
+		graph := depgraph.Build(files, func(relPath string) ([]byte, error) {
+			fullPath, err := projectFilePath(projectPath, relPath)
+			if err != nil {
+				return nil, err
+			}
+			return os.ReadFile(fullPath)
+		}, goModule)
+
+		expanded := graph.Expand(seeds, viper.GetInt("analyze.expand.hops"), direction)
+		setResultCount(len(expanded))
+		printJSON(map[string]interface{}{
+			"seeds":     seeds,
+			"hops":      viper.GetInt("analyze.expand.hops"),
+			"direction": direction,
+			"files":     expanded,
+		})
+	},
+}
+
+var analyzeDetectCmd = &cobra.Command{
+	Use:   "detect",
+	Short: "Detect the build systems and frameworks of a project",
+	Long: `Identifies the build systems and frameworks of the cached project from marker files, for prompt preambles
+like "This is a Go modules project using Cobra".
+
+Build systems are detected from their files: go.mod/go.work (Go modules), package-lock.json, yarn.lock,
+pnpm-lock.yaml and bun.lock (npm, Yarn, pnpm, Bun; a package.json without a lock file means npm), poetry.lock or
+[tool.poetry] in pyproject.toml (Poetry), uv.lock, Pipfile, requirements.txt, setup.py, pom.xml (Maven),
+build.gradle (Gradle), Cargo.toml (Cargo), WORKSPACE/MODULE.bazel/BUILD.bazel (Bazel), CMakeLists.txt, Makefile,
+Gemfile, composer.json and mix.exs. Frameworks are detected from the dependencies these manifests declare
+(React, Next.js, Vue, Angular, Express, NestJS, Django, Flask, FastAPI, Gin, Echo, Cobra, Spring Boot, Rails, ...).
+
+Each detection lists the marker files it was found from as "evidence". All cached files are considered, whatever
+filter a profile sets. The same list is returned as "detected" by 'analyze stats' and is available to report
+templates as "detected", e.g.
+  Built with {{#each detected}}{{this.name}} {{/each}}
+
+Example:
+  code-prompt-core analyze detect --project-path /p/proj`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.detect.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		detected, err := projectDetections(db, projectID, projectPath)
+		if err != nil {
+			printError(err)
+			return
+		}
+		printJSON(detected)
+	},
+}
+
+// projectDetections detects the build systems and frameworks among all cached files of a
+// project, reading the manifests from the project directory.
+func projectDetections(db database.Querier, projectID int64, absProjectPath string) ([]detect.Detection, error) {
+	hashes, err := contentHashes(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(hashes))
+	for relPath := range hashes {
+		files = append(files, relPath)
+	}
+	sort.Strings(files)
+	return detect.Detect(files, func(relPath string) ([]byte, error) {
+		fullPath, err := projectFilePath(absProjectPath, relPath)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(fullPath)
+	}), nil
+}
+
+var analyzePackagesCmd = &cobra.Command{
+	Use:   "packages",
+	Short: "List the packages (subprojects) of a monorepo",
+	Long: `Enumerates the subprojects of the cached project from their manifests: go.mod (named by its module path),
+package.json ("name"), pyproject.toml ([project] or [tool.poetry] name) and Cargo.toml ([package] name). Each
+package has a name, a kind (go, npm, python or cargo), its root directory and its manifest; manifests without a
+name are named after their directory. All cached files are considered, whatever filter a profile sets.
+
+The global '--package <name>' flag scopes the filter of any command to the subtree of one package, given by name
+or by root; it sets the "subtree" key of the filter, so it combines with profiles and --filter-json.
+
+Example:
+  code-prompt-core analyze packages --project-path /p/monorepo
+  code-prompt-core content get --project-path /p/monorepo --package @acme/web --filter-json '{"includeExts":["ts"]}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.packages.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		pkgs, err := projectPackages(db, projectID, projectPath)
+		if err != nil {
+			printError(err)
+			return
+		}
+		printJSON(pkgs)
+	},
+}
+
+// projectPackages lists the packages declared by the manifests among all cached files of a
+// project, reading them from the project directory.
+func projectPackages(db database.Querier, projectID int64, absProjectPath string) ([]packages.Package, error) {
+	hashes, err := contentHashes(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(hashes))
+	for relPath := range hashes {
+		files = append(files, relPath)
+	}
+	return packages.Find(files, func(relPath string) ([]byte, error) {
+		fullPath, err := projectFilePath(absProjectPath, relPath)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(fullPath)
+	}), nil
+}
+
+var analyzeDocsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Find the documentation most relevant to the filtered files",
+	Long: `Locates the documentation files of the cached project and ranks them by proximity to the files passing the
+filter, so a prompt about some code can include the documentation closest to it.
+
+Documentation files are READMEs, CONTRIBUTING and ARCHITECTURE/DESIGN files (by name, in any directory), ADRs
+(files of an "adr", "adrs" or "decisions" directory) and the Markdown, reStructuredText, AsciiDoc and text files
+of "doc" or "docs" directories. They are looked up among all cached files, whatever the filter says.
+
+Each file has a "distance": the number of directory steps from its directory to the closest directory of a
+filtered file (0 for a README next to them, 1 for one in their parent), and "covers": the number of filtered files
+in its directory or below. Files are ranked by distance, then kind (readme, contributing, architecture, adr,
+docs), then covers. The response lists the '--top' best files (-1 for all), with their contents and estimated
+tokens when '--content' is set.
+
+Report templates can use the 5 best files, with their contents, as "docs" (for the filtered files), e.g.
+  {{#each docs}}## {{this.path}}
+  {{{this.content}}}
+  {{/each}}
+
+Example:
+  code-prompt-core analyze docs --project-path /p/proj --filter-json '{"includePaths":["services/billing/"]}' --top 3 --content`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.docs.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.docs.profile-name"), viper.GetString("analyze.docs.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		docs, truncated, err := projectDocs(tx, projectID, projectPath, f, viper.GetInt("analyze.docs.top"), viper.GetBool("analyze.docs.content"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		if truncated {
+			markTruncated()
+		}
+		setResultCount(len(docs))
+		printJSON(docs)
+	},
+}
+
+// docEntry is a documentation file as listed by 'analyze docs', with its content on request.
+type docEntry struct {
+	docfiles.Doc
+	Tokens  int64  `json:"tokens,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// projectDocs ranks the documentation files of a project by their proximity to the files
+// passing the filter and returns the top ones (all for a negative top), reading their
+// contents if withContent is set, and whether files were left out by top. Files that cannot
+// be read are left out with a warning.
+func projectDocs(db database.Querier, projectID int64, absProjectPath string, f filter.Filter, top int, withContent bool) ([]docEntry, bool, error) {
+	hashes, err := contentHashes(db, projectID)
+	if err != nil {
+		return nil, false, err
+	}
+	files := make([]string, 0, len(hashes))
+	for relPath := range hashes {
+		files = append(files, relPath)
+	}
+	targets, err := filter.GetFilteredFilePaths(db, projectID, f)
+	if err != nil {
+		return nil, false, fmt.Errorf("error applying filters: %w", err)
+	}
+	found := docfiles.Find(files, targets)
+	truncated := top >= 0 && len(found) > top
+	if truncated {
+		found = found[:top]
+	}
+	docs := make([]docEntry, 0, len(found))
+	for _, doc := range found {
+		entry := docEntry{Doc: doc}
+		if withContent {
+			fullPath, err := projectFilePath(absProjectPath, doc.Path)
+			if err != nil {
+				return nil, false, err
+			}
+			data, err := os.ReadFile(fullPath)
+			if err != nil {
+				warn("skipping unreadable documentation file %s: %v", doc.Path, err)
+				continue
+			}
+			entry.Content = string(data)
+			entry.Tokens = tokens.Estimate(entry.Content)
+		}
+		docs = append(docs, entry)
+	}
+	return docs, truncated, nil
+}
+
+var analyzeEntrypointsCmd = &cobra.Command{
+	Use:   "entrypoints",
+	Short: "List the likely entry points of a project, ranked",
+	Long: `Finds the files where reading a project should start and returns them ranked by a score, highest first:
+- go-main:        Go files of package main declaring func main
+- rust-main:      src/main.rs and src/bin/*.rs declaring fn main
+- django-manage:  manage.py
+- package-bin:    the "bin" commands of a package.json, with their target file
+- package-main:   the "main" file of a package.json
+- package-script: the "scripts" of a package.json; start, dev and serve rank above build, test and lint
+- dockerfile:     the ENTRYPOINT and CMD of a Dockerfile
+- python-main:    Python files with an 'if __name__ == "__main__":' guard (__main__.py first)
+
+Scores drop with the directory depth of the file, so the root entry points of a monorepo come first. Only the
+files passing the filter are considered; the response lists the '--top' best entry points (-1 for all).
+
+Report templates can use the same data as "entrypoints" (for the filtered files), e.g.
+  Start reading here: {{#each entrypoints}}{{this.path}} ({{this.kind}}) {{/each}}
+
+Example:
+  code-prompt-core analyze entrypoints --project-path /p/proj --top 5`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.entrypoints.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.entrypoints.profile-name"), viper.GetString("analyze.entrypoints.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		found, err := projectEntrypoints(tx, projectID, projectPath, f)
+		if err != nil {
+			printError(err)
+			return
+		}
+		if top := viper.GetInt("analyze.entrypoints.top"); top >= 0 && len(found) > top {
+			found = found[:top]
+			markTruncated()
+		}
+		setResultCount(len(found))
+		printJSON(found)
+	},
+}
+
+// projectEntrypoints detects the entry points among the files passing the filter, reading
+// the candidates from the project directory.
+func projectEntrypoints(db database.Querier, projectID int64, absProjectPath string, f filter.Filter) ([]entrypoints.EntryPoint, error) {
+	relativePaths, err := filter.GetFilteredFilePaths(db, projectID, f)
+	if err != nil {
+		return nil, fmt.Errorf("error applying filters: %w", err)
+	}
+	found := entrypoints.Detect(relativePaths, func(relPath string) ([]byte, error) {
+		fullPath, err := projectFilePath(absProjectPath, relPath)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(fullPath)
+	})
+	if found == nil {
+		found = []entrypoints.EntryPoint{}
+	}
+	return found, nil
+}
+
+var analyzeOwnersCmd = &cobra.Command{
+	Use:   "owners",
+	Short: "Report the likely owners of files or directories",
+	Long: `Merges the project's CODEOWNERS file (.github/CODEOWNERS, CODEOWNERS or docs/CODEOWNERS) with git commit
+authorship to report who owns each directory ('--by directory', default) or file ('--by file') of the filtered files.
+
+Every entry lists the CODEOWNERS owners, the top '--top' authors by number of non-merge commits (limited to
+'--since', e.g. "6 months ago" or "2024-01-01", when set) and "likelyOwners": the CODEOWNERS owners if there are
+any, else the top authors. Projects outside a git repository only get CODEOWNERS data.
+
+Report templates can use the same data as "owners" (by directory, for the filtered files), e.g.
+  {{#each owners}}{{this.path}}: {{#each this.likelyOwners}}{{this}} {{/each}}
+  {{/each}}
+
+Example:
+  code-prompt-core analyze owners --project-path /p/proj --by file --since "1 year ago" --top 3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.owners.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		by := viper.GetString("analyze.owners.by")
+		if by != owners.ByFile && by != owners.ByDirectory {
+			printError(fmt.Errorf("invalid --by '%s' (expected file or directory)", by))
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.owners.profile-name"), viper.GetString("analyze.owners.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		relativePaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		co, entries, err := getOwnersData(projectPath, relativePaths, by, viper.GetString("analyze.owners.since"), viper.GetInt("analyze.owners.top"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		setResultCount(len(entries))
+		printJSON(map[string]interface{}{
+			"codeownersFile": co.Path,
+			"by":             by,
+			"owners":         entries,
+		})
+	},
+}
+
+// getOwnersData loads CODEOWNERS and git authorship and builds the owner entries of files.
+// A project that is not in a git repository only gets CODEOWNERS data.
+func getOwnersData(absProjectPath string, relativePaths []string, by, since string, top int) (*owners.CodeOwners, []owners.Entry, error) {
+	co, err := owners.LoadCodeOwners(absProjectPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CODEOWNERS: %w", err)
+	}
+	authorship, err := owners.GitAuthorship(absProjectPath, since)
+	if err != nil {
+		warn("no git authorship available: %v", err)
+		authorship = owners.Authorship{}
+	}
+	return co, owners.Build(relativePaths, co, authorship, by, top), nil
+}
+
+var analyzeChurnCmd = &cobra.Command{
+	Use:         "churn",
+	Annotations: mutatingCommand,
+	Short:       "Compute per-file commit counts and changed lines from git history",
+	Long: `Counts, for every cached file, the non-merge commits and the added and deleted lines in the git history since
+'--since' ("90d", "12w", "6m", "1y", or any 'git log --since' value such as "2024-01-01"), and stores the result
+in the database, replacing the previous run. Binary files count commits but no lines.
+
+The stored churn (added plus deleted lines) can then be used by every filter:
+  {"minChurn": 100}      keeps only files with at least 100 changed lines
+  {"sortBy": "churn"}    returns the most changed files first
+Files without history (or changed before '--since') have a churn of 0.
+
+The response lists the '--top' most changed files of the filter (-1 for all).
+
+Example:
+  code-prompt-core analyze churn --project-path /p/proj --since 90d
+  code-prompt-core content get --project-path /p/proj --filter-json '{"includeExts":["go"],"minChurn":50,"sortBy":"churn"}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.churn.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		since := viper.GetString("analyze.churn.since")
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		f, err := getFilter(db, projectID, viper.GetString("analyze.churn.profile-name"), viper.GetString("analyze.churn.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		history, err := churn.FromGit(projectPath, since)
+		if err != nil {
+			printError(err)
+			return
+		}
+		hashes, err := contentHashes(db, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			printError(fmt.Errorf("error starting transaction: %w", err))
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM file_churn WHERE project_id = ?", projectID); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error clearing stored churn: %w", err))
+			return
+		}
+		stored := 0
+		for relPath, fc := range history {
+			// Only files that are still cached are stored.
+			if _, ok := hashes[relPath]; !ok {
+				continue
+			}
+			if _, err := tx.Exec("INSERT INTO file_churn (project_id, relative_path, commits, lines_added, lines_deleted) VALUES (?, ?, ?, ?, ?)",
+				projectID, relPath, fc.Commits, fc.LinesAdded, fc.LinesDeleted); err != nil {
+				tx.Rollback()
+				printError(fmt.Errorf("error storing churn: %w", err))
+				return
+			}
+			stored++
+		}
+		if err := tx.Commit(); err != nil {
+			printError(fmt.Errorf("error committing churn: %w", err))
+			return
+		}
+
+		f.SortBy = filter.SortByChurn
+		relativePaths, err := filter.GetFilteredFilePaths(db, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		type churnEntry struct {
+			churn.FileChurn
+			Churn int64 `json:"churn"`
+		}
+		files := []churnEntry{}
+		for _, relPath := range relativePaths {
+			fc, ok := history[relPath]
+			if !ok {
+				continue
+			}
+			files = append(files, churnEntry{FileChurn: *fc, Churn: fc.Churn()})
+		}
+		if top := viper.GetInt("analyze.churn.top"); top >= 0 && len(files) > top {
+			files = files[:top]
+			markTruncated()
+		}
+		setResultCount(len(files))
+		printJSON(map[string]interface{}{
+			"since":       since,
+			"filesStored": stored,
+			"files":       files,
+		})
+	},
+}
+
+var analyzeAttributesCmd = &cobra.Command{
+	Use:   "attributes",
+	Short: "List the file attributes stored by scan plugins",
+	Long: `Lists the key/value attributes that the scan plugins declared under 'plugins.scan' in the config
+file returned for the project's files during 'cache update' (see 'cache update --help' for the plugin
+protocol). The result maps each file to its attributes by plugin name; files without attributes are
+left out. Use --plugin to show a single plugin, and a filter or profile to restrict the files.
+
+Example:
+  code-prompt-core analyze attributes --project-path /p/proj
+  code-prompt-core analyze attributes --project-path /p/proj --plugin license --filter-json '{"includeExts":["go"]}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("analyze.attributes.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		plugin := viper.GetString("analyze.attributes.plugin")
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(tx, projectID, viper.GetString("analyze.attributes.profile-name"), viper.GetString("analyze.attributes.filter-json"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		paths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error filtering files: %w", err))
+			return
+		}
+		included := make(map[string]bool, len(paths))
+		for _, p := range paths {
+			included[p] = true
+		}
+
+		rows, err := tx.Query("SELECT relative_path, plugin, key, value FROM file_attributes WHERE project_id = ? AND (? = '' OR plugin = ?)", projectID, plugin, plugin)
+		if err != nil {
+			printError(fmt.Errorf("error querying file attributes: %w", err))
+			return
+		}
+		defer rows.Close()
+		attributes := make(map[string]map[string]map[string]string)
+		for rows.Next() {
+			var relPath, pluginName, key, value string
+			if err := rows.Scan(&relPath, &pluginName, &key, &value); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			if !included[relPath] {
+				continue
+			}
+			if attributes[relPath] == nil {
+				attributes[relPath] = make(map[string]map[string]string)
+			}
+			if attributes[relPath][pluginName] == nil {
+				attributes[relPath][pluginName] = make(map[string]string)
+			}
+			attributes[relPath][pluginName][key] = value
+		}
+		printJSON(attributes)
+	},
+}
+
+var analyzeUsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Review the locally recorded usage statistics",
+	Long: `Summarizes the command invocations recorded with --usage-stats (or 'usage-stats: true' in the
+config file): per command, the number of runs and failures, the total, average, 95th percentile
+and maximum duration, and the average and maximum response size. Commands are ordered by total
+duration, so the operations that dominate a wrapper's latency come first.
+
+Recording is opt-in and local: each run adds one row (command path, start time, duration,
+response size, success) to the 'usage' table of the database; no arguments, paths or file
+contents are stored, and nothing is sent anywhere. Runs with --read-only are not recorded.
+
+Example:
+  code-prompt-core analyze usage
+  code-prompt-core analyze usage --since 168h`,
+	Run: func(cmd *cobra.Command, args []string) {
+		since := viper.GetDuration("analyze.usage.since")
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		cutoff := ""
+		if since > 0 {
+			cutoff = time.Now().Add(-since).UTC().Format(database.UsageTimeFormat)
+		}
+		rows, err := db.Query("SELECT command, duration_ms, result_bytes, success FROM usage WHERE started_at >= ? ORDER BY command", cutoff)
+		if err != nil {
+			printError(fmt.Errorf("error querying usage: %w", err))
+			return
+		}
+		defer rows.Close()
+		type commandUsage struct {
+			Command          string `json:"command"`
+			Invocations      int    `json:"invocations"`
+			Failures         int    `json:"failures"`
+			TotalDurationMs  int64  `json:"totalDurationMs"`
+			AvgDurationMs    int64  `json:"avgDurationMs"`
+			P95DurationMs    int64  `json:"p95DurationMs"`
+			MaxDurationMs    int64  `json:"maxDurationMs"`
+			AvgResultBytes   int64  `json:"avgResultBytes"`
+			MaxResultBytes   int64  `json:"maxResultBytes"`
+			totalResultBytes int64
+			durations        []int64
+		}
+		byCommand := make(map[string]*commandUsage)
+		invocations := 0
+		for rows.Next() {
+			var command string
+			var durationMs, resultBytes int64
+			var success bool
+			if err := rows.Scan(&command, &durationMs, &resultBytes, &success); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			u, ok := byCommand[command]
+			if !ok {
+				u = &commandUsage{Command: command}
+				byCommand[command] = u
+			}
+			u.Invocations++
+			if !success {
+				u.Failures++
+			}
+			u.TotalDurationMs += durationMs
+			u.durations = append(u.durations, durationMs)
+			u.MaxDurationMs = max(u.MaxDurationMs, durationMs)
+			u.totalResultBytes += resultBytes
+			u.MaxResultBytes = max(u.MaxResultBytes, resultBytes)
+			invocations++
+		}
+		if err := rows.Err(); err != nil {
+			printError(fmt.Errorf("error reading usage: %w", err))
+			return
+		}
+		commands := make([]*commandUsage, 0, len(byCommand))
+		for _, u := range byCommand {
+			u.AvgDurationMs = u.TotalDurationMs / int64(u.Invocations)
+			u.AvgResultBytes = u.totalResultBytes / int64(u.Invocations)
+			sort.Slice(u.durations, func(i, j int) bool { return u.durations[i] < u.durations[j] })
+			// Nearest-rank percentile.
+			u.P95DurationMs = u.durations[(len(u.durations)*95+99)/100-1]
+			commands = append(commands, u)
+		}
+		sort.Slice(commands, func(i, j int) bool {
+			if commands[i].TotalDurationMs != commands[j].TotalDurationMs {
+				return commands[i].TotalDurationMs > commands[j].TotalDurationMs
+			}
+			return commands[i].Command < commands[j].Command
+		})
+		setResultCount(len(commands))
+		printJSON(map[string]interface{}{
+			"recording":   viper.GetBool("usage-stats"),
+			"invocations": invocations,
+			"commands":    commands,
+		})
+	},
+}
+
+// embeddingProviderFromConfig builds the embedding provider from the provider, model,
+// base-url and api-key-env settings under a command's viper prefix.
+func embeddingProviderFromConfig(prefix string) (embeddings.Provider, error) {
+	return embeddings.New(
+		viper.GetString(prefix+".provider"),
+		viper.GetString(prefix+".model"),
+		viper.GetString(prefix+".base-url"),
+		os.Getenv(viper.GetString(prefix+".api-key-env")),
+	)
+}
+
+// loadEmbeddings returns the stored vectors of a model by content hash.
+func loadEmbeddings(db database.Querier, model string) (map[string][]float32, error) {
+	rows, err := db.Query("SELECT content_hash, vector FROM embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, fmt.Errorf("error querying embeddings: %w", err)
+	}
+	defer rows.Close()
+	vectors := make(map[string][]float32)
+	for rows.Next() {
+		var hash string
+		var data []byte
+		if err := rows.Scan(&hash, &data); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		vectors[hash] = embeddings.Decode(data)
+	}
+	return vectors, rows.Err()
+}
+
+// addEmbeddingProviderFlags registers the flags shared by 'analyze embed' and 'analyze similar'.
+func addEmbeddingProviderFlags(cmd *cobra.Command, prefix string) {
+	cmd.Flags().String("provider", embeddings.ProviderOllama, "Embedding provider: openai or ollama")
+	cmd.Flags().String("model", "", "Embedding model, e.g. nomic-embed-text or text-embedding-3-small (required)")
+	cmd.Flags().String("base-url", "", "Base URL of the provider API (default depends on the provider)")
+	cmd.Flags().String("api-key-env", "OPENAI_API_KEY", "Environment variable holding the API key (openai)")
+	for _, name := range []string{"provider", "model", "base-url", "api-key-env"} {
+		viper.BindPFlag(prefix+"."+name, cmd.Flags().Lookup(name))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+	addResponseOutputFlag(analyzeCmd, "analyze.output")
+
+	analyzeCmd.AddCommand(analyzeFilterCmd)
+	analyzeFilterCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeFilterCmd.Flags().String("filter-json", "", "JSON string with filter conditions")
+	analyzeFilterCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use") // 新增
+	viper.BindPFlag("analyze.filter.project-path", analyzeFilterCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.filter.filter-json", analyzeFilterCmd.Flags().Lookup("filter-json"))
+	analyzeFilterCmd.Flags().String("base-path", "", "Only list files under this project directory, with paths relative to it")
+	viper.BindPFlag("analyze.filter.profile-name", analyzeFilterCmd.Flags().Lookup("profile-name")) // 新增
+	viper.BindPFlag("analyze.filter.base-path", analyzeFilterCmd.Flags().Lookup("base-path"))
+
+	// *** 新增：注册 analyze summary 命令 ***
+	analyzeCmd.AddCommand(analyzeSummaryCmd)
+	analyzeSummaryCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeSummaryCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeSummaryCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	analyzeSummaryCmd.Flags().Int("largest", 10, "Number of largest files to list in 'largestFiles' (-1 for all)")
+	viper.BindPFlag("analyze.summary.project-path", analyzeSummaryCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.summary.profile-name", analyzeSummaryCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.summary.filter-json", analyzeSummaryCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.summary.largest", analyzeSummaryCmd.Flags().Lookup("largest"))
+
+	analyzeCmd.AddCommand(analyzeStatsCmd)
+	analyzeStatsCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("analyze.stats.project-path", analyzeStatsCmd.Flags().Lookup("project-path"))
+
+	analyzeCmd.AddCommand(analyzeOnelineCmd)
+	analyzeOnelineCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeOnelineCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeOnelineCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	analyzeOnelineCmd.Flags().Int("top", 2, "Number of languages to name (-1 for all)")
+	viper.BindPFlag("analyze.oneline.project-path", analyzeOnelineCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.oneline.profile-name", analyzeOnelineCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.oneline.filter-json", analyzeOnelineCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.oneline.top", analyzeOnelineCmd.Flags().Lookup("top"))
+
+	analyzeCmd.AddCommand(analyzeLanguagesCmd)
+	analyzeLanguagesCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeLanguagesCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeLanguagesCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	viper.BindPFlag("analyze.languages.project-path", analyzeLanguagesCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.languages.profile-name", analyzeLanguagesCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.languages.filter-json", analyzeLanguagesCmd.Flags().Lookup("filter-json"))
+
+	analyzeCmd.AddCommand(analyzeBudgetCmd)
+	analyzeBudgetCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeBudgetCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeBudgetCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	analyzeBudgetCmd.Flags().Int64("max-tokens", 0, "Token budget to check (required)")
+	analyzeBudgetCmd.Flags().StringSlice("strategies", []string{"largest-first", "oldest-first"}, "Orders in which files are dropped to fit: largest-first, oldest-first")
+	viper.BindPFlag("analyze.budget.project-path", analyzeBudgetCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.budget.profile-name", analyzeBudgetCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.budget.filter-json", analyzeBudgetCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.budget.max-tokens", analyzeBudgetCmd.Flags().Lookup("max-tokens"))
+	viper.BindPFlag("analyze.budget.strategies", analyzeBudgetCmd.Flags().Lookup("strategies"))
+
+	analyzeCmd.AddCommand(analyzeExtensionsCmd)
+	analyzeExtensionsCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeExtensionsCmd.Flags().Int("samples", 3, "Number of sample paths per extension")
+	viper.BindPFlag("analyze.extensions.project-path", analyzeExtensionsCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.extensions.samples", analyzeExtensionsCmd.Flags().Lookup("samples"))
 
 	analyzeCmd.AddCommand(analyzeTreeCmd)
 	analyzeTreeCmd.Flags().String("project-path", "", "Path to the project")
-	analyzeTreeCmd.Flags().String("format", "json", "Output format for the tree (json or text)")
+	analyzeTreeCmd.Flags().String("format", "json", "Output format for the tree (json, text or markdown)")
 	analyzeTreeCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use for annotating the tree")
 	analyzeTreeCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
 	viper.BindPFlag("analyze.tree.project-path", analyzeTreeCmd.Flags().Lookup("project-path"))
 	viper.BindPFlag("analyze.tree.format", analyzeTreeCmd.Flags().Lookup("format"))
 	viper.BindPFlag("analyze.tree.profile-name", analyzeTreeCmd.Flags().Lookup("profile-name"))
+	analyzeTreeCmd.Flags().String("base-path", "", "Only show the subtree of this project directory, with paths relative to it")
+	analyzeTreeCmd.Flags().Bool("no-sizes", false, "Leave out sizes and file counts in the text format")
+	analyzeTreeCmd.Flags().Bool("tokens", false, "Show estimated prompt tokens of files and directories in the text format")
+	analyzeTreeCmd.Flags().Bool("collapse-single-child", false, "Merge chains of directories with a single subdirectory (src/main/java) into one node")
 	viper.BindPFlag("analyze.tree.filter-json", analyzeTreeCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.tree.base-path", analyzeTreeCmd.Flags().Lookup("base-path"))
+	viper.BindPFlag("analyze.tree.no-sizes", analyzeTreeCmd.Flags().Lookup("no-sizes"))
+	viper.BindPFlag("analyze.tree.tokens", analyzeTreeCmd.Flags().Lookup("tokens"))
+	viper.BindPFlag("analyze.tree.collapse-single-child", analyzeTreeCmd.Flags().Lookup("collapse-single-child"))
+
+	analyzeCmd.AddCommand(analyzeEmbedCmd)
+	analyzeEmbedCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeEmbedCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeEmbedCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	analyzeEmbedCmd.Flags().Int("batch-size", 32, "Number of files sent to the provider per request")
+	analyzeEmbedCmd.Flags().Int64("max-tokens", 2048, "Only the first N tokens of a file are embedded (0 embeds whole files)")
+	analyzeEmbedCmd.Flags().Bool("refresh", false, "Recompute embeddings that are already stored")
+	addEmbeddingProviderFlags(analyzeEmbedCmd, "analyze.embed")
+	viper.BindPFlag("analyze.embed.project-path", analyzeEmbedCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.embed.profile-name", analyzeEmbedCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.embed.filter-json", analyzeEmbedCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.embed.batch-size", analyzeEmbedCmd.Flags().Lookup("batch-size"))
+	viper.BindPFlag("analyze.embed.max-tokens", analyzeEmbedCmd.Flags().Lookup("max-tokens"))
+	viper.BindPFlag("analyze.embed.refresh", analyzeEmbedCmd.Flags().Lookup("refresh"))
+
+	analyzeCmd.AddCommand(analyzeSimilarCmd)
+	analyzeSimilarCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeSimilarCmd.Flags().String("profile-name", "", "Name of a saved filter profile restricting the candidates")
+	analyzeSimilarCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions restricting the candidates")
+	analyzeSimilarCmd.Flags().String("query", "", "Natural language query (required)")
+	analyzeSimilarCmd.Flags().Int("limit", 10, "Maximum number of results (-1 for all)")
+	addEmbeddingProviderFlags(analyzeSimilarCmd, "analyze.similar")
+	viper.BindPFlag("analyze.similar.project-path", analyzeSimilarCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.similar.profile-name", analyzeSimilarCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.similar.filter-json", analyzeSimilarCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.similar.query", analyzeSimilarCmd.Flags().Lookup("query"))
+	viper.BindPFlag("analyze.similar.limit", analyzeSimilarCmd.Flags().Lookup("limit"))
+
+	analyzeCmd.AddCommand(analyzeExpandCmd)
+	analyzeExpandCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeExpandCmd.Flags().StringSlice("seed", nil, "Relative path of a seed file (repeatable)")
+	analyzeExpandCmd.Flags().Int("hops", 1, "Number of import edges to follow from the seeds")
+	analyzeExpandCmd.Flags().String("direction", depgraph.Both, "Edges to follow: both, dependencies or dependents")
+	viper.BindPFlag("analyze.expand.project-path", analyzeExpandCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.expand.seed", analyzeExpandCmd.Flags().Lookup("seed"))
+	viper.BindPFlag("analyze.expand.hops", analyzeExpandCmd.Flags().Lookup("hops"))
+	viper.BindPFlag("analyze.expand.direction", analyzeExpandCmd.Flags().Lookup("direction"))
+
+	analyzeCmd.AddCommand(analyzeDetectCmd)
+	analyzeDetectCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("analyze.detect.project-path", analyzeDetectCmd.Flags().Lookup("project-path"))
+
+	analyzeCmd.AddCommand(analyzePackagesCmd)
+	analyzePackagesCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("analyze.packages.project-path", analyzePackagesCmd.Flags().Lookup("project-path"))
+
+	analyzeCmd.AddCommand(analyzeDocsCmd)
+	analyzeDocsCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeDocsCmd.Flags().String("profile-name", "", "Name of a saved filter profile selecting the files the documentation should be close to")
+	analyzeDocsCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions selecting the files the documentation should be close to")
+	analyzeDocsCmd.Flags().Int("top", 10, "Number of best ranked documentation files listed (-1 for all)")
+	analyzeDocsCmd.Flags().Bool("content", false, "Include the contents and estimated tokens of the listed files")
+	viper.BindPFlag("analyze.docs.project-path", analyzeDocsCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.docs.profile-name", analyzeDocsCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.docs.filter-json", analyzeDocsCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.docs.top", analyzeDocsCmd.Flags().Lookup("top"))
+	viper.BindPFlag("analyze.docs.content", analyzeDocsCmd.Flags().Lookup("content"))
+
+	analyzeCmd.AddCommand(analyzeEntrypointsCmd)
+	analyzeEntrypointsCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeEntrypointsCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeEntrypointsCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	analyzeEntrypointsCmd.Flags().Int("top", 10, "Number of best ranked entry points listed (-1 for all)")
+	viper.BindPFlag("analyze.entrypoints.project-path", analyzeEntrypointsCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.entrypoints.profile-name", analyzeEntrypointsCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.entrypoints.filter-json", analyzeEntrypointsCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.entrypoints.top", analyzeEntrypointsCmd.Flags().Lookup("top"))
+
+	analyzeCmd.AddCommand(analyzeOwnersCmd)
+	analyzeOwnersCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeOwnersCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	analyzeOwnersCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	analyzeOwnersCmd.Flags().String("by", owners.ByDirectory, "Report owners per 'directory' or per 'file'")
+	analyzeOwnersCmd.Flags().String("since", "", "Only count commits more recent than this date (any 'git log --since' value)")
+	analyzeOwnersCmd.Flags().Int("top", 3, "Number of top authors listed per entry (-1 for all)")
+	viper.BindPFlag("analyze.owners.project-path", analyzeOwnersCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.owners.profile-name", analyzeOwnersCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.owners.filter-json", analyzeOwnersCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.owners.by", analyzeOwnersCmd.Flags().Lookup("by"))
+	viper.BindPFlag("analyze.owners.since", analyzeOwnersCmd.Flags().Lookup("since"))
+	viper.BindPFlag("analyze.owners.top", analyzeOwnersCmd.Flags().Lookup("top"))
+
+	analyzeCmd.AddCommand(analyzeChurnCmd)
+	analyzeChurnCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeChurnCmd.Flags().String("profile-name", "", "Name of a saved filter profile restricting the listed files")
+	analyzeChurnCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions restricting the listed files")
+	analyzeChurnCmd.Flags().String("since", "90d", "History window: 90d, 12w, 6m, 1y or any 'git log --since' value (empty for all history)")
+	analyzeChurnCmd.Flags().Int("top", 20, "Number of most changed files listed in the response (-1 for all)")
+	viper.BindPFlag("analyze.churn.project-path", analyzeChurnCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.churn.profile-name", analyzeChurnCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.churn.filter-json", analyzeChurnCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.churn.since", analyzeChurnCmd.Flags().Lookup("since"))
+	viper.BindPFlag("analyze.churn.top", analyzeChurnCmd.Flags().Lookup("top"))
+
+	analyzeCmd.AddCommand(analyzeAttributesCmd)
+	analyzeAttributesCmd.Flags().String("project-path", "", "Path to the project")
+	analyzeAttributesCmd.Flags().String("profile-name", "", "Name of a saved filter profile restricting the listed files")
+	analyzeAttributesCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions restricting the listed files")
+	analyzeAttributesCmd.Flags().String("plugin", "", "Only list the attributes of this scan plugin")
+	viper.BindPFlag("analyze.attributes.project-path", analyzeAttributesCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("analyze.attributes.profile-name", analyzeAttributesCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("analyze.attributes.filter-json", analyzeAttributesCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("analyze.attributes.plugin", analyzeAttributesCmd.Flags().Lookup("plugin"))
+
+	analyzeCmd.AddCommand(analyzeUsageCmd)
+	analyzeUsageCmd.Flags().Duration("since", 0, "Only include invocations started within this duration (e.g. 168h); 0 for all")
+	viper.BindPFlag("analyze.usage.since", analyzeUsageCmd.Flags().Lookup("since"))
 }
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// batchOperation is one command of a 'batch' file. Flags are appended to the command line
+// as --name=value, a list giving the flag once per value; Args are appended after them as is.
+type batchOperation struct {
+	Command string                 `json:"command"`
+	Flags   map[string]interface{} `json:"flags,omitempty"`
+	Args    []string               `json:"args,omitempty"`
+}
+
+// batchResult is the outcome of one operation. Data is the payload of the command's JSON
+// response; commands that print something else (e.g. 'content chunks') have it in Output.
+type batchResult struct {
+	Command    string          `json:"command"`
+	Status     string          `json:"status"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Output     string          `json:"output,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Warnings   []string        `json:"warnings,omitempty"`
+	DurationMs int64           `json:"durationMs"`
+}
+
+// inBatch is set while 'batch' runs an operation: printError then unwinds the operation
+// with a batchAbort panic instead of exiting the process.
+var inBatch bool
+
+type batchAbort struct{ err error }
+
+// batchExcluded are the commands that cannot run inside a batch.
+var batchExcluded = map[string]bool{"batch": true, "cache schedule": true}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Run a list of commands in one process and return all their results",
+	Long: `Runs the commands listed in a JSON file (or stdin) one after the other in a single process, which saves
+the process start-up and database opening of every call in scripted pipelines. The file is an array of
+operations with the command path, its flags and its arguments:
+  [
+    {"command": "cache update", "flags": {"project-path": "/p/proj", "incremental": true}},
+    {"command": "analyze summary", "flags": {"project-path": "/p/proj"}},
+    {"command": "content get", "flags": {"project-path": "/p/proj", "max-file-bytes": 200000}}
+  ]
+
+The response is an array with one result per operation, in order: {"command", "status", "data"} on success
+and {"command", "status": "error", "message"} on failure. Commands whose output is not a JSON response
+have it as a string in "output". By default the batch stops at the first failure and the remaining
+operations are reported with the status "skipped"; '--continue-on-error' runs them anyway.
+
+Global flags (--db, --read-only, ...) are taken from the batch command line and apply to every operation.
+Hooks run for every operation as if it were run on its own. 'cache schedule' cannot be batched.
+
+Example:
+  code-prompt-core batch --file ops.json
+  echo '[{"command":"project list"}]' | code-prompt-core batch`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ops, err := readBatchOperations(viper.GetString("batch.file"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		continueOnError := viper.GetBool("batch.continue-on-error")
+		results := make([]batchResult, 0, len(ops))
+		failed := false
+		for _, op := range ops {
+			if failed && !continueOnError {
+				results = append(results, batchResult{Command: op.Command, Status: "skipped"})
+				continue
+			}
+			argv, err := op.commandLine()
+			if err != nil {
+				results = append(results, batchResult{Command: op.Command, Status: "error", Message: err.Error()})
+				failed = true
+				continue
+			}
+			result := runBatchOperation(argv)
+			result.Command = op.Command
+			failed = failed || result.Status == "error"
+			results = append(results, result)
+		}
+		printJSON(results)
+	},
+}
+
+// readBatchOperations reads the operations from a file, or from stdin if name is "-".
+func readBatchOperations(name string) ([]batchOperation, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("error opening batch file '%s': %w", name, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var ops []batchOperation
+	if err := decoder.Decode(&ops); err != nil {
+		return nil, fmt.Errorf("invalid batch file: %w", err)
+	}
+	return ops, nil
+}
+
+// commandLine builds the arguments of the operation, without the program name.
+func (op batchOperation) commandLine() ([]string, error) {
+	argv := strings.Fields(op.Command)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("missing command")
+	}
+	names := make([]string, 0, len(op.Flags))
+	for name := range op.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values, ok := op.Flags[name].([]interface{})
+		if !ok {
+			values = []interface{}{op.Flags[name]}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case string, bool, json.Number:
+				argv = append(argv, fmt.Sprintf("--%s=%v", name, v))
+			default:
+				return nil, fmt.Errorf("invalid value for flag '%s': expected a string, number, boolean or a list of them", name)
+			}
+		}
+	}
+	return append(argv, op.Args...), nil
+}
+
+// runBatchOperation executes one command line through the root command, with stdout captured
+// and the flags of the command reset to their defaults first.
+func runBatchOperation(argv []string) (result batchResult) {
+	started := time.Now()
+	defer func() { result.DurationMs = time.Since(started).Milliseconds() }()
+	target, _, err := rootCmd.Find(argv)
+	if err != nil || target == rootCmd || !target.Runnable() {
+		return batchResult{Status: "error", Message: fmt.Sprintf("unknown command '%s'", strings.Join(argv, " "))}
+	}
+	path := strings.TrimPrefix(target.CommandPath(), rootCmd.Name()+" ")
+	if batchExcluded[path] {
+		return batchResult{Status: "error", Message: fmt.Sprintf("'%s' cannot be run in a batch", path)}
+	}
+	for c := target; c != rootCmd; c = c.Parent() {
+		resetFlags(c.NonInheritedFlags())
+	}
+
+	capture, err := os.CreateTemp("", "code-prompt-core-batch-*")
+	if err != nil {
+		return batchResult{Status: "error", Message: fmt.Sprintf("error capturing output: %v", err)}
+	}
+	defer os.Remove(capture.Name())
+	defer capture.Close()
+
+	// The operation gets its own response state and shutdown hooks; those of the batch
+	// command itself are put back afterwards.
+	globals := saveFlags(rootCmd.PersistentFlags())
+	savedHooks, savedFailed, savedBytes, savedResponse, savedOutput := shutdownHooks, commandFailed, responseBytes, lastResponse, responseOutput
+	savedStarted, savedMeta, savedWarnings := commandStarted, responseMeta, responseWarnings
+	shutdownHooks, commandFailed, responseBytes, lastResponse = nil, false, 0, nil
+	stdout := os.Stdout
+	os.Stdout = capture
+	silenceErrors, silenceUsage := rootCmd.SilenceErrors, rootCmd.SilenceUsage
+	rootCmd.SilenceErrors, rootCmd.SilenceUsage = true, true
+	inBatch = true
+	defer func() {
+		inBatch = false
+		os.Stdout = stdout
+		rootCmd.SilenceErrors, rootCmd.SilenceUsage = silenceErrors, silenceUsage
+		runShutdownHooks()
+		shutdownHooks, commandFailed, responseBytes, lastResponse, responseOutput = savedHooks, savedFailed, savedBytes, savedResponse, savedOutput
+		commandStarted, responseMeta, responseWarnings = savedStarted, savedMeta, savedWarnings
+		globals()
+	}()
+
+	var runErr error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				abort, ok := r.(batchAbort)
+				if !ok {
+					panic(r)
+				}
+				runErr = abort.err
+			}
+		}()
+		rootCmd.SetArgs(argv)
+		_, runErr = rootCmd.ExecuteC()
+	}()
+	if runErr != nil {
+		return batchResult{Status: "error", Message: runErr.Error(), Warnings: responseWarnings}
+	}
+
+	output, err := os.ReadFile(capture.Name())
+	if err != nil {
+		return batchResult{Status: "error", Message: fmt.Sprintf("error reading output: %v", err)}
+	}
+	var resp struct {
+		Status string          `json:"status"`
+		Data   json.RawMessage `json:"data"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	if decoder.Decode(&resp) == nil && resp.Status == "success" && !decoder.More() {
+		return batchResult{Status: "success", Data: resp.Data, Warnings: responseWarnings}
+	}
+	return batchResult{Status: "success", Output: string(output), Warnings: responseWarnings}
+}
+
+// resetFlags sets the flags back to their default values, as before parsing.
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			def := strings.TrimSuffix(strings.TrimPrefix(f.DefValue, "["), "]")
+			values := []string{}
+			if def != "" {
+				values = strings.Split(def, ",")
+			}
+			s.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
+// saveFlags records the values of the flags and returns a function that restores them.
+func saveFlags(flags *pflag.FlagSet) func() {
+	type state struct {
+		value   string
+		changed bool
+	}
+	saved := make(map[string]state)
+	flags.VisitAll(func(f *pflag.Flag) {
+		saved[f.Name] = state{f.Value.String(), f.Changed}
+	})
+	return func() {
+		flags.VisitAll(func(f *pflag.Flag) {
+			f.Value.Set(saved[f.Name].value)
+			f.Changed = saved[f.Name].changed
+		})
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.Flags().String("file", "-", "JSON file with the operations to run ('-' for stdin)")
+	batchCmd.Flags().Bool("continue-on-error", false, "Run the remaining operations after a failure instead of skipping them")
+	viper.BindPFlag("batch.file", batchCmd.Flags().Lookup("file"))
+	viper.BindPFlag("batch.continue-on-error", batchCmd.Flags().Lookup("continue-on-error"))
+}
@@ -0,0 +1,200 @@
+// File: cmd/bench.go
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/filter"
+	"code-prompt-core/pkg/scanner"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var benchCmd = &cobra.Command{
+	Use:    "bench",
+	Short:  "Measure scan, filter and content performance on a project",
+	Hidden: true,
+	Long: `Times the main pipeline stages on a project and reports a structured profile:
+- fullScan:        walking the project and inserting all files into an empty cache
+- incrementalScan: rescanning the project against the cache filled by the full scan
+- filter:          evaluating the filter against the cached files
+- contentPack:     reading the contents of the filtered files
+
+The benchmark uses a throwaway database in a temporary directory, so the real cache is never modified.
+Each stage is run --iterations times; the response reports the minimum, average and maximum duration in milliseconds.
+
+Example:
+  code-prompt-core bench --project-path /p/proj --iterations 3 --filter-json '{"includeExts":["go"]}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		absProjectPath, err := getAbsoluteProjectPath("bench.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		iterations := viper.GetInt("bench.iterations")
+		if iterations < 1 {
+			printError(fmt.Errorf("--iterations must be at least 1"))
+			return
+		}
+		var f filter.Filter
+		if filterJSON := viper.GetString("bench.filter-json"); filterJSON != "" {
+			if f, err = unmarshalFilter(filterJSON); err != nil {
+				printError(fmt.Errorf("error parsing filter JSON: %w", err))
+				return
+			}
+		}
+		if f.Priority == "" {
+			f.Priority = "includes"
+		}
+		if err := f.Compile(); err != nil {
+			printError(fmt.Errorf("error compiling filter rules: %w", err))
+			return
+		}
+
+		tempDir, err := os.MkdirTemp("", "code-prompt-core-bench-")
+		if err != nil {
+			printError(fmt.Errorf("error creating temporary directory: %w", err))
+			return
+		}
+		defer os.RemoveAll(tempDir)
+		db, err := database.InitializeDB(filepath.Join(tempDir, "bench.db"))
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := getOrCreateProject(db, absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error getting or creating project: %w", err))
+			return
+		}
+
+		scanOpts := scanOptionsFromConfig()
+		if err := resolveHashAlgorithm(db, projectID, &scanOpts); err != nil {
+			printError(err)
+			return
+		}
+		batchSize := viper.GetInt("cache.update.batch-size")
+		if batchSize <= 0 {
+			batchSize = 100
+		}
+
+		var filesScanned, filesMatched int
+		var contentBytes int64
+		fullScan := benchStage(iterations, func() error {
+			if _, err := db.Exec("DELETE FROM file_metadata WHERE project_id = ?", projectID); err != nil {
+				return err
+			}
+			files, _, err := scanner.ScanProjectWithReport(absProjectPath, scanOpts)
+			if err != nil {
+				return err
+			}
+			filesScanned = len(files)
+			return benchInsert(db, projectID, files, batchSize)
+		})
+		incremental := benchStage(iterations, func() error {
+			_, err := incrementalScan(db, projectID, absProjectPath, scanOpts, batchSize)
+			return err
+		})
+		var paths []string
+		filterStage := benchStage(iterations, func() error {
+			var err error
+			paths, err = filter.GetFilteredFilePaths(db, projectID, f)
+			filesMatched = len(paths)
+			return err
+		})
+		contentPack := benchStage(iterations, func() error {
+			contentBytes = 0
+			for _, content := range readFileContents(absProjectPath, paths, contentReadOptions{}) {
+				contentBytes += int64(len(content))
+			}
+			return nil
+		})
+		for name, stage := range map[string]benchResult{"fullScan": fullScan, "incrementalScan": incremental, "filter": filterStage, "contentPack": contentPack} {
+			if stage.err != nil {
+				printError(fmt.Errorf("benchmark stage '%s' failed: %w", name, stage.err))
+				return
+			}
+		}
+
+		printJSON(map[string]interface{}{
+			"project_path": absProjectPath,
+			"iterations":   iterations,
+			"environment": map[string]interface{}{
+				"goVersion": runtime.Version(),
+				"os":        runtime.GOOS,
+				"arch":      runtime.GOARCH,
+				"numCPU":    runtime.NumCPU(),
+			},
+			"filesScanned": filesScanned,
+			"filesMatched": filesMatched,
+			"contentBytes": contentBytes,
+			"stages": map[string]benchResult{
+				"fullScan":        fullScan,
+				"incrementalScan": incremental,
+				"filter":          filterStage,
+				"contentPack":     contentPack,
+			},
+		})
+	},
+}
+
+// benchResult holds the timings of one benchmark stage in milliseconds.
+type benchResult struct {
+	MinMs float64 `json:"minMs"`
+	AvgMs float64 `json:"avgMs"`
+	MaxMs float64 `json:"maxMs"`
+	err   error
+}
+
+func benchStage(iterations int, run func() error) benchResult {
+	var result benchResult
+	var total time.Duration
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		if err := run(); err != nil {
+			result.err = err
+			return result
+		}
+		elapsed := time.Since(start)
+		ms := float64(elapsed.Microseconds()) / 1000
+		if i == 0 || ms < result.MinMs {
+			result.MinMs = ms
+		}
+		if ms > result.MaxMs {
+			result.MaxMs = ms
+		}
+		total += elapsed
+	}
+	result.AvgMs = float64(total.Microseconds()) / 1000 / float64(iterations)
+	return result
+}
+
+func benchInsert(db *sql.DB, projectID int64, files []scanner.FileMetadata, batchSize int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := batchInsert(tx, projectID, files, batchSize); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().String("project-path", "", "Path to the project")
+	benchCmd.Flags().Int("iterations", 1, "Number of times each stage is run")
+	benchCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions for the filter and content stages")
+	viper.BindPFlag("bench.project-path", benchCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("bench.iterations", benchCmd.Flags().Lookup("iterations"))
+	viper.BindPFlag("bench.filter-json", benchCmd.Flags().Lookup("filter-json"))
+}
@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
 	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/plugins"
 	"code-prompt-core/pkg/scanner"
 
 	"github.com/spf13/cobra"
@@ -20,15 +28,53 @@ var cacheCmd = &cobra.Command{
 }
 
 var cacheUpdateCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Create or update the cache for a project (full or incremental)",
+	Use:         "update",
+	Annotations: mutatingCommand,
+	Short:       "Create or update the cache for a project (full or incremental)",
 	Long: `Performs a scan of the specified project and updates the cache in the database.
 
 This is the core data-gathering command. It can perform two types of scans:
 1. Full Scan (default): Clears any existing data for the project and scans everything from scratch.
 2. Incremental Scan (--incremental): Much faster for subsequent scans. It compares the file system with the last cached state and only processes new, modified, or deleted files.
 
+Use --dry-run to verify ignore rules and scan scope first: the project is scanned and the files that would be added, modified or deleted are listed, but nothing is written to the database.
+
+Use --skip-dirs-over-files N to protect against scanning massive data or artifact folders that the preset excludes do not cover: any directory with more than N direct entries is skipped and listed in the "skipped_dirs" field of the result.
+
+If the project has scan roots (see 'project set-roots'), only those subdirectories are scanned.
+
+Use --hash to choose how file contents are hashed: sha256 (the default), xxh3 (much faster, not cryptographic, and
+enough to detect changes) or none (no hashing; changes are detected from the modification time only, and commands
+that cache results by content hash it on the fly). The algorithm is recorded in the project, and later scans without
+--hash keep using it. Changing it rehashes every file, so the next scan reports all files as modified.
+
+Use --change-detection to choose how incremental scans find changed files: hash (the default) reads and hashes every
+file and compares its hash and modification time with the cache; mtime only reads files whose size or modification
+time differ from the cache, which is much faster on large projects but misses edits that keep both (and changes to
+.gitattributes, until the next full scan). The mode is recorded in the project, and later scans without
+--change-detection keep using it.
+
+Only one scan of a project can run at a time: while another 'cache update' holds the project's scan lock, this command fails immediately.
+A lock left behind by a crashed process on the same host is taken over automatically.
+
 This command intelligently ignores files specified in '.gitignore' and common dependency directories (like 'node_modules', 'vendor', etc.) by default. This behavior can be modified with flags.
+Files marked 'linguist-generated' or 'linguist-vendored' in the project's root '.gitattributes' are cached with a "generated" flag; filters exclude them unless "excludeGenerated" is set to false.
+Files that look minified (very long average lines) or carry a "DO NOT EDIT"/"@generated" header are cached with a "minified" flag; filters exclude them unless "excludeMinified" is set to false.
+The permission bits of each file are cached too, with an "executable" flag for files with an execute bit; the filter key "includeExecutable" selects or drops them.
+Files following a test naming convention ("*_test.go", "test_*.py", "*.spec.ts", "__tests__/", ...) are cached with a "test" flag; the filter keys "includeTests" and "excludeTests" isolate or drop them.
+PDF, DOCX and ODT documents are always cached, even without --include-binary, so that 'content get --extract-docs' can return their text.
+
+Scan plugins declared under 'plugins.scan' in the config file run after each scan on the files that were added or
+changed (every file on a full scan). Each plugin receives one JSON line per file on stdin (path, relative_path,
+extension, size_bytes, line_count, is_text, is_generated, is_minified, content_hash) and may print one line per
+file: {"relative_path": "...", "attributes": {"key": "value"}}. The attributes are stored in the database and can
+be listed with 'analyze attributes'. A failing plugin does not fail the scan; it is reported in "plugin_errors".
+  plugins:
+    scan:
+      - name: license
+        command: python3 classify_license.py
+        extensions: [go, py]
+        timeout: 2m
 
 All parameters for this command can be configured in your config file under the 'cache.update' key.
 For example:
@@ -43,22 +89,36 @@ For example:
 			printError(err)
 			return
 		}
-		scanOpts := scanner.ScanOptions{
-			NoGitIgnores:     viper.GetBool("cache.update.no-git-ignores"),
-			IncludeBinary:    viper.GetBool("cache.update.include-binary"),
-			NoPresetExcludes: viper.GetBool("cache.update.no-preset-excludes"),
-		}
-		db, err := database.InitializeDB(viper.GetString("db"))
+		scanOpts := scanOptionsFromConfig()
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
+		defer database.Close(db)
+		if viper.GetBool("cache.update.dry-run") {
+			runDryRunScan(db, projectPath, scanOpts)
+			return
+		}
 		projectID, err := getOrCreateProject(db, projectPath)
 		if err != nil {
 			printError(fmt.Errorf("error getting or creating project: %w", err))
 			return
 		}
+		release, err := lockProjectForScan(db, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+		defer release()
+		if scanOpts.Roots, err = loadScanRoots(db, projectID); err != nil {
+			printError(err)
+			return
+		}
+		if err := resolveHashAlgorithm(db, projectID, &scanOpts); err != nil {
+			printError(err)
+			return
+		}
 		if !viper.GetBool("cache.update.incremental") {
 			runFullScan(db, projectID, projectPath, scanOpts)
 		} else {
@@ -67,124 +127,646 @@ For example:
 	},
 }
 
+var cacheClearCmd = &cobra.Command{
+	Use:         "clear",
+	Annotations: mutatingCommand,
+	Short:       "Delete the cached file metadata of a project",
+	Long: `Deletes all cached file metadata of a project, so that the next 'cache update' starts from scratch.
+Unlike 'project delete', the project record and everything attached to it (profiles, selections, tags, report configurations, settings) is kept.
+
+Example:
+  code-prompt-core cache clear --project-path /path/to/project`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("cache.clear.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", projectPath, err))
+			return
+		}
+		release, err := lockProjectForScan(db, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+		defer release()
+		tx, err := db.Begin()
+		if err != nil {
+			printError(fmt.Errorf("error starting transaction: %w", err))
+			return
+		}
+		result, err := tx.Exec("DELETE FROM file_metadata WHERE project_id = ?", projectID)
+		if err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error clearing cache: %w", err))
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM file_attributes WHERE project_id = ?", projectID); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error clearing plugin attributes: %w", err))
+			return
+		}
+		if _, err := tx.Exec("UPDATE projects SET last_scan_timestamp = ? WHERE id = ?", "not_scanned_yet", projectID); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error resetting scan timestamp: %w", err))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			printError(fmt.Errorf("error committing cache clear: %w", err))
+			return
+		}
+		filesRemoved, _ := result.RowsAffected()
+		printJSON(map[string]interface{}{
+			"message":      fmt.Sprintf("Cache of project '%s' cleared.", projectPath),
+			"filesRemoved": filesRemoved,
+		})
+	},
+}
+
+var cacheUnlockCmd = &cobra.Command{
+	Use:         "unlock",
+	Annotations: mutatingCommand,
+	Short:       "Remove the scan lock of a project left behind by a crashed process",
+	Long: `Removes the scan lock of a project, whoever holds it. A lock left by a process on this host that no longer
+runs is taken over automatically, but one left by a process on another host (a database shared over NFS or
+between CI runners) cannot be checked and blocks every scan until it is removed with this command.
+Make sure the holder reported by the "project is locked" error has really stopped: unlocking a running scan
+lets a second one write the cache at the same time.
+
+Example:
+  code-prompt-core cache unlock --project-path /path/to/project`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("cache.unlock.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", projectPath, err))
+			return
+		}
+		holder, err := database.ForceReleaseScanLock(db, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
+		if holder == nil {
+			printJSON(map[string]interface{}{"message": fmt.Sprintf("Project '%s' was not locked.", projectPath), "unlocked": false})
+			return
+		}
+		printJSON(map[string]interface{}{
+			"message":  fmt.Sprintf("Removed the scan lock of pid %d on %s (since %s).", holder.PID, holder.Hostname, holder.AcquiredAt),
+			"unlocked": true,
+		})
+	},
+}
+
+// scanOptionsFromConfig reads the scanner options from the 'cache.update' flags or config keys.
+func scanOptionsFromConfig() scanner.ScanOptions {
+	return scanner.ScanOptions{
+		NoGitIgnores:      viper.GetBool("cache.update.no-git-ignores"),
+		IncludeBinary:     viper.GetBool("cache.update.include-binary"),
+		NoPresetExcludes:  viper.GetBool("cache.update.no-preset-excludes"),
+		NoGitAttributes:   viper.GetBool("cache.update.no-git-attributes"),
+		SkipDirsOverFiles: viper.GetInt("cache.update.skip-dirs-over-files"),
+		Hash:              viper.GetString("cache.update.hash"),
+	}
+}
+
+// Change detection modes of incremental scans (--change-detection).
+const (
+	changeDetectionHash  = "hash"
+	changeDetectionMtime = "mtime"
+)
+
+// resolveChangeDetection returns the change detection mode given with --change-detection or,
+// if none was given, the one recorded for the project.
+func resolveChangeDetection(db *sql.DB, projectID int64) (string, error) {
+	switch mode := viper.GetString("cache.update.change-detection"); mode {
+	case "":
+		return loadChangeDetection(db, projectID)
+	case changeDetectionHash, changeDetectionMtime:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid --change-detection '%s' (valid: %s, %s)", mode, changeDetectionHash, changeDetectionMtime)
+	}
+}
+
+// resolveHashAlgorithm checks the hash algorithm of scanOpts or, if none was given, sets the
+// one the project's cache was built with, so incremental scans compare hashes of one kind.
+func resolveHashAlgorithm(db *sql.DB, projectID int64, scanOpts *scanner.ScanOptions) error {
+	if scanOpts.Hash != "" {
+		if !slices.Contains(scanner.HashAlgorithms, scanOpts.Hash) {
+			return fmt.Errorf("invalid --hash '%s' (valid: %s)", scanOpts.Hash, strings.Join(scanner.HashAlgorithms, ", "))
+		}
+		return nil
+	}
+	algorithm, err := loadHashAlgorithm(db, projectID)
+	if err != nil {
+		return err
+	}
+	scanOpts.Hash = algorithm
+	return nil
+}
+
+// runFullScan replaces the cached files of a project. The old rows are deleted in the same
+// transaction that inserts the new ones, so an interrupted scan leaves the previous cache intact.
+// Files are inserted in batches while the scan is still running instead of after it.
 func runFullScan(db *sql.DB, projectID int64, projectPath string, scanOpts scanner.ScanOptions) {
-	_, err := db.Exec("DELETE FROM file_metadata WHERE project_id = ?", projectID)
+	batchSize := viper.GetInt("cache.update.batch-size")
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	tx, err := db.Begin()
 	if err != nil {
+		printError(fmt.Errorf("error starting transaction: %w", err))
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM file_metadata WHERE project_id = ?", projectID); err != nil {
+		tx.Rollback()
 		printError(fmt.Errorf("error clearing old cache: %w", err))
 		return
 	}
-	files, err := scanner.ScanProject(projectPath, scanOpts)
-	if err != nil {
-		printError(fmt.Errorf("error scanning project: %w", err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := make(chan scanner.FileMetadata, batchSize)
+	var report scanner.ScanReport
+	var scanErr error
+	scanDone := make(chan struct{})
+	go func() {
+		report, scanErr = scanner.ScanProjectStream(ctx, projectPath, scanOpts, files)
+		close(scanDone)
+	}()
+	filesScanned, insertErr := streamInsert(tx, projectID, files, batchSize)
+	if insertErr != nil {
+		cancel()
+		for range files {
+		}
+	}
+	<-scanDone
+
+	if scanErr != nil && insertErr == nil {
+		tx.Rollback()
+		printError(fmt.Errorf("error scanning project: %w", scanErr))
 		return
 	}
-	tx, err := db.Begin()
+	if insertErr != nil {
+		tx.Rollback()
+		printError(fmt.Errorf("full scan insert failed: %w", insertErr))
+		return
+	}
+	changeDetection, err := resolveChangeDetection(db, projectID)
 	if err != nil {
-		printError(fmt.Errorf("error starting transaction: %w", err))
+		tx.Rollback()
+		printError(err)
 		return
 	}
-	if err := batchInsert(tx, projectID, files, viper.GetInt("cache.update.batch-size")); err != nil {
+	if _, err := tx.Exec("UPDATE projects SET hash_algorithm = ?, change_detection = ? WHERE id = ?", cmp.Or(scanOpts.Hash, scanner.HashSHA256), changeDetection, projectID); err != nil {
 		tx.Rollback()
-		printError(fmt.Errorf("full scan insert failed: %w", err))
+		printError(fmt.Errorf("error recording scan settings: %w", err))
 		return
 	}
 	if err := tx.Commit(); err != nil {
 		printError(fmt.Errorf("full scan commit failed: %w", err))
 		return
 	}
-	db.Exec("UPDATE projects SET last_scan_timestamp = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), projectID)
-	printJSON(map[string]interface{}{
+	database.For(db).TouchLastScan(projectID)
+	pluginErrors, err := runScanPlugins(db, projectID, projectPath, nil)
+	if err != nil {
+		printError(err)
+		return
+	}
+	result := map[string]interface{}{
 		"status":       "cache updated (full scan)",
-		"filesScanned": len(files),
-	})
+		"filesScanned": filesScanned,
+		"skipped_dirs": report.SkippedDirs,
+	}
+	if len(pluginErrors) > 0 {
+		result["plugin_errors"] = pluginErrors
+	}
+	printJSON(result)
 }
 
-func runIncrementalScan(db *sql.DB, projectID int64, projectPath string, scanOpts scanner.ScanOptions, batchSize int) {
-	type dbFileInfo struct {
-		ModTime time.Time
-		Hash    string
+// streamInsert inserts the files received from a scan stream in batches of batchSize and
+// returns how many were inserted. On error it stops reading; the caller drains the stream.
+func streamInsert(tx *sql.Tx, projectID int64, files <-chan scanner.FileMetadata, batchSize int) (int, error) {
+	inserted := 0
+	batch := make([]scanner.FileMetadata, 0, batchSize)
+	for f := range files {
+		batch = append(batch, f)
+		if len(batch) < batchSize {
+			continue
+		}
+		if err := batchInsert(tx, projectID, batch, batchSize); err != nil {
+			return inserted, err
+		}
+		inserted += len(batch)
+		batch = batch[:0]
+	}
+	if err := batchInsert(tx, projectID, batch, batchSize); err != nil {
+		return inserted, err
 	}
-	dbFiles := make(map[string]dbFileInfo)
-	rows, err := db.Query("SELECT relative_path, last_mod_time, content_hash FROM file_metadata WHERE project_id = ?", projectID)
+	return inserted + len(batch), nil
+}
+
+func runIncrementalScan(db *sql.DB, projectID int64, projectPath string, scanOpts scanner.ScanOptions, batchSize int) {
+	changes, err := incrementalScan(db, projectID, projectPath, scanOpts, batchSize)
 	if err != nil {
 		printError(err)
 		return
 	}
-	for rows.Next() {
-		var path, modTimeStr, hash string
-		if err := rows.Scan(&path, &modTimeStr, &hash); err != nil {
-			rows.Close()
-			printError(err)
-			return
-		}
-		modTime, _ := time.Parse(time.RFC3339Nano, modTimeStr)
-		dbFiles[path] = dbFileInfo{ModTime: modTime, Hash: hash}
+	if changes.Added == 0 && changes.Modified == 0 && changes.Deleted == 0 {
+		printJSON(map[string]interface{}{
+			"status":       "cache is up-to-date",
+			"skipped_dirs": changes.Report.SkippedDirs,
+		})
+		return
 	}
-	rows.Close()
-	localFiles, err := scanner.ScanProject(projectPath, scanOpts)
+	result := map[string]interface{}{
+		"status":         "cache updated (incremental scan)",
+		"files_added":    changes.Added,
+		"files_modified": changes.Modified,
+		"files_deleted":  changes.Deleted,
+		"skipped_dirs":   changes.Report.SkippedDirs,
+	}
+	if len(changes.PluginErrors) > 0 {
+		result["plugin_errors"] = changes.PluginErrors
+	}
+	printJSON(result)
+}
+
+// scanChanges summarizes what an incremental scan changed in the cache.
+type scanChanges struct {
+	Added, Modified, Deleted int
+	Report                   scanner.ScanReport
+	// PluginErrors holds the error of every scan plugin that failed, by plugin name.
+	PluginErrors map[string]string
+}
+
+// incrementalScan rescans a project and applies only the differences to the cache.
+func incrementalScan(db *sql.DB, projectID int64, projectPath string, scanOpts scanner.ScanOptions, batchSize int) (scanChanges, error) {
+	var changes scanChanges
+	changeDetection, err := resolveChangeDetection(db, projectID)
 	if err != nil {
-		printError(err)
-		return
+		return changes, err
+	}
+	dbFiles, err := loadCachedFiles(db, projectID)
+	if err != nil {
+		return changes, err
+	}
+	if changeDetection == changeDetectionMtime {
+		scanOpts.Unchanged = dbFiles.unchanged
+	}
+	localFiles, report, err := scanner.ScanProjectWithReport(projectPath, scanOpts)
+	if err != nil {
+		return changes, err
+	}
+	changes.Report = report
+	toInsert, toUpdate, toDelete := diffCachedFiles(dbFiles, localFiles)
+	if len(toInsert) == 0 && len(toUpdate) == 0 && len(toDelete) == 0 {
+		return changes, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return changes, err
+	}
+	if err := batchInsert(tx, projectID, toInsert, batchSize); err != nil {
+		tx.Rollback()
+		return changes, fmt.Errorf("batch insert failed: %w", err)
+	}
+	if err := singleUpdate(tx, projectID, toUpdate); err != nil {
+		tx.Rollback()
+		return changes, fmt.Errorf("update failed: %w", err)
+	}
+	if err := batchDelete(tx, projectID, toDelete, batchSize); err != nil {
+		tx.Rollback()
+		return changes, fmt.Errorf("batch delete failed: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE projects SET hash_algorithm = ?, change_detection = ? WHERE id = ?", cmp.Or(scanOpts.Hash, scanner.HashSHA256), changeDetection, projectID); err != nil {
+		tx.Rollback()
+		return changes, fmt.Errorf("error recording scan settings: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return changes, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	database.For(db).TouchLastScan(projectID)
+	changes.Added, changes.Modified, changes.Deleted = len(toInsert), len(toUpdate), len(toDelete)
+	changed := make([]string, 0, len(toInsert)+len(toUpdate))
+	for _, f := range append(toInsert, toUpdate...) {
+		changed = append(changed, f.RelativePath)
+	}
+	if changes.PluginErrors, err = runScanPlugins(db, projectID, projectPath, changed); err != nil {
+		return changes, err
 	}
+	return changes, nil
+}
+
+// cachedFile is the state of a cached file that scans compare against.
+type cachedFile struct {
+	ModTime     time.Time
+	SizeBytes   int64
+	Hash        string
+	IsGenerated bool
+	Mode        fs.FileMode
+	IsTest      bool
+}
+
+// cachedFiles maps the relative paths of a project's cached files to their state.
+type cachedFiles map[string]cachedFile
+
+// loadCachedFiles returns the cached state of every file of a project.
+func loadCachedFiles(db *sql.DB, projectID int64) (cachedFiles, error) {
+	dbFiles := make(cachedFiles)
+	rows, err := db.Query("SELECT relative_path, last_mod_time, size_bytes, content_hash, is_generated, mode, is_test FROM file_metadata WHERE project_id = ?", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path, modTimeStr string
+		var f cachedFile
+		var mode int64
+		if err := rows.Scan(&path, &modTimeStr, &f.SizeBytes, &f.Hash, &f.IsGenerated, &mode, &f.IsTest); err != nil {
+			return nil, err
+		}
+		f.Mode = fs.FileMode(mode)
+		f.ModTime, _ = time.Parse(time.RFC3339Nano, modTimeStr)
+		dbFiles[path] = f
+	}
+	return dbFiles, rows.Err()
+}
+
+// unchanged reports whether a file is cached with the same size, modification time and
+// permission bits. It is the scanner.ScanOptions.Unchanged of the mtime change detection.
+// Files cached with a stale test flag (by a version without it) are reported as changed.
+func (c cachedFiles) unchanged(relPath string, sizeBytes int64, modTime time.Time, mode fs.FileMode) bool {
+	f, ok := c[relPath]
+	return ok && f.SizeBytes == sizeBytes && f.ModTime.Equal(modTime) && f.Mode == mode && f.IsTest == scanner.IsTestFile(relPath)
+}
+
+// diffCachedFiles compares freshly scanned files with the cached state of a project
+// and returns the files to insert, the files to update and the paths to delete.
+func diffCachedFiles(dbFiles cachedFiles, localFiles []scanner.FileMetadata) (toInsert, toUpdate []scanner.FileMetadata, toDelete []string) {
 	localFilesMap := make(map[string]scanner.FileMetadata)
-	var toInsert, toUpdate []scanner.FileMetadata
 	for _, f := range localFiles {
 		localFilesMap[f.RelativePath] = f
+		if f.Unchanged {
+			continue
+		}
 		dbInfo, exists := dbFiles[f.RelativePath]
 		if !exists {
 			toInsert = append(toInsert, f)
-		} else if !f.LastModTime.Equal(dbInfo.ModTime) || f.ContentHash != dbInfo.Hash {
+		} else if !f.LastModTime.Equal(dbInfo.ModTime) || f.ContentHash != dbInfo.Hash || f.IsGenerated != dbInfo.IsGenerated || f.Mode != dbInfo.Mode || f.IsTest != dbInfo.IsTest {
 			toUpdate = append(toUpdate, f)
 		}
 	}
-	var toDelete []string
 	for path := range dbFiles {
 		if _, exists := localFilesMap[path]; !exists {
 			toDelete = append(toDelete, path)
 		}
 	}
-	if len(toInsert) == 0 && len(toUpdate) == 0 && len(toDelete) == 0 {
-		printJSON(map[string]interface{}{"status": "cache is up-to-date"})
+	return toInsert, toUpdate, toDelete
+}
+
+// runDryRunScan scans the project and reports how the cache would change, without writing to the database.
+// A project that is not registered yet is treated as having an empty cache.
+func runDryRunScan(db *sql.DB, projectPath string, scanOpts scanner.ScanOptions) {
+	projectID, err := database.For(db).ProjectID(projectPath)
+	if err != nil && err != sql.ErrNoRows {
+		printError(fmt.Errorf("error finding project: %w", err))
 		return
 	}
-	tx, err := db.Begin()
-	if err != nil {
+	if scanOpts.Roots, err = loadScanRoots(db, projectID); err != nil {
 		printError(err)
 		return
 	}
-	if err := batchInsert(tx, projectID, toInsert, batchSize); err != nil {
-		tx.Rollback()
-		printError(fmt.Errorf("batch insert failed: %w", err))
+	if err := resolveHashAlgorithm(db, projectID, &scanOpts); err != nil {
+		printError(err)
 		return
 	}
-	if err := singleUpdate(tx, projectID, toUpdate); err != nil {
-		tx.Rollback()
-		printError(fmt.Errorf("update failed: %w", err))
+	changeDetection, err := resolveChangeDetection(db, projectID)
+	if err != nil {
+		printError(err)
 		return
 	}
-	if err := batchDelete(tx, projectID, toDelete, batchSize); err != nil {
-		tx.Rollback()
-		printError(fmt.Errorf("batch delete failed: %w", err))
+	dbFiles, err := loadCachedFiles(db, projectID)
+	if err != nil {
+		printError(err)
 		return
 	}
-	if err := tx.Commit(); err != nil {
-		printError(fmt.Errorf("transaction commit failed: %w", err))
+	if changeDetection == changeDetectionMtime && viper.GetBool("cache.update.incremental") {
+		scanOpts.Unchanged = dbFiles.unchanged
+	}
+	localFiles, report, err := scanner.ScanProjectWithReport(projectPath, scanOpts)
+	if err != nil {
+		printError(fmt.Errorf("error scanning project: %w", err))
 		return
 	}
-	db.Exec("UPDATE projects SET last_scan_timestamp = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), projectID)
+	toInsert, toUpdate, toDelete := diffCachedFiles(dbFiles, localFiles)
+
+	mode := "full"
+	if viper.GetBool("cache.update.incremental") {
+		mode = "incremental"
+	}
+	toAdd := make([]string, 0, len(toInsert))
+	for _, f := range toInsert {
+		toAdd = append(toAdd, f.RelativePath)
+	}
+	toModify := make([]string, 0, len(toUpdate))
+	for _, f := range toUpdate {
+		toModify = append(toModify, f.RelativePath)
+	}
+	if toDelete == nil {
+		toDelete = []string{}
+	}
+	sort.Strings(toAdd)
+	sort.Strings(toModify)
+	sort.Strings(toDelete)
 	printJSON(map[string]interface{}{
-		"status":         "cache updated (incremental scan)",
-		"files_added":    len(toInsert),
-		"files_modified": len(toUpdate),
-		"files_deleted":  len(toDelete),
+		"status":       fmt.Sprintf("dry run (%s scan), no changes written", mode),
+		"filesScanned": len(localFiles),
+		"to_add":       toAdd,
+		"to_modify":    toModify,
+		"to_delete":    toDelete,
+		"skipped_dirs": report.SkippedDirs,
 	})
 }
 
+// scanPluginsFromConfig reads the 'plugins.scan' entries of the config file.
+func scanPluginsFromConfig() ([]plugins.ScanPlugin, error) {
+	var list []plugins.ScanPlugin
+	if err := viper.UnmarshalKey("plugins.scan", &list); err != nil {
+		return nil, fmt.Errorf("invalid 'plugins.scan' config: %w", err)
+	}
+	for i := range list {
+		if list[i].Command == "" {
+			return nil, fmt.Errorf("invalid 'plugins.scan' config: entry %d has no command", i+1)
+		}
+		if list[i].Name == "" {
+			list[i].Name = list[i].Command
+		}
+	}
+	return list, nil
+}
+
+// runScanPlugins runs the configured scan plugins on the cached files of a project after a
+// scan and replaces their stored attributes. changed limits the run to those files; nil
+// means every cached file. Attributes of files that are no longer cached, and of plugins no
+// longer configured, are removed. A failing plugin keeps its previous attributes and is
+// reported in the returned map (and on stderr) instead of failing the scan.
+func runScanPlugins(db *sql.DB, projectID int64, projectPath string, changed []string) (map[string]string, error) {
+	configured, err := scanPluginsFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]interface{}, 0, len(configured)+1)
+	names = append(names, projectID)
+	for _, p := range configured {
+		names = append(names, p.Name)
+	}
+	cleanup := "DELETE FROM file_attributes WHERE project_id = ? AND (relative_path NOT IN (SELECT relative_path FROM file_metadata WHERE project_id = file_attributes.project_id)"
+	if len(configured) > 0 {
+		cleanup += " OR plugin NOT IN (?" + strings.Repeat(", ?", len(configured)-1) + "))"
+	} else {
+		cleanup += " OR 1)"
+	}
+	if _, err := db.Exec(cleanup, names...); err != nil {
+		return nil, fmt.Errorf("error removing stale plugin attributes: %w", err)
+	}
+	if len(configured) == 0 || (changed != nil && len(changed) == 0) {
+		return nil, nil
+	}
+
+	var wanted map[string]bool
+	if changed != nil {
+		wanted = make(map[string]bool, len(changed))
+		for _, p := range changed {
+			wanted[p] = true
+		}
+	}
+	rows, err := db.Query("SELECT relative_path, extension, size_bytes, line_count, is_text, is_generated, is_minified, content_hash FROM file_metadata WHERE project_id = ? ORDER BY relative_path", projectID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying file metadata: %w", err)
+	}
+	var files []plugins.File
+	for rows.Next() {
+		var f plugins.File
+		var ext sql.NullString
+		if err := rows.Scan(&f.RelativePath, &ext, &f.SizeBytes, &f.LineCount, &f.IsText, &f.IsGenerated, &f.IsMinified, &f.ContentHash); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if wanted != nil && !wanted[f.RelativePath] {
+			continue
+		}
+		f.Extension = ext.String
+		f.Path = filepath.Join(projectPath, filepath.FromSlash(f.RelativePath))
+		files = append(files, f)
+	}
+	rows.Close()
+
+	pluginErrors := make(map[string]string)
+	for _, p := range configured {
+		var input []plugins.File
+		for _, f := range files {
+			if p.Accepts(f.Extension) {
+				input = append(input, f)
+			}
+		}
+		if len(input) == 0 {
+			continue
+		}
+		attributes, err := runScanPlugin(p, projectPath, input)
+		if err != nil {
+			pluginErrors[p.Name] = err.Error()
+			warn("scan plugin '%s' failed: %v", p.Name, err)
+			continue
+		}
+		if err := storeFileAttributes(db, projectID, p.Name, input, attributes); err != nil {
+			return pluginErrors, err
+		}
+	}
+	return pluginErrors, nil
+}
+
+func runScanPlugin(p plugins.ScanPlugin, projectPath string, files []plugins.File) (map[string]map[string]string, error) {
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	c := shellCommand(ctx, p.Command)
+	c.Dir = projectPath
+	c.Env = append(os.Environ(), "CODE_PROMPT_CORE_PROJECT="+projectPath)
+	c.WaitDelay = time.Second
+	attributes, err := plugins.Run(c, files)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("plugin timed out after %s", p.Timeout)
+	}
+	return attributes, err
+}
+
+// storeFileAttributes replaces the attributes a plugin stored for files.
+func storeFileAttributes(db *sql.DB, projectID int64, plugin string, files []plugins.File, attributes map[string]map[string]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, f := range files {
+		if _, err := tx.Exec("DELETE FROM file_attributes WHERE project_id = ? AND relative_path = ? AND plugin = ?", projectID, f.RelativePath, plugin); err != nil {
+			return fmt.Errorf("error clearing plugin attributes: %w", err)
+		}
+		for key, value := range attributes[f.RelativePath] {
+			if _, err := tx.Exec("INSERT INTO file_attributes (project_id, relative_path, plugin, key, value) VALUES (?, ?, ?, ?, ?)",
+				projectID, f.RelativePath, plugin, key, value); err != nil {
+				return fmt.Errorf("error storing plugin attributes: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing plugin attributes: %w", err)
+	}
+	return nil
+}
+
+// maxSQLVariables is the smallest limit on bound parameters per statement among SQLite builds
+// (SQLITE_MAX_VARIABLE_NUMBER defaulted to 999 before 3.32); batched statements stay below it.
+const maxSQLVariables = 999
+
+// statementBatchSize caps a batch size so that a statement binding perRow parameters per row
+// plus fixed ones stays within maxSQLVariables, whatever --batch-size says.
+func statementBatchSize(batchSize, perRow, fixed int) int {
+	if limit := (maxSQLVariables - fixed) / perRow; batchSize > limit || batchSize <= 0 {
+		return limit
+	}
+	return batchSize
+}
+
 func batchInsert(tx *sql.Tx, projectID int64, files []scanner.FileMetadata, batchSize int) error {
 	if len(files) == 0 {
 		return nil
 	}
-	sqlStr := "INSERT INTO file_metadata(project_id, relative_path, filename, extension, size_bytes, line_count, is_text, last_mod_time, content_hash) VALUES "
+	batchSize = statementBatchSize(batchSize, 14, 0)
+	sqlStr := "INSERT INTO file_metadata(project_id, relative_path, filename, extension, size_bytes, line_count, is_text, last_mod_time, content_hash, is_generated, is_minified, mode, is_executable, is_test) VALUES "
 	for i := 0; i < len(files); i += batchSize {
 		end := i + batchSize
 		if end > len(files) {
@@ -194,8 +776,8 @@ func batchInsert(tx *sql.Tx, projectID int64, files []scanner.FileMetadata, batc
 		vals := []interface{}{}
 		placeholders := make([]string, 0, len(batch))
 		for _, f := range batch {
-			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?, ?)")
-			vals = append(vals, projectID, f.RelativePath, f.Filename, f.Extension, f.SizeBytes, f.LineCount, f.IsText, f.LastModTime.Format(time.RFC3339Nano), f.ContentHash)
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			vals = append(vals, projectID, f.RelativePath, f.Filename, f.Extension, f.SizeBytes, f.LineCount, f.IsText, f.LastModTime.Format(time.RFC3339Nano), f.ContentHash, f.IsGenerated, f.IsMinified, int64(f.Mode), f.IsExecutable, f.IsTest)
 		}
 		batchSQL := sqlStr + strings.Join(placeholders, ",")
 		if _, err := tx.Exec(batchSQL, vals...); err != nil {
@@ -209,13 +791,13 @@ func singleUpdate(tx *sql.Tx, projectID int64, files []scanner.FileMetadata) err
 	if len(files) == 0 {
 		return nil
 	}
-	stmt, err := tx.Prepare("UPDATE file_metadata SET size_bytes = ?, line_count = ?, is_text = ?, last_mod_time = ?, content_hash = ? WHERE project_id = ? AND relative_path = ?")
+	stmt, err := tx.Prepare("UPDATE file_metadata SET size_bytes = ?, line_count = ?, is_text = ?, last_mod_time = ?, content_hash = ?, is_generated = ?, is_minified = ?, mode = ?, is_executable = ?, is_test = ? WHERE project_id = ? AND relative_path = ?")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	for _, f := range files {
-		_, err := stmt.Exec(f.SizeBytes, f.LineCount, f.IsText, f.LastModTime.Format(time.RFC3339Nano), f.ContentHash, projectID, f.RelativePath)
+		_, err := stmt.Exec(f.SizeBytes, f.LineCount, f.IsText, f.LastModTime.Format(time.RFC3339Nano), f.ContentHash, f.IsGenerated, f.IsMinified, int64(f.Mode), f.IsExecutable, f.IsTest, projectID, f.RelativePath)
 		if err != nil {
 			return err
 		}
@@ -227,6 +809,7 @@ func batchDelete(tx *sql.Tx, projectID int64, paths []string, batchSize int) err
 	if len(paths) == 0 {
 		return nil
 	}
+	batchSize = statementBatchSize(batchSize, 1, 1)
 	sqlStr := "DELETE FROM file_metadata WHERE project_id = ? AND relative_path IN ("
 	for i := 0; i < len(paths); i += batchSize {
 		end := i + batchSize
@@ -248,8 +831,7 @@ func batchDelete(tx *sql.Tx, projectID int64, paths []string, batchSize int) err
 }
 
 func getOrCreateProject(db *sql.DB, projectPath string) (int64, error) {
-	var projectID int64
-	err := db.QueryRow("SELECT id FROM projects WHERE project_path = ?", projectPath).Scan(&projectID)
+	projectID, err := database.For(db).ProjectID(projectPath)
 	if err == sql.ErrNoRows {
 		res, err := db.Exec("INSERT INTO projects(project_path, last_scan_timestamp) VALUES(?, ?)", projectPath, "not_scanned_yet")
 		if err != nil {
@@ -269,12 +851,30 @@ func init() {
 	cacheUpdateCmd.Flags().Bool("no-git-ignores", false, "Disable .gitignore file parsing")
 	cacheUpdateCmd.Flags().Bool("include-binary", false, "Include binary files in the scan")
 	cacheUpdateCmd.Flags().Bool("no-preset-excludes", false, "Disable default exclusion of dependency directories")
+	cacheUpdateCmd.Flags().Bool("no-git-attributes", false, "Do not mark linguist-generated/linguist-vendored files from .gitattributes")
 	cacheUpdateCmd.Flags().Int("batch-size", 100, "Number of DB operations to batch in incremental scans")
+	cacheUpdateCmd.Flags().Int("skip-dirs-over-files", 0, "Skip directories with more than N direct entries, e.g. data or artifact folders (0 disables)")
+	cacheUpdateCmd.Flags().String("hash", "", "Content hash algorithm: sha256, xxh3 or none (default: the project's, sha256 for new projects)")
+	cacheUpdateCmd.Flags().String("change-detection", "", "How incremental scans detect changes: hash or mtime (size and modification time only; default: the project's, hash for new projects)")
+	cacheUpdateCmd.Flags().Bool("dry-run", false, "Scan and report what would be added, modified or deleted without writing to the database")
 
 	viper.BindPFlag("cache.update.project-path", cacheUpdateCmd.Flags().Lookup("project-path"))
 	viper.BindPFlag("cache.update.incremental", cacheUpdateCmd.Flags().Lookup("incremental"))
 	viper.BindPFlag("cache.update.no-git-ignores", cacheUpdateCmd.Flags().Lookup("no-git-ignores"))
 	viper.BindPFlag("cache.update.include-binary", cacheUpdateCmd.Flags().Lookup("include-binary"))
 	viper.BindPFlag("cache.update.no-preset-excludes", cacheUpdateCmd.Flags().Lookup("no-preset-excludes"))
+	viper.BindPFlag("cache.update.no-git-attributes", cacheUpdateCmd.Flags().Lookup("no-git-attributes"))
 	viper.BindPFlag("cache.update.batch-size", cacheUpdateCmd.Flags().Lookup("batch-size"))
+	viper.BindPFlag("cache.update.skip-dirs-over-files", cacheUpdateCmd.Flags().Lookup("skip-dirs-over-files"))
+	viper.BindPFlag("cache.update.hash", cacheUpdateCmd.Flags().Lookup("hash"))
+	viper.BindPFlag("cache.update.change-detection", cacheUpdateCmd.Flags().Lookup("change-detection"))
+	viper.BindPFlag("cache.update.dry-run", cacheUpdateCmd.Flags().Lookup("dry-run"))
+
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheClearCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("cache.clear.project-path", cacheClearCmd.Flags().Lookup("project-path"))
+
+	cacheCmd.AddCommand(cacheUnlockCmd)
+	cacheUnlockCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("cache.unlock.project-path", cacheUnlockCmd.Flags().Lookup("project-path"))
 }
@@ -2,50 +2,400 @@
 package cmd
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
+	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/docextract"
 	"code-prompt-core/pkg/filter"
+	"code-prompt-core/pkg/notebook"
+	"code-prompt-core/pkg/packages"
+	"code-prompt-core/pkg/transform"
 
+	"github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 // --- Response structs are unchanged ---
 type Response struct {
-	Status string      `json:"status"`
-	Data   interface{} `json:"data,omitempty"`
+	Status string        `json:"status"`
+	Data   interface{}   `json:"data,omitempty"`
+	Meta   *ResponseMeta `json:"meta,omitempty"`
+	// Warnings are the non-fatal issues the command ran into.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ResponseMeta describes how a success response came about, so that clients can show
+// freshness and performance without extra calls.
+type ResponseMeta struct {
+	DurationMs int64 `json:"duration_ms"`
+	// ScanTimestamp is the last scan of the project the command read from, if it read one.
+	ScanTimestamp string `json:"scan_timestamp,omitempty"`
+	// ResultCount is the length of a list payload, or of the main list of an object payload.
+	ResultCount *int `json:"result_count,omitempty"`
+	// Truncated reports that a limit such as --limit, --top or --max-file-bytes left results out.
+	Truncated bool `json:"truncated"`
 }
 
 type ErrorResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	Status   string   `json:"status"`
+	Message  string   `json:"message"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// marshalResponse encodes a response envelope, indented unless --compact is set.
+func marshalResponse(resp interface{}) ([]byte, error) {
+	if viper.GetBool("compact") {
+		return json.Marshal(resp)
+	}
+	return json.MarshalIndent(resp, "", "  ")
 }
 
 func printJSON(data interface{}) {
-	resp := Response{Status: "success", Data: data}
-	bytes, err := json.MarshalIndent(resp, "", "  ")
+	resp := Response{Status: "success", Data: data, Meta: finishResponseMeta(data), Warnings: responseWarnings}
+	bytes, err := marshalResponse(resp)
 	if err != nil {
 		printError(fmt.Errorf("failed to marshal JSON response: %w", err))
 		return
 	}
+	if responseOutput != "" {
+		writeResponseOutput(append(bytes, '\n'))
+		lastResponse = bytes
+		return
+	}
 	fmt.Println(string(bytes))
+	responseBytes += int64(len(bytes)) + 1
+	lastResponse = bytes
+}
+
+// commandStarted and responseMeta are the state of the meta object of the command's
+// response, and responseWarnings its warnings. preRun resets them; commands fill in what
+// they know.
+var (
+	commandStarted   time.Time
+	responseMeta     ResponseMeta
+	responseWarnings []string
+)
+
+func resetResponseMeta() {
+	commandStarted = time.Now()
+	responseMeta = ResponseMeta{}
+	responseWarnings = nil
+}
+
+// setResultCount sets the result count of a response whose payload is not a list.
+func setResultCount(n int) {
+	responseMeta.ResultCount = &n
+}
+
+// markTruncated records that a limit left results out of the response.
+func markTruncated() {
+	responseMeta.Truncated = true
+}
+
+// finishResponseMeta completes the meta object for a response with the given payload.
+func finishResponseMeta(data interface{}) *ResponseMeta {
+	meta := responseMeta
+	meta.DurationMs = time.Since(commandStarted).Milliseconds()
+	if v := reflect.ValueOf(data); meta.ResultCount == nil && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) {
+		n := v.Len()
+		meta.ResultCount = &n
+	}
+	return &meta
+}
+
+// responseOutput is the file given with the --output flag of the analyze and content
+// commands; their output goes there instead of stdout. It is set by preRun.
+var responseOutput string
+
+// responseOutputKeys maps the command groups with a persistent --output flag to its config key.
+var responseOutputKeys = map[*cobra.Command]string{}
+
+// addResponseOutputFlag gives all commands of a group the --output flag.
+func addResponseOutputFlag(group *cobra.Command, key string) {
+	group.PersistentFlags().String("output", "", "Write the result to this file (atomically, through a temporary file) instead of stdout")
+	viper.BindPFlag(key, group.PersistentFlags().Lookup("output"))
+	responseOutputKeys[group] = key
+}
+
+// outputFile is the response printed instead of a result written to --output.
+type outputFile struct {
+	Output string `json:"output"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// writeResponseOutput writes a command's output to responseOutput and prints where it went.
+func writeResponseOutput(data []byte) {
+	if err := writeFileAtomic(responseOutput, data); err != nil {
+		printError(fmt.Errorf("error writing output file: %w", err))
+		return
+	}
+	responseBytes += int64(len(data))
+	printOutputFile(responseOutput, int64(len(data)))
+}
+
+// printOutputFile prints the response that points to a result written to a file.
+func printOutputFile(path string, size int64) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	bytes, _ := marshalResponse(Response{Status: "success", Data: outputFile{Output: path, Bytes: size}, Meta: finishResponseMeta(nil), Warnings: responseWarnings})
+	fmt.Println(string(bytes))
+}
+
+// atomicFile is written under a temporary name next to its path and renamed into place by
+// Commit, so readers of the path never see a partial file.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmp, path: path}, nil
+}
+
+// Commit closes the file and renames it to its path.
+func (f *atomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving the path untouched.
+func (f *atomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// writeFileAtomic replaces the file at path with data.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
 }
 
 func printError(err error) {
-	resp := ErrorResponse{Status: "error", Message: err.Error()}
-	bytes, _ := json.MarshalIndent(resp, "", "  ")
+	resp := ErrorResponse{Status: "error", Message: err.Error(), Warnings: responseWarnings}
+	bytes, _ := marshalResponse(resp)
+	responseBytes += int64(len(bytes)) + 1
+	commandFailed = true
+	lastResponse = bytes
+	if inBatch {
+		panic(batchAbort{err})
+	}
 	fmt.Fprintln(os.Stderr, string(bytes))
+	runShutdownHooks()
 	os.Exit(1)
 }
 
+// encryptedDBs are the decrypted working copies opened by this process, by database path.
+// Every openDatabase call of a command shares one, so that a copy opened early (such as by
+// resolveAutoProjectPath) is not sealed over the command's changes.
+var encryptedDBs = map[string]*database.EncryptedDB{}
+
+// beginRead starts the read transaction through which a command reads the cache, so that
+// all its reads see one snapshot (see database.BeginRead). A failure is reported with
+// printError, which does not return. The caller defers the rollback.
+func beginRead(db *sql.DB) *sql.Tx {
+	tx, err := database.BeginRead(db)
+	if err != nil {
+		printError(fmt.Errorf("error starting read transaction: %w", err))
+		return nil
+	}
+	return tx
+}
+
+// openDatabase opens the cache database selected by --db or --db-name. With --db-key-file,
+// the database is encrypted at rest: it is decrypted and locked by the first call and
+// re-sealed when the command exits.
+func openDatabase() (*sql.DB, error) {
+	dbPath, err := resolveDBPath()
+	if err != nil {
+		return nil, err
+	}
+	readOnly := viper.GetBool("read-only")
+	keyFile := viper.GetString("db-key-file")
+	if keyFile == "" {
+		if readOnly {
+			return database.OpenReadOnly(dbPath)
+		}
+		return database.InitializeDB(dbPath)
+	}
+	if encrypted, ok := encryptedDBs[dbPath]; ok {
+		return encrypted.Open()
+	}
+	key, err := database.KeyFromFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := database.OpenEncrypted(dbPath, key, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	encryptedDBs[dbPath] = encrypted
+	stop := sealOnSignal(encrypted)
+	shutdownHooks = append(shutdownHooks, func() error {
+		stop()
+		delete(encryptedDBs, dbPath)
+		return encrypted.Seal()
+	})
+	return encrypted.Open()
+}
+
+// sealOnSignal seals an encrypted database and exits when the process is interrupted or
+// terminated; without it, Ctrl+C would lose the changes and leave the decrypted working copy
+// behind. The returned function stops handling the signals.
+func sealOnSignal(encrypted *database.EncryptedDB) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			if err := encrypted.Seal(); err != nil {
+				fmt.Fprintln(os.Stderr, "Error during shutdown:", err)
+			}
+			fmt.Fprintf(os.Stderr, "Interrupted (%v)\n", sig)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// responseBytes and commandFailed describe the command's responses for the usage statistics.
+var (
+	responseBytes int64
+	commandFailed bool
+)
+
+// recordUsage registers a shutdown hook that stores the invocation of cmd in the usage
+// table once it has finished, successfully or not. It is registered before the command
+// opens the database, so it runs after the command's own hooks (such as re-sealing an
+// encrypted database) and opens the database again.
+func recordUsage(cmd *cobra.Command) {
+	started := time.Now()
+	command := strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+	shutdownHooks = append(shutdownHooks, func() error {
+		duration := time.Since(started)
+		db, err := openDatabase()
+		if err != nil {
+			return fmt.Errorf("error recording usage: %w", err)
+		}
+		err = database.RecordUsage(db, command, started, duration, responseBytes, !commandFailed)
+		database.Close(db)
+		// Hooks registered by openDatabase are not part of the run that called this one.
+		runShutdownHooks()
+		return err
+	})
+}
+
+// shutdownHooks run once before the process exits, on success (Execute) and on error (printError).
+// Like deferred calls they run in reverse order of registration.
+var shutdownHooks []func() error
+
+func runShutdownHooks() {
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](); err != nil {
+			fmt.Fprintln(os.Stderr, "Error during shutdown:", err)
+		}
+	}
+}
+
+// lockProjectForScan takes the scan lock of a project. The returned release function should
+// be deferred; it is also registered as a shutdown hook because printError exits without
+// running deferred calls.
+func lockProjectForScan(db *sql.DB, projectID int64) (func() error, error) {
+	release, err := database.AcquireScanLock(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	shutdownHooks = append(shutdownHooks, release)
+	return release, nil
+}
+
+// resolveDBPath returns the database file to use. --db-name looks the path up in the
+// "dbs" map of the config file, e.g.
+//
+//	dbs:
+//	  work: ~/caches/work.db
+//	  personal: ~/caches/personal.db
+func resolveDBPath() (string, error) {
+	dbPath := viper.GetString("db")
+	if name := viper.GetString("db-name"); name != "" {
+		if rootCmd.PersistentFlags().Changed("db") {
+			return "", fmt.Errorf("--db and --db-name cannot be used together")
+		}
+		dbs := viper.GetStringMapString("dbs")
+		named, ok := dbs[strings.ToLower(name)]
+		if !ok || named == "" {
+			return "", fmt.Errorf("no database named '%s' in the 'dbs' section of the config file", name)
+		}
+		dbPath = named
+	}
+	if strings.HasPrefix(dbPath, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error resolving home directory: %w", err)
+		}
+		dbPath = filepath.Join(home, dbPath[2:])
+	}
+	return dbPath, nil
+}
+
+// autoProjectPath is the --project-path value that resolves the project from the working directory.
+const autoProjectPath = "auto"
+
 func getAbsoluteProjectPath(viperKey string) (string, error) {
 	projectPath := viper.GetString(viperKey)
 	if projectPath == "" {
 		return "", fmt.Errorf("project-path is required (viper key: %s)", viperKey)
 	}
+	if projectPath == autoProjectPath {
+		return resolveAutoProjectPath()
+	}
 	absPath, err := filepath.Abs(projectPath)
 	if err != nil {
 		return "", fmt.Errorf("error resolving absolute path for '%s': %w", projectPath, err)
@@ -53,15 +403,58 @@ func getAbsoluteProjectPath(viperKey string) (string, error) {
 	return absPath, nil
 }
 
+// warnf writes a human-readable diagnostic to stderr, unless --quiet is set.
+func warnf(format string, args ...interface{}) {
+	if viper.GetBool("quiet") {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// warn reports a non-fatal issue: it is added to the "warnings" of the response, so that
+// it reaches GUI users, and written to stderr like warnf.
+func warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	responseWarnings = append(responseWarnings, msg)
+	warnf("Warning: %s\n", msg)
+}
+
+// warnIfNoMatch warns about a filter that selected none of the cached files, which is
+// usually a mistake in the filter rather than the intended result.
+func warnIfNoMatch(matched int) {
+	if matched == 0 {
+		warn("the filter matched 0 files")
+	}
+}
+
 // getFilter 是一个新的帮助函数，用于从 profile 或 JSON 字符串构建 Filter 对象
 // 它集中处理加载、解析和编译过滤规则的逻辑
-func getFilter(db *sql.DB, projectID int64, profileName, filterJSON string) (filter.Filter, error) {
+// A profile name of the form "selection:<name>" refers to a saved selection set instead of a profile.
+func getFilter(db database.Querier, projectID int64, profileName, filterJSON string) (filter.Filter, error) {
 	var f filter.Filter
 	var finalFilterJSON string
 
+	if filterJSON == "" && profileName == "" && !viper.GetBool("no-default-filter") {
+		// 未指定过滤条件时，使用项目的默认 profile（如果有）
+		if err := db.QueryRow("SELECT default_profile FROM projects WHERE id = ?", projectID).Scan(&profileName); err != nil && err != sql.ErrNoRows {
+			return f, fmt.Errorf("error loading default profile: %w", err)
+		}
+	}
+
 	if filterJSON != "" {
 		// 优先使用直接传入的 filter-json
 		finalFilterJSON = filterJSON
+	} else if strings.HasPrefix(profileName, selectionProfilePrefix) {
+		// 选择集：显式的文件列表，转换为精确匹配的 includePaths
+		paths, err := loadSelection(db, projectID, strings.TrimPrefix(profileName, selectionProfilePrefix))
+		if err != nil {
+			return f, err
+		}
+		f.IncludePaths = paths
+		if len(paths) == 0 {
+			// An empty selection must select nothing rather than everything.
+			f.IncludeRegex = []string{`^$`}
+		}
 	} else if profileName != "" {
 		// 其次，从 profile 加载
 		err := db.QueryRow("SELECT profile_data_json FROM profiles WHERE project_id = ? AND profile_name = ?", projectID, profileName).Scan(&finalFilterJSON)
@@ -74,11 +467,59 @@ func getFilter(db *sql.DB, projectID int64, profileName, filterJSON string) (fil
 	}
 
 	if finalFilterJSON != "" {
-		if err := json.Unmarshal([]byte(finalFilterJSON), &f); err != nil {
+		var err error
+		if f, err = unmarshalFilter(finalFilterJSON); err != nil {
 			return f, fmt.Errorf("error parsing filter JSON: %w", err)
 		}
 	}
+	if name := viper.GetString("package"); name != "" {
+		root, err := packageRoot(db, projectID, name)
+		if err != nil {
+			return f, err
+		}
+		f.Subtree = root
+	}
+	return compileFilter(f)
+}
+
+// packageRoot resolves the name or root of a package of a project, as listed by
+// 'analyze packages', to its root directory.
+func packageRoot(db database.Querier, projectID int64, name string) (string, error) {
+	var projectPath string
+	if err := db.QueryRow("SELECT project_path FROM projects WHERE id = ?", projectID).Scan(&projectPath); err != nil {
+		return "", fmt.Errorf("error loading project path: %w", err)
+	}
+	pkgs, err := projectPackages(db, projectID, projectPath)
+	if err != nil {
+		return "", err
+	}
+	pkg, err := packages.Lookup(pkgs, name)
+	if err != nil {
+		return "", fmt.Errorf("invalid --package: %w", err)
+	}
+	return pkg.Root, nil
+}
+
+// parseFilterJSON parses and compiles a filter given as JSON, without any database lookup.
+func parseFilterJSON(filterJSON string) (filter.Filter, error) {
+	f, err := unmarshalFilter(filterJSON)
+	if err != nil {
+		return f, fmt.Errorf("error parsing filter JSON: %w", err)
+	}
+	return compileFilter(f)
+}
+
+// unmarshalFilter decodes filter JSON, rejecting unknown keys with --strict-filter.
+func unmarshalFilter(filterJSON string) (filter.Filter, error) {
+	if viper.GetBool("strict-filter") {
+		return filter.ParseStrict([]byte(filterJSON))
+	}
+	var f filter.Filter
+	err := json.Unmarshal([]byte(filterJSON), &f)
+	return f, err
+}
 
+func compileFilter(f filter.Filter) (filter.Filter, error) {
 	// Set default priority if not specified
 	if f.Priority == "" {
 		f.Priority = "includes"
@@ -91,3 +532,320 @@ func getFilter(db *sql.DB, projectID int64, profileName, filterJSON string) (fil
 
 	return f, nil
 }
+
+// resolveAutoProjectPath finds the project containing the working directory: the nearest
+// registered project that is the directory itself or one of its ancestors, or else the
+// nearest ancestor containing a .git entry.
+func resolveAutoProjectPath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("error resolving working directory: %w", err)
+	}
+
+	registered := make(map[string]bool)
+	db, err := openDatabase()
+	if err != nil {
+		return "", fmt.Errorf("error initializing database: %w", err)
+	}
+	rows, err := db.Query("SELECT project_path FROM projects")
+	if err != nil {
+		database.Close(db)
+		return "", fmt.Errorf("error listing projects: %w", err)
+	}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			database.Close(db)
+			return "", fmt.Errorf("error scanning project row: %w", err)
+		}
+		registered[p] = true
+	}
+	rows.Close()
+	database.Close(db)
+
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if registered[dir] {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return "", fmt.Errorf("--project-path auto: no registered project or git repository found above '%s'", cwd)
+}
+
+// projectFilePath resolves a cached relative path against the project root. Paths stored in
+// the database or given in a filter are not trusted: absolute paths and paths with ".."
+// segments are rejected, so that a crafted cache cannot make a command read files outside
+// the project.
+func projectFilePath(absProjectPath, relPath string) (string, error) {
+	native := filepath.FromSlash(relPath)
+	if relPath == "" || filepath.IsAbs(native) || filepath.VolumeName(native) != "" || strings.HasPrefix(relPath, "/") || strings.HasPrefix(relPath, `\`) {
+		return "", fmt.Errorf("path '%s' is not relative to the project", relPath)
+	}
+	for _, segment := range strings.FieldsFunc(relPath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return "", fmt.Errorf("path '%s' leaves the project directory", relPath)
+		}
+	}
+	return filepath.Join(absProjectPath, native), nil
+}
+
+// basePathPrefix reads a --base-path flag and returns it as a slash-terminated prefix of
+// relative paths ("src/"), or "" for the project root.
+func basePathPrefix(viperKey string) (string, error) {
+	value := filepath.ToSlash(viper.GetString(viperKey))
+	p := path.Clean(value)
+	if p == "." {
+		return "", nil
+	}
+	if path.IsAbs(value) || filepath.IsAbs(value) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("--base-path '%s' must be a directory inside the project", value)
+	}
+	return p + "/", nil
+}
+
+// rebasePath strips a --base-path prefix from a relative path; ok is false for paths
+// outside the base path.
+func rebasePath(relPath, prefix string) (rebased string, ok bool) {
+	if prefix == "" {
+		return relPath, true
+	}
+	rest, ok := strings.CutPrefix(relPath, prefix)
+	return rest, ok && rest != ""
+}
+
+// contentReadOptions controls how readFileContents turns files into prompt text.
+type contentReadOptions struct {
+	// ExtractDocs returns the plain text of PDF, DOCX and ODT files; otherwise they are omitted.
+	ExtractDocs bool
+	// Transform is applied to every file read successfully.
+	Transform transform.Pipeline
+	// Handlers are the per-file rules of the 'content.handlers' config, applied before Transform.
+	Handlers transform.Handlers
+}
+
+// readFileContents reads the given project files concurrently with a bounded
+// worker pool. Results are collected by index, so the outcome does not depend
+// on the order in which the workers finish. Unreadable files get an error
+// message as their content instead of failing the whole batch. Jupyter
+// notebooks are converted to plain code and markdown. Files matched by one of
+// opts.Handlers are skipped, replaced by a placeholder, extracted or truncated
+// as it says.
+func readFileContents(absProjectPath string, relativePaths []string, opts contentReadOptions) map[string]string {
+	contents := make([]string, len(relativePaths))
+	omitted := make([]bool, len(relativePaths))
+	failed := make([]bool, len(relativePaths))
+	p := pool.New().WithMaxGoroutines(runtime.NumCPU())
+	for i, relPath := range relativePaths {
+		p.Go(func() {
+			ext := path.Ext(relPath)
+			handler, _ := opts.Handlers.For(relPath)
+			extract := opts.ExtractDocs || handler.Action == transform.HandlerExtract
+			if handler.Action == transform.HandlerSkip || (docextract.IsDocument(ext) && !extract) {
+				omitted[i] = true
+				return
+			}
+			fullPath, err := projectFilePath(absProjectPath, relPath)
+			if err != nil {
+				contents[i] = fmt.Sprintf("Error: Unable to read file. %v", err)
+				failed[i] = true
+				return
+			}
+			if handler.Action == transform.HandlerPlaceholder {
+				// The size is all a placeholder needs, so the file is not read.
+				info, err := os.Stat(fullPath)
+				if err != nil {
+					contents[i] = fmt.Sprintf("Error: Unable to read file. %v", err)
+					failed[i] = true
+					return
+				}
+				contents[i] = opts.Transform.Apply(relPath, transform.Placeholder(relPath, info.Size()))
+				return
+			}
+			content, err := os.ReadFile(fullPath)
+			if err != nil {
+				contents[i] = fmt.Sprintf("Error: Unable to read file. %v", err)
+				failed[i] = true
+				return
+			}
+			contents[i] = string(content)
+			switch {
+			case docextract.IsDocument(ext):
+				text, err := docextract.ExtractText(ext, content)
+				if err != nil {
+					contents[i] = fmt.Sprintf("Error: Unable to extract document text. %v", err)
+					failed[i] = true
+					return
+				}
+				contents[i] = text
+			case strings.TrimPrefix(ext, ".") == notebook.Extension:
+				// Notebooks are reduced to their code and markdown; unparsable ones are returned as is.
+				if text, err := notebook.ToText(content); err == nil {
+					contents[i] = text
+				}
+			}
+			contents[i] = opts.Transform.Apply(relPath, handler.Apply(relPath, contents[i]))
+		})
+	}
+	p.Wait()
+	if n := countTrue(failed); n > 0 {
+		warn("%d files unreadable; their content is an error message", n)
+	}
+
+	contentMap := make(map[string]string, len(relativePaths))
+	for i, relPath := range relativePaths {
+		if !omitted[i] {
+			contentMap[relPath] = contents[i]
+		}
+	}
+	return contentMap
+}
+
+func countTrue(values []bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// transformFlags are the flags registered by addTransformFlags.
+var transformFlags = []string{"strip-comments", "redact-secrets", "max-file-tokens", "truncate", "fence"}
+
+// addTransformFlags registers the flags that set the content transform of a command.
+func addTransformFlags(cmd *cobra.Command, prefix string) {
+	cmd.Flags().Bool("strip-comments", false, "Remove comments from the file contents")
+	cmd.Flags().Bool("redact-secrets", false, "Replace likely secrets (private keys, tokens, passwords) with "+transform.RedactedMarker)
+	cmd.Flags().Int64("max-file-tokens", 0, "Truncate files estimated above N tokens, marking the cut (0 disables)")
+	cmd.Flags().String("truncate", transform.TruncateHead, "Part of a truncated file to keep: head, tail or middle (first and last lines)")
+	cmd.Flags().Bool("fence", false, "Wrap every file in a Markdown code fence tagged with its language")
+	for _, name := range transformFlags {
+		viper.BindPFlag(prefix+"."+name, cmd.Flags().Lookup(name))
+	}
+}
+
+// transformOverride returns the transform options set with the flags of addTransformFlags,
+// or nil if none of them is set. Flags replace the "transform" of the filter as a whole.
+func transformOverride(prefix string) (*transform.Options, error) {
+	set := false
+	for _, name := range transformFlags {
+		set = set || viper.IsSet(prefix+"."+name)
+	}
+	if !set {
+		return nil, nil
+	}
+	opts := &transform.Options{
+		StripComments: viper.GetBool(prefix + ".strip-comments"),
+		RedactSecrets: viper.GetBool(prefix + ".redact-secrets"),
+		MaxFileTokens: viper.GetInt64(prefix + ".max-file-tokens"),
+		Truncate:      viper.GetString(prefix + ".truncate"),
+		Fence:         viper.GetBool(prefix + ".fence"),
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// transformPipeline returns the content transform of a filter.
+func transformPipeline(f filter.Filter) transform.Pipeline {
+	if f.Transform == nil {
+		return nil
+	}
+	return transform.New(*f.Transform)
+}
+
+// contentHandlers returns the handlers of the 'content.handlers' config, which map file
+// name suffixes or names to what the content commands do with those files.
+func contentHandlers() (transform.Handlers, error) {
+	handlers, err := transform.ParseHandlers(viper.GetStringMapString("content.handlers"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content.handlers config: %w", err)
+	}
+	return handlers, nil
+}
+
+// shellCommand runs a user-supplied command line through the platform shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// oldCacheWarning is the age from which the cache is reported as old when --auto-refresh is off.
+const oldCacheWarning = 7 * 24 * time.Hour
+
+// refreshCacheIfStale implements the global --auto-refresh flag. When the last scan of
+// the project is older than --auto-refresh-after (or it was never scanned), it either
+// runs an incremental scan ("incremental") or only warns on stderr ("check"). In any case
+// it records the scan timestamp in the response meta, and warns about a cache older than
+// oldCacheWarning.
+func refreshCacheIfStale(db *sql.DB, projectID int64, absProjectPath string) error {
+	var lastScan string
+	if err := db.QueryRow("SELECT last_scan_timestamp FROM projects WHERE id = ?", projectID).Scan(&lastScan); err != nil {
+		return fmt.Errorf("error reading last scan timestamp: %w", err)
+	}
+	responseMeta.ScanTimestamp = lastScan
+
+	mode := viper.GetString("auto-refresh")
+	if mode == "" || mode == "off" {
+		if scannedAt, err := time.Parse(time.RFC3339, lastScan); err == nil && time.Since(scannedAt) > oldCacheWarning {
+			warn("cache is %d days old; run 'cache update --incremental' or use --auto-refresh", int(time.Since(scannedAt)/(24*time.Hour)))
+		}
+		return nil
+	}
+	if mode != "incremental" && mode != "check" {
+		return fmt.Errorf("invalid --auto-refresh mode '%s' (expected incremental or check)", mode)
+	}
+	age := time.Duration(-1)
+	if scannedAt, err := time.Parse(time.RFC3339, lastScan); err == nil {
+		age = time.Since(scannedAt)
+	}
+	if age >= 0 && age < viper.GetDuration("auto-refresh-after") {
+		return nil
+	}
+
+	// A read-only database cannot be rescanned, so a stale cache is only reported.
+	if mode == "check" || viper.GetBool("read-only") {
+		if age < 0 {
+			warn("project '%s' has not been scanned yet; run 'cache update'", absProjectPath)
+		} else {
+			warn("cache for project '%s' is %s old; run 'cache update --incremental'", absProjectPath, age.Round(time.Second))
+		}
+		return nil
+	}
+	release, err := lockProjectForScan(db, projectID)
+	if err != nil {
+		return fmt.Errorf("error refreshing stale cache: %w", err)
+	}
+	defer release()
+	scanOpts := scanOptionsFromConfig()
+	roots, err := loadScanRoots(db, projectID)
+	if err != nil {
+		return err
+	}
+	scanOpts.Roots = roots
+	if err := resolveHashAlgorithm(db, projectID, &scanOpts); err != nil {
+		return fmt.Errorf("error refreshing stale cache: %w", err)
+	}
+	if _, err := incrementalScan(db, projectID, absProjectPath, scanOpts, viper.GetInt("cache.update.batch-size")); err != nil {
+		return fmt.Errorf("error refreshing stale cache: %w", err)
+	}
+	if err := db.QueryRow("SELECT last_scan_timestamp FROM projects WHERE id = ?", projectID).Scan(&responseMeta.ScanTimestamp); err != nil {
+		return fmt.Errorf("error reading last scan timestamp: %w", err)
+	}
+	return nil
+}
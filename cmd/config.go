@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"bytes"
 	"code-prompt-core/pkg/database"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -12,27 +14,89 @@ import (
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage generic key-value configurations stored in the database",
-	Long:  "This command allows setting and getting arbitrary key-value pairs, useful for storing GUI settings or other metadata.",
+	Long: `This command allows setting and getting arbitrary key-value pairs, useful for storing GUI settings or other metadata.
+
+Values are global by default. With '--project-path', they are stored in the namespace of that project instead
+and are deleted together with the project. Values saved with '--json' are validated as JSON and returned as structured JSON.`,
+}
+
+// configEntry is a stored configuration value. Value is a string, or the decoded JSON for values saved with --json.
+type configEntry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// configScope resolves the optional --project-path of a config command into the table and
+// WHERE clause holding its values. Without a project path, the global kv_store is used.
+func configScope(db *sql.DB, viperKey string) (table, where string, params []interface{}, err error) {
+	if viper.GetString(viperKey) == "" {
+		return "kv_store", "1 = 1", nil, nil
+	}
+	absProjectPath, err := getAbsoluteProjectPath(viperKey)
+	if err != nil {
+		return "", "", nil, err
+	}
+	projectID, err := database.For(db).ProjectID(absProjectPath)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("error finding project '%s': %w", absProjectPath, err)
+	}
+	return "project_kv_store", "project_id = ?", []interface{}{projectID}, nil
+}
+
+func decodeConfigValue(value string, isJSON bool) (interface{}, error) {
+	if !isJSON {
+		return value, nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
 }
 
 var configSetCmd = &cobra.Command{
-	Use:   "set",
-	Short: "Sets a value for a given key",
+	Use:         "set",
+	Annotations: mutatingCommand,
+	Short:       "Sets a value for a given key",
+	Long: `Sets a value for a given key, replacing any previous value.
+
+Example:
+  code-prompt-core config set --key theme --value dark
+  code-prompt-core config set --project-path /p/proj --key gui.layout --json --value '{"sidebar":true,"width":320}'`,
 	Run: func(cmd *cobra.Command, args []string) {
 		key := viper.GetString("config.set.key")
 		value := viper.GetString("config.set.value")
+		isJSON := viper.GetBool("config.set.json")
 		if key == "" {
 			printError(fmt.Errorf("--key is required"))
 			return
 		}
-		db, err := database.InitializeDB(viper.GetString("db"))
+		if isJSON {
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, []byte(value)); err != nil {
+				printError(fmt.Errorf("--value is not valid JSON: %w", err))
+				return
+			}
+			value = compacted.String()
+		}
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		upsertSQL := `INSERT INTO kv_store (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value;`
-		_, err = db.Exec(upsertSQL, key, value)
+		defer database.Close(db)
+		table, _, params, err := configScope(db, "config.set.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		var upsertSQL string
+		if table == "kv_store" {
+			upsertSQL = `INSERT INTO kv_store (key, value, is_json) VALUES (?, ?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value, is_json = excluded.is_json;`
+		} else {
+			upsertSQL = `INSERT INTO project_kv_store (project_id, key, value, is_json) VALUES (?, ?, ?, ?) ON CONFLICT(project_id, key) DO UPDATE SET value = excluded.value, is_json = excluded.is_json;`
+		}
+		_, err = db.Exec(upsertSQL, append(params, key, value, isJSON)...)
 		if err != nil {
 			printError(fmt.Errorf("error setting config for key '%s': %w", key, err))
 			return
@@ -50,14 +114,21 @@ var configGetCmd = &cobra.Command{
 			printError(fmt.Errorf("--key is required"))
 			return
 		}
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
+		defer database.Close(db)
+		table, where, params, err := configScope(db, "config.get.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
 		var value string
-		err = db.QueryRow("SELECT value FROM kv_store WHERE key = ?", key).Scan(&value)
+		var isJSON bool
+		query := fmt.Sprintf("SELECT value, is_json FROM %s WHERE %s AND key = ?", table, where)
+		err = db.QueryRow(query, append(params, key)...).Scan(&value, &isJSON)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				printError(fmt.Errorf("no config value found for key: %s", key))
@@ -66,7 +137,96 @@ var configGetCmd = &cobra.Command{
 			}
 			return
 		}
-		printJSON(value)
+		decoded, err := decodeConfigValue(value, isJSON)
+		if err != nil {
+			printError(fmt.Errorf("config value for key '%s' is corrupted: %w", key, err))
+			return
+		}
+		printJSON(decoded)
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all keys and values",
+	Long: `Lists the global values, or the values of a project with '--project-path', sorted by key.
+Use '--prefix' to only list keys starting with a given string.
+
+Example:
+  code-prompt-core config list --project-path /p/proj --prefix gui.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		table, where, params, err := configScope(db, "config.list.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		query := fmt.Sprintf("SELECT key, value, is_json FROM %s WHERE %s", table, where)
+		if prefix := viper.GetString("config.list.prefix"); prefix != "" {
+			query += " AND substr(key, 1, ?) = ?"
+			params = append(params, len(prefix), prefix)
+		}
+		rows, err := db.Query(query+" ORDER BY key", params...)
+		if err != nil {
+			printError(fmt.Errorf("error listing config: %w", err))
+			return
+		}
+		defer rows.Close()
+		entries := []configEntry{}
+		for rows.Next() {
+			var key, value string
+			var isJSON bool
+			if err := rows.Scan(&key, &value, &isJSON); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			decoded, err := decodeConfigValue(value, isJSON)
+			if err != nil {
+				printError(fmt.Errorf("config value for key '%s' is corrupted: %w", key, err))
+				return
+			}
+			entries = append(entries, configEntry{Key: key, Value: decoded})
+		}
+		printJSON(entries)
+	},
+}
+
+var configDeleteCmd = &cobra.Command{
+	Use:         "delete",
+	Annotations: mutatingCommand,
+	Short:       "Deletes a key",
+	Run: func(cmd *cobra.Command, args []string) {
+		key := viper.GetString("config.delete.key")
+		if key == "" {
+			printError(fmt.Errorf("--key is required"))
+			return
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		table, where, params, err := configScope(db, "config.delete.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		result, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s AND key = ?", table, where), append(params, key)...)
+		if err != nil {
+			printError(fmt.Errorf("error deleting config for key '%s': %w", key, err))
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			printError(fmt.Errorf("no config value found for key: %s", key))
+			return
+		}
+		printJSON(fmt.Sprintf("Config for key '%s' was deleted.", key))
 	},
 }
 
@@ -76,10 +236,28 @@ func init() {
 	configCmd.AddCommand(configSetCmd)
 	configSetCmd.Flags().String("key", "", "The configuration key")
 	configSetCmd.Flags().String("value", "", "The configuration value to set")
+	configSetCmd.Flags().Bool("json", false, "Validate the value as JSON and store it as structured data")
+	configSetCmd.Flags().String("project-path", "", "Store the value in the namespace of this project")
 	viper.BindPFlag("config.set.key", configSetCmd.Flags().Lookup("key"))
 	viper.BindPFlag("config.set.value", configSetCmd.Flags().Lookup("value"))
+	viper.BindPFlag("config.set.json", configSetCmd.Flags().Lookup("json"))
+	viper.BindPFlag("config.set.project-path", configSetCmd.Flags().Lookup("project-path"))
 
 	configCmd.AddCommand(configGetCmd)
 	configGetCmd.Flags().String("key", "", "The configuration key to get")
+	configGetCmd.Flags().String("project-path", "", "Read the value from the namespace of this project")
 	viper.BindPFlag("config.get.key", configGetCmd.Flags().Lookup("key"))
+	viper.BindPFlag("config.get.project-path", configGetCmd.Flags().Lookup("project-path"))
+
+	configCmd.AddCommand(configListCmd)
+	configListCmd.Flags().String("project-path", "", "List the values of this project instead of the global ones")
+	configListCmd.Flags().String("prefix", "", "Only list keys starting with this prefix")
+	viper.BindPFlag("config.list.project-path", configListCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("config.list.prefix", configListCmd.Flags().Lookup("prefix"))
+
+	configCmd.AddCommand(configDeleteCmd)
+	configDeleteCmd.Flags().String("key", "", "The configuration key to delete")
+	configDeleteCmd.Flags().String("project-path", "", "Delete the value from the namespace of this project")
+	viper.BindPFlag("config.delete.key", configDeleteCmd.Flags().Lookup("key"))
+	viper.BindPFlag("config.delete.project-path", configDeleteCmd.Flags().Lookup("project-path"))
 }
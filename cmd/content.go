@@ -2,13 +2,30 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"code-prompt-core/pkg/chunker"
 	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/docextract"
 	"code-prompt-core/pkg/filter"
+	"code-prompt-core/pkg/imageinfo"
+	"code-prompt-core/pkg/sample"
+	"code-prompt-core/pkg/tokens"
+	"code-prompt-core/pkg/transform"
 
+	"github.com/sourcegraph/conc/pool"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -16,6 +33,26 @@ import (
 var contentCmd = &cobra.Command{
 	Use:   "content",
 	Short: "Retrieve file contents",
+	Long: `The "content" command group returns the contents of the filtered files of a project.
+
+With '--output result.json' a command writes its result to that file instead of stdout and prints only
+{"output": "<absolute path>", "bytes": N}. Large results then do not have to pass through a pipe; the file is
+written under a temporary name and renamed into place, so it never holds a partial result.`,
+}
+
+// Reasons for which 'content get' leaves a file out.
+const (
+	skippedBinary   = "binary"
+	skippedDocument = "document"
+	skippedTooLarge = "too_large"
+	skippedHandler  = "handler"
+)
+
+// skippedFile is a file matched by the filter whose content 'content get' did not return.
+type skippedFile struct {
+	RelativePath string `json:"relative_path"`
+	Reason       string `json:"reason"`
+	SizeBytes    int64  `json:"size_bytes"`
 }
 
 var contentGetCmd = &cobra.Command{
@@ -26,10 +63,46 @@ var contentGetCmd = &cobra.Command{
 You can filter the files using either a saved profile via '--profile-name'
 or a temporary filter via '--filter-json'. This command reads the
 file contents from disk based on the file paths retrieved from the cache.
+Jupyter notebooks (.ipynb) are returned as their markdown and code cells only; outputs are dropped.
+PDF, DOCX and ODT documents are skipped unless '--extract-docs' is set, in which case their plain text is returned.
+Binary images (cached with 'cache update --include-binary') are returned as placeholder objects
+{"path", "mime_type", "width", "height", "size"}; images up to '--image-base64-max-bytes' also carry a "base64" field.
+
+The response has the contents keyed by relative path in "files", and the matched files that were left
+out in "skipped", each with its "reason":
+  "binary"     the file is not text (override with '--include-binary')
+  "document"   a PDF, DOCX or ODT document without '--extract-docs'
+  "too_large"  the file is larger than '--max-file-bytes' (default 1 MiB, 0 for no limit)
+  "handler"    a "skip" handler of the content.handlers config matches the file
+
+'--base-path src/' limits the result to the files under src/ and makes their paths relative to it, which
+saves the repeated prefix when a prompt is about a single package of a monorepo.
+
+File contents go through the content transform, in this order: '--strip-comments', '--redact-secrets',
+'--max-file-tokens N' and '--fence' (wraps each file in a Markdown code fence). Files estimated above N tokens are
+cut to whole lines with a "[... truncated 1,234 lines ...]" marker where lines were removed; '--truncate' keeps their
+head (default), their tail or their first and last lines (middle), and the marker counts towards N. Profiles can set the same steps in their "transform" field, e.g.
+{"includeExts":["go"],"transform":{"stripComments":true,"redactSecrets":true,"maxFileTokens":4000,"truncate":"middle","fence":true}};
+giving any of these flags replaces the profile's transform.
+
+The content.handlers config encodes per-file policy once for 'content get' and reports. It maps a file name
+suffix (".lock", ".min.js") or a whole file name ("package-lock.json") to an action; the longest match wins:
+  skip          leave the file out (reported as skipped with reason "handler")
+  placeholder   replace the content with a line like "[logo.svg: 12 kB, content omitted]" without reading it
+  extract       return the text of documents even without '--extract-docs'
+  truncate N    keep the first lines that fit into N tokens, before the content transform
+For example, in the config file:
+  content:
+    handlers:
+      .lock: skip
+      .svg: placeholder
+      .ipynb: extract
+      .min.js: truncate 50
 
 Example:
   code-prompt-core content get --project-path /p/proj --filter-json '{"includeExts":[".go"]}'
   code-prompt-core content get --project-path /p/proj --profile-name "go-source"
+  code-prompt-core content get --project-path /p/proj --filter-json '{"includePaths":["docs/"]}' --extract-docs
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		projectPath, err := getAbsoluteProjectPath("content.get.project-path")
@@ -38,22 +111,27 @@ Example:
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", projectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project: %w", err))
 			return
 		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
 
 		// *** 修改：使用 getFilter 帮助函数 ***
 		f, err := getFilter(
-			db,
+			tx,
 			projectID,
 			viper.GetString("content.get.profile-name"),
 			viper.GetString("content.get.filter-json"),
@@ -62,37 +140,631 @@ Example:
 			printError(err)
 			return
 		}
+		override, err := transformOverride("content.get")
+		if err != nil {
+			printError(err)
+			return
+		}
+		if override != nil {
+			f.Transform = override
+		}
+
+		basePath, err := basePathPrefix("content.get.base-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		extractDocs := viper.GetBool("content.get.extract-docs")
+		includeBinary := viper.GetBool("content.get.include-binary")
+		maxFileBytes := viper.GetInt64("content.get.max-file-bytes")
+		handlers, err := contentHandlers()
+		if err != nil {
+			printError(err)
+			return
+		}
+		var imagePaths, textPaths []string
+		skipped := []skippedFile{}
+		err = filter.IterateFilteredFiles(tx, projectID, f, func(m filter.FileMetadata) error {
+			if _, ok := rebasePath(m.RelativePath, basePath); !ok {
+				return nil
+			}
+			ext := path.Ext(m.RelativePath)
+			handler, _ := handlers.For(m.RelativePath)
+			reason := ""
+			switch {
+			case handler.Action == transform.HandlerSkip:
+				reason = skippedHandler
+			case handler.Action == transform.HandlerPlaceholder:
+				// Placeholders are not read, so neither the type nor the size of the file matters.
+			case imageinfo.IsImage(ext):
+				imagePaths = append(imagePaths, m.RelativePath)
+				return nil
+			case docextract.IsDocument(ext):
+				if !extractDocs && handler.Action != transform.HandlerExtract {
+					reason = skippedDocument
+				}
+			case !m.IsText && !includeBinary:
+				reason = skippedBinary
+			}
+			if reason == "" && handler.Action != transform.HandlerPlaceholder && maxFileBytes > 0 && m.SizeBytes > maxFileBytes {
+				reason = skippedTooLarge
+			}
+			if reason != "" {
+				skipped = append(skipped, skippedFile{RelativePath: m.RelativePath, Reason: reason, SizeBytes: m.SizeBytes})
+				return nil
+			}
+			textPaths = append(textPaths, m.RelativePath)
+			return nil
+		})
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		contentMap := make(map[string]interface{}, len(textPaths)+len(imagePaths))
+		for p, content := range readFileContents(projectPath, textPaths, contentReadOptions{
+			ExtractDocs: extractDocs,
+			Transform:   transformPipeline(f),
+			Handlers:    handlers,
+		}) {
+			rebased, _ := rebasePath(p, basePath)
+			contentMap[rebased] = content
+		}
+		for _, p := range imagePaths {
+			rebased, _ := rebasePath(p, basePath)
+			contentMap[rebased] = describeImage(projectPath, p, viper.GetInt64("content.get.image-base64-max-bytes"))
+		}
+		for i := range skipped {
+			skipped[i].RelativePath, _ = rebasePath(skipped[i].RelativePath, basePath)
+			if skipped[i].Reason == skippedTooLarge {
+				markTruncated()
+			}
+		}
+		setResultCount(len(contentMap))
+		warnIfNoMatch(len(textPaths) + len(imagePaths) + len(skipped))
+		printJSON(map[string]interface{}{
+			"files":   contentMap,
+			"skipped": skipped,
+		})
+	},
+}
+
+var contentSampleCmd = &cobra.Command{
+	Use:   "sample",
+	Short: "Returns representative excerpts of the filtered files within a token budget",
+	Long: `Like 'content get', but the result is guaranteed to fit into '--max-tokens' (estimated at ` + fmt.Sprint(tokens.BytesPerToken) + ` bytes per token).
+If all filtered files fit, they are returned whole. Otherwise they are sampled with '--strategy':
+- head:       every file is reduced to its first lines; small files are kept whole and the rest
+              of the budget is shared equally by the larger ones.
+- stratified: the budget is shared equally by the directories, then by the files of each directory,
+              and every file is reduced to evenly spaced chunks (start, middle, end) separated by "` + strings.TrimSpace(sample.ChunkSeparator) + `".
+When the budget cannot give every file at least ` + fmt.Sprint(sample.MinExcerptTokens) + ` tokens, an evenly spread subset of the files
+(or, for stratified, of the directories) is sampled and the others are listed in "omitted".
+Images and documents are not sampled.
+
+Example:
+  code-prompt-core content sample --project-path /p/proj --max-tokens 8000
+  code-prompt-core content sample --project-path /p/proj --profile-name "go-source" --strategy stratified --max-tokens 20000
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("content.sample.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		maxTokens := viper.GetInt64("content.sample.max-tokens")
+		if maxTokens <= 0 {
+			printError(fmt.Errorf("--max-tokens must be a positive number"))
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(
+			tx,
+			projectID,
+			viper.GetString("content.sample.profile-name"),
+			viper.GetString("content.sample.filter-json"),
+		)
+		if err != nil {
+			printError(err)
+			return
+		}
+		relativePaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		var textPaths []string
+		for _, p := range relativePaths {
+			if !imageinfo.IsImage(path.Ext(p)) {
+				textPaths = append(textPaths, p)
+			}
+		}
+		var files []sample.File
+		var totalTokens int64
+		for p, content := range readFileContents(projectPath, textPaths, contentReadOptions{}) {
+			files = append(files, sample.File{Path: p, Content: content})
+			totalTokens += tokens.Estimate(content)
+		}
+
+		strategy := viper.GetString("content.sample.strategy")
+		result, err := sample.Sample(files, strategy, maxTokens)
+		if err != nil {
+			printError(err)
+			return
+		}
+		var sampledTokens int64
+		for _, excerpt := range result.Excerpts {
+			sampledTokens += excerpt.Tokens
+		}
+		setResultCount(len(result.Excerpts))
+		if totalTokens > maxTokens {
+			markTruncated()
+		}
+		printJSON(map[string]interface{}{
+			"strategy":      strategy,
+			"maxTokens":     maxTokens,
+			"totalTokens":   totalTokens,
+			"sampledTokens": sampledTokens,
+			"sampled":       totalTokens > maxTokens,
+			"files":         result.Excerpts,
+			"omitted":       result.Omitted,
+		})
+	},
+}
+
+var contentSummarizeCmd = &cobra.Command{
+	Use:         "summarize",
+	Annotations: mutatingCommand,
+	Short:       "Summarizes the filtered files with an external command and caches the results",
+	Long: `Pipes the content of every filtered file into '--command' and returns the command's output as the file's summary.
+The command line is run through the shell ('sh -c', or 'cmd /C' on Windows), once per file, with the file
+content on stdin and the relative path in the CODE_PROMPT_CORE_FILE environment variable.
+
+Summaries are cached in the database by the file's content hash and the command line, so unchanged files
+are never summarized twice, even across projects. Use '--refresh' to regenerate cached summaries.
+The content hash comes from the cache: run 'cache update' (or use --auto-refresh) after editing files.
+Files whose command fails or exceeds '--timeout' are reported with an "error" and are not cached.
+Images and documents are skipped.
+
+Example:
+  code-prompt-core content summarize --project-path /p/proj --profile-name "go-source" --command "llm -s 'Summarize this file in 3 sentences'"
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("content.summarize.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		command := viper.GetString("content.summarize.command")
+		if strings.TrimSpace(command) == "" {
+			printError(fmt.Errorf("--command is required"))
+			return
+		}
+		jobs := viper.GetInt("content.summarize.jobs")
+		if jobs < 1 {
+			jobs = 1
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(
+			tx,
+			projectID,
+			viper.GetString("content.summarize.profile-name"),
+			viper.GetString("content.summarize.filter-json"),
+		)
+		if err != nil {
+			printError(err)
+			return
+		}
+		relativePaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
+		if err != nil {
+			printError(fmt.Errorf("error applying filters: %w", err))
+			return
+		}
+		hashes, err := contentHashes(tx, projectID)
+		if err != nil {
+			printError(err)
+			return
+		}
 
-		relativePaths, err := filter.GetFilteredFilePaths(db, projectID, f)
+		var textPaths []string
+		for _, p := range relativePaths {
+			if !imageinfo.IsImage(path.Ext(p)) {
+				textPaths = append(textPaths, p)
+			}
+		}
+		contents := readFileContents(projectPath, textPaths, contentReadOptions{})
+		refresh := viper.GetBool("content.summarize.refresh")
+		timeout := viper.GetDuration("content.summarize.timeout")
+
+		type summaryResult struct {
+			Summary string `json:"summary,omitempty"`
+			Cached  bool   `json:"cached"`
+			Error   string `json:"error,omitempty"`
+			// key is the content key the summary is cached under.
+			key string
+		}
+		results := make(map[string]summaryResult, len(contents))
+		var generated, cached, failed int
+		// Cache hits are collected before any summarizer starts, so that the workers are the
+		// only writers of results and an error here leaves none running.
+		type pendingFile struct{ key, content string }
+		pending := make(map[string]pendingFile, len(contents))
+		for relPath, content := range contents {
+			hash := contentKey(hashes[relPath], content)
+			if !refresh {
+				var summary string
+				err := db.QueryRow("SELECT summary FROM summaries WHERE content_hash = ? AND command = ?", hash, command).Scan(&summary)
+				if err == nil {
+					results[relPath] = summaryResult{Summary: summary, Cached: true}
+					cached++
+					continue
+				}
+				if err != sql.ErrNoRows {
+					printError(fmt.Errorf("error reading summary cache: %w", err))
+					return
+				}
+			}
+			pending[relPath] = pendingFile{key: hash, content: content}
+		}
+
+		var mu sync.Mutex
+		p := pool.New().WithMaxGoroutines(jobs)
+		for relPath, file := range pending {
+			p.Go(func() {
+				summary, err := runSummarizer(command, relPath, file.content, timeout)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					results[relPath] = summaryResult{Error: err.Error()}
+					failed++
+					return
+				}
+				results[relPath] = summaryResult{Summary: summary, key: file.key}
+				generated++
+			})
+		}
+		p.Wait()
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		for relPath, result := range results {
+			if result.Cached || result.Error != "" {
+				continue
+			}
+			if _, err := db.Exec("INSERT OR REPLACE INTO summaries (content_hash, command, summary, created_at) VALUES (?, ?, ?, ?)",
+				result.key, command, result.Summary, now); err != nil {
+				printError(fmt.Errorf("error caching summary of '%s': %w", relPath, err))
+				return
+			}
+		}
+		setResultCount(len(results))
+		printJSON(map[string]interface{}{
+			"command":   command,
+			"files":     results,
+			"generated": generated,
+			"cached":    cached,
+			"failed":    failed,
+		})
+	},
+}
+
+var contentChunksCmd = &cobra.Command{
+	Use:   "chunks",
+	Short: "Splits the filtered files into addressable chunks, emitted as NDJSON",
+	Long: `Splits every filtered text file into chunks of whole lines for ingestion into retrieval (RAG) systems.
+Chunks hold at most '--chunk-tokens' tokens (a single longer line forms its own chunk), and consecutive chunks
+of a file share up to '--overlap' tokens of lines. Boundaries depend only on the file content, so unchanged
+files always yield the same chunks.
+
+Unlike other commands, the output is newline-delimited JSON: one object per chunk, files in path order:
+  {"id":"src/a.go:1-40","path":"src/a.go","startLine":1,"endLine":40,"tokens":498,"hash":"<sha256 of content>","content":"..."}
+Errors before the first chunk are reported with the usual JSON error response.
+Images and documents are skipped.
+
+Example:
+  code-prompt-core content chunks --project-path /p/proj --profile-name "go-source" --chunk-tokens 512 --overlap 64 > chunks.ndjson
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("content.chunks.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		chunkTokens := viper.GetInt64("content.chunks.chunk-tokens")
+		overlap := viper.GetInt64("content.chunks.overlap")
+		if chunkTokens <= 0 || overlap < 0 || overlap >= chunkTokens {
+			printError(fmt.Errorf("--chunk-tokens must be positive and --overlap must be between 0 and --chunk-tokens"))
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project: %w", err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, projectPath); err != nil {
+			printError(err)
+			return
+		}
+		tx := beginRead(db)
+		defer tx.Rollback()
+		f, err := getFilter(
+			tx,
+			projectID,
+			viper.GetString("content.chunks.profile-name"),
+			viper.GetString("content.chunks.filter-json"),
+		)
+		if err != nil {
+			printError(err)
+			return
+		}
+		relativePaths, err := filter.GetFilteredFilePaths(tx, projectID, f)
 		if err != nil {
 			printError(fmt.Errorf("error applying filters: %w", err))
 			return
 		}
-		contentMap := make(map[string]string)
-		for _, relPath := range relativePaths {
-			// *** 修改：使用 projectPath (abs) ***
-			fullPath := filepath.Join(projectPath, filepath.Clean(relPath))
-			content, err := os.ReadFile(fullPath)
+		var textPaths []string
+		for _, p := range relativePaths {
+			if !imageinfo.IsImage(path.Ext(p)) {
+				textPaths = append(textPaths, p)
+			}
+		}
+		sort.Strings(textPaths)
+
+		type chunkRecord struct {
+			ID   string `json:"id"`
+			Path string `json:"path"`
+			chunker.Chunk
+		}
+		stdout := &countingWriter{w: os.Stdout}
+		var dest io.Writer = stdout
+		if responseOutput != "" {
+			file, err := createAtomic(responseOutput)
 			if err != nil {
-				contentMap[relPath] = fmt.Sprintf("Error: Unable to read file. %v", err)
-			} else {
-				contentMap[relPath] = string(content)
+				printError(fmt.Errorf("error writing output file: %w", err))
+				return
+			}
+			defer file.Abort()
+			dest = file
+		}
+		out := bufio.NewWriter(dest)
+		encoder := json.NewEncoder(out)
+		// fail reports a write error with the usual JSON error response, unless chunks already
+		// reached stdout, where it would end up in the middle of the NDJSON. Either way the
+		// command fails with a non-zero exit status.
+		fail := func(err error) {
+			err = fmt.Errorf("error writing chunk: %w", err)
+			if file, ok := dest.(*atomicFile); ok {
+				file.Abort()
+			}
+			if stdout.n == 0 || inBatch {
+				printError(err)
+				return
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			commandFailed = true
+			runShutdownHooks()
+			os.Exit(1)
+		}
+		// Files are read in small groups so that memory stays bounded on large projects.
+		const group = 64
+		for start := 0; start < len(textPaths); start += group {
+			end := start + group
+			if end > len(textPaths) {
+				end = len(textPaths)
+			}
+			contents := readFileContents(projectPath, textPaths[start:end], contentReadOptions{})
+			for _, relPath := range textPaths[start:end] {
+				content, ok := contents[relPath]
+				if !ok {
+					continue
+				}
+				for _, chunk := range chunker.Split(content, chunkTokens, overlap) {
+					id := fmt.Sprintf("%s:%d-%d", relPath, chunk.StartLine, chunk.EndLine)
+					if err := encoder.Encode(chunkRecord{ID: id, Path: relPath, Chunk: chunk}); err != nil {
+						fail(err)
+						return
+					}
+				}
 			}
 		}
-		printJSON(contentMap)
+		if err := out.Flush(); err != nil {
+			fail(err)
+			return
+		}
+		if file, ok := dest.(*atomicFile); ok {
+			size, _ := file.Seek(0, io.SeekCurrent)
+			if err := file.Commit(); err != nil {
+				printError(fmt.Errorf("error writing output file: %w", err))
+				return
+			}
+			responseBytes += size
+			printOutputFile(file.path, size)
+		}
 	},
 }
 
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// contentHashes returns the cached content hash of every file of a project.
+func contentHashes(db database.Querier, projectID int64) (map[string]string, error) {
+	rows, err := db.Query("SELECT relative_path, content_hash FROM file_metadata WHERE project_id = ?", projectID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying content hashes: %w", err)
+	}
+	defer rows.Close()
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var relPath, hash string
+		if err := rows.Scan(&relPath, &hash); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		hashes[relPath] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// contentKey returns the key under which results derived from a file's content are cached:
+// its content hash, or the SHA-256 of the content if the project is scanned with --hash none.
+func contentKey(hash, content string) string {
+	if hash != "" {
+		return hash
+	}
+	return sha256Hex(content)
+}
+
+// runSummarizer pipes content into the summarize command and returns its trimmed output.
+func runSummarizer(command, relPath, content string, timeout time.Duration) (string, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	c := shellCommand(ctx, command)
+	c.Stdin = strings.NewReader(content)
+	c.Env = append(os.Environ(), "CODE_PROMPT_CORE_FILE="+relPath)
+	// Children of the shell may keep the output pipe open after it was killed.
+	c.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command timed out after %s", timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// describeImage returns the placeholder of an image, or an error message like readFileContents
+// if the image cannot be read.
+func describeImage(absProjectPath, relPath string, base64MaxBytes int64) interface{} {
+	fullPath, err := projectFilePath(absProjectPath, relPath)
+	if err != nil {
+		return fmt.Sprintf("Error: Unable to read file. %v", err)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Sprintf("Error: Unable to read file. %v", err)
+	}
+	return imageinfo.Describe(relPath, data, base64MaxBytes)
+}
+
 func init() {
 	rootCmd.AddCommand(contentCmd)
+	addResponseOutputFlag(contentCmd, "content.output")
 	contentCmd.AddCommand(contentGetCmd)
+	contentCmd.AddCommand(contentSampleCmd)
+	contentCmd.AddCommand(contentSummarizeCmd)
+	contentCmd.AddCommand(contentChunksCmd)
 
 	// *** 修改：移除旧标志，添加新标志 ***
 	contentGetCmd.Flags().String("project-path", "", "Path to the project")
 	contentGetCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
 	contentGetCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	contentGetCmd.Flags().Int64("image-base64-max-bytes", 0, "Embed images up to this size as base64 in their placeholders (0 disables embedding)")
+	contentGetCmd.Flags().Bool("extract-docs", false, "Return the plain text of PDF, DOCX and ODT files instead of skipping them")
+	contentGetCmd.Flags().Bool("include-binary", false, "Return the raw content of non-text files instead of skipping them")
+	contentGetCmd.Flags().Int64("max-file-bytes", 1<<20, "Skip files larger than this many bytes (0 for no limit)")
+	contentGetCmd.Flags().String("base-path", "", "Only return files under this project directory, with paths relative to it")
 
 	viper.BindPFlag("content.get.project-path", contentGetCmd.Flags().Lookup("project-path"))
 	viper.BindPFlag("content.get.profile-name", contentGetCmd.Flags().Lookup("profile-name"))
 	viper.BindPFlag("content.get.filter-json", contentGetCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("content.get.image-base64-max-bytes", contentGetCmd.Flags().Lookup("image-base64-max-bytes"))
+	viper.BindPFlag("content.get.extract-docs", contentGetCmd.Flags().Lookup("extract-docs"))
+	viper.BindPFlag("content.get.include-binary", contentGetCmd.Flags().Lookup("include-binary"))
+	viper.BindPFlag("content.get.max-file-bytes", contentGetCmd.Flags().Lookup("max-file-bytes"))
+	viper.BindPFlag("content.get.base-path", contentGetCmd.Flags().Lookup("base-path"))
+	addTransformFlags(contentGetCmd, "content.get")
+
+	contentSampleCmd.Flags().String("project-path", "", "Path to the project")
+	contentSampleCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	contentSampleCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	contentSampleCmd.Flags().String("strategy", sample.StrategyHead, "Sampling strategy: head or stratified")
+	contentSampleCmd.Flags().Int64("max-tokens", 0, "Token budget of the result (required)")
+	viper.BindPFlag("content.sample.project-path", contentSampleCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("content.sample.profile-name", contentSampleCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("content.sample.filter-json", contentSampleCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("content.sample.strategy", contentSampleCmd.Flags().Lookup("strategy"))
+	viper.BindPFlag("content.sample.max-tokens", contentSampleCmd.Flags().Lookup("max-tokens"))
+
+	contentSummarizeCmd.Flags().String("project-path", "", "Path to the project")
+	contentSummarizeCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	contentSummarizeCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	contentSummarizeCmd.Flags().String("command", "", "Command line that reads a file on stdin and prints its summary (required)")
+	contentSummarizeCmd.Flags().Int("jobs", 4, "Number of files summarized in parallel")
+	contentSummarizeCmd.Flags().Duration("timeout", 2*time.Minute, "Maximum run time of the command per file (0 disables the limit)")
+	contentSummarizeCmd.Flags().Bool("refresh", false, "Regenerate summaries even if they are cached")
+	viper.BindPFlag("content.summarize.project-path", contentSummarizeCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("content.summarize.profile-name", contentSummarizeCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("content.summarize.filter-json", contentSummarizeCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("content.summarize.command", contentSummarizeCmd.Flags().Lookup("command"))
+	viper.BindPFlag("content.summarize.jobs", contentSummarizeCmd.Flags().Lookup("jobs"))
+	viper.BindPFlag("content.summarize.timeout", contentSummarizeCmd.Flags().Lookup("timeout"))
+	viper.BindPFlag("content.summarize.refresh", contentSummarizeCmd.Flags().Lookup("refresh"))
+
+	contentChunksCmd.Flags().String("project-path", "", "Path to the project")
+	contentChunksCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use")
+	contentChunksCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions")
+	contentChunksCmd.Flags().Int64("chunk-tokens", 512, "Maximum tokens per chunk")
+	contentChunksCmd.Flags().Int64("overlap", 64, "Tokens of lines shared by consecutive chunks")
+	viper.BindPFlag("content.chunks.project-path", contentChunksCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("content.chunks.profile-name", contentChunksCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("content.chunks.filter-json", contentChunksCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("content.chunks.chunk-tokens", contentChunksCmd.Flags().Lookup("chunk-tokens"))
+	viper.BindPFlag("content.chunks.overlap", contentChunksCmd.Flags().Lookup("overlap"))
 }
@@ -0,0 +1,303 @@
+// File: cmd/db.go
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/scanner"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the cache database",
+}
+
+var dbPruneCmd = &cobra.Command{
+	Use:         "prune",
+	Annotations: mutatingCommand,
+	Short:       "Remove projects that no longer exist on disk, orphaned data and stale content",
+	Long: `Keeps a shared database tidy across many experiments:
+1. Projects whose directory no longer exists are deleted, together with all their data.
+2. Rows that reference a project that no longer exists (left behind by older versions) are removed.
+3. Content that is not tied to a project is removed once it is older than '--content-max-age' (default
+   90 days, 0 keeps it): the contents stored for 'report replay' (a manifest recording the same content
+   again renews it), cached summaries and embeddings. Summaries and embeddings are recomputed when needed;
+   manifests older than the limit can no longer be replayed.
+4. The database file is compacted with VACUUM, and the reclaimed space is reported.
+
+With --dry-run, nothing is changed; the response lists what would be removed.
+
+Example:
+  code-prompt-core db prune --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun := viper.GetBool("db.prune.dry-run")
+		maxAge := viper.GetDuration("db.prune.content-max-age")
+		if maxAge < 0 {
+			printError(fmt.Errorf("--content-max-age must not be negative"))
+			return
+		}
+		// A zero cutoff keeps all content.
+		var contentCutoff time.Time
+		if maxAge > 0 {
+			contentCutoff = time.Now().Add(-maxAge)
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+
+		rows, err := db.Query("SELECT id, project_path FROM projects ORDER BY project_path")
+		if err != nil {
+			printError(fmt.Errorf("error querying projects: %w", err))
+			return
+		}
+		type missingProject struct {
+			id   int64
+			path string
+		}
+		var missing []missingProject
+		for rows.Next() {
+			var p missingProject
+			if err := rows.Scan(&p.id, &p.path); err != nil {
+				rows.Close()
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			if _, err := os.Stat(p.path); os.IsNotExist(err) {
+				missing = append(missing, p)
+			}
+		}
+		rows.Close()
+		removedProjects := []string{}
+		for _, p := range missing {
+			removedProjects = append(removedProjects, p.path)
+		}
+
+		if dryRun {
+			orphans, err := database.CountOrphans(db)
+			if err != nil {
+				printError(err)
+				return
+			}
+			stale, err := database.CountStaleContent(db, contentCutoff)
+			if err != nil {
+				printError(err)
+				return
+			}
+			printJSON(map[string]interface{}{
+				"status":           "dry run, nothing was changed",
+				"removedProjects":  removedProjects,
+				"orphanedRows":     orphans,
+				"staleContentRows": stale,
+			})
+			return
+		}
+
+		sizeBefore, err := database.SizeBytes(db)
+		if err != nil {
+			printError(fmt.Errorf("error reading database size: %w", err))
+			return
+		}
+		for _, p := range missing {
+			if _, err := db.Exec("DELETE FROM projects WHERE id = ?", p.id); err != nil {
+				printError(fmt.Errorf("error deleting project '%s': %w", p.path, err))
+				return
+			}
+		}
+		orphans, err := database.RemoveOrphans(db)
+		if err != nil {
+			printError(err)
+			return
+		}
+		stale, err := database.RemoveStaleContent(db, contentCutoff)
+		if err != nil {
+			printError(err)
+			return
+		}
+		if _, err := db.Exec("VACUUM"); err != nil {
+			printError(fmt.Errorf("error compacting database: %w", err))
+			return
+		}
+		sizeAfter, err := database.SizeBytes(db)
+		if err != nil {
+			printError(fmt.Errorf("error reading database size: %w", err))
+			return
+		}
+		printJSON(map[string]interface{}{
+			"status":           "database pruned",
+			"removedProjects":  removedProjects,
+			"orphanedRows":     orphans,
+			"staleContentRows": stale,
+			"sizeBeforeBytes":  sizeBefore,
+			"sizeAfterBytes":   sizeAfter,
+			"reclaimedBytes":   sizeBefore - sizeAfter,
+		})
+	},
+}
+
+var dbDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the cached files of a project with another database",
+	Long: `Compares the file_metadata of a project in the current database with the same project in '--other'
+(e.g. a cache produced by CI), by content hash, to explain why prompts built from the two caches differ.
+
+The other database is opened read-only and never modified. If the project is registered there under a
+different path (e.g. the CI checkout directory), pass it with '--other-project-path'.
+
+The response lists files only present in this database ("onlyInThis"), only present in the other
+("onlyInOther"), and present in both with a different content hash ("different"), plus the number of
+identical files. Files are compared by content hash when both projects are scanned with the same hash
+algorithm; otherwise (different algorithms, or --hash none on either side) they are compared by size and
+modification time, with a warning, and "comparedBy" says which was used.
+
+Example:
+  code-prompt-core db diff --project-path /home/me/proj --other ci-cache.db --other-project-path /builds/proj`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("db.diff.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		otherPath := viper.GetString("db.diff.other")
+		if otherPath == "" {
+			printError(fmt.Errorf("--other is required"))
+			return
+		}
+		otherProjectPath := viper.GetString("db.diff.other-project-path")
+		if otherProjectPath == "" {
+			otherProjectPath = projectPath
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		other, err := database.OpenReadOnly(otherPath)
+		if err != nil {
+			printError(fmt.Errorf("error opening other database: %w", err))
+			return
+		}
+		defer database.Close(other)
+
+		these, thisAlgorithm, err := cachedFileStates(db, projectPath)
+		if err != nil {
+			printError(err)
+			return
+		}
+		those, otherAlgorithm, err := cachedFileStates(other, otherProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("other database: %w", err))
+			return
+		}
+		// Hashes of different algorithms never match, and --hash none stores none at all.
+		comparedBy := "hash"
+		if thisAlgorithm != otherAlgorithm || thisAlgorithm == scanner.HashNone {
+			comparedBy = "size-and-mtime"
+			warn("the projects are scanned with different hash algorithms (%s, %s) or without hashes; comparing by size and modification time", thisAlgorithm, otherAlgorithm)
+		}
+
+		type difference struct {
+			Path           string `json:"path"`
+			ThisHash       string `json:"thisHash"`
+			OtherHash      string `json:"otherHash"`
+			ThisSizeBytes  int64  `json:"thisSizeBytes"`
+			OtherSizeBytes int64  `json:"otherSizeBytes"`
+		}
+		onlyInThis, onlyInOther := []string{}, []string{}
+		different := []difference{}
+		identical := 0
+		for relPath, this := range these {
+			that, ok := those[relPath]
+			switch {
+			case !ok:
+				onlyInThis = append(onlyInThis, relPath)
+			case comparedBy == "hash" && this.hash != that.hash,
+				comparedBy != "hash" && (this.size != that.size || this.modTime != that.modTime):
+				different = append(different, difference{relPath, this.hash, that.hash, this.size, that.size})
+			default:
+				identical++
+			}
+		}
+		for relPath := range those {
+			if _, ok := these[relPath]; !ok {
+				onlyInOther = append(onlyInOther, relPath)
+			}
+		}
+		sort.Strings(onlyInThis)
+		sort.Strings(onlyInOther)
+		sort.Slice(different, func(i, j int) bool { return different[i].Path < different[j].Path })
+		printJSON(map[string]interface{}{
+			"project_path":       projectPath,
+			"other_db":           otherPath,
+			"other_project_path": otherProjectPath,
+			"comparedBy":         comparedBy,
+			"identical":          identical,
+			"onlyInThis":         onlyInThis,
+			"onlyInOther":        onlyInOther,
+			"different":          different,
+		})
+	},
+}
+
+type cachedFileState struct {
+	hash    string
+	size    int64
+	modTime string
+}
+
+// cachedFileStates returns the content hash, size and modification time of every cached file
+// of a project, and the hash algorithm of the project.
+func cachedFileStates(db *sql.DB, projectPath string) (map[string]cachedFileState, string, error) {
+	projectID, err := database.For(db).ProjectID(projectPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error finding project '%s': %w", projectPath, err)
+	}
+	algorithm, err := loadHashAlgorithm(db, projectID)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := db.Query("SELECT relative_path, content_hash, size_bytes, last_mod_time FROM file_metadata WHERE project_id = ?", projectID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying file metadata: %w", err)
+	}
+	defer rows.Close()
+	states := make(map[string]cachedFileState)
+	for rows.Next() {
+		var relPath string
+		var state cachedFileState
+		if err := rows.Scan(&relPath, &state.hash, &state.size, &state.modTime); err != nil {
+			return nil, "", fmt.Errorf("error scanning row: %w", err)
+		}
+		states[relPath] = state
+	}
+	return states, algorithm, rows.Err()
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbPruneCmd)
+	dbPruneCmd.Flags().Bool("dry-run", false, "List what would be removed without changing the database")
+	dbPruneCmd.Flags().Duration("content-max-age", 90*24*time.Hour, "Remove replay contents, summaries and embeddings older than this (0 keeps them)")
+	viper.BindPFlag("db.prune.dry-run", dbPruneCmd.Flags().Lookup("dry-run"))
+	viper.BindPFlag("db.prune.content-max-age", dbPruneCmd.Flags().Lookup("content-max-age"))
+
+	dbCmd.AddCommand(dbDiffCmd)
+	dbDiffCmd.Flags().String("project-path", "", "Path to the project")
+	dbDiffCmd.Flags().String("other", "", "Path of the database to compare with (required)")
+	dbDiffCmd.Flags().String("other-project-path", "", "Path under which the project is registered in the other database (default: --project-path)")
+	viper.BindPFlag("db.diff.project-path", dbDiffCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("db.diff.other", dbDiffCmd.Flags().Lookup("other"))
+	viper.BindPFlag("db.diff.other-project-path", dbDiffCmd.Flags().Lookup("other-project-path"))
+}
@@ -2,13 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"code-prompt-core/pkg/jsonschema"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -20,9 +25,10 @@ var docsCmd = &cobra.Command{
 }
 
 var docsExportCmd = &cobra.Command{
-	Use:   "export",
-	Short: "Export all command documentation to a Markdown file",
-	Long:  `Recursively traverses all application commands and exports their full help text into a single, well-formatted Markdown file.`,
+	Use:        "export",
+	Deprecated: "use 'docs markdown', which writes one file per command with flag tables",
+	Short:      "Export all command documentation to a Markdown file",
+	Long:       `Recursively traverses all application commands and exports their full help text into a single, well-formatted Markdown file.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		outputFile := viper.GetString("docs.export.output")
 		f, err := os.Create(outputFile)
@@ -41,7 +47,115 @@ var docsExportCmd = &cobra.Command{
 			printError(fmt.Errorf("failed to generate documentation: %w", err))
 			return
 		}
-		fmt.Printf("Documentation successfully generated in %s\n", outputFile)
+		printJSON(fmt.Sprintf("Documentation successfully generated in %s", outputFile))
+	},
+}
+
+var docsMarkdownCmd = &cobra.Command{
+	Use:   "markdown",
+	Short: "Generate one Markdown file per command",
+	Long: `Writes one Markdown file per command to --dir, named after the command path
+("code-prompt-core_analyze_filter.md"). Each file has the description, usage, a table of
+the command's own flags, a table of the inherited global flags, and links to the parent
+and sub-commands.
+
+Example:
+  code-prompt-core docs markdown --dir ./docs`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := viper.GetString("docs.markdown.dir")
+		count, err := generateDocTree(rootCmd, dir, ".md", writeMarkdownDoc)
+		if err != nil {
+			printError(fmt.Errorf("failed to generate documentation: %w", err))
+			return
+		}
+		printJSON(fmt.Sprintf("%d Markdown files generated in %s", count, dir))
+	},
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man",
+	Short: "Generate man pages",
+	Long: `Writes one man page (section 1) per command to --dir, named after the command path
+("code-prompt-core-analyze-filter.1"). View one with 'man ./man/code-prompt-core.1' or
+install them into a MANPATH directory.
+
+Example:
+  code-prompt-core docs man --dir ./man`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := viper.GetString("docs.man.dir")
+		count, err := generateDocTree(rootCmd, dir, ".1", writeManPage)
+		if err != nil {
+			printError(fmt.Errorf("failed to generate man pages: %w", err))
+			return
+		}
+		printJSON(fmt.Sprintf("%d man pages generated in %s", count, dir))
+	},
+}
+
+var docsSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Export JSON Schemas of the command responses",
+	Long: `Emits a JSON Schema (draft 2020-12) for the response of every command, so that GUI and
+MCP wrapper authors can generate typed clients. Each schema describes the full response
+envelope: {"status":"success","data":...,"meta":...} or {"status":"error","message":...}. "meta" has the
+duration_ms of the command, the scan_timestamp of the project it read, the result_count and whether a limit
+truncated the result. Both envelopes may carry "warnings", the non-fatal issues the command ran into (a
+filter that matched no files, unreadable files, an old cache).
+"content chunks" writes NDJSON records without the envelope, and its schema describes one record.
+
+Without --output-dir the schemas are printed in one response, keyed by command path
+("analyze filter", "cache update", ...). With --output-dir one file per command is
+written, named after the command path ("analyze-filter.schema.json").
+Commands whose payload has no documented shape get an unconstrained "data".
+
+Example:
+  code-prompt-core docs schema
+  code-prompt-core docs schema --output-dir ./schemas`,
+	Run: func(cmd *cobra.Command, args []string) {
+		payloads := responseSchemas()
+		schemas := make(map[string]jsonschema.Schema)
+		var collect func(c *cobra.Command)
+		collect = func(c *cobra.Command) {
+			// Shell completion scripts are not JSON responses.
+			if !c.IsAvailableCommand() || c.IsAdditionalHelpTopicCommand() || c.Name() == "completion" {
+				return
+			}
+			if c.Runnable() && c != rootCmd {
+				path := strings.TrimPrefix(c.CommandPath(), rootCmd.Name()+" ")
+				data, ok := payloads[path]
+				if !ok {
+					data = jsonschema.Any()
+				}
+				schemas[path] = envelopeSchema(path, data)
+			}
+			for _, sub := range c.Commands() {
+				collect(sub)
+			}
+		}
+		collect(rootCmd)
+
+		outputDir := viper.GetString("docs.schema.output-dir")
+		if outputDir == "" {
+			printJSON(schemas)
+			return
+		}
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			printError(fmt.Errorf("failed to create output directory: %w", err))
+			return
+		}
+		for path, schema := range schemas {
+			data, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				printError(fmt.Errorf("failed to encode schema of '%s': %w", path, err))
+				return
+			}
+			fileName := strings.ReplaceAll(path, " ", "-") + ".schema.json"
+			if err := os.WriteFile(filepath.Join(outputDir, fileName), append(data, '\n'), 0644); err != nil {
+				printError(fmt.Errorf("failed to write schema file: %w", err))
+				return
+			}
+		}
+		printJSON(fmt.Sprintf("%d schemas written to %s", len(schemas), outputDir))
 	},
 }
 
@@ -70,9 +184,190 @@ func generateDocForCmd(cmd *cobra.Command, w io.Writer) error {
 	return nil
 }
 
+// docFileName names the documentation file of a command after its path, joining the
+// words with "_" for Markdown (as links between the files expect) and "-" for man pages.
+func docFileName(cmd *cobra.Command, ext string) string {
+	sep := "_"
+	if ext == ".1" {
+		sep = "-"
+	}
+	return strings.ReplaceAll(cmd.CommandPath(), " ", sep) + ext
+}
+
+// generateDocTree writes one file per available command under dir using write and
+// returns the number of files written.
+func generateDocTree(cmd *cobra.Command, dir, ext string, write func(*cobra.Command, io.Writer) error) (int, error) {
+	if !cmd.IsAvailableCommand() || cmd.IsAdditionalHelpTopicCommand() {
+		return 0, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(filepath.Join(dir, docFileName(cmd, ext)))
+	if err != nil {
+		return 0, err
+	}
+	if err := write(cmd, f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	count := 1
+	for _, sub := range cmd.Commands() {
+		n, err := generateDocTree(sub, dir, ext, write)
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// visibleFlags returns the non-hidden flags of a set, sorted by name.
+func visibleFlags(flags *pflag.FlagSet) []*pflag.Flag {
+	var result []*pflag.Flag
+	flags.VisitAll(func(f *pflag.Flag) {
+		if !f.Hidden {
+			result = append(result, f)
+		}
+	})
+	return result
+}
+
+func writeMarkdownDoc(cmd *cobra.Command, w io.Writer) error {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "## %s\n\n%s\n\n", cmd.CommandPath(), cmd.Short)
+	if cmd.Long != "" {
+		fmt.Fprintf(buf, "### Synopsis\n\n```text\n%s\n```\n\n", cmd.Long)
+	}
+	if cmd.Runnable() {
+		fmt.Fprintf(buf, "```text\n%s\n```\n\n", cmd.UseLine())
+	}
+	writeMarkdownFlagTable(buf, "Options", visibleFlags(cmd.NonInheritedFlags()))
+	writeMarkdownFlagTable(buf, "Options inherited from parent commands", visibleFlags(cmd.InheritedFlags()))
+
+	var seeAlso []string
+	if cmd.HasParent() {
+		parent := cmd.Parent()
+		seeAlso = append(seeAlso, fmt.Sprintf("* [%s](%s)\t - %s", parent.CommandPath(), docFileName(parent, ".md"), parent.Short))
+	}
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		seeAlso = append(seeAlso, fmt.Sprintf("* [%s](%s)\t - %s", sub.CommandPath(), docFileName(sub, ".md"), sub.Short))
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(buf, "### SEE ALSO\n\n%s\n", strings.Join(seeAlso, "\n"))
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeMarkdownFlagTable(w io.Writer, title string, flags []*pflag.Flag) {
+	if len(flags) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "### %s\n\n| Flag | Shorthand | Type | Default | Description |\n|---|---|---|---|---|\n", title)
+	cell := strings.NewReplacer("|", "\\|", "\n", " ")
+	for _, f := range flags {
+		shorthand := ""
+		if f.Shorthand != "" {
+			shorthand = "`-" + f.Shorthand + "`"
+		}
+		def := ""
+		if f.DefValue != "" && f.DefValue != "[]" {
+			def = "`" + cell.Replace(f.DefValue) + "`"
+		}
+		fmt.Fprintf(w, "| `--%s` | %s | %s | %s | %s |\n", f.Name, shorthand, f.Value.Type(), def, cell.Replace(f.Usage))
+	}
+	fmt.Fprintln(w)
+}
+
+// roffEscaper escapes text for roff: backslashes, and hyphens so they render as minus signs.
+var roffEscaper = strings.NewReplacer("\\", "\\e", "-", "\\-")
+
+// roffText escapes a block of text and protects lines starting with a control character.
+func roffText(s string) string {
+	lines := strings.Split(roffEscaper.Replace(s), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = "\\&" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeManPage(cmd *cobra.Command, w io.Writer) error {
+	buf := new(bytes.Buffer)
+	title := strings.ToUpper(strings.ReplaceAll(cmd.CommandPath(), " ", "-"))
+	fmt.Fprintf(buf, ".TH \"%s\" \"1\" \"%s\" \"%s\" \"User Commands\"\n", title, time.Now().Format("Jan 2006"), rootCmd.Name())
+	fmt.Fprintf(buf, ".SH NAME\n%s \\- %s\n", roffText(strings.ReplaceAll(cmd.CommandPath(), " ", "-")), roffText(cmd.Short))
+	fmt.Fprintf(buf, ".SH SYNOPSIS\n.B %s\n", roffText(cmd.UseLine()))
+	description := cmd.Long
+	if description == "" {
+		description = cmd.Short
+	}
+	// Long texts are pre-formatted (examples are indented), so they are kept as written.
+	fmt.Fprintf(buf, ".SH DESCRIPTION\n.nf\n%s\n.fi\n", roffText(description))
+	writeManFlags(buf, "OPTIONS", visibleFlags(cmd.NonInheritedFlags()))
+	writeManFlags(buf, "OPTIONS INHERITED FROM PARENT COMMANDS", visibleFlags(cmd.InheritedFlags()))
+
+	var seeAlso []string
+	if cmd.HasParent() {
+		seeAlso = append(seeAlso, fmt.Sprintf("\\fB%s\\fP(1)", roffText(strings.ReplaceAll(cmd.Parent().CommandPath(), " ", "-"))))
+	}
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		seeAlso = append(seeAlso, fmt.Sprintf("\\fB%s\\fP(1)", roffText(strings.ReplaceAll(sub.CommandPath(), " ", "-"))))
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(buf, ".SH SEE ALSO\n%s\n", strings.Join(seeAlso, ", "))
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeManFlags(w io.Writer, title string, flags []*pflag.Flag) {
+	if len(flags) == 0 {
+		return
+	}
+	fmt.Fprintf(w, ".SH %s\n", title)
+	for _, f := range flags {
+		name := "\\fB\\-\\-" + roffText(f.Name) + "\\fP"
+		if f.Shorthand != "" {
+			name = "\\fB\\-" + roffText(f.Shorthand) + "\\fP, " + name
+		}
+		if f.Value.Type() != "bool" {
+			name += " \\fI" + f.Value.Type() + "\\fP"
+		}
+		usage := f.Usage
+		if f.DefValue != "" && f.DefValue != "[]" && f.DefValue != "false" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(w, ".TP\n%s\n%s\n", name, roffText(usage))
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(docsCmd)
 	docsCmd.AddCommand(docsExportCmd)
 	docsExportCmd.Flags().StringP("output", "o", "APIDocumentation.md", "Output file for the generated Markdown documentation")
 	viper.BindPFlag("docs.export.output", docsExportCmd.Flags().Lookup("output"))
+
+	docsCmd.AddCommand(docsMarkdownCmd)
+	docsMarkdownCmd.Flags().String("dir", "docs", "Directory to write the Markdown files to")
+	viper.BindPFlag("docs.markdown.dir", docsMarkdownCmd.Flags().Lookup("dir"))
+
+	docsCmd.AddCommand(docsManCmd)
+	docsManCmd.Flags().String("dir", "man", "Directory to write the man pages to")
+	viper.BindPFlag("docs.man.dir", docsManCmd.Flags().Lookup("dir"))
+
+	docsCmd.AddCommand(docsSchemaCmd)
+	docsSchemaCmd.Flags().String("output-dir", "", "Write one <command-path>.schema.json file per command to this directory instead of printing")
+	viper.BindPFlag("docs.schema.output-dir", docsSchemaCmd.Flags().Lookup("output-dir"))
 }
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"code-prompt-core/pkg/filter"
+	js "code-prompt-core/pkg/jsonschema"
+	"code-prompt-core/pkg/transform"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "Work with filter rules",
+	Long:  `Commands to describe filter rules and check them before they are saved to a profile.`,
+}
+
+// filterTestResult is the outcome of one path in 'filter test'.
+type filterTestResult struct {
+	Path     string `json:"path"`
+	Included bool   `json:"included"`
+}
+
+var filterTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Evaluate a filter against given paths without touching the cache",
+	Long: `Evaluates a filter against relative paths given on the command line or in a file, and reports for each
+one whether the filter includes it. No project or database is involved, so the paths need not exist: use it to
+try out rules before saving them with 'profiles save'.
+
+The paths are tested as untagged, hand-written files: tag rules only match through their include/exclude
+fallbacks, and the generated, minified and churn rules never drop a path.
+
+Example:
+  code-prompt-core filter test --filter-json '{"excludeRegex":["_test\\.go$"],"priority":"excludes"}' --path src/foo_test.go --path src/foo.go
+  git ls-files | code-prompt-core filter test --filter-json '{"includeExts":["go"]}' --paths-file -`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filterJSON := viper.GetString("filter.test.filter-json")
+		if filterJSON == "" {
+			printError(fmt.Errorf("--filter-json is required"))
+			return
+		}
+		f, err := parseFilterJSON(filterJSON)
+		if err != nil {
+			printError(err)
+			return
+		}
+		paths := viper.GetStringSlice("filter.test.path")
+		if pathsFile := viper.GetString("filter.test.paths-file"); pathsFile != "" {
+			filePaths, err := readPathsFile(pathsFile)
+			if err != nil {
+				printError(err)
+				return
+			}
+			paths = append(paths, filePaths...)
+		}
+		if len(paths) == 0 {
+			printError(fmt.Errorf("no paths given: use --path or --paths-file"))
+			return
+		}
+		results := make([]filterTestResult, 0, len(paths))
+		for _, p := range paths {
+			p = filepath.ToSlash(p)
+			results = append(results, filterTestResult{Path: p, Included: f.Match(p, filter.FileAttributes{})})
+		}
+		printJSON(results)
+	},
+}
+
+var filterHashCmd = &cobra.Command{
+	Use:   "hash",
+	Short: "Print a stable hash of a filter",
+	Long: `Prints the SHA-256 of the normalized filter, for orchestration layers that key caches by filter; the
+report cache uses the same hash. Filters that differ only in form hash equally: the order and duplicates of
+rule lists, extensions with or without their dot, legacy keys and defaults given explicitly (priority
+"includes", "excludeGenerated": true, ...) do not change the hash. The response also has the normalized filter.
+
+Example:
+  code-prompt-core filter hash --filter-json '{"includeExts":[".go","md"],"priority":"includes"}'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filterJSON := viper.GetString("filter.hash.filter-json")
+		if filterJSON == "" {
+			printError(fmt.Errorf("--filter-json is required"))
+			return
+		}
+		f, err := parseFilterJSON(filterJSON)
+		if err != nil {
+			printError(err)
+			return
+		}
+		printJSON(filterHashResult{Hash: f.Hash(), Filter: f.Normalize()})
+	},
+}
+
+// filterHashResult is the response of 'filter hash'.
+type filterHashResult struct {
+	Hash   string        `json:"hash"`
+	Filter filter.Filter `json:"filter"`
+}
+
+var filterSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the filter JSON",
+	Long: `Prints the JSON Schema (draft 2020-12) of the filter JSON accepted by '--filter-json' and 'profiles save',
+so that GUIs can generate filter editing forms and validate filters before calling the core. It is derived
+from the filter itself, so new fields appear as they are added. All fields are optional; unknown keys are
+rejected as with '--strict-filter', and the legacy keys "includes" and "excludes" are marked deprecated.
+
+Example:
+  code-prompt-core filter schema`,
+	Run: func(cmd *cobra.Command, args []string) {
+		printJSON(filterSchema())
+	},
+}
+
+// filterFieldDocs describe the filter fields in the schema of 'filter schema'.
+var filterFieldDocs = map[string]string{
+	"includePaths":      "Exact relative paths; a path ending in '/' includes everything below it",
+	"excludePaths":      "Exact relative paths; a path ending in '/' excludes everything below it",
+	"includeExts":       "File extensions, with or without the leading dot",
+	"excludeExts":       "File extensions, with or without the leading dot",
+	"includePrefixes":   "Prefixes of any path component",
+	"excludePrefixes":   "Prefixes of any path component",
+	"includeRegex":      "Regular expressions (Go syntax) matched against the relative path",
+	"excludeRegex":      "Regular expressions (Go syntax) matched against the relative path",
+	"includeTags":       "Tags attached with the 'tag' command",
+	"excludeTags":       "Tags attached with the 'tag' command",
+	"excludeGenerated":  "Drop files marked linguist-generated or linguist-vendored (default true)",
+	"excludeMinified":   "Drop minified files and files with a generated-code header (default true)",
+	"includeTests":      "Keep only test files (\"*_test.go\", \"test_*.py\", \"*.spec.ts\", \"__tests__/\", ...)",
+	"excludeTests":      "Drop test files",
+	"includeExecutable": "true keeps only files with an execute bit, false drops them; unset ignores the execute bits",
+	"minChurn":          "Keep only files with at least this many changed lines stored by 'analyze churn'",
+	"sortBy":            "Order of the matching files; cache order by default",
+	"transform":         "Content transform of the commands that return file contents",
+	"priority":          "Which rule wins when a file matches both include and exclude rules (default includes)",
+}
+
+// filterFieldEnums are the allowed values of the string fields of the filter, by schema path.
+var filterFieldEnums = map[string][]string{
+	"priority":           {"includes", "excludes"},
+	"sortBy":             {filter.SortByChurn},
+	"transform.truncate": {transform.TruncateHead, transform.TruncateTail, transform.TruncateMiddle},
+}
+
+// filterSchema returns the JSON Schema of the filter JSON. The reflected schema describes
+// the filter as it is encoded; as an input schema, no field is required and null is not
+// needed where a field can be left out.
+func filterSchema() js.Schema {
+	schema := inputSchema(js.Reflect(filter.Filter{}), "")
+	props := schema["properties"].(map[string]interface{})
+	for name, doc := range filterFieldDocs {
+		if prop, ok := props[name].(js.Schema); ok {
+			props[name] = js.Describe(prop, doc)
+		}
+	}
+	for legacy, current := range filter.LegacyKeys {
+		prop := js.Describe(js.Array(js.String()), fmt.Sprintf("Legacy alias of %s", current))
+		prop["deprecated"] = true
+		props[legacy] = prop
+	}
+	schema["$schema"] = js.Draft
+	schema["title"] = "filter"
+	return schema
+}
+
+// inputSchema makes every property of the objects in s optional, closes them to unknown
+// properties and unwraps nullable schemas. It adds the filterFieldEnums; at is the path
+// of s below the filter.
+func inputSchema(s js.Schema, at string) js.Schema {
+	if options, ok := s["oneOf"].([]js.Schema); ok && len(options) == 2 && options[1]["type"] == "null" {
+		return inputSchema(options[0], at)
+	}
+	if enum, ok := filterFieldEnums[at]; ok {
+		s["enum"] = enum
+	}
+	if items, ok := s["items"].(js.Schema); ok {
+		s["items"] = inputSchema(items, at)
+	}
+	if props, ok := s["properties"].(map[string]interface{}); ok {
+		for name, prop := range props {
+			path := name
+			if at != "" {
+				path = at + "." + name
+			}
+			props[name] = inputSchema(prop.(js.Schema), path)
+		}
+		delete(s, "required")
+		s["additionalProperties"] = false
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(filterCmd)
+	filterCmd.AddCommand(filterTestCmd)
+	filterCmd.AddCommand(filterSchemaCmd)
+	filterCmd.AddCommand(filterHashCmd)
+	filterHashCmd.Flags().String("filter-json", "", "Filter rules as a JSON string")
+	viper.BindPFlag("filter.hash.filter-json", filterHashCmd.Flags().Lookup("filter-json"))
+	filterTestCmd.Flags().String("filter-json", "", "Filter rules as a JSON string")
+	filterTestCmd.Flags().StringSlice("path", nil, "Relative path to test (repeatable)")
+	filterTestCmd.Flags().String("paths-file", "", "File with one relative path per line ('-' for stdin)")
+	viper.BindPFlag("filter.test.filter-json", filterTestCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("filter.test.path", filterTestCmd.Flags().Lookup("path"))
+	viper.BindPFlag("filter.test.paths-file", filterTestCmd.Flags().Lookup("paths-file"))
+}
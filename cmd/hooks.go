@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Command hooks are shell commands configured under 'hooks' in the config file:
+//
+//	hooks:
+//	  pre-report: ./check-clean-tree.sh
+//	  post-cache-update:
+//	    - jq .data > last-scan.json
+//	    - ./notify.sh
+//
+// A key is "pre-" or "post-" followed by a command path with dashes ("cache-update"); a
+// group ("report") matches all of its sub-commands. Pre hooks run before the command and get
+// {"command": ..., "args": [...]} on stdin; a failing pre hook aborts the command. Post hooks
+// run after it, successful or not, with its JSON response on stdin; their failures are
+// only reported. Hook output goes to stderr so that stdout keeps carrying the response.
+
+// inHookEnvVar is set for hook processes; hooks are not run for commands started by a hook,
+// so a hook can call code-prompt-core without recursing.
+const inHookEnvVar = "CODE_PROMPT_CORE_IN_HOOK"
+
+// lastResponse is the JSON response printed by the command, passed to post hooks.
+var lastResponse []byte
+
+// commandHooks returns the hooks of the given phase ("pre" or "post") that apply to cmd,
+// by hook key. Keys are ordered from the most general to the most specific.
+func commandHooks(phase string, cmd *cobra.Command) ([]string, map[string][]string, error) {
+	path := strings.ReplaceAll(strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" "), " ", "-")
+	hooks := make(map[string][]string)
+	var keys []string
+	for key := range viper.GetStringMap("hooks") {
+		target, ok := strings.CutPrefix(key, phase+"-")
+		if !ok || (target != path && !strings.HasPrefix(path, target+"-")) {
+			continue
+		}
+		var commands []string
+		switch v := viper.Get("hooks." + key).(type) {
+		case string:
+			commands = []string{v}
+		case []interface{}:
+			for _, c := range v {
+				s, ok := c.(string)
+				if !ok {
+					return nil, nil, fmt.Errorf("invalid hook 'hooks.%s': entries must be strings", key)
+				}
+				commands = append(commands, s)
+			}
+		default:
+			return nil, nil, fmt.Errorf("invalid hook 'hooks.%s': expected a command or a list of commands", key)
+		}
+		hooks[key] = commands
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) < len(keys[j]) })
+	return keys, hooks, nil
+}
+
+// runCommandHook runs one hook command with stdin as its input.
+func runCommandHook(key, command, commandPath string, stdin []byte, env ...string) error {
+	c := shellCommand(context.Background(), command)
+	c.Stdin = bytes.NewReader(stdin)
+	c.Env = append(os.Environ(), inHookEnvVar+"=1", "CODE_PROMPT_CORE_HOOK="+key, "CODE_PROMPT_CORE_COMMAND="+commandPath)
+	c.Env = append(c.Env, env...)
+	var output io.Writer = os.Stderr
+	if viper.GetBool("quiet") {
+		output = io.Discard
+	}
+	c.Stdout = output
+	c.Stderr = output
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("hook 'hooks.%s' (%s) failed: %w", key, command, err)
+	}
+	return nil
+}
+
+// runPreHooks runs the pre hooks of cmd and registers its post hooks as a shutdown hook.
+func runPreHooks(cmd *cobra.Command, args []string) error {
+	if os.Getenv(inHookEnvVar) != "" {
+		return nil
+	}
+	commandPath := strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+	keys, hooks, err := commandHooks("pre", cmd)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if args == nil {
+			args = []string{}
+		}
+		input, _ := json.Marshal(map[string]interface{}{"command": commandPath, "args": args})
+		for _, key := range keys {
+			for _, command := range hooks[key] {
+				if err := runCommandHook(key, command, commandPath, input); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	postKeys, postHooks, err := commandHooks("post", cmd)
+	if err != nil {
+		return err
+	}
+	if len(postKeys) == 0 {
+		return nil
+	}
+	shutdownHooks = append(shutdownHooks, func() error {
+		status := "success"
+		if commandFailed {
+			status = "error"
+		}
+		// The most specific hooks run first, like deferred calls.
+		for i := len(postKeys) - 1; i >= 0; i-- {
+			for _, command := range postHooks[postKeys[i]] {
+				if err := runCommandHook(postKeys[i], command, commandPath, lastResponse, "CODE_PROMPT_CORE_STATUS="+status); err != nil {
+					warnf("Warning: %v\n", err)
+				}
+			}
+		}
+		return nil
+	})
+	return nil
+}
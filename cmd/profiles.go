@@ -2,11 +2,17 @@
 package cmd
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"code-prompt-core/pkg/database"
 	"code-prompt-core/pkg/filter"
+	builtinprofiles "code-prompt-core/profiles"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,9 +25,11 @@ var profilesCmd = &cobra.Command{
 }
 
 var profilesSaveCmd = &cobra.Command{
-	Use:   "save",
-	Short: "Save or update a filter profile",
+	Use:         "save",
+	Annotations: mutatingCommand,
+	Short:       "Save or update a filter profile",
 	Long: `Saves a filter configuration as a named profile for a specific project. If a profile with the same name already exists, it will be updated.
+The previous rules are kept as a numbered version, see 'profiles history' and 'profiles rollback'.
 
 The filter configuration must be provided as a JSON string via the --data flag.
 The JSON structure supports both simple and advanced (regex) rules:
@@ -35,13 +43,32 @@ The JSON structure supports both simple and advanced (regex) rules:
   
   "includeRegex": ["\\.hbs$"],
   "excludeRegex": ["^\\.git/"],
+
+  "includeTags": ["core-logic"],
+  "excludeTags": ["deprecated"],
+
+  "excludeGenerated": true,
+  "excludeMinified": true,
+  "includeExecutable": false,
+  "excludeTests": true,
   
   "priority": "includes"
 }
 
 - Simple rules (paths, exts, prefixes) are convenient for common cases.
 - Regex rules (includeRegex, excludeRegex) provide maximum flexibility for advanced users.
+- Tag rules (includeTags, excludeTags) select files by the tags attached with the 'tag' command.
+- "excludeGenerated": Optional. Drops files marked linguist-generated or linguist-vendored in .gitattributes. Defaults to true.
+- "excludeMinified": Optional. Drops files detected as minified or carrying a "DO NOT EDIT"/"@generated" header. Defaults to true.
+- "includeExecutable": Optional. true keeps only files with an execute bit (scripts, tooling), false drops them. Unset, execute bits are ignored.
+- "subtree": Optional. Keeps only the files under this directory, whatever the other rules say. The global
+  '--package <name>' flag sets it to the root of a package listed by 'analyze packages'.
+- "includeTests" / "excludeTests": Optional. Keep only or drop test files, recognized by language conventions
+  ("*_test.go", "test_*.py", "*.spec.ts", "*Test.java", "__tests__/", "tests/", ...).
 - "priority": Optional. Can be "includes" or "excludes". Determines which rule wins if a file matches both lists. Defaults to "includes".
+- The keys "includes" and "excludes" of older releases are still accepted as aliases of "includeRegex" and "excludeRegex".
+- Unknown keys are ignored, so a typo like "includeExt" yields a filter that includes everything; the global
+  '--strict-filter' flag rejects them instead, here and wherever filter JSON or a profile is read.
 
 Example:
   code-prompt-core profiles save --project-path /p/my-proj --name "go-source" --data '{"includeExts":["go"], "excludePaths": ["vendor/"]}'`,
@@ -54,8 +81,7 @@ Example:
 		}
 
 		// Validate that the data is valid JSON for a filter
-		var f filter.Filter
-		if err := json.Unmarshal([]byte(profileData), &f); err != nil {
+		if _, err := unmarshalFilter(profileData); err != nil {
 			printError(fmt.Errorf("invalid JSON format for --data: %w", err))
 			return
 		}
@@ -66,28 +92,168 @@ Example:
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
 			return
 		}
-		upsertSQL := `INSERT INTO profiles (project_id, profile_name, profile_data_json) VALUES (?, ?, ?) ON CONFLICT(project_id, profile_name) DO UPDATE SET profile_data_json = excluded.profile_data_json;`
-		_, err = db.Exec(upsertSQL, projectID, profileName, profileData)
-		if err != nil {
-			printError(fmt.Errorf("error saving profile: %w", err))
+		if err := saveProfile(db, projectID, profileName, profileData); err != nil {
+			printError(err)
 			return
 		}
 		printJSON(fmt.Sprintf("Profile '%s' saved successfully for project '%s'.", profileName, absProjectPath))
 	},
 }
 
+var profilesListBuiltinCmd = &cobra.Command{
+	Use:   "list-builtin",
+	Short: "List the starter profiles shipped with the binary",
+	Long: `Lists the built-in filter profiles (e.g. "frontend", "backend-go", "python-ds", "docs-only") with their description
+and rules. Use 'profiles init --builtin <name>' to save one of them to a project, then adjust it with 'profiles save'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		printJSON(builtinprofiles.BuiltInProfiles)
+	},
+}
+
+var profilesInitCmd = &cobra.Command{
+	Use:         "init",
+	Annotations: mutatingCommand,
+	Short:       "Save a built-in starter profile to a project",
+	Long: `Saves the rules of a built-in profile (see 'profiles list-builtin') as a profile of the project, under the
+built-in's name unless --name is given. As with 'profiles save', an existing profile of the same name is archived
+and replaced.
+
+Example:
+  code-prompt-core profiles init --project-path /p/my-proj --builtin backend-go
+  code-prompt-core profiles init --project-path /p/my-proj --builtin docs-only --name docs`,
+	Run: func(cmd *cobra.Command, args []string) {
+		builtinName := viper.GetString("profiles.init.builtin")
+		if builtinName == "" {
+			printError(fmt.Errorf("--builtin is required"))
+			return
+		}
+		builtin, ok := builtinprofiles.Lookup(builtinName)
+		if !ok {
+			names := make([]string, 0, len(builtinprofiles.BuiltInProfiles))
+			for _, p := range builtinprofiles.BuiltInProfiles {
+				names = append(names, p.Name)
+			}
+			printError(fmt.Errorf("unknown built-in profile '%s' (available: %s)", builtinName, strings.Join(names, ", ")))
+			return
+		}
+		profileName := viper.GetString("profiles.init.name")
+		if profileName == "" {
+			profileName = builtin.Name
+		}
+		absProjectPath, err := getAbsoluteProjectPath("profiles.init.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		if err := saveProfile(db, projectID, profileName, string(builtin.Data)); err != nil {
+			printError(err)
+			return
+		}
+		printJSON(fmt.Sprintf("Profile '%s' created from built-in '%s' for project '%s'.", profileName, builtin.Name, absProjectPath))
+	},
+}
+
+// importedGitignore is the response of 'profiles import-gitignore'.
+type importedGitignore struct {
+	Profile      string   `json:"profile"`
+	ExcludeRegex []string `json:"excludeRegex"`
+	// Unsupported lists the negated patterns, which exclusion rules cannot express.
+	Unsupported []string `json:"unsupported"`
+}
+
+var profilesImportGitignoreCmd = &cobra.Command{
+	Use:         "import-gitignore",
+	Annotations: mutatingCommand,
+	Short:       "Create a filter profile from the patterns of a .gitignore file",
+	Long: `Converts the patterns of a .gitignore file into "excludeRegex" rules and saves them as a profile, so an
+existing ignore file can seed an exclusion profile. Patterns keep their gitignore meaning: a pattern without
+a slash matches at any depth, one with a slash is relative to the project root, "*", "?", "[...]" and "**"
+are translated, and a directory pattern excludes everything below it. The profile has "priority": "excludes",
+without which a filter with no include rules keeps every file.
+
+Negated patterns ("!keep.txt") cannot be expressed as exclusions; they are left out and listed in the
+response under "unsupported". The file defaults to the .gitignore at the root of the project. As with
+'profiles save', an existing profile of the same name is archived and replaced.
+
+Example:
+  code-prompt-core profiles import-gitignore --project-path /p/my-proj --name base-excludes
+  code-prompt-core profiles import-gitignore --project-path /p/my-proj --file ~/.config/git/ignore --name global-ignores`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profileName := viper.GetString("profiles.import-gitignore.name")
+		if profileName == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("profiles.import-gitignore.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		file := viper.GetString("profiles.import-gitignore.file")
+		if file == "" {
+			file = filepath.Join(absProjectPath, ".gitignore")
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			printError(fmt.Errorf("error reading ignore file '%s': %w", file, err))
+			return
+		}
+		excludeRegex, negated := filter.GitignoreRules(strings.Split(string(content), "\n"))
+		if len(excludeRegex) == 0 {
+			printError(fmt.Errorf("no exclusion patterns found in '%s'", file))
+			return
+		}
+		profileData, err := json.Marshal(filter.Filter{ExcludeRegex: excludeRegex, Priority: "excludes"})
+		if err != nil {
+			printError(fmt.Errorf("error encoding profile: %w", err))
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		if err := saveProfile(db, projectID, profileName, string(profileData)); err != nil {
+			printError(err)
+			return
+		}
+		if negated == nil {
+			negated = []string{}
+		}
+		printJSON(importedGitignore{Profile: profileName, ExcludeRegex: excludeRegex, Unsupported: negated})
+	},
+}
+
 var profilesListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all saved profiles for a project",
@@ -99,14 +265,13 @@ var profilesListCmd = &cobra.Command{
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
 			return
@@ -152,14 +317,13 @@ var profilesLoadCmd = &cobra.Command{
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
 			return
@@ -180,9 +344,10 @@ var profilesLoadCmd = &cobra.Command{
 }
 
 var profilesDeleteCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete a filter profile",
-	Long:  `Deletes a named filter profile from a project. This action is irreversible.`,
+	Use:         "delete",
+	Annotations: mutatingCommand,
+	Short:       "Delete a filter profile",
+	Long:        `Deletes a named filter profile from a project. The deleted rules are kept in the profile's history and can be restored with 'profiles rollback'.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		profileName := viper.GetString("profiles.delete.name")
 		if profileName == "" {
@@ -195,32 +360,248 @@ var profilesDeleteCmd = &cobra.Command{
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
 			return
 		}
-		result, err := db.Exec("DELETE FROM profiles WHERE project_id = ? AND profile_name = ?", projectID, profileName)
+		tx, err := db.Begin()
+		if err != nil {
+			printError(fmt.Errorf("error starting transaction: %w", err))
+			return
+		}
+		if _, err := archiveProfileVersion(tx, projectID, profileName); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error archiving profile before delete: %w", err))
+			return
+		}
+		result, err := tx.Exec("DELETE FROM profiles WHERE project_id = ? AND profile_name = ?", projectID, profileName)
 		if err != nil {
+			tx.Rollback()
 			printError(fmt.Errorf("error deleting profile: %w", err))
 			return
 		}
 		rowsAffected, _ := result.RowsAffected()
 		if rowsAffected == 0 {
+			tx.Rollback()
 			printError(fmt.Errorf("no profile found with name '%s' for project '%s'", profileName, absProjectPath))
 			return
 		}
+		// A deleted profile can no longer be the project's default.
+		if _, err := tx.Exec("UPDATE projects SET default_profile = '' WHERE id = ? AND default_profile = ?", projectID, profileName); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error clearing default profile: %w", err))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			printError(fmt.Errorf("error committing profile deletion: %w", err))
+			return
+		}
 		printJSON(fmt.Sprintf("Profile '%s' deleted successfully.", profileName))
 	},
 }
 
+var profilesHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the archived versions of a filter profile",
+	Long: `Every time a profile is overwritten by 'profiles save', rolled back, or deleted, its previous rules are archived as a numbered version.
+This command lists those versions (newest first) together with the currently active rules.
+
+Example:
+  code-prompt-core profiles history --project-path /p/my-proj --name "go-source"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profileName := viper.GetString("profiles.history.name")
+		if profileName == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("profiles.history.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+
+		var current json.RawMessage
+		var currentStr string
+		err = db.QueryRow("SELECT profile_data_json FROM profiles WHERE project_id = ? AND profile_name = ?", projectID, profileName).Scan(&currentStr)
+		if err != nil && err != sql.ErrNoRows {
+			printError(fmt.Errorf("error loading profile '%s': %w", profileName, err))
+			return
+		}
+		if err == nil {
+			current = json.RawMessage(currentStr)
+		}
+
+		rows, err := db.Query("SELECT version, archived_at, profile_data_json FROM profile_versions WHERE project_id = ? AND profile_name = ? ORDER BY version DESC", projectID, profileName)
+		if err != nil {
+			printError(fmt.Errorf("error listing profile versions: %w", err))
+			return
+		}
+		defer rows.Close()
+		type ProfileVersion struct {
+			Version    int             `json:"version"`
+			ArchivedAt string          `json:"archived_at"`
+			Data       json.RawMessage `json:"data"`
+		}
+		versions := []ProfileVersion{}
+		for rows.Next() {
+			var v ProfileVersion
+			var dataStr string
+			if err := rows.Scan(&v.Version, &v.ArchivedAt, &dataStr); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			v.Data = json.RawMessage(dataStr)
+			versions = append(versions, v)
+		}
+		if current == nil && len(versions) == 0 {
+			printError(fmt.Errorf("no profile or history found with name '%s' for project '%s'", profileName, absProjectPath))
+			return
+		}
+		printJSON(map[string]interface{}{
+			"name":     profileName,
+			"current":  current,
+			"versions": versions,
+		})
+	},
+}
+
+var profilesRollbackCmd = &cobra.Command{
+	Use:         "rollback",
+	Annotations: mutatingCommand,
+	Short:       "Restore a filter profile to an archived version",
+	Long: `Replaces the current rules of a profile with an archived version from its history.
+If --version is omitted, the most recently archived version is restored. The rules being replaced are archived as a new version first, so a rollback can itself be undone.
+
+Example:
+  code-prompt-core profiles rollback --project-path /p/my-proj --name "go-source" --version 3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profileName := viper.GetString("profiles.rollback.name")
+		version := viper.GetInt("profiles.rollback.version")
+		if profileName == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("profiles.rollback.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			printError(fmt.Errorf("error starting transaction: %w", err))
+			return
+		}
+		var profileData string
+		if version > 0 {
+			err = tx.QueryRow("SELECT profile_data_json FROM profile_versions WHERE project_id = ? AND profile_name = ? AND version = ?", projectID, profileName, version).Scan(&profileData)
+		} else {
+			err = tx.QueryRow("SELECT version, profile_data_json FROM profile_versions WHERE project_id = ? AND profile_name = ? ORDER BY version DESC LIMIT 1", projectID, profileName).Scan(&version, &profileData)
+		}
+		if err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				printError(fmt.Errorf("no archived version found for profile '%s'", profileName))
+			} else {
+				printError(fmt.Errorf("error loading profile version: %w", err))
+			}
+			return
+		}
+		if _, err := archiveProfileVersion(tx, projectID, profileName); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error archiving current profile version: %w", err))
+			return
+		}
+		upsertSQL := `INSERT INTO profiles (project_id, profile_name, profile_data_json) VALUES (?, ?, ?) ON CONFLICT(project_id, profile_name) DO UPDATE SET profile_data_json = excluded.profile_data_json;`
+		if _, err := tx.Exec(upsertSQL, projectID, profileName, profileData); err != nil {
+			tx.Rollback()
+			printError(fmt.Errorf("error restoring profile: %w", err))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			printError(fmt.Errorf("error committing rollback: %w", err))
+			return
+		}
+		printJSON(fmt.Sprintf("Profile '%s' rolled back to version %d.", profileName, version))
+	},
+}
+
+// saveProfile creates or replaces a profile, archiving its previous rules as a new version.
+func saveProfile(db *sql.DB, projectID int64, profileName, profileData string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	if _, err := archiveProfileVersion(tx, projectID, profileName); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error archiving previous profile version: %w", err)
+	}
+	upsertSQL := `INSERT INTO profiles (project_id, profile_name, profile_data_json) VALUES (?, ?, ?) ON CONFLICT(project_id, profile_name) DO UPDATE SET profile_data_json = excluded.profile_data_json;`
+	if _, err := tx.Exec(upsertSQL, projectID, profileName, profileData); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error saving profile: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing profile: %w", err)
+	}
+	return nil
+}
+
+// archiveProfileVersion copies the current rules of a profile into profile_versions
+// under the next free version number. It returns 0 if the profile does not exist.
+func archiveProfileVersion(tx *sql.Tx, projectID int64, profileName string) (int, error) {
+	var current string
+	err := tx.QueryRow("SELECT profile_data_json FROM profiles WHERE project_id = ? AND profile_name = ?", projectID, profileName).Scan(&current)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) + 1 FROM profile_versions WHERE project_id = ? AND profile_name = ?", projectID, profileName).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("INSERT INTO profile_versions (project_id, profile_name, version, profile_data_json, archived_at) VALUES (?, ?, ?, ?, ?)",
+		projectID, profileName, version, current, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
 func init() {
 	rootCmd.AddCommand(profilesCmd)
 
@@ -232,6 +613,24 @@ func init() {
 	viper.BindPFlag("profiles.save.name", profilesSaveCmd.Flags().Lookup("name"))
 	viper.BindPFlag("profiles.save.data", profilesSaveCmd.Flags().Lookup("data"))
 
+	profilesCmd.AddCommand(profilesImportGitignoreCmd)
+	profilesImportGitignoreCmd.Flags().String("project-path", "", "Path to the project")
+	profilesImportGitignoreCmd.Flags().String("file", "", "Ignore file to convert (default: .gitignore at the project root)")
+	profilesImportGitignoreCmd.Flags().String("name", "", "Name of the profile to create")
+	viper.BindPFlag("profiles.import-gitignore.project-path", profilesImportGitignoreCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("profiles.import-gitignore.file", profilesImportGitignoreCmd.Flags().Lookup("file"))
+	viper.BindPFlag("profiles.import-gitignore.name", profilesImportGitignoreCmd.Flags().Lookup("name"))
+
+	profilesCmd.AddCommand(profilesListBuiltinCmd)
+
+	profilesCmd.AddCommand(profilesInitCmd)
+	profilesInitCmd.Flags().String("project-path", "", "Path to the project")
+	profilesInitCmd.Flags().String("builtin", "", "Name of the built-in profile (see 'profiles list-builtin')")
+	profilesInitCmd.Flags().String("name", "", "Name of the profile to create (default: the built-in's name)")
+	viper.BindPFlag("profiles.init.project-path", profilesInitCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("profiles.init.builtin", profilesInitCmd.Flags().Lookup("builtin"))
+	viper.BindPFlag("profiles.init.name", profilesInitCmd.Flags().Lookup("name"))
+
 	profilesCmd.AddCommand(profilesListCmd)
 	profilesListCmd.Flags().String("project-path", "", "Path to the project")
 	viper.BindPFlag("profiles.list.project-path", profilesListCmd.Flags().Lookup("project-path"))
@@ -247,4 +646,18 @@ func init() {
 	profilesDeleteCmd.Flags().String("name", "", "Name of the profile to delete")
 	viper.BindPFlag("profiles.delete.project-path", profilesDeleteCmd.Flags().Lookup("project-path"))
 	viper.BindPFlag("profiles.delete.name", profilesDeleteCmd.Flags().Lookup("name"))
+
+	profilesCmd.AddCommand(profilesHistoryCmd)
+	profilesHistoryCmd.Flags().String("project-path", "", "Path to the project")
+	profilesHistoryCmd.Flags().String("name", "", "Name of the profile")
+	viper.BindPFlag("profiles.history.project-path", profilesHistoryCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("profiles.history.name", profilesHistoryCmd.Flags().Lookup("name"))
+
+	profilesCmd.AddCommand(profilesRollbackCmd)
+	profilesRollbackCmd.Flags().String("project-path", "", "Path to the project")
+	profilesRollbackCmd.Flags().String("name", "", "Name of the profile to roll back")
+	profilesRollbackCmd.Flags().Int("version", 0, "Archived version to restore (default: the most recent one)")
+	viper.BindPFlag("profiles.rollback.project-path", profilesRollbackCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("profiles.rollback.name", profilesRollbackCmd.Flags().Lookup("name"))
+	viper.BindPFlag("profiles.rollback.version", profilesRollbackCmd.Flags().Lookup("version"))
 }
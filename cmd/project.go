@@ -2,7 +2,13 @@ package cmd
 
 import (
 	"code-prompt-core/pkg/database"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -15,8 +21,9 @@ var projectCmd = &cobra.Command{
 }
 
 var projectAddCmd = &cobra.Command{
-	Use:   "add",
-	Short: "Adds a new project to the database without scanning",
+	Use:         "add",
+	Annotations: mutatingCommand,
+	Short:       "Adds a new project to the database without scanning",
 	Long: `This lightweight command creates a project record in the database, allowing profile management or other configurations before performing the first (potentially long) scan.
 If the project already exists, this command will do nothing and will not return an error.
 
@@ -28,12 +35,12 @@ Example:
 			printError(err)
 			return
 		}
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
+		defer database.Close(db)
 		_, err = db.Exec("INSERT OR IGNORE INTO projects(project_path, last_scan_timestamp) VALUES(?, ?)", projectPath, "not_scanned_yet")
 		if err != nil {
 			printError(fmt.Errorf("error adding project: %w", err))
@@ -48,29 +55,38 @@ var projectListCmd = &cobra.Command{
 	Short: "List all projects stored in the database",
 	Long:  `Retrieves and displays a list of all projects currently managed in the specified database file, along with the timestamp of their last scan.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		rows, err := db.Query("SELECT project_path, last_scan_timestamp FROM projects")
+		defer database.Close(db)
+		rows, err := db.Query("SELECT project_path, last_scan_timestamp, scan_roots, default_profile, hash_algorithm, change_detection FROM projects")
 		if err != nil {
 			printError(fmt.Errorf("error querying projects: %w", err))
 			return
 		}
 		defer rows.Close()
 		type Project struct {
-			ProjectPath       string `json:"project_path"`
-			LastScanTimestamp string `json:"last_scan_timestamp"`
+			ProjectPath       string   `json:"project_path"`
+			LastScanTimestamp string   `json:"last_scan_timestamp"`
+			ScanRoots         []string `json:"scan_roots"`
+			DefaultProfile    string   `json:"default_profile"`
+			HashAlgorithm     string   `json:"hash_algorithm"`
+			ChangeDetection   string   `json:"change_detection"`
 		}
 		var projects []Project
 		for rows.Next() {
 			var p Project
-			if err := rows.Scan(&p.ProjectPath, &p.LastScanTimestamp); err != nil {
+			var rootsJSON string
+			if err := rows.Scan(&p.ProjectPath, &p.LastScanTimestamp, &rootsJSON, &p.DefaultProfile, &p.HashAlgorithm, &p.ChangeDetection); err != nil {
 				printError(fmt.Errorf("error scanning row: %w", err))
 				return
 			}
+			if err := json.Unmarshal([]byte(rootsJSON), &p.ScanRoots); err != nil {
+				printError(fmt.Errorf("invalid scan roots for project '%s': %w", p.ProjectPath, err))
+				return
+			}
 			projects = append(projects, p)
 		}
 		printJSON(projects)
@@ -78,8 +94,9 @@ var projectListCmd = &cobra.Command{
 }
 
 var projectDeleteCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete a project and all its associated data",
+	Use:         "delete",
+	Annotations: mutatingCommand,
+	Short:       "Delete a project and all its associated data",
 	Long: `Deletes a project record from the database.
 Due to the database schema's 'ON DELETE CASCADE' setting, this will also automatically delete all associated file metadata and saved filter profiles for that project. This action is irreversible.
 
@@ -91,12 +108,12 @@ Example:
 			printError(err)
 			return
 		}
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
+		defer database.Close(db)
 		result, err := db.Exec("DELETE FROM projects WHERE project_path = ?", projectPath)
 		if err != nil {
 			printError(fmt.Errorf("error deleting project: %w", err))
@@ -111,6 +128,175 @@ Example:
 	},
 }
 
+var projectSetRootsCmd = &cobra.Command{
+	Use:         "set-roots",
+	Annotations: mutatingCommand,
+	Short:       "Restrict scans of a project to a set of subdirectories",
+	Long: `Defines the scan roots of a project: the subdirectories that 'cache update' walks instead of the whole project directory.
+This avoids caching enormous unrelated trees in monorepos. Cached paths stay relative to the project path, so filters and profiles are unaffected.
+Calling this command without any --root resets the project to scanning everything.
+The new roots take effect on the next 'cache update'; files outside them are then removed from the cache.
+
+Example:
+  code-prompt-core project set-roots --project-path /path/to/monorepo --root src --root proto --root docs/adr`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("project.set-roots.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		roots, err := normalizeScanRoots(viper.GetStringSlice("project.set-roots.root"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		for _, root := range roots {
+			info, err := os.Stat(filepath.Join(projectPath, filepath.FromSlash(root)))
+			if err != nil || !info.IsDir() {
+				printError(fmt.Errorf("scan root '%s' is not a directory inside '%s'", root, projectPath))
+				return
+			}
+		}
+		rootsJSON, err := json.Marshal(roots)
+		if err != nil {
+			printError(fmt.Errorf("error encoding scan roots: %w", err))
+			return
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		if _, err := getOrCreateProject(db, projectPath); err != nil {
+			printError(fmt.Errorf("error getting or creating project: %w", err))
+			return
+		}
+		if _, err := db.Exec("UPDATE projects SET scan_roots = ? WHERE project_path = ?", string(rootsJSON), projectPath); err != nil {
+			printError(fmt.Errorf("error saving scan roots: %w", err))
+			return
+		}
+		printJSON(map[string]interface{}{
+			"project_path": projectPath,
+			"scan_roots":   roots,
+		})
+	},
+}
+
+var projectSetDefaultProfileCmd = &cobra.Command{
+	Use:         "set-default-profile",
+	Annotations: mutatingCommand,
+	Short:       "Set the filter profile applied when no filter is given",
+	Long: `Defines the default profile of a project. Analyze, content and report commands apply it implicitly
+whenever neither '--profile-name' nor '--filter-json' is given, instead of selecting every cached file.
+The value can be a saved profile or a selection ('selection:<name>'). Calling this command without --name clears the default.
+Use the global '--no-default-filter' flag to ignore the default for a single call.
+
+Example:
+  code-prompt-core project set-default-profile --project-path /path/to/project --name go-source`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("project.set-default-profile.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		name := strings.TrimSpace(viper.GetString("project.set-default-profile.name"))
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", projectPath, err))
+			return
+		}
+		if name != "" {
+			// Validate the profile by resolving it once.
+			if _, err := getFilter(db, projectID, name, ""); err != nil {
+				printError(err)
+				return
+			}
+		}
+		if _, err := db.Exec("UPDATE projects SET default_profile = ? WHERE id = ?", name, projectID); err != nil {
+			printError(fmt.Errorf("error saving default profile: %w", err))
+			return
+		}
+		printJSON(map[string]interface{}{
+			"project_path":    projectPath,
+			"default_profile": name,
+		})
+	},
+}
+
+// normalizeScanRoots cleans user supplied scan roots into '/'-separated paths relative to the project,
+// rejecting absolute paths and paths that escape the project directory.
+func normalizeScanRoots(roots []string) ([]string, error) {
+	result := []string{}
+	for _, root := range roots {
+		root = strings.TrimSpace(root)
+		if root == "" {
+			continue
+		}
+		if filepath.IsAbs(root) {
+			return nil, fmt.Errorf("scan root '%s' must be relative to the project path", root)
+		}
+		clean := path.Clean(filepath.ToSlash(root))
+		if clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("scan root '%s' escapes the project directory", root)
+		}
+		if clean == "." {
+			return []string{}, nil
+		}
+		result = append(result, clean)
+	}
+	return dedupeStrings(result), nil
+}
+
+// loadScanRoots returns the scan roots configured for a project. A project that
+// does not exist yet (projectID 0) has no roots.
+func loadScanRoots(db *sql.DB, projectID int64) ([]string, error) {
+	var rootsJSON string
+	err := db.QueryRow("SELECT scan_roots FROM projects WHERE id = ?", projectID).Scan(&rootsJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading scan roots: %w", err)
+	}
+	var roots []string
+	if err := json.Unmarshal([]byte(rootsJSON), &roots); err != nil {
+		return nil, fmt.Errorf("invalid scan roots: %w", err)
+	}
+	return roots, nil
+}
+
+// loadHashAlgorithm returns the content hash algorithm the cache of a project was built
+// with. A project that does not exist yet (projectID 0) has none.
+func loadHashAlgorithm(db *sql.DB, projectID int64) (string, error) {
+	var algorithm string
+	err := db.QueryRow("SELECT hash_algorithm FROM projects WHERE id = ?", projectID).Scan(&algorithm)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error loading hash algorithm: %w", err)
+	}
+	return algorithm, nil
+}
+
+// loadChangeDetection returns how incremental scans of a project detect changed files.
+// A project that does not exist yet (projectID 0) uses changeDetectionHash.
+func loadChangeDetection(db *sql.DB, projectID int64) (string, error) {
+	mode := changeDetectionHash
+	err := db.QueryRow("SELECT change_detection FROM projects WHERE id = ?", projectID).Scan(&mode)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error loading change detection: %w", err)
+	}
+	return mode, nil
+}
+
 func init() {
 	rootCmd.AddCommand(projectCmd)
 	projectCmd.AddCommand(projectAddCmd)
@@ -119,6 +305,18 @@ func init() {
 
 	projectCmd.AddCommand(projectListCmd)
 
+	projectCmd.AddCommand(projectSetRootsCmd)
+	projectSetRootsCmd.Flags().String("project-path", "", "Path to the project")
+	projectSetRootsCmd.Flags().StringSlice("root", nil, "Subdirectory to scan, relative to the project path (repeatable; none resets to the whole project)")
+	viper.BindPFlag("project.set-roots.project-path", projectSetRootsCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("project.set-roots.root", projectSetRootsCmd.Flags().Lookup("root"))
+
+	projectCmd.AddCommand(projectSetDefaultProfileCmd)
+	projectSetDefaultProfileCmd.Flags().String("project-path", "", "Path to the project")
+	projectSetDefaultProfileCmd.Flags().String("name", "", "Profile name or 'selection:<name>' (empty clears the default)")
+	viper.BindPFlag("project.set-default-profile.project-path", projectSetDefaultProfileCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("project.set-default-profile.name", projectSetDefaultProfileCmd.Flags().Lookup("name"))
+
 	projectCmd.AddCommand(projectDeleteCmd)
 	projectDeleteCmd.Flags().String("project-path", "", "Path to the project")
 	viper.BindPFlag("project.delete.project-path", projectDeleteCmd.Flags().Lookup("project-path"))
@@ -2,17 +2,34 @@
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/detect"
+	"code-prompt-core/pkg/entrypoints"
 	"code-prompt-core/pkg/filter"
+	"code-prompt-core/pkg/markdown"
+	"code-prompt-core/pkg/owners"
+	"code-prompt-core/pkg/symbols"
+	"code-prompt-core/pkg/textdiff"
+	"code-prompt-core/pkg/tokens"
+	"code-prompt-core/pkg/transform"
+	"code-prompt-core/pkg/tree"
 	"code-prompt-core/templates"
 
 	"github.com/aymerick/raymond"
@@ -65,6 +82,54 @@ var reportGenerateCmd = &cobra.Command{
 	Short: "Generate a report from a template",
 	Long: `This command aggregates project statistics, file structure, and file contents, then uses a Handlebars template to generate a final report file.
 
+The template context exposes:
+- files:       the included files ordered by path, each with path, language, size, tokens (an estimate) and content
+               ({{#each files}}{{path}} ({{tokens}} tokens){{{content}}}{{/each}}). Templates that still iterate it
+               as a path-to-content map with {{@key}} get the map, and a file object prints as its content
+- stats:       per-extension statistics
+- tree:        the directory tree
+- symbols:     per-file outlines of top-level declarations ({{#each symbols}}{{@key}}: {{#each this}}{{name}} ({{kind}}, line {{line}}){{/each}}{{/each}})
+- annotations: per-file TODO/FIXME/HACK/XXX/BUG/NOTE comments with tag, text and line
+- vars:        user-defined values from '--var' and '--vars-json'
+- languages:   the included files by language, as 'analyze languages' (only computed when the template mentions "languages")
+- oneline:     a one-line summary of the included files, as 'analyze oneline' (only computed when the template mentions "oneline")
+- owners:      per-directory owners from CODEOWNERS and git history, as in 'analyze owners' (only computed when the template mentions "owners")
+- detected:    the build systems and frameworks of the project, as 'analyze detect' (only computed when the template mentions "detected")
+- docs:        the 5 documentation files closest to the included files, with their contents, as 'analyze docs --top 5 --content'
+               (only computed when the template mentions "docs")
+- entrypoints: the ranked entry points of the included files, as 'analyze entrypoints' (only computed when the template mentions "entrypoints")
+
+The file contents go through the content transform, in this order: '--strip-comments', '--redact-secrets',
+'--max-file-tokens N' and '--fence' (wraps each file in a Markdown code fence). Files estimated above N tokens are
+cut to whole lines with a "[... truncated 1,234 lines ...]" marker where lines were removed; '--truncate' keeps their
+head (default), their tail or their first and last lines (middle), and the marker counts towards N. Profiles can set the same steps in their "transform" field, e.g.
+{"includeExts":["go"],"transform":{"stripComments":true,"redactSecrets":true,"maxFileTokens":4000,"truncate":"middle","fence":true}};
+giving any of these flags replaces the profile's transform.
+The content.handlers config (see 'content get --help') applies here too.
+
+Besides the Handlebars built-ins, templates can use {{humanizeBytes n}}, {{#if (eq a b)}} and the {{#groupBy files "dir"}}
+block helper, which renders its block once per group of files with {{key}}, {{count}} and {{#each files}}{{path}}{{content}}{{/each}}.
+Files can be grouped by "dir", "ext" or "tag":
+  {{#groupBy files "dir"}}## {{key}} ({{count}} files)
+  {{#each files}}### {{path}}
+  {{{content}}}
+  {{/each}}{{/groupBy}}
+
+For HTML templates, {{highlight content language}} returns the code as escaped HTML with comments, strings, numbers
+and keywords in <span class="hl-com|hl-str|hl-num|hl-kw">, {{fileTree files}} a collapsible tree of the files with
+their sizes and tokens linking to {{fileAnchor path}}, the id to give each file's section. The built-in
+'interactive.html' template uses them for a standalone page to review what will be sent to the LLM:
+  code-prompt-core report generate --project-path /p/proj --template interactive.html --output review.html
+
+Templates can embed the output of commands allowlisted under 'report.exec' in the config file with {{exec "name"}}
+(extra arguments: {{exec "go-vet" args="./pkg/..."}}). Commands run in the project directory without a shell, and
+their combined stdout and stderr is inserted as is, without HTML escaping, also when they exit non-zero (HTML
+templates should wrap it in {{highlight (exec "name") "text"}} or escape it themselves). 'report.exec-timeout' bounds each call (default 1m).
+  report:
+    exec:
+      go-vet: go vet ./...
+      tests: [go, test, -count=1, ./...]
+
 You can filter the files included in the report using either a saved profile via '--profile-name' or a temporary filter via '--filter-json'. If both are provided, '--filter-json' takes precedence.
 
 The filter JSON structure supports both simple and advanced rules:
@@ -76,15 +141,86 @@ The filter JSON structure supports both simple and advanced rules:
 
 If the '--output' flag is provided with a file path, the report is saved to that file. Otherwise, the report content is printed directly to the standard output.
 
+Use '--formats' to produce several outputs in one run:
+- md:   the rendered template output as-is
+- html: the rendered output passed through a markdown-to-HTML stage, as a standalone page
+- json: a structured dump of the template context (stats, tree, files, symbols, annotations, ...)
+With '--output report.md --formats md,html,json', the files report.md, report.html and report.json are written.
+Without '--output', the data field of the response is an object keyed by format.
+
+The stats, tree and file contents of a report are cached in the database, keyed by the last scan and the filter, so
+regenerating a report without changes does not read every file again. Files edited since the last 'cache update'
+are therefore only picked up after the next scan; use '--no-cache' to read them anyway.
+
+User-defined values are available as 'vars', from '--vars-json' and the repeatable '--var key=value' (which wins):
+  code-prompt-core report generate --project-path /p/proj --template task.hbs --var ticket=ABC-123 --var "task=Fix the login bug"
+  with {{vars.ticket}} and {{vars.task}} in task.hbs
+
+Small templates can be passed inline with '--template-string' instead of '--template', without a temporary file:
+  code-prompt-core report generate --project-path /p/proj --template-string '{{#each files}}{{@key}}{{/each}}' --raw
+
+Use '--diff-against' with a previous report to see what changed between two prompt iterations. The response lists the
+added and removed lines per section (Markdown headings and the file delimiters of summary.txt) and a unified diff;
+with '--raw' only the diff is printed. With '--output', the new report is also written there:
+  code-prompt-core report generate --project-path /p/proj --output v2.md --diff-against v1.md
+
+Use '--manifest report.manifest.json' to record the provenance of a prompt: the manifest holds the project path, the
+timestamp of the scan the report was built from, the hash and rules of the filter, the template, every included file
+with the SHA-256 and tokens of the content the report shows, the token total and the SHA-256 of the report itself:
+  code-prompt-core report generate --project-path /p/proj --output prompt.md --manifest prompt.manifest.json
+The contents are also stored in the database by hash, so that 'report replay --manifest prompt.manifest.json'
+can regenerate the exact report later; 'db prune' removes them after '--content-max-age' (90 days by default).
+
+Use '--raw' to write the rendered report (or the single requested format) directly to stdout, without the JSON envelope:
+  code-prompt-core report generate --project-path /p/proj --template summary.txt --raw > report.txt
+
 Example (using a built-in template and a filter):
   code-prompt-core report generate --template summary.txt --filter-json '{"includeExts":["go"]}' --output report.txt`,
 	Run: func(cmd *cobra.Command, args []string) {
-		templateIdentifier := viper.GetString("report.generate.template")
-		outputPath := viper.GetString("report.generate.output")
-		if templateIdentifier == "" {
+		opts := reportOptions{
+			Template:       viper.GetString("report.generate.template"),
+			TemplateString: viper.GetString("report.generate.template-string"),
+			ProfileName:    viper.GetString("report.generate.profile-name"),
+			FilterJSON:     viper.GetString("report.generate.filter-json"),
+			Sort:           viper.GetString("report.generate.sort"),
+			Output:         viper.GetString("report.generate.output"),
+			Raw:            viper.GetBool("report.generate.raw"),
+			NoCache:        viper.GetBool("report.generate.no-cache"),
+			Manifest:       viper.GetString("report.generate.manifest"),
+		}
+		transformOpts, err := transformOverride("report.generate")
+		if err != nil {
+			printError(err)
+			return
+		}
+		opts.Transform = transformOpts
+		if opts.TemplateString != "" {
+			if cmd.Flags().Changed("template") {
+				printError(fmt.Errorf("--template and --template-string cannot be used together"))
+				return
+			}
+			opts.Template = ""
+		} else if opts.Template == "" {
 			printError(fmt.Errorf("--template is required"))
 			return
 		}
+		formats, err := parseReportFormats(viper.GetString("report.generate.formats"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		opts.Formats = formats
+		vars, err := parseReportVars(viper.GetString("report.generate.vars-json"), viper.GetStringSlice("report.generate.var"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		opts.Vars = vars
+		diffAgainst := viper.GetString("report.generate.diff-against")
+		if diffAgainst != "" && len(opts.Formats) > 0 {
+			printError(fmt.Errorf("--diff-against cannot be combined with --formats"))
+			return
+		}
 
 		absProjectPath, err := getAbsoluteProjectPath("report.generate.project-path")
 		if err != nil {
@@ -92,75 +228,924 @@ Example (using a built-in template and a filter):
 			return
 		}
 
-		db, err := database.InitializeDB(viper.GetString("db"))
+		db, err := openDatabase()
 		if err != nil {
 			printError(fmt.Errorf("error initializing database: %w", err))
 			return
 		}
-		defer db.Close()
-		var projectID int64
-		err = db.QueryRow("SELECT id FROM projects WHERE project_path = ?", absProjectPath).Scan(&projectID)
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
 		if err != nil {
 			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
 			return
 		}
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
 
-		raymond.RegisterHelper("humanizeBytes", func(bytes int64) string {
-			return humanize.Bytes(uint64(bytes))
-		})
-		templateContent, err := getTemplateContent(templateIdentifier)
+		result, err := renderReport(db, projectID, absProjectPath, opts)
 		if err != nil {
 			printError(err)
 			return
 		}
-		if strings.Contains(templateContent, "{{> treePartial") {
-			treePartial := `{{#each nodes}}{{this.indent}}├── {{{this.Name}}} {{#if this.IsDir}} ({{this.TotalFileCount}} files, {{humanizeBytes this.TotalSizeBytes}}){{else}} ({{humanizeBytes this.SizeBytes}}){{/if}}{{#if this.isDir}}/{{/if}}
-{{#if this.Children}}{{> treePartial nodes=this.Children indent=(append this.indent "    ")}}{{/if}}{{/each}}`
-			raymond.RegisterPartial("treePartial", treePartial)
-			raymond.RegisterHelper("append", func(base, addition string) string {
-				return base + addition
-			},
-			)
+		if opts.Manifest != "" {
+			if err := writeReportManifest(db, projectID, absProjectPath, result, opts); err != nil {
+				printError(err)
+				return
+			}
 		}
+		if diffAgainst != "" {
+			writeReportDiff(result, opts, diffAgainst)
+			return
+		}
+		writeReportResult(result, opts)
+	},
+}
+
+var reportReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Regenerate a report exactly from its manifest",
+	Long: `Regenerates a report written with 'report generate --manifest' from the contents stored in the database
+when the manifest was written: the template, the file contents as the report showed them and the rest of the
+report context. Neither the project files nor the current cache are read, so the result is what the LLM was
+shown even after the project has changed. The regenerated report is checked against the reportHash of the
+manifest.
 
-		f, err := getFilter(
-			db,
-			projectID,
-			viper.GetString("report.generate.profile-name"),
-			viper.GetString("report.generate.filter-json"),
-		)
+The command fails, listing the hashes, if any stored content is missing or does not match its hash (for
+example with a different --db), and for templates that use {{exec}}, whose output is not stored.
+
+The report is printed in the JSON envelope, to stdout with '--raw', or written to '--output'.
+
+Example:
+  code-prompt-core report replay --manifest prompt.manifest.json --output prompt-again.md`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manifestPath := viper.GetString("report.replay.manifest")
+		if manifestPath == "" {
+			printError(fmt.Errorf("--manifest is required"))
+			return
+		}
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			printError(fmt.Errorf("error reading manifest: %w", err))
+			return
+		}
+		var manifest reportManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			printError(fmt.Errorf("error parsing manifest: %w", err))
+			return
+		}
+		if manifest.Version != reportManifestVersion {
+			printError(fmt.Errorf("unsupported manifest version %d (expected %d)", manifest.Version, reportManifestVersion))
+			return
+		}
+		if manifest.SnapshotHash == "" {
+			printError(fmt.Errorf("the manifest was written without storing the report contents (read-only database)"))
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		text, err := replayReport(db, manifest)
 		if err != nil {
 			printError(err)
 			return
 		}
 
-		reportCtx, err := buildReportContext(db, projectID, absProjectPath, f)
-		if err != nil {
-			printError(fmt.Errorf("error building report context: %w", err))
-			return
+		output := viper.GetString("report.replay.output")
+		switch {
+		case output != "":
+			if err := writeFileAtomic(output, []byte(text)); err != nil {
+				printError(fmt.Errorf("error writing output file '%s': %w", output, err))
+				return
+			}
+			printJSON(map[string]string{
+				"message":    "Report replayed successfully",
+				"outputPath": output,
+			})
+		case viper.GetBool("report.replay.raw"):
+			fmt.Print(text)
+		default:
+			printJSON(text)
+		}
+	},
+}
+
+// replayReport renders the report of a manifest from the stored contents and checks that
+// it is the recorded one.
+func replayReport(db *sql.DB, manifest reportManifest) (string, error) {
+	hashes := []string{manifest.TemplateHash, manifest.SnapshotHash}
+	for _, file := range manifest.Files {
+		hashes = append(hashes, file.ContentHash)
+	}
+	blobs, err := loadBlobs(db, hashes)
+	if err != nil {
+		return "", err
+	}
+	var snapshot reportSnapshot
+	if err := json.Unmarshal([]byte(blobs[manifest.SnapshotHash]), &snapshot); err != nil {
+		return "", fmt.Errorf("error decoding report snapshot: %w", err)
+	}
+	if len(snapshot.Sections.Files) != len(manifest.Files) {
+		return "", fmt.Errorf("the report snapshot has %d files, the manifest %d", len(snapshot.Sections.Files), len(manifest.Files))
+	}
+	files := snapshot.Sections.Files
+	for i := range files {
+		files[i].Content = blobs[manifest.Files[i].ContentHash]
+	}
+	vars := manifest.Vars
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	reportCtx := map[string]interface{}{
+		"project_path":       manifest.ProjectPath,
+		"absolute_code_path": manifest.ProjectPath,
+		"generated_at":       snapshot.GeneratedAt,
+		"config":             manifest.Filter,
+		"stats":              snapshot.Sections.Stats,
+		"tree":               snapshot.Sections.Tree,
+		"files":              files,
+		"symbols":            snapshot.Sections.Symbols,
+		"annotations":        snapshot.Sections.Annotations,
+		"vars":               vars,
+	}
+	if snapshot.Oneline != nil {
+		reportCtx["oneline"] = *snapshot.Oneline
+	}
+	if snapshot.Languages != nil {
+		reportCtx["languages"] = snapshot.Languages
+	}
+	if snapshot.Owners != nil {
+		reportCtx["owners"] = snapshot.Owners
+	}
+	if snapshot.Entrypoints != nil {
+		reportCtx["entrypoints"] = snapshot.Entrypoints
+	}
+	if snapshot.Detected != nil {
+		reportCtx["detected"] = snapshot.Detected
+	}
+	if snapshot.Docs != nil {
+		reportCtx["docs"] = snapshot.Docs
+	}
+
+	// Tags for {{#groupBy files "tag"}} come from the project as it is now; the hash check
+	// below catches a tag change that alters the report.
+	var projectID int64
+	if id, err := database.For(db).ProjectID(manifest.ProjectPath); err == nil {
+		projectID = id
+	}
+	registerReportHelpers()
+	noExec := func(name string, options *raymond.Options) raymond.SafeString {
+		panic(fmt.Errorf("{{exec \"%s\"}}: command output is not stored, so this report cannot be replayed", name))
+	}
+	text, err := executeReportTemplate(db, projectID, blobs[manifest.TemplateHash], reportCtx, noExec)
+	if err != nil {
+		return "", err
+	}
+	if sha256Hex(text) != manifest.ReportHash {
+		return "", fmt.Errorf("the replayed report differs from the recorded one (hash %s, expected %s)", sha256Hex(text), manifest.ReportHash)
+	}
+	return text, nil
+}
+
+// reportDiff is the response of 'report generate --diff-against'.
+type reportDiff struct {
+	Against    string `json:"against"`
+	OutputPath string `json:"outputPath,omitempty"`
+	Identical  bool   `json:"identical"`
+	Added      int    `json:"added"`
+	Removed    int    `json:"removed"`
+	// Sections are the changed sections in order, by the heading they fall under.
+	Sections []reportDiffSection `json:"sections"`
+	Diff     string              `json:"diff"`
+}
+
+type reportDiffSection struct {
+	Section string `json:"section"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// reportHeadingPattern matches the lines that start a section of a report: Markdown headings,
+// the "--- path ---" file delimiters of summary.txt and its "* Title *" banners.
+var reportHeadingPattern = regexp.MustCompile(`^(#{1,6} \S|'{3}--- .+ ---'{3}$|\* .+ \*$)`)
+
+// isReportHeading reports whether a line starts a section, which the closing "--- End of path ---"
+// delimiters of summary.txt do not.
+func isReportHeading(line string) bool {
+	return reportHeadingPattern.MatchString(line) && !strings.HasPrefix(line, "'''--- End of ")
+}
+
+// writeReportDiff compares the rendered report with an earlier one and prints the differences,
+// after writing the new report to --output if it is set.
+func writeReportDiff(report *renderedReport, opts reportOptions, against string) {
+	previous, err := os.ReadFile(against)
+	if err != nil {
+		printError(fmt.Errorf("error reading previous report '%s': %w", against, err))
+		return
+	}
+	if opts.Output != "" {
+		if err := writeFileAtomic(opts.Output, []byte(report.Text)); err != nil {
+			printError(fmt.Errorf("error writing output file '%s': %w", opts.Output, err))
+			return
+		}
+	}
+
+	newName := opts.Output
+	if newName == "" {
+		newName = "(generated)"
+	}
+	edits := textdiff.Diff(textdiff.SplitLines(string(previous)), textdiff.SplitLines(report.Text))
+	result := reportDiff{
+		Against:    against,
+		OutputPath: opts.Output,
+		Identical:  !textdiff.Changed(edits),
+		Sections:   []reportDiffSection{},
+		Diff:       textdiff.Unified(against, newName, edits, 3, isReportHeading),
+	}
+	sectionIndex := make(map[string]int)
+	oldSection, newSection := "(start)", "(start)"
+	for _, e := range edits {
+		isHeading := isReportHeading(e.Line)
+		if isHeading && e.Kind != '+' {
+			oldSection = e.Line
+		}
+		if isHeading && e.Kind != '-' {
+			newSection = e.Line
+		}
+		if e.Kind == ' ' {
+			continue
+		}
+		section := newSection
+		if e.Kind == '-' {
+			section = oldSection
+		}
+		idx, ok := sectionIndex[section]
+		if !ok {
+			idx = len(result.Sections)
+			sectionIndex[section] = idx
+			result.Sections = append(result.Sections, reportDiffSection{Section: section})
+		}
+		if e.Kind == '+' {
+			result.Added++
+			result.Sections[idx].Added++
+		} else {
+			result.Removed++
+			result.Sections[idx].Removed++
+		}
+	}
+
+	if opts.Raw {
+		fmt.Print(result.Diff)
+		return
+	}
+	printJSON(result)
+}
+
+// reportOptions holds everything that shapes a single report run.
+// It is also the JSON document persisted by 'report config save'.
+type reportOptions struct {
+	Template string `json:"template"`
+	// TemplateString is the template source itself, given inline instead of Template.
+	TemplateString string   `json:"templateString,omitempty"`
+	ProfileName    string   `json:"profileName,omitempty"`
+	FilterJSON     string   `json:"filterJson,omitempty"`
+	Sort           string   `json:"sort,omitempty"`
+	Formats        []string `json:"formats,omitempty"`
+	Output         string   `json:"output,omitempty"`
+	// Vars are user-defined values exposed to the template as "vars".
+	Vars map[string]interface{} `json:"vars,omitempty"`
+	// Transform replaces the content transform of the filter when set.
+	Transform *transform.Options `json:"transform,omitempty"`
+	// Raw writes the rendered text to stdout without the JSON envelope. It is a per-run switch and is not saved.
+	Raw bool `json:"-"`
+	// NoCache rebuilds the report context instead of reusing the cached one. It is not saved either.
+	NoCache bool `json:"-"`
+	// Manifest is the path of the provenance manifest written next to the report. It is not saved.
+	Manifest string `json:"-"`
+}
+
+var registerReportHelpersOnce sync.Once
+
+// registerReportHelpers registers the global raymond helpers and partials used by report templates.
+// raymond panics on duplicate registration, so this must only run once per process.
+func registerReportHelpers() {
+	registerReportHelpersOnce.Do(func() {
+		raymond.RegisterHelper("humanizeBytes", func(bytes int64) string {
+			return humanize.Bytes(uint64(bytes))
+		})
+		raymond.RegisterHelper("append", func(base, addition string) string {
+			return base + addition
+		})
+		raymond.RegisterHelper("eq", func(a, b interface{}) bool {
+			return fmt.Sprint(a) == fmt.Sprint(b)
+		})
+		raymond.RegisterHelper("highlight", func(code, language string) raymond.SafeString {
+			return raymond.SafeString(markdown.Highlight(code, language))
+		})
+		raymond.RegisterHelper("fileAnchor", fileAnchor)
+		raymond.RegisterHelper("fileTree", func(files []reportFile) raymond.SafeString {
+			b := tree.NewBuilder("files", nil)
+			for _, f := range files {
+				b.AddFile(f.Path, f.Size, f.Tokens)
+			}
+			var sb strings.Builder
+			tree.RenderHTML(&sb, b.Build(), fileAnchor)
+			return raymond.SafeString(sb.String())
+		})
+		treePartial := `{{#each nodes}}{{this.indent}}├── {{{this.Name}}} {{#if this.IsDir}} ({{this.TotalFileCount}} files, {{humanizeBytes this.TotalSizeBytes}}){{else}} ({{humanizeBytes this.SizeBytes}}){{/if}}{{#if this.isDir}}/{{/if}}
+{{#if this.Children}}{{> treePartial nodes=this.Children indent=(append this.indent "    ")}}{{/if}}{{/each}}`
+		raymond.RegisterPartial("treePartial", treePartial)
+	})
+}
+
+// renderedReport is the result of a report run: the rendered template text
+// together with the context it was rendered from.
+type renderedReport struct {
+	Text    string
+	Context map[string]interface{}
+	// Filter, Files and Template are the filter of the run, the files it included and the
+	// template source, for the manifest.
+	Filter   filter.Filter
+	Files    []reportFile
+	Template string
+}
+
+// reportDocsTop is the number of documentation files in the "docs" of the report context.
+const reportDocsTop = 5
+
+// renderReport builds the report context for a project and renders it with the configured template.
+func renderReport(db *sql.DB, projectID int64, absProjectPath string, opts reportOptions) (*renderedReport, error) {
+	registerReportHelpers()
+	templateContent := opts.TemplateString
+	if templateContent == "" {
+		var err error
+		if templateContent, err = getTemplateContent(opts.Template); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := getFilter(db, projectID, opts.ProfileName, opts.FilterJSON)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Transform != nil {
+		f.Transform = opts.Transform
+	}
+
+	reportCtx, err := buildReportContext(db, projectID, absProjectPath, f, opts.Sort, !opts.NoCache)
+	if err != nil {
+		return nil, fmt.Errorf("error building report context: %w", err)
+	}
+
+	files, _ := reportCtx["files"].([]reportFile)
+	vars := opts.Vars
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	reportCtx["vars"] = vars
+
+	if strings.Contains(templateContent, "oneline") {
+		line, err := projectOneline(db, projectID, f, 2)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		reportCtx["oneline"] = line
+	}
+	if strings.Contains(templateContent, "languages") {
+		languages, err := projectLanguages(db, projectID, f)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		reportCtx["languages"] = languages
+	}
+
+	// Ownership needs the git history, so it is only computed for templates that use it.
+	if strings.Contains(templateContent, "owners") {
+		relativePaths, err := filter.GetFilteredFilePaths(db, projectID, f)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		_, entries, err := getOwnersData(absProjectPath, relativePaths, owners.ByDirectory, "", 3)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		reportCtx["owners"] = entries
+	}
+	if strings.Contains(templateContent, "entrypoints") {
+		found, err := projectEntrypoints(db, projectID, absProjectPath, f)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		reportCtx["entrypoints"] = found
+	}
+	if strings.Contains(templateContent, "detected") {
+		detected, err := projectDetections(db, projectID, absProjectPath)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		reportCtx["detected"] = detected
+	}
+	if strings.Contains(templateContent, "docs") {
+		docs, _, err := projectDocs(db, projectID, absProjectPath, f, reportDocsTop, true)
+		if err != nil {
+			return nil, fmt.Errorf("error building report context: %w", err)
+		}
+		reportCtx["docs"] = docs
+	}
+
+	result, err := executeReportTemplate(db, projectID, templateContent, reportCtx, execHelper(absProjectPath))
+	if err != nil {
+		return nil, err
+	}
+	return &renderedReport{Text: result, Context: reportCtx, Filter: f, Files: files, Template: templateContent}, nil
+}
+
+// executeReportTemplate renders a report template with its context and the {{exec}} helper.
+func executeReportTemplate(db *sql.DB, projectID int64, templateContent string, reportCtx map[string]interface{}, exec interface{}) (string, error) {
+	// Templates written for the former map keep it: {{#each files}} with @key as the path.
+	if legacyFilesPattern.MatchString(templateContent) {
+		if files, ok := reportCtx["files"].([]reportFile); ok {
+			reportCtx["files"] = contentsByPath(files)
+		}
+	}
+	tpl, err := raymond.Parse(templateContent)
+	if err != nil {
+		return "", fmt.Errorf("error rendering template: %w", err)
+	}
+	tpl.RegisterHelper("exec", exec)
+	tpl.RegisterHelper("groupBy", groupByHelper(db, projectID))
+	result, err := tpl.Exec(reportCtx)
+	if err != nil {
+		return "", fmt.Errorf("error rendering template: %w", err)
+	}
+	return result, nil
+}
+
+// fileAnchor returns the HTML id of a file section: "file-" and the path with every character
+// other than letters, digits, '.', '-' and '/' replaced by '_'.
+func fileAnchor(relPath string) string {
+	return "file-" + strings.Map(func(r rune) rune {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(".-/", r)) {
+			return r
+		}
+		return '_'
+	}, relPath)
+}
+
+// groupByHelper returns the {{#groupBy files "dir"}} block helper, which renders its block once
+// per group of files, in key order, with the context {key, count, files} where files are the
+// file objects of the "files" array. Files are grouped by "dir" (the parent directory, "." at the root), "ext"
+// (the extension without the dot, "" if none) or "tag" (a file with several tags is in each of
+// their groups, untagged files in the group ""). @index, @first and @last are set as in #each;
+// the {{else}} block renders when there are no files.
+func groupByHelper(db *sql.DB, projectID int64) func(interface{}, string, *raymond.Options) string {
+	var fileTags map[string][]string
+	return func(files interface{}, by string, options *raymond.Options) string {
+		if by == "tag" && fileTags == nil {
+			var err error
+			if fileTags, err = filter.LoadFileTags(db, projectID); err != nil {
+				panic(err)
+			}
+		}
+		var list []reportFile
+		switch files := files.(type) {
+		case []reportFile:
+			list = files
+		case map[string]string:
+			for _, relPath := range sortedKeys(files) {
+				list = append(list, reportFile{Path: relPath, Content: files[relPath]})
+			}
+		}
+		groups := make(map[string][]reportFile)
+		for _, file := range list {
+			relPath := file.Path
+			var keys []string
+			switch by {
+			case "dir":
+				keys = []string{path.Dir(relPath)}
+			case "ext":
+				keys = []string{strings.TrimPrefix(path.Ext(relPath), ".")}
+			case "tag":
+				keys = fileTags[relPath]
+				if len(keys) == 0 {
+					keys = []string{""}
+				}
+			default:
+				panic(fmt.Errorf("groupBy: unknown grouping '%s' (expected dir, ext or tag)", by))
+			}
+			for _, key := range keys {
+				groups[key] = append(groups[key], file)
+			}
+		}
+		if len(groups) == 0 {
+			return options.Inverse()
+		}
+		var sb strings.Builder
+		keys := sortedKeys(groups)
+		for i, key := range keys {
+			frame := options.NewDataFrame()
+			frame.Set("index", i)
+			frame.Set("key", key)
+			frame.Set("first", i == 0)
+			frame.Set("last", i == len(keys)-1)
+			group := map[string]interface{}{"key": key, "count": len(groups[key]), "files": groups[key]}
+			sb.WriteString(options.FnCtxData(group, frame))
+		}
+		return sb.String()
+	}
+}
+
+// sortedKeys returns the keys of a map in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// defaultExecTimeout bounds each {{exec}} call unless 'report.exec-timeout' is set.
+const defaultExecTimeout = time.Minute
+
+// execHelper returns the {{exec "name"}} template helper. Templates can only run the
+// commands allowlisted under 'report.exec' in the config file, by name:
+//
+//	report:
+//	  exec:
+//	    go-vet: go vet ./...
+//	    tests: [go, test, -count=1, ./...]
+//
+// A command is a list of arguments or a string split on whitespace; it runs in the project
+// directory without a shell. {{exec "go-vet" args="./pkg/..."}} appends arguments. The
+// helper returns the combined stdout and stderr unescaped, since reports are mostly Markdown
+// or text where "<" and "&" must stay as is, also when the command exits non-zero
+// (a failing 'go vet' is the data the report wants); it fails the report only when the
+// command is not allowlisted, cannot be started or times out. Results are reused within
+// one report.
+func execHelper(absProjectPath string) func(string, *raymond.Options) raymond.SafeString {
+	results := make(map[string]raymond.SafeString)
+	return func(name string, options *raymond.Options) raymond.SafeString {
+		argv, err := allowlistedCommand(name)
+		if err != nil {
+			panic(err)
+		}
+		argv = append(argv, strings.Fields(options.HashStr("args"))...)
+		key := strings.Join(argv, "\x00")
+		if out, ok := results[key]; ok {
+			return out
+		}
+		timeout := defaultExecTimeout
+		if viper.IsSet("report.exec-timeout") {
+			timeout = viper.GetDuration("report.exec-timeout")
+		}
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		c.Dir = absProjectPath
+		c.WaitDelay = time.Second
+		out, err := c.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			panic(fmt.Errorf("exec '%s' timed out after %s", name, timeout))
+		}
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			panic(fmt.Errorf("exec '%s': %w", name, err))
+		}
+		results[key] = raymond.SafeString(strings.TrimRight(string(out), "\n"))
+		return results[key]
+	}
+}
+
+// allowlistedCommand returns the arguments of the command registered under 'report.exec.<name>'.
+func allowlistedCommand(name string) ([]string, error) {
+	key := "report.exec." + name
+	if name == "" || strings.Contains(name, ".") || !viper.IsSet(key) {
+		return nil, fmt.Errorf("exec: command '%s' is not allowlisted under 'report.exec' in the config file", name)
+	}
+	var argv []string
+	switch v := viper.Get(key).(type) {
+	case string:
+		argv = strings.Fields(v)
+	case []interface{}:
+		for _, a := range v {
+			argv = append(argv, fmt.Sprint(a))
+		}
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("exec: 'report.exec.%s' must be a command string or a list of arguments", name)
+	}
+	return argv, nil
+}
+
+// parseReportVars merges the --vars-json object with the key=value pairs of --var, which win.
+func parseReportVars(varsJSON string, pairs []string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	if varsJSON != "" {
+		if err := json.Unmarshal([]byte(varsJSON), &vars); err != nil {
+			return nil, fmt.Errorf("invalid --vars-json (expected a JSON object): %w", err)
+		}
+	}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --var '%s' (expected key=value)", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// reportFormats lists the output formats supported by --formats, mapped to their file extensions.
+var reportFormats = map[string]string{
+	"md":   ".md",
+	"html": ".html",
+	"json": ".json",
+}
+
+// parseReportFormats splits and validates a comma separated --formats value.
+func parseReportFormats(value string) ([]string, error) {
+	var formats []string
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" {
+			continue
+		}
+		if _, ok := reportFormats[format]; !ok {
+			return nil, fmt.Errorf("unsupported report format '%s' (expected md, html or json)", format)
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+// formatReport converts a rendered report into the requested output format.
+// "md" is the template output as-is, "html" passes it through a markdown-to-HTML
+// stage, and "json" is a structured dump of the template context.
+func formatReport(report *renderedReport, format string) ([]byte, error) {
+	switch format {
+	case "md":
+		return []byte(report.Text), nil
+	case "html":
+		title := "Code Prompt Report"
+		if projectPath, ok := report.Context["project_path"].(string); ok {
+			title = filepath.Base(projectPath) + " - " + title
+		}
+		return []byte(markdown.Document(title, markdown.ToHTML(report.Text))), nil
+	case "json":
+		return json.MarshalIndent(report.Context, "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported report format '%s'", format)
+	}
+}
+
+// writeReportResult saves the rendered report to the configured output, or prints it inside the JSON envelope when no output is set.
+// With multiple formats, each one is written next to the output path with its own extension.
+func writeReportResult(report *renderedReport, opts reportOptions) {
+	if len(opts.Formats) == 0 {
+		if opts.Output != "" {
+			err := writeFileAtomic(opts.Output, []byte(report.Text))
+			if err != nil {
+				printError(fmt.Errorf("error writing output file '%s': %w", opts.Output, err))
+				return
+			}
+			printJSON(map[string]string{
+				"message":    "Report generated successfully",
+				"outputPath": opts.Output,
+			})
+		} else if opts.Raw {
+			fmt.Print(report.Text)
+		} else {
+			// 将原始报告文本作为data字段的值，通过标准JSON格式输出
+			printJSON(report.Text)
+		}
+		return
+	}
+
+	outputs := make(map[string][]byte, len(opts.Formats))
+	for _, format := range opts.Formats {
+		data, err := formatReport(report, format)
+		if err != nil {
+			printError(fmt.Errorf("error formatting report as %s: %w", format, err))
+			return
+		}
+		outputs[format] = data
+	}
+
+	if opts.Output == "" && opts.Raw {
+		if len(outputs) != 1 {
+			printError(fmt.Errorf("--raw without --output requires a single format, got %d", len(outputs)))
+			return
+		}
+		os.Stdout.Write(outputs[opts.Formats[0]])
+		return
+	}
+
+	if opts.Output == "" {
+		result := make(map[string]interface{}, len(outputs))
+		for format, data := range outputs {
+			if format == "json" {
+				result[format] = json.RawMessage(data)
+			} else {
+				result[format] = string(data)
+			}
+		}
+		printJSON(result)
+		return
+	}
+
+	base := strings.TrimSuffix(opts.Output, filepath.Ext(opts.Output))
+	outputPaths := make(map[string]string, len(outputs))
+	for format, data := range outputs {
+		outputPath := base + reportFormats[format]
+		if err := writeFileAtomic(outputPath, data); err != nil {
+			printError(fmt.Errorf("error writing output file '%s': %w", outputPath, err))
+			return
+		}
+		outputPaths[format] = outputPath
+	}
+	printJSON(map[string]interface{}{
+		"message":     "Report generated successfully",
+		"outputPaths": outputPaths,
+	})
+}
+
+// reportManifestVersion is the version of the manifest format written by --manifest.
+const reportManifestVersion = 1
+
+// reportManifest records what a report was made of, so that the prompt it became can be
+// traced back to the project state and reproduced.
+type reportManifest struct {
+	Version       int                    `json:"version"`
+	GeneratedAt   string                 `json:"generatedAt"`
+	ProjectPath   string                 `json:"projectPath"`
+	ScanTimestamp string                 `json:"scanTimestamp"`
+	FilterHash    string                 `json:"filterHash"`
+	Filter        filter.Filter          `json:"filter"`
+	Template      string                 `json:"template"`
+	TemplateHash  string                 `json:"templateHash"`
+	Vars          map[string]interface{} `json:"vars,omitempty"`
+	Files         []manifestFile         `json:"files"`
+	TotalTokens   int64                  `json:"totalTokens"`
+	ReportHash    string                 `json:"reportHash"`
+	// SnapshotHash is the blob of the rest of the report context, for 'report replay'.
+	SnapshotHash string `json:"snapshotHash,omitempty"`
+}
+
+// reportSnapshot is the report context apart from the file contents (blobs of their own)
+// and what the manifest records itself. It is stored as a blob with the manifest.
+type reportSnapshot struct {
+	GeneratedAt string                   `json:"generatedAt"`
+	Sections    reportSections           `json:"sections"`
+	Oneline     *string                  `json:"oneline,omitempty"`
+	Languages   []languageShare          `json:"languages,omitempty"`
+	Owners      []owners.Entry           `json:"owners,omitempty"`
+	Entrypoints []entrypoints.EntryPoint `json:"entrypoints,omitempty"`
+	Detected    []detect.Detection       `json:"detected,omitempty"`
+	Docs        []docEntry               `json:"docs,omitempty"`
+}
+
+// manifestFile is a file included in a report. ContentHash is the SHA-256 of the content as the
+// report shows it, after the content transform.
+type manifestFile struct {
+	Path        string `json:"path"`
+	ContentHash string `json:"contentHash"`
+	Tokens      int64  `json:"tokens"`
+}
+
+// writeReportManifest writes the manifest of a rendered report to opts.Manifest.
+func writeReportManifest(db *sql.DB, projectID int64, absProjectPath string, report *renderedReport, opts reportOptions) error {
+	var lastScan string
+	if err := db.QueryRow("SELECT last_scan_timestamp FROM projects WHERE id = ?", projectID).Scan(&lastScan); err != nil {
+		return fmt.Errorf("error reading last scan timestamp: %w", err)
+	}
+	template := opts.Template
+	if template == "" {
+		template = "(inline)"
+	}
+	manifest := reportManifest{
+		Version:       reportManifestVersion,
+		GeneratedAt:   time.Now().UTC().Format(time.RFC3339),
+		ProjectPath:   absProjectPath,
+		ScanTimestamp: lastScan,
+		FilterHash:    report.Filter.Hash(),
+		Filter:        report.Filter,
+		Template:      template,
+		TemplateHash:  sha256Hex(report.Template),
+		Vars:          opts.Vars,
+		Files:         make([]manifestFile, 0, len(report.Files)),
+		ReportHash:    sha256Hex(report.Text),
+	}
+	for _, file := range report.Files {
+		manifest.Files = append(manifest.Files, manifestFile{Path: file.Path, ContentHash: sha256Hex(file.Content), Tokens: file.Tokens})
+		manifest.TotalTokens += file.Tokens
+	}
+	if viper.GetBool("read-only") {
+		warn("the database is read-only, so the report contents are not stored and 'report replay' cannot regenerate the report")
+	} else {
+		hash, err := storeReportBlobs(db, report)
+		if err != nil {
+			return err
+		}
+		manifest.SnapshotHash = hash
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	if err := writeFileAtomic(opts.Manifest, append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing manifest '%s': %w", opts.Manifest, err)
+	}
+	return nil
+}
+
+// storeReportBlobs stores the template, the file contents and the snapshot of a report in the
+// content_blobs table and returns the hash of the snapshot.
+func storeReportBlobs(db *sql.DB, report *renderedReport) (string, error) {
+	snapshot := reportSnapshot{
+		GeneratedAt: fmt.Sprint(report.Context["generated_at"]),
+		Sections:    reportSections{Files: make([]reportFile, len(report.Files))},
+	}
+	snapshot.Sections.Stats, _ = report.Context["stats"].(*TemplateStats)
+	snapshot.Sections.Symbols, _ = report.Context["symbols"].(map[string][]symbols.Symbol)
+	snapshot.Sections.Annotations, _ = report.Context["annotations"].(map[string][]symbols.Annotation)
+	snapshot.Sections.Tree, _ = report.Context["tree"].(*tree.Node)
+	for i, file := range report.Files {
+		file.Content = ""
+		snapshot.Sections.Files[i] = file
+	}
+	if line, ok := report.Context["oneline"].(string); ok {
+		snapshot.Oneline = &line
+	}
+	snapshot.Languages, _ = report.Context["languages"].([]languageShare)
+	snapshot.Owners, _ = report.Context["owners"].([]owners.Entry)
+	snapshot.Entrypoints, _ = report.Context["entrypoints"].([]entrypoints.EntryPoint)
+	snapshot.Detected, _ = report.Context["detected"].([]detect.Detection)
+	snapshot.Docs, _ = report.Context["docs"].([]docEntry)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("error encoding report snapshot: %w", err)
+	}
+
+	blobs := []string{report.Template, string(data)}
+	for _, file := range report.Files {
+		blobs = append(blobs, file.Content)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, blob := range blobs {
+		if _, err := tx.Exec("INSERT INTO content_blobs (hash, content, created_at) VALUES (?, ?, ?) ON CONFLICT(hash) DO UPDATE SET created_at = excluded.created_at", sha256Hex(blob), []byte(blob), now); err != nil {
+			return "", fmt.Errorf("error storing report contents: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error storing report contents: %w", err)
+	}
+	return sha256Hex(string(data)), nil
+}
+
+// loadBlobs returns the content_blobs of the given hashes. It fails with the list of the
+// hashes that are missing, or whose content no longer matches its hash.
+func loadBlobs(db *sql.DB, hashes []string) (map[string]string, error) {
+	blobs := make(map[string]string, len(hashes))
+	var missing []string
+	for _, hash := range hashes {
+		if _, ok := blobs[hash]; ok {
+			continue
+		}
+		var content []byte
+		err := db.QueryRow("SELECT content FROM content_blobs WHERE hash = ?", hash).Scan(&content)
+		if err == sql.ErrNoRows || (err == nil && sha256Hex(string(content)) != hash) {
+			missing = append(missing, hash)
+			continue
 		}
-
-		result, err := raymond.Render(templateContent, reportCtx)
 		if err != nil {
-			printError(fmt.Errorf("error rendering template: %w", err))
-			return
+			return nil, fmt.Errorf("error reading stored contents: %w", err)
 		}
+		blobs[hash] = string(content)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%d stored contents are missing or corrupt: %s", len(missing), strings.Join(missing, ", "))
+	}
+	return blobs, nil
+}
 
-		if outputPath != "" {
-			err = os.WriteFile(outputPath, []byte(result), 0644)
-			if err != nil {
-				printError(fmt.Errorf("error writing output file '%s': %w", outputPath, err))
-				return
-			}
-			printJSON(map[string]string{
-				"message":    "Report generated successfully",
-				"outputPath": outputPath,
-			})
-		} else {
-			// 将原始报告文本作为data字段的值，通过标准JSON格式输出
-			printJSON(result)
-		}
-	},
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
 }
 
 func getTemplateContent(identifier string) (string, error) {
@@ -183,32 +1168,176 @@ func getTemplateContent(identifier string) (string, error) {
 	return string(contentBytes), nil
 }
 
-func buildReportContext(db *sql.DB, projectID int64, absProjectPath string, f filter.Filter) (map[string]interface{}, error) {
-	stats, err := getStatsData(db, projectID, f)
+func buildReportContext(db *sql.DB, projectID int64, absProjectPath string, f filter.Filter, sortBy string, useCache bool) (map[string]interface{}, error) {
+	sections, err := loadReportSections(db, projectID, absProjectPath, f, sortBy, useCache)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get stats data: %w", err)
+		return nil, err
+	}
+	ctx := map[string]interface{}{
+		"project_path":       absProjectPath,
+		"absolute_code_path": absProjectPath,
+		"generated_at":       time.Now().Format(time.RFC1123),
+		"config":             f,
+		"stats":              sections.Stats,
+		"tree":               sections.Tree,
+		"files":              sections.Files,
+		"symbols":            sections.Symbols,
+		"annotations":        sections.Annotations,
+	}
+	return ctx, nil
+}
+
+// reportSections are the parts of the report context that depend only on the cache and the
+// filter. Reading every file is the expensive part of a report, so they are cached in the
+// report_cache table and reused while the project is not rescanned.
+type reportSections struct {
+	Stats       *TemplateStats                  `json:"stats"`
+	Tree        *tree.Node                      `json:"tree"`
+	Files       []reportFile                    `json:"files"`
+	Symbols     map[string][]symbols.Symbol     `json:"symbols"`
+	Annotations map[string][]symbols.Annotation `json:"annotations"`
+}
+
+// reportCacheEntries is the number of cached report contexts kept per project.
+const reportCacheEntries = 5
+
+// loadReportSections returns the cached sections for the project's current scan and filter,
+// or builds and caches them. The key covers the last scan timestamp, the filter and sort,
+// the files the filter selects and the content hashes of all cached files, so rescans,
+// tag or churn changes that alter the selection all miss the cache. Files edited on disk
+// after the last scan are only picked up after the next 'cache update' (or with --no-cache).
+func loadReportSections(db *sql.DB, projectID int64, absProjectPath string, f filter.Filter, sortBy string, useCache bool) (*reportSections, error) {
+	var lastScan string
+	if err := db.QueryRow("SELECT last_scan_timestamp FROM projects WHERE id = ?", projectID).Scan(&lastScan); err != nil {
+		return nil, fmt.Errorf("error reading last scan timestamp: %w", err)
+	}
+	useCache = useCache && lastScan != "not_scanned_yet" && !viper.GetBool("read-only")
+	var key string
+	if useCache {
+		var err error
+		if key, err = reportCacheKey(db, projectID, lastScan, f, sortBy); err != nil {
+			return nil, err
+		}
+		var data []byte
+		err = db.QueryRow("SELECT sections FROM report_cache WHERE project_id = ? AND cache_key = ?", projectID, key).Scan(&data)
+		if err == nil {
+			var sections reportSections
+			if err := json.Unmarshal(data, &sections); err == nil {
+				return &sections, nil
+			}
+		} else if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("error reading report cache: %w", err)
+		}
 	}
 
+	stats, err := getStatsData(db, projectID, f, sortBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats data: %w", err)
+	}
 	tree, err := getTreeData(db, projectID, absProjectPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tree data: %w", err)
 	}
-
-	contents, err := getContentsData(db, projectID, absProjectPath, f)
+	files, err := getContentsData(db, projectID, absProjectPath, f)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contents data: %w", err)
 	}
+	contents := contentsByPath(files)
+	sections := &reportSections{
+		Stats:       stats,
+		Tree:        tree,
+		Files:       files,
+		Symbols:     getSymbolsData(contents),
+		Annotations: getAnnotationsData(contents),
+	}
+	if useCache {
+		if err := storeReportSections(db, projectID, key, lastScan, sections); err != nil {
+			return nil, err
+		}
+	}
+	return sections, nil
+}
 
-	ctx := map[string]interface{}{
-		"project_path":       absProjectPath,
-		"absolute_code_path": absProjectPath,
-		"generated_at":       time.Now().Format(time.RFC1123),
-		"config":             f,
-		"stats":              stats,
-		"tree":               tree,
-		"files":              contents,
+func reportCacheKey(db *sql.DB, projectID int64, lastScan string, f filter.Filter, sortBy string) (string, error) {
+	h := sha256.New()
+	// Content handlers come from the config rather than the filter; fmt prints maps sorted by key.
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%v\x00", lastScan, f.Hash(), sortBy, viper.GetStringMapString("content.handlers"))
+	included, err := filter.GetFilteredFilePaths(db, projectID, f)
+	if err != nil {
+		return "", fmt.Errorf("error filtering files: %w", err)
 	}
-	return ctx, nil
+	for _, p := range included {
+		fmt.Fprintf(h, "%s\x00", p)
+	}
+	rows, err := db.Query("SELECT relative_path, content_hash FROM file_metadata WHERE project_id = ? ORDER BY relative_path", projectID)
+	if err != nil {
+		return "", fmt.Errorf("error querying file metadata: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var relPath, hash string
+		if err := rows.Scan(&relPath, &hash); err != nil {
+			return "", fmt.Errorf("error scanning row: %w", err)
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", relPath, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeReportSections caches sections under key, dropping entries of older scans and all
+// but the most recent reportCacheEntries entries of the project.
+func storeReportSections(db *sql.DB, projectID int64, key, lastScan string, sections *reportSections) error {
+	data, err := json.Marshal(sections)
+	if err != nil {
+		return fmt.Errorf("error encoding report cache: %w", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM report_cache WHERE project_id = ? AND scan_timestamp != ?", projectID, lastScan); err != nil {
+		return fmt.Errorf("error pruning report cache: %w", err)
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO report_cache (project_id, cache_key, scan_timestamp, sections, created_at) VALUES (?, ?, ?, ?, ?)",
+		projectID, key, lastScan, data, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("error writing report cache: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM report_cache WHERE project_id = ? AND cache_key NOT IN (SELECT cache_key FROM report_cache WHERE project_id = ? ORDER BY created_at DESC LIMIT ?)",
+		projectID, projectID, reportCacheEntries); err != nil {
+		return fmt.Errorf("error pruning report cache: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error writing report cache: %w", err)
+	}
+	return nil
+}
+
+// getSymbolsData extracts the top-level declarations of every included file, keyed by relative path.
+// Files without recognisable symbols are omitted.
+func getSymbolsData(contents map[string]string) map[string][]symbols.Symbol {
+	result := make(map[string][]symbols.Symbol)
+	for relPath, content := range contents {
+		if syms := symbols.ExtractSymbols(relPath, content); len(syms) > 0 {
+			result[relPath] = syms
+		}
+	}
+	return result
+}
+
+// getAnnotationsData collects TODO/FIXME-style markers of every included file, keyed by relative path.
+// Files without annotations are omitted.
+func getAnnotationsData(contents map[string]string) map[string][]symbols.Annotation {
+	result := make(map[string][]symbols.Annotation)
+	for relPath, content := range contents {
+		if annotations := symbols.ExtractAnnotations(content); len(annotations) > 0 {
+			result[relPath] = annotations
+		}
+	}
+	return result
 }
 
 type TemplateStat struct {
@@ -219,140 +1348,408 @@ type TemplateStat struct {
 	IsIncluded bool   `json:"isIncluded"`
 }
 
-func getStatsData(db *sql.DB, projectID int64, f filter.Filter) (map[string]interface{}, error) {
-	rows, err := db.Query("SELECT extension, COUNT(*), SUM(size_bytes), SUM(line_count), GROUP_CONCAT(relative_path) FROM file_metadata WHERE project_id = ? GROUP BY extension", projectID)
+// TemplateStats is the "stats" section of the report context.
+type TemplateStats struct {
+	TotalFiles  int            `json:"totalFiles"`
+	TotalSize   int64          `json:"totalSize"`
+	TotalLines  int            `json:"totalLines"`
+	ByExtension []TemplateStat `json:"byExtension"`
+}
+
+func getStatsData(db *sql.DB, projectID int64, f filter.Filter, sortBy string) (*TemplateStats, error) {
+	// An extension counts as included if at least one of its files passes the filter.
+	includedPaths, err := filter.GetFilteredFilePaths(db, projectID, f)
+	if err != nil {
+		return nil, err
+	}
+	includedSet := make(map[string]struct{}, len(includedPaths))
+	for _, p := range includedPaths {
+		includedSet[p] = struct{}{}
+	}
+
+	rows, err := db.Query("SELECT extension, relative_path, size_bytes, line_count FROM file_metadata WHERE project_id = ?", projectID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var statsList []TemplateStat
+	byExt := make(map[string]*TemplateStat)
 	var totalFiles, totalLines int
 	var totalSize int64
 
-	compiledIncludes := f.GetCompiledIncludeRegex()
-	compiledExcludes := f.GetCompiledExcludeRegex()
-
 	for rows.Next() {
 		var ext sql.NullString
-		var s TemplateStat
-		var relativePathsStr sql.NullString
-		if err := rows.Scan(&ext, &s.FileCount, &s.TotalSize, &s.TotalLines, &relativePathsStr); err != nil {
+		var relPath string
+		var size int64
+		var lines int
+		if err := rows.Scan(&ext, &relPath, &size, &lines); err != nil {
 			return nil, err
 		}
 
-		s.ExtName = "no_extension"
+		extName := "no_extension"
 		if ext.Valid && ext.String != "" {
-			s.ExtName = ext.String
+			extName = ext.String
+		}
+		s, ok := byExt[extName]
+		if !ok {
+			s = &TemplateStat{ExtName: extName}
+			byExt[extName] = s
+		}
+		s.FileCount++
+		s.TotalSize += size
+		s.TotalLines += lines
+		if _, included := includedSet[relPath]; included {
+			s.IsIncluded = true
 		}
 
-		s.IsIncluded = false
-		if relativePathsStr.Valid {
-			paths := strings.Split(relativePathsStr.String, ",")
-			for _, path := range paths {
-				matchInclude := len(compiledIncludes) == 0 || filter.MatchesAny(path, compiledIncludes)
-				matchExclude := len(compiledExcludes) > 0 && filter.MatchesAny(path, compiledExcludes)
+		totalFiles++
+		totalSize += size
+		totalLines += lines
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-				priority := f.Priority
-				if priority == "" {
-					priority = "includes"
-				}
+	statsList := make([]TemplateStat, 0, len(byExt))
+	for _, s := range byExt {
+		statsList = append(statsList, *s)
+	}
+	if err := sortTemplateStats(statsList, sortBy); err != nil {
+		return nil, err
+	}
 
-				if (matchInclude && !matchExclude) || (matchInclude && matchExclude && priority == "includes") {
-					s.IsIncluded = true
-					break
-				}
-			}
-		}
+	return &TemplateStats{
+		TotalFiles:  totalFiles,
+		TotalSize:   totalSize,
+		TotalLines:  totalLines,
+		ByExtension: statsList,
+	}, nil
+}
 
-		statsList = append(statsList, s)
-		totalFiles += s.FileCount
-		totalSize += s.TotalSize
-		totalLines += s.TotalLines
+// sortTemplateStats orders the per-extension statistics. Supported keys are
+// "size" (default), "count", "lines" and "name".
+func sortTemplateStats(statsList []TemplateStat, sortBy string) error {
+	var less func(a, b TemplateStat) bool
+	switch sortBy {
+	case "", "size":
+		less = func(a, b TemplateStat) bool { return a.TotalSize > b.TotalSize }
+	case "count":
+		less = func(a, b TemplateStat) bool { return a.FileCount > b.FileCount }
+	case "lines":
+		less = func(a, b TemplateStat) bool { return a.TotalLines > b.TotalLines }
+	case "name":
+		less = func(a, b TemplateStat) bool { return a.ExtName < b.ExtName }
+	default:
+		return fmt.Errorf("invalid sort order '%s' (expected size, count, lines or name)", sortBy)
 	}
-
 	sort.Slice(statsList, func(i, j int) bool {
-		return statsList[i].TotalSize > statsList[j].TotalSize
+		a, b := statsList[i], statsList[j]
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.ExtName < b.ExtName
 	})
+	return nil
+}
 
-	return map[string]interface{}{
-		"totalFiles":  totalFiles,
-		"totalSize":   totalSize,
-		"totalLines":  totalLines,
-		"byExtension": statsList,
-	}, nil
+func getTreeData(db *sql.DB, projectID int64, absProjectPath string) (*tree.Node, error) {
+	// buildFileTree is shared with 'analyze tree' (cmd/analyze.go).
+	return buildFileTree(db, projectID, absProjectPath, nil, "")
 }
 
-func getTreeData(db *sql.DB, projectID int64, absProjectPath string) (*TreeNode, error) {
-	rows, err := db.Query("SELECT relative_path, size_bytes FROM file_metadata WHERE project_id = ? ORDER BY relative_path ASC", projectID)
+// reportFile is one entry of the "files" array of the report context. It prints as its
+// content, so templates written for the former path-to-content map still render with {{{this}}}.
+type reportFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Size     int64  `json:"size"`
+	Tokens   int64  `json:"tokens"`
+	Content  string `json:"content"`
+}
+
+func (f reportFile) String() string {
+	return f.Content
+}
+
+// getContentsData reads the included files, ordered by path (or by the filter's sortBy).
+// Documents and the files of "skip" content handlers are omitted.
+func getContentsData(db *sql.DB, projectID int64, absProjectPath string, f filter.Filter) ([]reportFile, error) {
+	handlers, err := contentHandlers()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	var metas []filter.FileMetadata
+	err = filter.IterateFilteredFiles(db, projectID, f, func(m filter.FileMetadata) error {
+		metas = append(metas, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	warnIfNoMatch(len(metas))
+	if f.SortBy == "" {
+		sort.Slice(metas, func(i, j int) bool { return metas[i].RelativePath < metas[j].RelativePath })
+	}
+	relativePaths := make([]string, len(metas))
+	for i, m := range metas {
+		relativePaths[i] = m.RelativePath
+	}
+	contents := readFileContents(absProjectPath, relativePaths, contentReadOptions{Transform: transformPipeline(f), Handlers: handlers})
+	files := make([]reportFile, 0, len(contents))
+	for _, m := range metas {
+		content, ok := contents[m.RelativePath]
+		if !ok {
+			continue
+		}
+		files = append(files, reportFile{
+			Path:     m.RelativePath,
+			Language: markdown.Language(m.RelativePath),
+			Size:     m.SizeBytes,
+			Tokens:   tokens.Estimate(content),
+			Content:  content,
+		})
+	}
+	return files, nil
+}
+
+// contentsByPath returns the contents of the files keyed by path, the shape of "files" before it became an array.
+func contentsByPath(files []reportFile) map[string]string {
+	contents := make(map[string]string, len(files))
+	for _, f := range files {
+		contents[f.Path] = f.Content
+	}
+	return contents
+}
 
-	root := &TreeNode{Name: filepath.Base(absProjectPath), IsDir: true}
-	nodes := make(map[string]*TreeNode)
-	nodes["."] = root
+// legacyFilesPattern finds templates iterating "files" with @key, which relied on it being a path-to-content map.
+var legacyFilesPattern = regexp.MustCompile(`\{\{#each\s+files\s*\}\}(?s:.*?)@key`)
 
-	for rows.Next() {
-		var dbPath string
-		var size int64
-		if err := rows.Scan(&dbPath, &size); err != nil {
-			return nil, err
+var reportConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage named report configurations",
+	Long:  `A named report configuration binds a template, a filter (profile or JSON), a statistics sort order and an output path, so that a recurring report can be regenerated with a single 'report config run --name ...'.`,
+}
+
+var reportConfigSaveCmd = &cobra.Command{
+	Use:         "save",
+	Annotations: mutatingCommand,
+	Short:       "Save or update a named report configuration",
+	Long: `Saves the given report options under a name for a specific project. If a configuration with the same name already exists, it will be updated.
+The profile is referenced by name, so later changes to the profile are picked up by the next run.
+
+Example:
+  code-prompt-core report config save --project-path /p/proj --name weekly-review --template summary.txt --profile-name go-source --sort lines --output weekly.txt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := viper.GetString("report.config.save.name")
+		opts := reportOptions{
+			Template:    viper.GetString("report.config.save.template"),
+			ProfileName: viper.GetString("report.config.save.profile-name"),
+			FilterJSON:  viper.GetString("report.config.save.filter-json"),
+			Sort:        viper.GetString("report.config.save.sort"),
+			Output:      viper.GetString("report.config.save.output"),
+		}
+		transformOpts, err := transformOverride("report.config.save")
+		if err != nil {
+			printError(err)
+			return
+		}
+		opts.Transform = transformOpts
+		if name == "" || opts.Template == "" {
+			printError(fmt.Errorf("--name and --template are required"))
+			return
+		}
+		if err := sortTemplateStats(nil, opts.Sort); err != nil {
+			printError(err)
+			return
+		}
+		formats, err := parseReportFormats(viper.GetString("report.config.save.formats"))
+		if err != nil {
+			printError(err)
+			return
+		}
+		opts.Formats = formats
+		configData, err := json.Marshal(opts)
+		if err != nil {
+			printError(fmt.Errorf("error encoding report configuration: %w", err))
+			return
+		}
+
+		absProjectPath, err := getAbsoluteProjectPath("report.config.save.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		upsertSQL := `INSERT INTO reports (project_id, report_name, report_config_json) VALUES (?, ?, ?) ON CONFLICT(project_id, report_name) DO UPDATE SET report_config_json = excluded.report_config_json;`
+		if _, err := db.Exec(upsertSQL, projectID, name, string(configData)); err != nil {
+			printError(fmt.Errorf("error saving report configuration: %w", err))
+			return
 		}
+		printJSON(fmt.Sprintf("Report configuration '%s' saved successfully for project '%s'.", name, absProjectPath))
+	},
+}
+
+var reportConfigRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Generate a report from a named report configuration",
+	Long: `Loads a saved report configuration and generates the report exactly as 'report generate' would with the same options.
+Passing --output overrides the saved output path for this run only.
 
-		// *** 关键修改点2：总是使用'/'来分割从数据库读出的路径 ***
-		parts := strings.Split(dbPath, "/")
-		currentPath := ""
+Example:
+  code-prompt-core report config run --project-path /p/proj --name weekly-review`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := viper.GetString("report.config.run.name")
+		if name == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("report.config.run.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
 
-		for i, part := range parts {
-			isDir := i < len(parts)-1
-			if i > 0 {
-				// *** 关键修改点3：使用 path.Join 来构建标准化的路径 ***
-				currentPath = path.Join(currentPath, part)
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		if err := refreshCacheIfStale(db, projectID, absProjectPath); err != nil {
+			printError(err)
+			return
+		}
+		var configData string
+		err = db.QueryRow("SELECT report_config_json FROM reports WHERE project_id = ? AND report_name = ?", projectID, name).Scan(&configData)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				printError(fmt.Errorf("report configuration '%s' not found for this project", name))
 			} else {
-				currentPath = part
+				printError(fmt.Errorf("error loading report configuration: %w", err))
 			}
+			return
+		}
+		var opts reportOptions
+		if err := json.Unmarshal([]byte(configData), &opts); err != nil {
+			printError(fmt.Errorf("error parsing report configuration '%s': %w", name, err))
+			return
+		}
+		if output := viper.GetString("report.config.run.output"); output != "" {
+			opts.Output = output
+		}
+		opts.Raw = viper.GetBool("report.config.run.raw")
+		opts.NoCache = viper.GetBool("report.config.run.no-cache")
 
-			if _, exists := nodes[currentPath]; !exists {
-				newNode := &TreeNode{Name: part, Path: currentPath, IsDir: isDir, Children: []*TreeNode{}}
-				if !isDir {
-					newNode.SizeBytes = size
-				}
+		result, err := renderReport(db, projectID, absProjectPath, opts)
+		if err != nil {
+			printError(err)
+			return
+		}
+		writeReportResult(result, opts)
+	},
+}
 
-				// *** 关键修改点4：使用 path.Dir 来查找父路径 ***
-				parentPath := path.Dir(currentPath)
-				if parent, ok := nodes[parentPath]; ok {
-					parent.Children = append(parent.Children, newNode)
-				}
-				nodes[currentPath] = newNode
-			}
+var reportConfigListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all named report configurations for a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		absProjectPath, err := getAbsoluteProjectPath("report.config.list.project-path")
+		if err != nil {
+			printError(err)
+			return
 		}
-	}
-	// *** 修改：调用在 cmd/analyze.go 中定义的聚合函数 ***
-	calculateTreeAggregates(root)
 
-	// sortTree is defined in cmd/analyze.go, it is shared and correct.
-	sortTree(root)
-	return root, nil
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		rows, err := db.Query("SELECT report_name, report_config_json FROM reports WHERE project_id = ? ORDER BY report_name", projectID)
+		if err != nil {
+			printError(fmt.Errorf("error listing report configurations: %w", err))
+			return
+		}
+		defer rows.Close()
+		type ReportConfig struct {
+			Name   string          `json:"name"`
+			Config json.RawMessage `json:"config"`
+		}
+		configs := []ReportConfig{}
+		for rows.Next() {
+			var rc ReportConfig
+			var dataStr string
+			if err := rows.Scan(&rc.Name, &dataStr); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			rc.Config = json.RawMessage(dataStr)
+			configs = append(configs, rc)
+		}
+		printJSON(configs)
+	},
 }
 
-func getContentsData(db *sql.DB, projectID int64, absProjectPath string, f filter.Filter) (map[string]string, error) {
-	relativePaths, err := filter.GetFilteredFilePaths(db, projectID, f)
-	if err != nil {
-		return nil, err
-	}
-	contentMap := make(map[string]string)
-	for _, relPath := range relativePaths {
-		fullPath := filepath.Join(absProjectPath, filepath.Clean(relPath))
-		content, err := os.ReadFile(fullPath)
+var reportConfigDeleteCmd = &cobra.Command{
+	Use:         "delete",
+	Annotations: mutatingCommand,
+	Short:       "Delete a named report configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		name := viper.GetString("report.config.delete.name")
+		if name == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("report.config.delete.project-path")
 		if err != nil {
-			contentMap[relPath] = fmt.Sprintf("Error: Unable to read file. %v", err)
-		} else {
-			contentMap[relPath] = string(content)
+			printError(err)
+			return
 		}
-	}
-	return contentMap, nil
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		result, err := db.Exec("DELETE FROM reports WHERE project_id = ? AND report_name = ?", projectID, name)
+		if err != nil {
+			printError(fmt.Errorf("error deleting report configuration: %w", err))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			printError(fmt.Errorf("no report configuration found with name '%s' for project '%s'", name, absProjectPath))
+			return
+		}
+		printJSON(fmt.Sprintf("Report configuration '%s' deleted successfully.", name))
+	},
 }
 
 func init() {
@@ -361,14 +1758,83 @@ func init() {
 	reportCmd.AddCommand(reportListTemplatesCmd)
 
 	reportCmd.AddCommand(reportGenerateCmd)
+	reportCmd.AddCommand(reportReplayCmd)
+	reportReplayCmd.Flags().String("manifest", "", "Manifest written by 'report generate --manifest'")
+	reportReplayCmd.Flags().String("output", "", "Write the regenerated report to this file instead of the response")
+	reportReplayCmd.Flags().Bool("raw", false, "Print the regenerated report to stdout without the JSON envelope")
+	viper.BindPFlag("report.replay.manifest", reportReplayCmd.Flags().Lookup("manifest"))
+	viper.BindPFlag("report.replay.output", reportReplayCmd.Flags().Lookup("output"))
+	viper.BindPFlag("report.replay.raw", reportReplayCmd.Flags().Lookup("raw"))
 	reportGenerateCmd.Flags().String("project-path", "", "Path to the project")
 	reportGenerateCmd.Flags().String("template", "summary.txt", "Name of a built-in template or path to a custom .hbs file")
 	reportGenerateCmd.Flags().String("output", "", "Path to the output report file. If empty, prints to stdout.")
 	reportGenerateCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use for filtering content")
 	reportGenerateCmd.Flags().String("filter-json", "", "A temporary JSON string with filter conditions to use (overrides profile-name)")
+	reportGenerateCmd.Flags().String("sort", "size", "Sort order for the per-extension statistics (size, count, lines or name)")
+	reportGenerateCmd.Flags().String("formats", "", "Comma separated output formats to produce in one run (md, html, json)")
 	viper.BindPFlag("report.generate.project-path", reportGenerateCmd.Flags().Lookup("project-path"))
 	viper.BindPFlag("report.generate.template", reportGenerateCmd.Flags().Lookup("template"))
+	reportGenerateCmd.Flags().StringArray("var", nil, "Template variable as key=value, available as {{vars.key}} (repeatable)")
+	reportGenerateCmd.Flags().String("vars-json", "", "JSON object of template variables, available under {{vars}}")
+	viper.BindPFlag("report.generate.var", reportGenerateCmd.Flags().Lookup("var"))
+	viper.BindPFlag("report.generate.vars-json", reportGenerateCmd.Flags().Lookup("vars-json"))
+	reportGenerateCmd.Flags().String("diff-against", "", "Previous report to compare the new one with; prints the differences instead of the report")
+	viper.BindPFlag("report.generate.diff-against", reportGenerateCmd.Flags().Lookup("diff-against"))
+	reportGenerateCmd.Flags().String("template-string", "", "Inline Handlebars template source, used instead of --template")
+	viper.BindPFlag("report.generate.template-string", reportGenerateCmd.Flags().Lookup("template-string"))
 	viper.BindPFlag("report.generate.output", reportGenerateCmd.Flags().Lookup("output"))
 	viper.BindPFlag("report.generate.profile-name", reportGenerateCmd.Flags().Lookup("profile-name"))
 	viper.BindPFlag("report.generate.filter-json", reportGenerateCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("report.generate.sort", reportGenerateCmd.Flags().Lookup("sort"))
+	viper.BindPFlag("report.generate.formats", reportGenerateCmd.Flags().Lookup("formats"))
+	reportGenerateCmd.Flags().Bool("raw", false, "Print the rendered report to stdout without the JSON envelope")
+	viper.BindPFlag("report.generate.raw", reportGenerateCmd.Flags().Lookup("raw"))
+	reportGenerateCmd.Flags().Bool("no-cache", false, "Rebuild the report context instead of reusing the one cached for the current scan and filter")
+	viper.BindPFlag("report.generate.no-cache", reportGenerateCmd.Flags().Lookup("no-cache"))
+	reportGenerateCmd.Flags().String("manifest", "", "Also write a provenance manifest (scan, filter hash, files with content hashes, tokens) to this JSON file")
+	viper.BindPFlag("report.generate.manifest", reportGenerateCmd.Flags().Lookup("manifest"))
+	addTransformFlags(reportGenerateCmd, "report.generate")
+
+	reportCmd.AddCommand(reportConfigCmd)
+
+	reportConfigCmd.AddCommand(reportConfigSaveCmd)
+	reportConfigSaveCmd.Flags().String("project-path", "", "Path to the project")
+	reportConfigSaveCmd.Flags().String("name", "", "Name of the report configuration")
+	reportConfigSaveCmd.Flags().String("template", "summary.txt", "Name of a built-in template or path to a custom .hbs file")
+	reportConfigSaveCmd.Flags().String("profile-name", "", "Name of a saved filter profile to use for filtering content")
+	reportConfigSaveCmd.Flags().String("filter-json", "", "A JSON string with filter conditions to use (overrides profile-name)")
+	reportConfigSaveCmd.Flags().String("sort", "size", "Sort order for the per-extension statistics (size, count, lines or name)")
+	reportConfigSaveCmd.Flags().String("formats", "", "Comma separated output formats to produce in one run (md, html, json)")
+	reportConfigSaveCmd.Flags().String("output", "", "Path to the output report file. If empty, prints to stdout.")
+	viper.BindPFlag("report.config.save.project-path", reportConfigSaveCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("report.config.save.name", reportConfigSaveCmd.Flags().Lookup("name"))
+	viper.BindPFlag("report.config.save.template", reportConfigSaveCmd.Flags().Lookup("template"))
+	viper.BindPFlag("report.config.save.profile-name", reportConfigSaveCmd.Flags().Lookup("profile-name"))
+	viper.BindPFlag("report.config.save.filter-json", reportConfigSaveCmd.Flags().Lookup("filter-json"))
+	viper.BindPFlag("report.config.save.sort", reportConfigSaveCmd.Flags().Lookup("sort"))
+	viper.BindPFlag("report.config.save.formats", reportConfigSaveCmd.Flags().Lookup("formats"))
+	viper.BindPFlag("report.config.save.output", reportConfigSaveCmd.Flags().Lookup("output"))
+	addTransformFlags(reportConfigSaveCmd, "report.config.save")
+
+	reportConfigCmd.AddCommand(reportConfigRunCmd)
+	reportConfigRunCmd.Flags().String("project-path", "", "Path to the project")
+	reportConfigRunCmd.Flags().String("name", "", "Name of the report configuration to run")
+	reportConfigRunCmd.Flags().String("output", "", "Override the saved output path for this run")
+	viper.BindPFlag("report.config.run.project-path", reportConfigRunCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("report.config.run.name", reportConfigRunCmd.Flags().Lookup("name"))
+	viper.BindPFlag("report.config.run.output", reportConfigRunCmd.Flags().Lookup("output"))
+	reportConfigRunCmd.Flags().Bool("raw", false, "Print the rendered report to stdout without the JSON envelope")
+	viper.BindPFlag("report.config.run.raw", reportConfigRunCmd.Flags().Lookup("raw"))
+	reportConfigRunCmd.Flags().Bool("no-cache", false, "Rebuild the report context instead of reusing the one cached for the current scan and filter")
+	viper.BindPFlag("report.config.run.no-cache", reportConfigRunCmd.Flags().Lookup("no-cache"))
+
+	reportConfigCmd.AddCommand(reportConfigListCmd)
+	reportConfigListCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("report.config.list.project-path", reportConfigListCmd.Flags().Lookup("project-path"))
+
+	reportConfigCmd.AddCommand(reportConfigDeleteCmd)
+	reportConfigDeleteCmd.Flags().String("project-path", "", "Path to the project")
+	reportConfigDeleteCmd.Flags().String("name", "", "Name of the report configuration to delete")
+	viper.BindPFlag("report.config.delete.project-path", reportConfigDeleteCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("report.config.delete.name", reportConfigDeleteCmd.Flags().Lookup("name"))
 }
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/aymerick/raymond"
+	"github.com/spf13/viper"
+)
+
+func TestExecHelperDoesNotEscape(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo not available")
+	}
+	registerReportHelpers()
+	viper.Set("report.exec.out", []interface{}{"echo", `a<b>`, "&", `'c'`, `"d"`})
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"double stash", `{{exec "out"}}`, `a<b> & 'c' "d"`},
+		{"triple stash", `{{{exec "out"}}}`, `a<b> & 'c' "d"`},
+		{"with args", `{{exec "out" args="x&y"}}`, `a<b> & 'c' "d" x&y`},
+		{"escaped for HTML", `{{highlight (exec "out") "text"}}`, `a&lt;b&gt; &amp; &#39;c&#39; &#34;d&#34;`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := raymond.Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tpl.RegisterHelper("exec", execHelper(t.TempDir()))
+			got, err := tpl.Exec(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
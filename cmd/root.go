@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -12,27 +14,121 @@ import (
 
 var cfgFile string
 
+const quietEnvVar = "CODE_PROMPT_CORE_QUIET"
+
 var rootCmd = &cobra.Command{
 	Use:   "code-prompt-core",
 	Short: "A high-performance, cross-platform code analysis kernel.",
 	Long: `Code Prompt Core is a standalone command-line tool that can be called by various user interfaces to analyze codebases.
 
 It serves as the backend engine, handling file system scanning, data caching, analysis, and report generation.
-All configurations can be managed via a central configuration file or overridden by command-line flags.`,
+All configurations can be managed via a central configuration file or overridden by command-line flags.
+
+Every '--project-path' flag accepts the value 'auto', which resolves the nearest registered project
+containing the current directory, or else the nearest enclosing git repository root.
+
+Command hooks run shell commands around a command; they are configured under 'hooks' in the config file.
+A key is "pre-" or "post-" and a command path with dashes, and a command group matches all its sub-commands:
+  hooks:
+    pre-report: ./check-clean-tree.sh
+    post-cache-update: [jq -c .data >> scans.log, ./notify.sh]
+Pre hooks get {"command":...,"args":[...]} on stdin, and a failing pre hook aborts the command. Post hooks run
+after the command, successful or not, with its JSON response on stdin and CODE_PROMPT_CORE_STATUS set to
+"success" or "error". Hook output goes to stderr. Commands run from a hook do not run hooks themselves.`,
 }
 
+// preRun enforces --read-only, starts the usage recording and runs the command hooks. It is assigned in init because
+// the usage recording refers back to rootCmd.
+func preRun(cmd *cobra.Command, args []string) error {
+	if viper.GetBool("read-only") && cmd.Annotations[mutatesAnnotation] == "true" {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("'%s' modifies the database and is not allowed with --read-only", cmd.CommandPath())
+	}
+	if viper.GetBool("usage-stats") && !viper.GetBool("read-only") {
+		recordUsage(cmd)
+	}
+	resetResponseMeta()
+	responseOutput = ""
+	for c := cmd; c != nil; c = c.Parent() {
+		if key, ok := responseOutputKeys[c]; ok {
+			responseOutput = viper.GetString(key)
+		}
+	}
+	if err := runPreHooks(cmd, args); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	return nil
+}
+
+// mutatesAnnotation marks commands that write to the database; they are refused with --read-only.
+const mutatesAnnotation = "mutates"
+
+var mutatingCommand = map[string]string{mutatesAnnotation: "true"}
+
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Flag parsing errors happen before viper sees --quiet, so quiet mode is detected up front.
+	quiet := quietRequested(os.Args[1:])
+	if quiet {
+		rootCmd.SilenceErrors = true
+		rootCmd.SilenceUsage = true
+	}
+	err := rootCmd.Execute()
+	runShutdownHooks()
+	if err != nil {
+		if quiet {
+			printError(err)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// quietRequested reports whether quiet mode is enabled by the command line or the
+// CODE_PROMPT_CORE_QUIET environment variable.
+func quietRequested(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-q", "--quiet", "--quiet=true":
+			return true
+		}
+	}
+	quiet, _ := strconv.ParseBool(os.Getenv(quietEnvVar))
+	return quiet
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentPreRunE = preRun
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/code-prompt-core/config.yaml)")
 	rootCmd.PersistentFlags().String("db", "code_prompt.db", "Path to the database file")
 	viper.BindPFlag("db", rootCmd.PersistentFlags().Lookup("db"))
+	rootCmd.PersistentFlags().String("db-name", "", "Use the database registered under this name in the 'dbs' section of the config file")
+	viper.BindPFlag("db-name", rootCmd.PersistentFlags().Lookup("db-name"))
+	rootCmd.PersistentFlags().String("db-key-file", "", "Encrypt the database at rest (AES-256-GCM) with a key derived from this file")
+	viper.BindPFlag("db-key-file", rootCmd.PersistentFlags().Lookup("db-key-file"))
+	rootCmd.PersistentFlags().Bool("read-only", false, "Open the database read-only and refuse every command that would modify it")
+	viper.BindPFlag("read-only", rootCmd.PersistentFlags().Lookup("read-only"))
+	rootCmd.PersistentFlags().String("auto-refresh", "", "Refresh a stale cache before analyze/content/report commands: 'incremental' rescans, 'check' only warns (--auto-refresh alone means incremental)")
+	rootCmd.PersistentFlags().Lookup("auto-refresh").NoOptDefVal = "incremental"
+	rootCmd.PersistentFlags().Duration("auto-refresh-after", 10*time.Minute, "Age after which the cache is considered stale by --auto-refresh")
+	viper.BindPFlag("auto-refresh", rootCmd.PersistentFlags().Lookup("auto-refresh"))
+	viper.BindPFlag("auto-refresh-after", rootCmd.PersistentFlags().Lookup("auto-refresh-after"))
+	rootCmd.PersistentFlags().Bool("no-default-filter", false, "Do not apply the project's default profile when no filter is given")
+	viper.BindPFlag("no-default-filter", rootCmd.PersistentFlags().Lookup("no-default-filter"))
+	rootCmd.PersistentFlags().Bool("strict-filter", false, "Reject filter JSON and profiles with unknown keys (e.g. a misspelt \"includeExt\") instead of ignoring them")
+	viper.BindPFlag("strict-filter", rootCmd.PersistentFlags().Lookup("strict-filter"))
+	rootCmd.PersistentFlags().String("package", "", "Scope the filter of any command to the subtree of this package (a name or root from 'analyze packages')")
+	viper.BindPFlag("package", rootCmd.PersistentFlags().Lookup("package"))
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Machine mode: suppress all non-JSON output so stdout carries exactly one JSON document (env "+quietEnvVar+")")
+	viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
+	viper.BindEnv("quiet", quietEnvVar)
+	rootCmd.PersistentFlags().Bool("usage-stats", false, "Record the command, its duration and response size in the local usage table (see 'analyze usage'); nothing leaves the machine")
+	viper.BindPFlag("usage-stats", rootCmd.PersistentFlags().Lookup("usage-stats"))
+	rootCmd.PersistentFlags().Bool("compact", false, "Print JSON responses on a single line instead of indented")
+	viper.BindPFlag("compact", rootCmd.PersistentFlags().Lookup("compact"))
 }
 
 func initConfig() {
@@ -51,7 +147,7 @@ func initConfig() {
 	viper.AutomaticEnv()
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			fmt.Fprintln(os.Stderr, "Error reading config file:", err)
+			warnf("Error reading config file: %v\n", err)
 		}
 	}
 }
@@ -60,7 +156,7 @@ func ensureDefaultConfig(configPath string) {
 	configFilePath := filepath.Join(configPath, "config.yaml")
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		if err := os.MkdirAll(configPath, 0755); err != nil {
-			fmt.Fprintln(os.Stderr, "Error creating config directory:", err)
+			warnf("Error creating config directory: %v\n", err)
 			return
 		}
 	}
@@ -71,6 +167,18 @@ func ensureDefaultConfig(configPath string) {
 
 db: code_prompt.db
 
+# Named databases, selectable with --db-name:
+# dbs:
+#   work: ~/caches/work.db
+#   personal: ~/caches/personal.db
+
+# Shell commands run before/after a command or command group (see 'code-prompt-core --help'):
+# hooks:
+#   post-cache-update: jq -c .data >> scans.log
+
+# Record command durations and response sizes locally for 'analyze usage':
+# usage-stats: true
+
 cache:
   update:
     incremental: false
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/schedule"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// scanHistoryEntries is the number of scan_history rows kept per project.
+const scanHistoryEntries = 1000
+
+var cacheScheduleCmd = &cobra.Command{
+	Use:         "schedule",
+	Annotations: mutatingCommand,
+	Short:       "Keep the caches of registered projects warm with periodic incremental scans",
+	Long: `Runs as a long-lived process that refreshes the caches of all registered projects (or only the
+'--project-path' ones) with incremental scans, so that interactive commands always hit a warm cache.
+
+The schedule is either a fixed '--interval' or a five-field '--cron' expression (minute hour day-of-month
+month day-of-week, e.g. "*/30 * * * *" or "0 8-18 * * 1-5"), evaluated in local time. A first round runs
+immediately at start-up; '--once' runs only that round and exits, for use from an external scheduler.
+The list of registered projects is read again every round.
+
+Every scan is recorded in the scan history (see 'cache history') and printed to stdout as one JSON line:
+  {"time":"...","project_path":"...","files_added":0,"files_modified":2,"files_deleted":0,"duration_ms":41}
+A failing project (missing directory, scan locked by another process, ...) is reported with an "error" field and
+does not stop the schedule. The scan settings are read from the 'cache.update' section of the config file.
+The process stops after the current scan on SIGINT or SIGTERM, or when its service is stopped (see
+'cache install-service').
+
+Example:
+  code-prompt-core cache schedule --interval 30m
+  code-prompt-core cache schedule --cron "0 * * * *" --project-path /p/proj --project-path /p/other`,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval := viper.GetDuration("cache.schedule.interval")
+		cronExpr := viper.GetString("cache.schedule.cron")
+		once := viper.GetBool("cache.schedule.once")
+		var cron *schedule.Cron
+		switch {
+		case cronExpr != "" && cmd.Flags().Changed("interval"):
+			printError(fmt.Errorf("--interval and --cron cannot be used together"))
+			return
+		case cronExpr != "":
+			var err error
+			if cron, err = schedule.ParseCron(cronExpr); err != nil {
+				printError(err)
+				return
+			}
+		case interval <= 0 && !once:
+			printError(fmt.Errorf("--interval must be positive"))
+			return
+		}
+		var onlyPaths []string
+		for _, p := range viper.GetStringSlice("cache.schedule.project-path") {
+			abs, err := filepath.Abs(p)
+			if p == autoProjectPath {
+				abs, err = resolveAutoProjectPath()
+			}
+			if err != nil {
+				printError(fmt.Errorf("error resolving project path '%s': %w", p, err))
+				return
+			}
+			onlyPaths = append(onlyPaths, abs)
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+
+		ctx, stop := daemonContext()
+		defer stop()
+		encoder := json.NewEncoder(os.Stdout)
+		for {
+			if err := runScheduledRound(ctx, db, onlyPaths, encoder); err != nil {
+				printError(err)
+				return
+			}
+			if once {
+				return
+			}
+			next := time.Now().Add(interval)
+			if cron != nil {
+				if next = cron.Next(time.Now()); next.IsZero() {
+					printError(fmt.Errorf("cron expression '%s' never matches", cronExpr))
+					return
+				}
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	},
+}
+
+// scheduledScan is the JSON line printed for every scan of 'cache schedule'.
+type scheduledScan struct {
+	Time          string `json:"time"`
+	ProjectPath   string `json:"project_path"`
+	FilesAdded    int    `json:"files_added"`
+	FilesModified int    `json:"files_modified"`
+	FilesDeleted  int    `json:"files_deleted"`
+	DurationMs    int64  `json:"duration_ms"`
+	Error         string `json:"error,omitempty"`
+}
+
+// runScheduledRound rescans the registered projects once, in path order. Only errors of
+// the database itself are returned; a failing project is reported and skipped.
+func runScheduledRound(ctx context.Context, db *sql.DB, onlyPaths []string, encoder *json.Encoder) error {
+	rows, err := db.Query("SELECT id, project_path FROM projects ORDER BY project_path")
+	if err != nil {
+		return fmt.Errorf("error listing projects: %w", err)
+	}
+	type project struct {
+		id   int64
+		path string
+	}
+	var projects []project
+	for rows.Next() {
+		var p project
+		if err := rows.Scan(&p.id, &p.path); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		projects = append(projects, p)
+	}
+	rows.Close()
+	wanted := make(map[string]bool, len(onlyPaths))
+	for _, p := range onlyPaths {
+		wanted[p] = true
+	}
+
+	for _, p := range projects {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if len(wanted) > 0 && !wanted[p.path] {
+			continue
+		}
+		started := time.Now()
+		changes, scanErr := scheduledScanProject(db, p.id, p.path)
+		record := scheduledScan{
+			Time:          started.UTC().Format(time.RFC3339),
+			ProjectPath:   p.path,
+			FilesAdded:    changes.Added,
+			FilesModified: changes.Modified,
+			FilesDeleted:  changes.Deleted,
+			DurationMs:    time.Since(started).Milliseconds(),
+		}
+		if scanErr != nil {
+			record.Error = scanErr.Error()
+		}
+		if err := recordScanHistory(db, p.id, record); err != nil {
+			return err
+		}
+		encoder.Encode(record)
+	}
+	return nil
+}
+
+func scheduledScanProject(db *sql.DB, projectID int64, projectPath string) (scanChanges, error) {
+	if info, err := os.Stat(projectPath); err != nil || !info.IsDir() {
+		return scanChanges{}, fmt.Errorf("project directory '%s' not found", projectPath)
+	}
+	release, err := database.AcquireScanLock(db, projectID)
+	if err != nil {
+		var locked *database.ScanLockedError
+		if errors.As(err, &locked) {
+			return scanChanges{}, fmt.Errorf("skipped: %w", err)
+		}
+		return scanChanges{}, err
+	}
+	defer release()
+	scanOpts := scanOptionsFromConfig()
+	if scanOpts.Roots, err = loadScanRoots(db, projectID); err != nil {
+		return scanChanges{}, err
+	}
+	if err := resolveHashAlgorithm(db, projectID, &scanOpts); err != nil {
+		return scanChanges{}, err
+	}
+	return incrementalScan(db, projectID, projectPath, scanOpts, viper.GetInt("cache.update.batch-size"))
+}
+
+func recordScanHistory(db *sql.DB, projectID int64, record scheduledScan) error {
+	_, err := db.Exec("INSERT INTO scan_history (project_id, started_at, duration_ms, files_added, files_modified, files_deleted, error) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		projectID, record.Time, record.DurationMs, record.FilesAdded, record.FilesModified, record.FilesDeleted, record.Error)
+	if err != nil {
+		return fmt.Errorf("error recording scan history: %w", err)
+	}
+	_, err = db.Exec("DELETE FROM scan_history WHERE project_id = ? AND id NOT IN (SELECT id FROM scan_history WHERE project_id = ? ORDER BY id DESC LIMIT ?)",
+		projectID, projectID, scanHistoryEntries)
+	if err != nil {
+		return fmt.Errorf("error pruning scan history: %w", err)
+	}
+	return nil
+}
+
+var cacheHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the scans run by 'cache schedule' for a project",
+	Long: `Lists the most recent scans that 'cache schedule' ran for a project, newest first, with the number of
+files added, modified and deleted, the duration and the error of failed scans.
+
+Example:
+  code-prompt-core cache history --project-path /path/to/project --limit 10`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := getAbsoluteProjectPath("cache.history.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(projectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", projectPath, err))
+			return
+		}
+		rows, err := db.Query("SELECT started_at, duration_ms, files_added, files_modified, files_deleted, error FROM scan_history WHERE project_id = ? ORDER BY id DESC LIMIT ?",
+			projectID, viper.GetInt("cache.history.limit"))
+		if err != nil {
+			printError(fmt.Errorf("error querying scan history: %w", err))
+			return
+		}
+		defer rows.Close()
+		history := []scheduledScan{}
+		for rows.Next() {
+			s := scheduledScan{ProjectPath: projectPath}
+			if err := rows.Scan(&s.Time, &s.DurationMs, &s.FilesAdded, &s.FilesModified, &s.FilesDeleted, &s.Error); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			history = append(history, s)
+		}
+		printJSON(history)
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheScheduleCmd)
+	cacheScheduleCmd.Flags().Duration("interval", 30*time.Minute, "Time between two rounds of scans")
+	cacheScheduleCmd.Flags().String("cron", "", "Five-field cron expression (local time) instead of --interval, e.g. \"*/30 * * * *\"")
+	cacheScheduleCmd.Flags().StringSlice("project-path", nil, "Only refresh these registered projects (repeatable; default all)")
+	cacheScheduleCmd.Flags().Bool("once", false, "Run a single round of scans and exit")
+	viper.BindPFlag("cache.schedule.interval", cacheScheduleCmd.Flags().Lookup("interval"))
+	viper.BindPFlag("cache.schedule.cron", cacheScheduleCmd.Flags().Lookup("cron"))
+	viper.BindPFlag("cache.schedule.project-path", cacheScheduleCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("cache.schedule.once", cacheScheduleCmd.Flags().Lookup("once"))
+
+	cacheCmd.AddCommand(cacheHistoryCmd)
+	cacheHistoryCmd.Flags().String("project-path", "", "Path to the project")
+	cacheHistoryCmd.Flags().Int("limit", 20, "Maximum number of scans to list")
+	viper.BindPFlag("cache.history.project-path", cacheHistoryCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("cache.history.limit", cacheHistoryCmd.Flags().Lookup("limit"))
+}
@@ -0,0 +1,390 @@
+// File: cmd/schema.go
+package cmd
+
+import (
+	"code-prompt-core/pkg/depgraph"
+	"code-prompt-core/pkg/detect"
+	"code-prompt-core/pkg/entrypoints"
+	"code-prompt-core/pkg/filter"
+	"code-prompt-core/pkg/imageinfo"
+	js "code-prompt-core/pkg/jsonschema"
+	"code-prompt-core/pkg/owners"
+	"code-prompt-core/pkg/packages"
+	"code-prompt-core/pkg/sample"
+	"code-prompt-core/pkg/tree"
+)
+
+// Schemas of the response payloads ("data" of the success envelope), by command path
+// without the root command. They are maintained by hand next to the commands: when a
+// command's output changes, its entry here must change too. Commands without an entry
+// are documented with an unconstrained payload.
+
+func message() js.Schema {
+	return js.Describe(js.String(), "Human-readable confirmation message")
+}
+
+func fileMetadataSchema(extra map[string]js.Schema) js.Schema {
+	props := map[string]js.Schema{
+		"relative_path": js.String(),
+		"filename":      js.String(),
+		"extension":     js.String(),
+		"size_bytes":    js.Integer(),
+		"line_count":    js.Integer(),
+		"is_text":       js.Boolean(),
+	}
+	for k, v := range extra {
+		props[k] = v
+	}
+	return js.Object(props)
+}
+
+func scheduledScanSchema() map[string]js.Schema {
+	return map[string]js.Schema{
+		"time":           js.String(),
+		"project_path":   js.String(),
+		"files_added":    js.Integer(),
+		"files_modified": js.Integer(),
+		"files_deleted":  js.Integer(),
+		"duration_ms":    js.Integer(),
+		"error":          js.String(),
+	}
+}
+
+func skippedDirsSchema() js.Schema {
+	return js.Array(js.Object(map[string]js.Schema{"path": js.String(), "entry_count": js.Integer()}))
+}
+
+func responseSchemas() map[string]js.Schema {
+	stringList := js.Array(js.String())
+	schemas := map[string]js.Schema{
+		"analyze filter": js.Array(fileMetadataSchema(map[string]js.Schema{
+			"is_generated":  js.Boolean(),
+			"is_minified":   js.Boolean(),
+			"mode":          js.Describe(js.String(), "Permission bits in octal, e.g. \"0755\""),
+			"is_executable": js.Boolean(),
+			"is_test":       js.Boolean(),
+		})),
+		"analyze summary": js.Object(map[string]js.Schema{
+			"fileCount":      js.Integer(),
+			"totalSizeBytes": js.Integer(),
+			"totalTokens":    js.Integer(),
+			"files":          js.Nullable(js.Array(fileMetadataSchema(nil))),
+			"byExtension": js.Array(js.Object(map[string]js.Schema{
+				"extension":      js.String(),
+				"fileCount":      js.Integer(),
+				"totalSizeBytes": js.Integer(),
+				"totalLines":     js.Integer(),
+				"totalTokens":    js.Integer(),
+			})),
+			"largestFiles": js.Array(js.Object(map[string]js.Schema{
+				"relative_path": js.String(),
+				"size_bytes":    js.Integer(),
+				"tokens":        js.Integer(),
+			})),
+		}),
+		"analyze budget":    js.Reflect(budgetReport{}),
+		"analyze languages": js.Array(js.Reflect(languageShare{})),
+		"analyze oneline":   js.Describe(js.String(), "One-line summary of the filtered files"),
+		"analyze extensions": js.Array(js.Object(map[string]js.Schema{
+			"extension":      js.String(),
+			"fileCount":      js.Integer(),
+			"totalSizeBytes": js.Integer(),
+			"samples":        js.Array(js.String()),
+		})),
+		"filter hash":   js.Reflect(filterHashResult{}),
+		"filter schema": js.Describe(js.Any(), "JSON Schema (draft 2020-12) of the filter JSON"),
+		"filter test": js.Array(js.Object(map[string]js.Schema{
+			"path":     js.String(),
+			"included": js.Boolean(),
+		})),
+		"analyze stats": js.Object(map[string]js.Schema{
+			"totalFiles": js.Integer(),
+			"totalSize":  js.Integer(),
+			"totalLines": js.Integer(),
+			"byExtension": js.Map(js.Object(map[string]js.Schema{
+				"fileCount":  js.Integer(),
+				"totalSize":  js.Integer(),
+				"totalLines": js.Integer(),
+			})),
+			"detected": js.Array(js.Reflect(detect.Detection{})),
+		}),
+		"analyze detect":   js.Array(js.Reflect(detect.Detection{})),
+		"analyze packages": js.Array(js.Reflect(packages.Package{})),
+		"analyze docs":     js.Array(js.Reflect(docEntry{})),
+		"analyze tree": js.Describe(js.OneOf(js.Reflect(tree.Node{}), js.String()),
+			"The tree root node with --format json, the rendered tree text with --format text or markdown"),
+		"analyze expand": js.Object(map[string]js.Schema{
+			"seeds":     stringList,
+			"hops":      js.Integer(),
+			"direction": js.String(),
+			"files":     js.Array(js.Reflect(depgraph.Node{})),
+		}),
+		"analyze entrypoints": js.Array(js.Reflect(entrypoints.EntryPoint{})),
+		"analyze owners": js.Object(map[string]js.Schema{
+			"codeownersFile": js.String(),
+			"by":             js.String(),
+			"owners":         js.Array(js.Reflect(owners.Entry{})),
+		}),
+		"analyze churn": js.Object(map[string]js.Schema{
+			"since":       js.String(),
+			"filesStored": js.Integer(),
+			"files": js.Array(js.Object(map[string]js.Schema{
+				"path":         js.String(),
+				"commits":      js.Integer(),
+				"linesAdded":   js.Integer(),
+				"linesDeleted": js.Integer(),
+				"churn":        js.Integer(),
+			})),
+		}),
+		"analyze embed": js.Object(map[string]js.Schema{
+			"model":      js.String(),
+			"files":      js.Integer(),
+			"embedded":   js.Integer(),
+			"cached":     js.Integer(),
+			"skipped":    js.Integer(),
+			"dimensions": js.Integer(),
+		}),
+		"analyze similar": js.Object(map[string]js.Schema{
+			"query":       js.String(),
+			"model":       js.String(),
+			"notEmbedded": js.Integer(),
+			"results":     js.Array(js.Object(map[string]js.Schema{"path": js.String(), "score": js.Number()})),
+		}),
+		"analyze attributes": js.Describe(js.Map(js.Map(js.Map(js.String()))), "Attributes keyed by file, then plugin, then key"),
+		"analyze usage": js.Object(map[string]js.Schema{
+			"recording":   js.Boolean(),
+			"invocations": js.Integer(),
+			"commands": js.Array(js.Object(map[string]js.Schema{
+				"command":         js.String(),
+				"invocations":     js.Integer(),
+				"failures":        js.Integer(),
+				"totalDurationMs": js.Integer(),
+				"avgDurationMs":   js.Integer(),
+				"p95DurationMs":   js.Integer(),
+				"maxDurationMs":   js.Integer(),
+				"avgResultBytes":  js.Integer(),
+				"maxResultBytes":  js.Integer(),
+			})),
+		}),
+		"cache update": js.Describe(js.ObjectWithOptional(map[string]js.Schema{
+			"status":         js.String(),
+			"plugin_errors":  js.Map(js.String()),
+			"filesScanned":   js.Integer(),
+			"files_added":    js.Integer(),
+			"files_modified": js.Integer(),
+			"files_deleted":  js.Integer(),
+			"to_add":         stringList,
+			"to_modify":      stringList,
+			"to_delete":      stringList,
+			"skipped_dirs":   skippedDirsSchema(),
+		}, []string{"filesScanned", "files_added", "files_modified", "files_deleted", "to_add", "to_modify", "to_delete", "plugin_errors"}),
+			"Full scans report filesScanned, incremental scans the files_* counts, and --dry-run the to_* lists"),
+		"cache schedule": js.Describe(js.ObjectWithOptional(scheduledScanSchema(), []string{"error"}), "One NDJSON line per scan"),
+		"cache history":  js.Array(js.ObjectWithOptional(scheduledScanSchema(), []string{"error"})),
+		"batch": js.Array(js.ObjectWithOptional(map[string]js.Schema{
+			"command":    js.String(),
+			"status":     {"enum": []string{"success", "error", "skipped"}},
+			"data":       js.Describe(js.Any(), "Payload of the command's response"),
+			"output":     js.Describe(js.String(), "Output of commands that do not print a JSON response"),
+			"message":    js.String(),
+			"warnings":   stringList,
+			"durationMs": js.Integer(),
+		}, []string{"data", "output", "message", "warnings"})),
+		"cache install-service": js.ObjectWithOptional(map[string]js.Schema{
+			"platform":   js.String(),
+			"path":       js.String(),
+			"definition": js.String(),
+			"commands":   stringList,
+			"registered": js.Boolean(),
+			"removed":    js.Boolean(),
+		}, []string{"path", "definition", "commands", "removed"}),
+		"cache clear":  js.Object(map[string]js.Schema{"message": js.String(), "filesRemoved": js.Integer()}),
+		"cache unlock": js.Object(map[string]js.Schema{"message": js.String(), "unlocked": js.Boolean()}),
+		"content get": js.Object(map[string]js.Schema{
+			"files": js.Describe(js.Map(js.OneOf(js.String(), js.Reflect(imageinfo.Placeholder{}))),
+				"File content keyed by relative path; images are placeholder objects"),
+			"skipped": js.Array(js.Reflect(skippedFile{})),
+		}),
+		"content sample": js.Object(map[string]js.Schema{
+			"strategy":      js.String(),
+			"maxTokens":     js.Integer(),
+			"totalTokens":   js.Integer(),
+			"sampledTokens": js.Integer(),
+			"sampled":       js.Boolean(),
+			"files":         js.Array(js.Reflect(sample.Excerpt{})),
+			"omitted":       stringList,
+		}),
+		"content summarize": js.Object(map[string]js.Schema{
+			"command":   js.String(),
+			"generated": js.Integer(),
+			"cached":    js.Integer(),
+			"failed":    js.Integer(),
+			"files": js.Map(js.ObjectWithOptional(map[string]js.Schema{
+				"summary": js.String(),
+				"cached":  js.Boolean(),
+				"error":   js.String(),
+			}, []string{"summary", "error"})),
+		}),
+		"content chunks": js.Describe(js.Object(map[string]js.Schema{
+			"id":        js.String(),
+			"path":      js.String(),
+			"startLine": js.Integer(),
+			"endLine":   js.Integer(),
+			"tokens":    js.Integer(),
+			"hash":      js.String(),
+			"content":   js.String(),
+		}), "One NDJSON line per chunk"),
+		"config get":    js.Describe(js.Any(), "The stored value: a string, or decoded JSON for values saved with --json"),
+		"config list":   js.Nullable(js.Array(js.Object(map[string]js.Schema{"key": js.String(), "value": js.Any()}))),
+		"config set":    message(),
+		"config delete": message(),
+		"db prune": js.ObjectWithOptional(map[string]js.Schema{
+			"status":           js.String(),
+			"removedProjects":  stringList,
+			"orphanedRows":     js.Map(js.Integer()),
+			"staleContentRows": js.Map(js.Integer()),
+			"sizeBeforeBytes":  js.Integer(),
+			"sizeAfterBytes":   js.Integer(),
+			"reclaimedBytes":   js.Integer(),
+		}, []string{"sizeBeforeBytes", "sizeAfterBytes", "reclaimedBytes"}),
+		"db diff": js.Object(map[string]js.Schema{
+			"project_path":       js.String(),
+			"other_db":           js.String(),
+			"other_project_path": js.String(),
+			"comparedBy":         js.String(),
+			"identical":          js.Integer(),
+			"onlyInThis":         stringList,
+			"onlyInOther":        stringList,
+			"different": js.Array(js.Object(map[string]js.Schema{
+				"path":           js.String(),
+				"thisHash":       js.String(),
+				"otherHash":      js.String(),
+				"thisSizeBytes":  js.Integer(),
+				"otherSizeBytes": js.Integer(),
+			})),
+		}),
+		"profiles save":     message(),
+		"profiles delete":   message(),
+		"profiles rollback": message(),
+		"profiles list":     js.Nullable(js.Array(js.Object(map[string]js.Schema{"name": js.String(), "data": js.Reflect(filter.Filter{})}))),
+		"profiles load":     js.Reflect(filter.Filter{}),
+		"profiles import-gitignore": js.Object(map[string]js.Schema{
+			"profile":      js.String(),
+			"excludeRegex": stringList,
+			"unsupported":  stringList,
+		}),
+		"profiles list-builtin": js.Array(js.Object(map[string]js.Schema{
+			"name":        js.String(),
+			"description": js.String(),
+			"data":        js.Any(),
+		})),
+		"profiles init": message(),
+		"profiles history": js.Object(map[string]js.Schema{
+			"name":    js.String(),
+			"current": js.Nullable(js.Reflect(filter.Filter{})),
+			"versions": js.Array(js.Object(map[string]js.Schema{
+				"version":     js.Integer(),
+				"archived_at": js.String(),
+				"data":        js.Reflect(filter.Filter{}),
+			})),
+		}),
+		"project add":    message(),
+		"project delete": message(),
+		"project list": js.Nullable(js.Array(js.Object(map[string]js.Schema{
+			"project_path":        js.String(),
+			"last_scan_timestamp": js.String(),
+			"scan_roots":          stringList,
+			"default_profile":     js.String(),
+			"hash_algorithm":      js.String(),
+			"change_detection":    js.String(),
+		}))),
+		"project set-roots":           js.Object(map[string]js.Schema{"project_path": js.String(), "scan_roots": stringList}),
+		"project set-default-profile": js.Object(map[string]js.Schema{"project_path": js.String(), "default_profile": js.String()}),
+		"report list-templates":       js.Array(js.Object(map[string]js.Schema{"name": js.String(), "description": js.String()})),
+		"report generate": js.Describe(js.OneOf(
+			js.String(),
+			js.Object(map[string]js.Schema{"message": js.String(), "outputPath": js.String()}),
+			js.Object(map[string]js.Schema{"message": js.String(), "outputPaths": js.Map(js.String())}),
+			js.Map(js.Any()),
+			js.Reflect(reportDiff{}),
+		), "The rendered text; the written file(s) with --output; with --formats and no --output, the outputs keyed by format; or, with --diff-against, the differences"),
+		"report replay": js.Describe(js.OneOf(
+			js.String(),
+			js.Object(map[string]js.Schema{"message": js.String(), "outputPath": js.String()}),
+		), "The regenerated text, or the written file with --output"),
+		"report config save":   message(),
+		"report config delete": message(),
+		"report config list": js.Nullable(js.Array(js.Object(map[string]js.Schema{
+			"name":   js.String(),
+			"config": js.Reflect(reportOptions{}),
+		}))),
+		"selection save":   js.Object(map[string]js.Schema{"message": js.String(), "fileCount": js.Integer(), "missing": stringList}),
+		"selection delete": message(),
+		"selection list":   js.Nullable(js.Array(js.Object(map[string]js.Schema{"name": js.String(), "paths": stringList}))),
+		"tag add":          message(),
+		"tag remove":       message(),
+		"version":          js.Describe(js.Reflect(versionInfo{}), "With --json; without it the version is printed as plain text"),
+		"tag list":         js.Describe(js.Map(stringList), "Files keyed by tag, or tags of one file with --path"),
+	}
+	// A saved report configuration runs "report generate" with the stored options.
+	schemas["report config run"] = schemas["report generate"]
+	return schemas
+}
+
+// unenvelopedCommands stream their records without the response envelope.
+var unenvelopedCommands = map[string]bool{"content chunks": true, "cache schedule": true}
+
+// envelopeSchema wraps a payload schema into the success/error response envelope, or
+// returns it as is for commands that do not use the envelope.
+func envelopeSchema(commandPath string, data js.Schema) js.Schema {
+	if unenvelopedCommands[commandPath] {
+		data["$schema"] = js.Draft
+		data["title"] = commandPath
+		return data
+	}
+	success := js.ObjectWithOptional(map[string]js.Schema{
+		"status":   {"const": "success"},
+		"data":     data,
+		"meta":     js.Reflect(ResponseMeta{}),
+		"warnings": js.Array(js.String()),
+	}, []string{"data", "meta", "warnings"})
+	failure := js.ObjectWithOptional(map[string]js.Schema{
+		"status":   {"const": "error"},
+		"message":  js.String(),
+		"warnings": js.Array(js.String()),
+	}, []string{"warnings"})
+	schema := js.OneOf(success, failure)
+	schema["$schema"] = js.Draft
+	schema["title"] = commandPath
+	defs := map[string]interface{}{}
+	hoistDefs(defs, schema)
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return schema
+}
+
+// hoistDefs moves the "$defs" of nested schemas (recursive types from js.Reflect) into
+// defs, so they can be placed at the document root where "#/$defs/..." references resolve.
+func hoistDefs(defs map[string]interface{}, node interface{}) {
+	switch n := node.(type) {
+	case js.Schema:
+		if nested, ok := n["$defs"].(map[string]interface{}); ok {
+			delete(n, "$defs")
+			for name, def := range nested {
+				defs[name] = def
+			}
+		}
+		for _, v := range n {
+			hoistDefs(defs, v)
+		}
+	case map[string]interface{}:
+		for _, v := range n {
+			hoistDefs(defs, v)
+		}
+	case []js.Schema:
+		for _, v := range n {
+			hoistDefs(defs, v)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// File: cmd/selection.go
+package cmd
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"code-prompt-core/pkg/database"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// selectionProfilePrefix marks a --profile-name value that refers to a selection set.
+const selectionProfilePrefix = "selection:"
+
+var selectionCmd = &cobra.Command{
+	Use:   "selection",
+	Short: "Manage explicit file selection sets for projects",
+	Long: `A selection set is a saved, explicit list of files, as opposed to the rule-based filters stored in profiles.
+It is meant for ad-hoc, hand-curated prompts such as "the files touched by this refactoring task".
+
+A selection can be used anywhere a profile is accepted by passing '--profile-name selection:<name>', e.g.:
+  code-prompt-core content get --project-path /p/proj --profile-name selection:refactor-task`,
+}
+
+var selectionSaveCmd = &cobra.Command{
+	Use:         "save",
+	Annotations: mutatingCommand,
+	Short:       "Save or update a selection set",
+	Long: `Saves a list of relative file paths as a named selection for a project. If a selection with the same name already exists, it is replaced.
+
+Paths can be given with repeated --path flags and/or read from --paths-file (one path per line, blank lines and lines starting with '#' are ignored; use '-' to read from stdin).
+Paths that are not in the project's cache are still saved, and reported in the "missing" field of the response.
+
+Example:
+  code-prompt-core selection save --project-path /p/proj --name refactor-task --paths-file list.txt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := viper.GetString("selection.save.name")
+		if name == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		paths := viper.GetStringSlice("selection.save.path")
+		if pathsFile := viper.GetString("selection.save.paths-file"); pathsFile != "" {
+			filePaths, err := readPathsFile(pathsFile)
+			if err != nil {
+				printError(err)
+				return
+			}
+			paths = append(paths, filePaths...)
+		}
+		paths = dedupeStrings(normalizeRelativePaths(paths))
+		if len(paths) == 0 {
+			printError(fmt.Errorf("at least one path is required (--path or --paths-file)"))
+			return
+		}
+
+		absProjectPath, err := getAbsoluteProjectPath("selection.save.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+
+		missing := []string{}
+		for _, p := range paths {
+			cached, err := database.For(db).FileCached(projectID, p)
+			if err != nil {
+				printError(fmt.Errorf("error checking file '%s': %w", p, err))
+				return
+			}
+			if !cached {
+				missing = append(missing, p)
+			}
+		}
+
+		pathsJSON, err := json.Marshal(paths)
+		if err != nil {
+			printError(fmt.Errorf("error encoding selection: %w", err))
+			return
+		}
+		upsertSQL := `INSERT INTO selections (project_id, selection_name, paths_json) VALUES (?, ?, ?) ON CONFLICT(project_id, selection_name) DO UPDATE SET paths_json = excluded.paths_json;`
+		if _, err := db.Exec(upsertSQL, projectID, name, string(pathsJSON)); err != nil {
+			printError(fmt.Errorf("error saving selection: %w", err))
+			return
+		}
+		printJSON(map[string]interface{}{
+			"message":   fmt.Sprintf("Selection '%s' saved successfully for project '%s'.", name, absProjectPath),
+			"fileCount": len(paths),
+			"missing":   missing,
+		})
+	},
+}
+
+var selectionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all selection sets for a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		absProjectPath, err := getAbsoluteProjectPath("selection.list.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		rows, err := db.Query("SELECT selection_name, paths_json FROM selections WHERE project_id = ? ORDER BY selection_name", projectID)
+		if err != nil {
+			printError(fmt.Errorf("error listing selections: %w", err))
+			return
+		}
+		defer rows.Close()
+		type Selection struct {
+			Name  string   `json:"name"`
+			Paths []string `json:"paths"`
+		}
+		var selections []Selection
+		for rows.Next() {
+			var sel Selection
+			var pathsStr string
+			if err := rows.Scan(&sel.Name, &pathsStr); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			if err := json.Unmarshal([]byte(pathsStr), &sel.Paths); err != nil {
+				printError(fmt.Errorf("selection '%s' is corrupted: %w", sel.Name, err))
+				return
+			}
+			selections = append(selections, sel)
+		}
+		printJSON(selections)
+	},
+}
+
+var selectionDeleteCmd = &cobra.Command{
+	Use:         "delete",
+	Annotations: mutatingCommand,
+	Short:       "Delete a selection set",
+	Run: func(cmd *cobra.Command, args []string) {
+		name := viper.GetString("selection.delete.name")
+		if name == "" {
+			printError(fmt.Errorf("--name is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("selection.delete.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+		result, err := db.Exec("DELETE FROM selections WHERE project_id = ? AND selection_name = ?", projectID, name)
+		if err != nil {
+			printError(fmt.Errorf("error deleting selection: %w", err))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			printError(fmt.Errorf("no selection found with name '%s' for project '%s'", name, absProjectPath))
+			return
+		}
+		if _, err := db.Exec("UPDATE projects SET default_profile = '' WHERE id = ? AND default_profile = ?", projectID, selectionProfilePrefix+name); err != nil {
+			printError(fmt.Errorf("error clearing default profile: %w", err))
+			return
+		}
+		printJSON(fmt.Sprintf("Selection '%s' deleted successfully.", name))
+	},
+}
+
+// loadSelection returns the paths of a saved selection set.
+func loadSelection(db database.Querier, projectID int64, name string) ([]string, error) {
+	var pathsStr string
+	err := db.QueryRow("SELECT paths_json FROM selections WHERE project_id = ? AND selection_name = ?", projectID, name).Scan(&pathsStr)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("selection '%s' not found for this project", name)
+		}
+		return nil, fmt.Errorf("error loading selection: %w", err)
+	}
+	var paths []string
+	if err := json.Unmarshal([]byte(pathsStr), &paths); err != nil {
+		return nil, fmt.Errorf("selection '%s' is corrupted: %w", name, err)
+	}
+	return paths, nil
+}
+
+// readPathsFile reads one path per line from a file, or from stdin if name is "-".
+// Blank lines and lines starting with '#' are skipped.
+func readPathsFile(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("error opening paths file '%s': %w", name, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var paths []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error reading paths file '%s': %w", name, err)
+	}
+	return paths, nil
+}
+
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+	return result
+}
+
+func init() {
+	rootCmd.AddCommand(selectionCmd)
+
+	selectionCmd.AddCommand(selectionSaveCmd)
+	selectionSaveCmd.Flags().String("project-path", "", "Path to the project")
+	selectionSaveCmd.Flags().String("name", "", "Name of the selection to save")
+	selectionSaveCmd.Flags().StringSlice("path", nil, "Relative path of a file to include (repeatable)")
+	selectionSaveCmd.Flags().String("paths-file", "", "File with one relative path per line ('-' for stdin)")
+	viper.BindPFlag("selection.save.project-path", selectionSaveCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("selection.save.name", selectionSaveCmd.Flags().Lookup("name"))
+	viper.BindPFlag("selection.save.path", selectionSaveCmd.Flags().Lookup("path"))
+	viper.BindPFlag("selection.save.paths-file", selectionSaveCmd.Flags().Lookup("paths-file"))
+
+	selectionCmd.AddCommand(selectionListCmd)
+	selectionListCmd.Flags().String("project-path", "", "Path to the project")
+	viper.BindPFlag("selection.list.project-path", selectionListCmd.Flags().Lookup("project-path"))
+
+	selectionCmd.AddCommand(selectionDeleteCmd)
+	selectionDeleteCmd.Flags().String("project-path", "", "Path to the project")
+	selectionDeleteCmd.Flags().String("name", "", "Name of the selection to delete")
+	viper.BindPFlag("selection.delete.project-path", selectionDeleteCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("selection.delete.name", selectionDeleteCmd.Flags().Lookup("name"))
+}
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"code-prompt-core/pkg/schedule"
+	"code-prompt-core/pkg/service"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// serviceName names the systemd unit and the Windows service of 'cache schedule'.
+	serviceName = "code-prompt-core-schedule"
+	// serviceLabel is the launchd label of 'cache schedule'.
+	serviceLabel = "com.code-prompt-core.schedule"
+)
+
+// installedService is the response of 'cache install-service'.
+type installedService struct {
+	Platform   string   `json:"platform"`
+	Path       string   `json:"path,omitempty"`
+	Definition string   `json:"definition,omitempty"`
+	Commands   []string `json:"commands,omitempty"`
+	Registered bool     `json:"registered"`
+	Removed    bool     `json:"removed,omitempty"`
+}
+
+var cacheInstallServiceCmd = &cobra.Command{
+	Use:   "install-service",
+	Short: "Register 'cache schedule' as an OS service that starts at boot or login",
+	Long: `Generates a service definition running 'cache schedule' and registers it with the service manager of the
+operating system, so that the caches stay warm across reboots without user scripts:
+  Linux    a systemd user unit in ~/.config/systemd/user (with '--system', a system unit in /etc/systemd/system),
+           enabled and started with systemctl; its output goes to the journal
+  macOS    a launchd agent in ~/Library/LaunchAgents (with '--system', a daemon in /Library/LaunchDaemons),
+           loaded with launchctl; its output goes to ~/Library/Logs/code-prompt-core-schedule.log
+  Windows  a service created with sc.exe, started automatically; requires an elevated prompt
+
+The '--interval', '--cron' and '--project-path' flags are passed on to 'cache schedule', as are the global
+'--db', '--config' and '--db-key-file' flags, made absolute. Running the command again replaces the service.
+'--print' only prints the definition; '--uninstall' stops and removes the service.
+
+Example:
+  code-prompt-core cache install-service --interval 15m
+  code-prompt-core cache install-service --cron "0 * * * *" --print
+  code-prompt-core cache install-service --uninstall`,
+	Run: func(cmd *cobra.Command, args []string) {
+		system := viper.GetBool("cache.install-service.system")
+		result, err := serviceFiles(runtime.GOOS, system)
+		if err != nil {
+			printError(err)
+			return
+		}
+		if viper.GetBool("cache.install-service.uninstall") {
+			if err := uninstallService(&result, system); err != nil {
+				printError(err)
+				return
+			}
+			printJSON(result)
+			return
+		}
+
+		def, err := scheduleServiceDefinition(cmd)
+		if err != nil {
+			printError(err)
+			return
+		}
+		switch runtime.GOOS {
+		case "linux":
+			result.Definition = service.Systemd(def, !system)
+		case "darwin":
+			result.Definition = service.Launchd(def)
+		case "windows":
+			result.Definition = service.WindowsCommandLine(def)
+		}
+		if viper.GetBool("cache.install-service.print") {
+			printJSON(result)
+			return
+		}
+		if err := installService(&result, def, system); err != nil {
+			printError(err)
+			return
+		}
+		printJSON(result)
+	},
+}
+
+// serviceFiles returns the platform and definition path of the service.
+func serviceFiles(goos string, system bool) (installedService, error) {
+	result := installedService{Platform: goos}
+	home, err := os.UserHomeDir()
+	if err != nil && !system && goos != "windows" {
+		return result, fmt.Errorf("error resolving home directory: %w", err)
+	}
+	switch goos {
+	case "linux":
+		result.Path = filepath.Join(home, ".config", "systemd", "user", serviceName+".service")
+		if system {
+			result.Path = filepath.Join("/etc/systemd/system", serviceName+".service")
+		}
+	case "darwin":
+		result.Path = filepath.Join(home, "Library", "LaunchAgents", serviceLabel+".plist")
+		if system {
+			result.Path = filepath.Join("/Library/LaunchDaemons", serviceLabel+".plist")
+		}
+	case "windows":
+		if system {
+			return result, fmt.Errorf("--system only applies to Linux and macOS; Windows services always run system-wide")
+		}
+	default:
+		return result, fmt.Errorf("service installation is not supported on %s", goos)
+	}
+	return result, nil
+}
+
+// scheduleServiceDefinition builds the 'cache schedule' command line run by the service.
+func scheduleServiceDefinition(cmd *cobra.Command) (service.Definition, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return service.Definition{}, fmt.Errorf("error resolving executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	dbPath, err := resolveDBPath()
+	if err != nil {
+		return service.Definition{}, err
+	}
+	if dbPath, err = filepath.Abs(dbPath); err != nil {
+		return service.Definition{}, fmt.Errorf("error resolving database path: %w", err)
+	}
+	args := []string{"cache", "schedule", "--db", dbPath}
+	if cfgFile != "" {
+		abs, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return service.Definition{}, fmt.Errorf("error resolving config path: %w", err)
+		}
+		args = append(args, "--config", abs)
+	}
+	if keyFile := viper.GetString("db-key-file"); keyFile != "" {
+		abs, err := filepath.Abs(keyFile)
+		if err != nil {
+			return service.Definition{}, fmt.Errorf("error resolving key file path: %w", err)
+		}
+		args = append(args, "--db-key-file", abs)
+	}
+	if cronExpr := viper.GetString("cache.install-service.cron"); cronExpr != "" {
+		if cmd.Flags().Changed("interval") {
+			return service.Definition{}, fmt.Errorf("--interval and --cron cannot be used together")
+		}
+		if _, err := schedule.ParseCron(cronExpr); err != nil {
+			return service.Definition{}, err
+		}
+		args = append(args, "--cron", cronExpr)
+	} else {
+		interval := viper.GetDuration("cache.install-service.interval")
+		if interval <= 0 {
+			return service.Definition{}, fmt.Errorf("--interval must be positive")
+		}
+		args = append(args, "--interval", interval.String())
+	}
+	for _, p := range viper.GetStringSlice("cache.install-service.project-path") {
+		abs, err := filepath.Abs(p)
+		if p == autoProjectPath {
+			abs, err = resolveAutoProjectPath()
+		}
+		if err != nil {
+			return service.Definition{}, fmt.Errorf("error resolving project path '%s': %w", p, err)
+		}
+		args = append(args, "--project-path", abs)
+	}
+
+	def := service.Definition{
+		Name:        serviceName,
+		Label:       serviceLabel,
+		Description: "code-prompt-core cache schedule",
+		Executable:  executable,
+		Args:        args,
+		WorkingDir:  filepath.Dir(dbPath),
+	}
+	if runtime.GOOS == "darwin" {
+		if home, err := os.UserHomeDir(); err == nil {
+			def.LogPath = filepath.Join(home, "Library", "Logs", serviceName+".log")
+		}
+	}
+	return def, nil
+}
+
+// installService writes the definition and registers it, replacing a previous installation.
+func installService(result *installedService, def service.Definition, system bool) error {
+	var commands [][]string
+	switch runtime.GOOS {
+	case "linux":
+		commands = [][]string{
+			systemctl(system, "daemon-reload"),
+			systemctl(system, "enable", serviceName+".service"),
+			systemctl(system, "restart", serviceName+".service"),
+		}
+	case "darwin":
+		// Unloading fails when the agent is not loaded yet, which is fine.
+		exec.Command("launchctl", "unload", result.Path).Run()
+		commands = [][]string{{"launchctl", "load", "-w", result.Path}}
+	case "windows":
+		exec.Command("sc.exe", "stop", serviceName).Run()
+		exec.Command("sc.exe", "delete", serviceName).Run()
+		commands = [][]string{
+			{"sc.exe", "create", serviceName, "binPath=", result.Definition, "start=", "auto", "DisplayName=", def.Description},
+			{"sc.exe", "start", serviceName},
+		}
+	}
+	if result.Path != "" {
+		if err := os.MkdirAll(filepath.Dir(result.Path), 0755); err != nil {
+			return fmt.Errorf("error creating directory for '%s': %w", result.Path, err)
+		}
+		if err := os.WriteFile(result.Path, []byte(result.Definition), 0644); err != nil {
+			return fmt.Errorf("error writing service definition '%s': %w", result.Path, err)
+		}
+	}
+	for _, c := range commands {
+		if err := runServiceCommand(result, c); err != nil {
+			return err
+		}
+	}
+	result.Registered = true
+	return nil
+}
+
+// uninstallService stops the service and removes its definition.
+func uninstallService(result *installedService, system bool) error {
+	var commands [][]string
+	switch runtime.GOOS {
+	case "linux":
+		if err := runServiceCommand(result, systemctl(system, "disable", "--now", serviceName+".service")); err != nil {
+			return err
+		}
+		commands = [][]string{systemctl(system, "daemon-reload")}
+	case "darwin":
+		if err := runServiceCommand(result, []string{"launchctl", "unload", "-w", result.Path}); err != nil {
+			return err
+		}
+	case "windows":
+		exec.Command("sc.exe", "stop", serviceName).Run()
+		commands = [][]string{{"sc.exe", "delete", serviceName}}
+	}
+	if result.Path != "" {
+		if err := os.Remove(result.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing service definition '%s': %w", result.Path, err)
+		}
+	}
+	for _, c := range commands {
+		if err := runServiceCommand(result, c); err != nil {
+			return err
+		}
+	}
+	result.Removed = true
+	return nil
+}
+
+// systemctl returns a systemctl command line for the user or the system manager.
+func systemctl(system bool, args ...string) []string {
+	if system {
+		return append([]string{"systemctl"}, args...)
+	}
+	return append([]string{"systemctl", "--user"}, args...)
+}
+
+// runServiceCommand runs a service manager command and records it in the result.
+func runServiceCommand(result *installedService, command []string) error {
+	result.Commands = append(result.Commands, strings.Join(command, " "))
+	output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("'%s' failed: %w: %s", strings.Join(command, " "), err, msg)
+		}
+		return fmt.Errorf("'%s' failed: %w", strings.Join(command, " "), err)
+	}
+	return nil
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheInstallServiceCmd)
+	cacheInstallServiceCmd.Flags().Duration("interval", 30*time.Minute, "Time between two rounds of scans, passed on to 'cache schedule'")
+	cacheInstallServiceCmd.Flags().String("cron", "", "Five-field cron expression instead of --interval, passed on to 'cache schedule'")
+	cacheInstallServiceCmd.Flags().StringSlice("project-path", nil, "Only refresh these registered projects (repeatable; default all)")
+	cacheInstallServiceCmd.Flags().Bool("system", false, "Install a system-wide service instead of a per-user one (Linux and macOS; needs root)")
+	cacheInstallServiceCmd.Flags().Bool("print", false, "Only print the service definition, without installing it")
+	cacheInstallServiceCmd.Flags().Bool("uninstall", false, "Stop and remove the service")
+	viper.BindPFlag("cache.install-service.interval", cacheInstallServiceCmd.Flags().Lookup("interval"))
+	viper.BindPFlag("cache.install-service.cron", cacheInstallServiceCmd.Flags().Lookup("cron"))
+	viper.BindPFlag("cache.install-service.project-path", cacheInstallServiceCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("cache.install-service.system", cacheInstallServiceCmd.Flags().Lookup("system"))
+	viper.BindPFlag("cache.install-service.print", cacheInstallServiceCmd.Flags().Lookup("print"))
+	viper.BindPFlag("cache.install-service.uninstall", cacheInstallServiceCmd.Flags().Lookup("uninstall"))
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// daemonContext returns the context of a long-running command. Started by the service control
+// manager (see 'cache install-service'), the process reports itself running and the context
+// is cancelled when the service is stopped; otherwise it is cancelled on Ctrl+C.
+func daemonContext() (context.Context, context.CancelFunc) {
+	if isService, err := svc.IsWindowsService(); err != nil || !isService {
+		return signal.NotifyContext(context.Background(), os.Interrupt)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		svc.Run(serviceName, serviceHandler{cancel: cancel})
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+type serviceHandler struct {
+	cancel context.CancelFunc
+}
+
+func (h serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for r := range requests {
+		switch r.Cmd {
+		case svc.Interrogate:
+			status <- r.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			h.cancel()
+			return false, 0
+		}
+	}
+	return false, 0
+}
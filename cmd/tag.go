@@ -0,0 +1,251 @@
+// File: cmd/tag.go
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code-prompt-core/pkg/database"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage semantic tags on cached files",
+	Long: `Tags attach free-form labels (e.g. "hot-path", "public-api") to files of a project, independent of their paths.
+Tagged files can then be selected in any filter JSON with "includeTags" and "excludeTags":
+{
+  "includeTags": ["core-logic"],
+  "excludeTags": ["deprecated"]
+}`,
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:         "add",
+	Annotations: mutatingCommand,
+	Short:       "Attach a tag to one or more files",
+	Long: `Attaches a tag to the given files. The files must exist in the project's cache. Adding a tag that is already attached is a no-op.
+
+Example:
+  code-prompt-core tag add --project-path /p/proj --tag core-logic --path pkg/filter/filter.go --path pkg/scanner/scanner.go`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tag := strings.TrimSpace(viper.GetString("tag.add.tag"))
+		paths := normalizeRelativePaths(viper.GetStringSlice("tag.add.path"))
+		if tag == "" || len(paths) == 0 {
+			printError(fmt.Errorf("--tag and at least one --path are required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("tag.add.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			printError(fmt.Errorf("error starting transaction: %w", err))
+			return
+		}
+		for _, p := range paths {
+			var exists int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM file_metadata WHERE project_id = ? AND relative_path = ?", projectID, p).Scan(&exists); err != nil {
+				tx.Rollback()
+				printError(fmt.Errorf("error checking file '%s': %w", p, err))
+				return
+			}
+			if exists == 0 {
+				tx.Rollback()
+				printError(fmt.Errorf("file '%s' is not in the cache of project '%s'", p, absProjectPath))
+				return
+			}
+			if _, err := tx.Exec("INSERT OR IGNORE INTO file_tags (project_id, relative_path, tag) VALUES (?, ?, ?)", projectID, p, tag); err != nil {
+				tx.Rollback()
+				printError(fmt.Errorf("error tagging file '%s': %w", p, err))
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			printError(fmt.Errorf("error committing tags: %w", err))
+			return
+		}
+		printJSON(fmt.Sprintf("Tag '%s' added to %d file(s).", tag, len(paths)))
+	},
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:         "remove",
+	Annotations: mutatingCommand,
+	Short:       "Detach a tag from files",
+	Long: `Detaches a tag from the given files. Without --path, the tag is removed from every file of the project.
+
+Example:
+  code-prompt-core tag remove --project-path /p/proj --tag core-logic --path pkg/filter/filter.go`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tag := strings.TrimSpace(viper.GetString("tag.remove.tag"))
+		paths := normalizeRelativePaths(viper.GetStringSlice("tag.remove.path"))
+		if tag == "" {
+			printError(fmt.Errorf("--tag is required"))
+			return
+		}
+		absProjectPath, err := getAbsoluteProjectPath("tag.remove.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+
+		var removed int64
+		if len(paths) == 0 {
+			result, err := db.Exec("DELETE FROM file_tags WHERE project_id = ? AND tag = ?", projectID, tag)
+			if err != nil {
+				printError(fmt.Errorf("error removing tag: %w", err))
+				return
+			}
+			removed, _ = result.RowsAffected()
+		} else {
+			for _, p := range paths {
+				result, err := db.Exec("DELETE FROM file_tags WHERE project_id = ? AND tag = ? AND relative_path = ?", projectID, tag, p)
+				if err != nil {
+					printError(fmt.Errorf("error removing tag from '%s': %w", p, err))
+					return
+				}
+				n, _ := result.RowsAffected()
+				removed += n
+			}
+		}
+		if removed == 0 {
+			printError(fmt.Errorf("tag '%s' is not attached to the given files", tag))
+			return
+		}
+		printJSON(fmt.Sprintf("Tag '%s' removed from %d file(s).", tag, removed))
+	},
+}
+
+var tagListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tags and the files they are attached to",
+	Long: `Lists the tags of a project as an object mapping each tag to its files.
+Use --tag to only show one tag, or --path to only show the tags of one file.
+
+Example:
+  code-prompt-core tag list --project-path /p/proj --tag core-logic`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tagFilter := strings.TrimSpace(viper.GetString("tag.list.tag"))
+		pathFilter := ""
+		if paths := normalizeRelativePaths([]string{viper.GetString("tag.list.path")}); len(paths) > 0 {
+			pathFilter = paths[0]
+		}
+		absProjectPath, err := getAbsoluteProjectPath("tag.list.project-path")
+		if err != nil {
+			printError(err)
+			return
+		}
+
+		db, err := openDatabase()
+		if err != nil {
+			printError(fmt.Errorf("error initializing database: %w", err))
+			return
+		}
+		defer database.Close(db)
+		projectID, err := database.For(db).ProjectID(absProjectPath)
+		if err != nil {
+			printError(fmt.Errorf("error finding project '%s': %w", absProjectPath, err))
+			return
+		}
+
+		query := "SELECT tag, relative_path FROM file_tags WHERE project_id = ?"
+		params := []interface{}{projectID}
+		if tagFilter != "" {
+			query += " AND tag = ?"
+			params = append(params, tagFilter)
+		}
+		if pathFilter != "" {
+			query += " AND relative_path = ?"
+			params = append(params, pathFilter)
+		}
+		rows, err := db.Query(query+" ORDER BY tag, relative_path", params...)
+		if err != nil {
+			printError(fmt.Errorf("error listing tags: %w", err))
+			return
+		}
+		defer rows.Close()
+		tags := make(map[string][]string)
+		for rows.Next() {
+			var tag, relPath string
+			if err := rows.Scan(&tag, &relPath); err != nil {
+				printError(fmt.Errorf("error scanning row: %w", err))
+				return
+			}
+			tags[tag] = append(tags[tag], relPath)
+		}
+		printJSON(tags)
+	},
+}
+
+// normalizeRelativePaths converts user supplied paths to the slash-separated, cleaned form stored in the cache.
+func normalizeRelativePaths(paths []string) []string {
+	var result []string
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		result = append(result, strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "./"))
+	}
+	return result
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	tagCmd.AddCommand(tagAddCmd)
+	tagAddCmd.Flags().String("project-path", "", "Path to the project")
+	tagAddCmd.Flags().StringSlice("path", nil, "Relative path of a file to tag (repeatable)")
+	tagAddCmd.Flags().String("tag", "", "Tag to attach")
+	viper.BindPFlag("tag.add.project-path", tagAddCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("tag.add.path", tagAddCmd.Flags().Lookup("path"))
+	viper.BindPFlag("tag.add.tag", tagAddCmd.Flags().Lookup("tag"))
+
+	tagCmd.AddCommand(tagRemoveCmd)
+	tagRemoveCmd.Flags().String("project-path", "", "Path to the project")
+	tagRemoveCmd.Flags().StringSlice("path", nil, "Relative path of a file to untag (repeatable, default: all files)")
+	tagRemoveCmd.Flags().String("tag", "", "Tag to detach")
+	viper.BindPFlag("tag.remove.project-path", tagRemoveCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("tag.remove.path", tagRemoveCmd.Flags().Lookup("path"))
+	viper.BindPFlag("tag.remove.tag", tagRemoveCmd.Flags().Lookup("tag"))
+
+	tagCmd.AddCommand(tagListCmd)
+	tagListCmd.Flags().String("project-path", "", "Path to the project")
+	tagListCmd.Flags().String("path", "", "Only show the tags of this file")
+	tagListCmd.Flags().String("tag", "", "Only show this tag")
+	viper.BindPFlag("tag.list.project-path", tagListCmd.Flags().Lookup("project-path"))
+	viper.BindPFlag("tag.list.path", tagListCmd.Flags().Lookup("path"))
+	viper.BindPFlag("tag.list.tag", tagListCmd.Flags().Lookup("tag"))
+}
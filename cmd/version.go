@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"code-prompt-core/pkg/database"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X code-prompt-core/cmd.version=v1.2.0 -X code-prompt-core/cmd.commit=abc1234 -X code-prompt-core/cmd.buildDate=2024-05-01T12:00:00Z"
+//
+// When they are not set, the commit and date are taken from the VCS information that
+// 'go build' embeds in binaries built inside a git checkout.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	// SchemaVersion is the database schema version this binary creates and migrates to.
+	SchemaVersion int `json:"schemaVersion"`
+	// DatabaseSchemaVersion is the schema version of the database file that commands would
+	// open, or nil when it does not exist yet or cannot be read (for example when encrypted).
+	DatabaseSchemaVersion *int `json:"databaseSchemaVersion"`
+}
+
+func buildVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:       version,
+		Commit:        commit,
+		BuildDate:     buildDate,
+		GoVersion:     runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		SchemaVersion: database.SchemaVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, build metadata and database schema version",
+	Long: `Prints the binary version, commit, build date, Go version and the database schema version
+this binary uses. With --json the information is a JSON response, which also includes the
+schema version of the database file selected by --db/--db-name; a wrapper can compare the two
+(or check 'schemaVersion' against the versions it supports) before driving the core.
+The database file is only inspected, never created or migrated.
+
+Example:
+  code-prompt-core version
+  code-prompt-core version --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		info := buildVersionInfo()
+		if !viper.GetBool("version.json") {
+			commit := info.Commit
+			if commit == "" {
+				commit = "unknown"
+			}
+			fmt.Printf("%s %s (commit %s, built %s, %s %s, schema version %d)\n",
+				rootCmd.Name(), info.Version, commit, info.BuildDate, info.GoVersion, info.Platform, info.SchemaVersion)
+			return
+		}
+		if viper.GetString("db-key-file") == "" {
+			if dbPath, err := resolveDBPath(); err == nil {
+				if v, err := database.FileSchemaVersion(dbPath); err == nil {
+					info.DatabaseSchemaVersion = &v
+				}
+			}
+		}
+		printJSON(info)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.Version = version
+	versionCmd.Flags().Bool("json", false, "Print the version information as a JSON response")
+	viper.BindPFlag("version.json", versionCmd.Flags().Lookup("json"))
+}
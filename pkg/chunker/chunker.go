@@ -0,0 +1,73 @@
+// File: pkg/chunker/chunker.go
+package chunker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"code-prompt-core/pkg/tokens"
+)
+
+// Chunk is a contiguous range of lines of a file.
+type Chunk struct {
+	// StartLine and EndLine are 1-based and inclusive.
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Tokens    int64  `json:"tokens"`
+	Hash      string `json:"hash"`
+	Content   string `json:"content"`
+}
+
+// Split cuts content into chunks of whole lines of at most chunkTokens tokens each.
+// Consecutive chunks share trailing lines worth up to overlapTokens tokens. A single
+// line longer than chunkTokens becomes a chunk of its own. Chunk boundaries depend only
+// on the content, so unchanged files always produce the same chunks and hashes.
+func Split(content string, chunkTokens, overlapTokens int64) []Chunk {
+	if content == "" {
+		return nil
+	}
+	if overlapTokens >= chunkTokens {
+		overlapTokens = chunkTokens / 2
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	lineTokens := make([]int64, len(lines))
+	for i, line := range lines {
+		lineTokens[i] = tokens.Estimate(line)
+	}
+
+	var chunks []Chunk
+	start := 0
+	for start < len(lines) {
+		end := start
+		var size int64
+		for end < len(lines) && (end == start || size+lineTokens[end] <= chunkTokens) {
+			size += lineTokens[end]
+			end++
+		}
+		text := strings.Join(lines[start:end], "")
+		sum := sha256.Sum256([]byte(text))
+		chunks = append(chunks, Chunk{
+			StartLine: start + 1,
+			EndLine:   end,
+			Tokens:    size,
+			Hash:      hex.EncodeToString(sum[:]),
+			Content:   text,
+		})
+		if end == len(lines) {
+			break
+		}
+		// Step back over the overlap, but always advance by at least one line.
+		next := end
+		var overlap int64
+		for next-1 > start && overlap+lineTokens[next-1] <= overlapTokens {
+			next--
+			overlap += lineTokens[next]
+		}
+		start = next
+	}
+	return chunks
+}
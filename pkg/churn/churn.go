@@ -0,0 +1,92 @@
+// File: pkg/churn/churn.go
+package churn
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileChurn is the git activity of one file.
+type FileChurn struct {
+	Path         string `json:"path"`
+	Commits      int    `json:"commits"`
+	LinesAdded   int64  `json:"linesAdded"`
+	LinesDeleted int64  `json:"linesDeleted"`
+}
+
+// Churn is the number of changed lines, the measure used by the "minChurn" filter rule.
+func (c FileChurn) Churn() int64 {
+	return c.LinesAdded + c.LinesDeleted
+}
+
+var shortDuration = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// SinceArgument converts short durations ("90d", "12w", "6m", "1y") into a value for
+// 'git log --since'; anything else (dates, "3 months ago") is passed through unchanged.
+func SinceArgument(since string) string {
+	m := shortDuration.FindStringSubmatch(strings.TrimSpace(since))
+	if m == nil {
+		return since
+	}
+	unit := map[string]string{"d": "days", "w": "weeks", "m": "months", "y": "years"}[m[2]]
+	return m[1] + " " + unit + " ago"
+}
+
+// FromGit computes per-file churn from the non-merge commits since the given time below
+// projectPath. Paths are relative to projectPath; binary changes count as commits only.
+func FromGit(projectPath, since string) (map[string]*FileChurn, error) {
+	args := []string{"-C", projectPath, "log", "--no-merges", "--relative", "--numstat", "--format=%x00"}
+	if since != "" {
+		args = append(args, "--since="+SinceArgument(since))
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	files := make(map[string]*FileChurn)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := renamedPath(fields[2])
+		fc := files[path]
+		if fc == nil {
+			fc = &FileChurn{Path: path}
+			files[path] = fc
+		}
+		fc.Commits++
+		// Binary files are reported as "-\t-".
+		if added, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			fc.LinesAdded += added
+		}
+		if deleted, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			fc.LinesDeleted += deleted
+		}
+	}
+	return files, nil
+}
+
+// renamedPath returns the new path of a numstat rename entry such as "a/{old => new}/b"
+// or "old => new".
+func renamedPath(path string) string {
+	if !strings.Contains(path, " => ") {
+		return path
+	}
+	if open := strings.Index(path, "{"); open >= 0 {
+		if end := strings.Index(path[open:], "}"); end >= 0 {
+			inner := path[open+1 : open+end]
+			parts := strings.SplitN(inner, " => ", 2)
+			result := path[:open] + parts[1] + path[open+end+1:]
+			return strings.TrimPrefix(strings.ReplaceAll(result, "//", "/"), "/")
+		}
+	}
+	return strings.SplitN(path, " => ", 2)[1]
+}
@@ -3,24 +3,60 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// schemaVersion is stored in PRAGMA user_version. Bump it whenever the schema statements or
+// migrate change, so existing databases are brought up to date on their next open.
+const schemaVersion = 13
+
+// SchemaVersion is the schema version that this build creates and migrates databases to.
+const SchemaVersion = schemaVersion
+
+// connectionPragmas are applied to every pooled connection through the DSN; a plain
+// "PRAGMA ..." statement would only affect the one connection that happened to run it.
+var connectionPragmas = []string{
+	"busy_timeout(5000)",
+	"foreign_keys(1)",
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+	"cache_size(-16000)",
+	"temp_store(MEMORY)",
+}
+
 func InitializeDB(dbPath string) (*sql.DB, error) {
-	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000", dbPath)
+	dsn := "file:" + dbPath + "?_pragma=" + strings.Join(connectionPragmas, "&_pragma=")
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
 	}
+	// SQLite has a single writer; a small pool is enough for concurrent readers.
+	db.SetMaxOpenConns(4)
+	db.SetMaxIdleConns(2)
+	db.SetConnMaxIdleTime(time.Minute)
 
-	statement := `
-	PRAGMA foreign_keys = ON;
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if version >= schemaVersion {
+		return db, nil
+	}
 
+	statement := `
 	CREATE TABLE IF NOT EXISTS projects (
 		id                  INTEGER PRIMARY KEY AUTOINCREMENT,
 		project_path        TEXT NOT NULL UNIQUE,
-		last_scan_timestamp TEXT NOT NULL
+		last_scan_timestamp TEXT NOT NULL,
+		scan_roots          TEXT NOT NULL DEFAULT '[]',
+		default_profile     TEXT NOT NULL DEFAULT '',
+		hash_algorithm      TEXT NOT NULL DEFAULT 'sha256',
+		change_detection    TEXT NOT NULL DEFAULT 'hash'
 	);
 
 	CREATE TABLE IF NOT EXISTS file_metadata (
@@ -33,11 +69,18 @@ func InitializeDB(dbPath string) (*sql.DB, error) {
 		is_text         BOOLEAN NOT NULL,
 		last_mod_time   TEXT NOT NULL,
 		content_hash    TEXT NOT NULL,
+		is_generated    BOOLEAN NOT NULL DEFAULT 0,
+		is_minified     BOOLEAN NOT NULL DEFAULT 0,
+		mode            INTEGER NOT NULL DEFAULT 0,
+		is_executable   BOOLEAN NOT NULL DEFAULT 0,
+		is_test         BOOLEAN NOT NULL DEFAULT 0,
 		UNIQUE (project_id, relative_path),
 		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_file_metadata_project_id ON file_metadata(project_id);
+	-- (project_id, relative_path) lookups use the index of the UNIQUE constraint above.
+	CREATE INDEX IF NOT EXISTS idx_file_metadata_project_ext ON file_metadata(project_id, extension);
 
 	CREATE TABLE IF NOT EXISTS profiles (
 		id                  INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -48,9 +91,154 @@ func InitializeDB(dbPath string) (*sql.DB, error) {
 		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
 	);
 
+	CREATE TABLE IF NOT EXISTS profile_versions (
+		id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id          INTEGER NOT NULL,
+		profile_name        TEXT NOT NULL,
+		version             INTEGER NOT NULL,
+		profile_data_json   TEXT NOT NULL,
+		archived_at         TEXT NOT NULL,
+		UNIQUE (project_id, profile_name, version),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS reports (
+		id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id          INTEGER NOT NULL,
+		report_name         TEXT NOT NULL,
+		report_config_json  TEXT NOT NULL,
+		UNIQUE (project_id, report_name),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS file_tags (
+		project_id      INTEGER NOT NULL,
+		relative_path   TEXT NOT NULL,
+		tag             TEXT NOT NULL,
+		UNIQUE (project_id, relative_path, tag),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_file_tags_project_tag ON file_tags(project_id, tag);
+
+	CREATE TABLE IF NOT EXISTS selections (
+		id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id          INTEGER NOT NULL,
+		selection_name      TEXT NOT NULL,
+		paths_json          TEXT NOT NULL,
+		UNIQUE (project_id, selection_name),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
 	CREATE TABLE IF NOT EXISTS kv_store (
 		key TEXT PRIMARY KEY NOT NULL,
-		value TEXT
+		value TEXT,
+		is_json BOOLEAN NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS project_kv_store (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		key        TEXT NOT NULL,
+		value      TEXT,
+		is_json    BOOLEAN NOT NULL DEFAULT 0,
+		UNIQUE (project_id, key),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS file_churn (
+		project_id    INTEGER NOT NULL,
+		relative_path TEXT NOT NULL,
+		commits       INTEGER NOT NULL,
+		lines_added   INTEGER NOT NULL,
+		lines_deleted INTEGER NOT NULL,
+		UNIQUE (project_id, relative_path),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	-- Key/value metadata returned by the scan plugins ('plugins.scan' in the config file).
+	CREATE TABLE IF NOT EXISTS file_attributes (
+		project_id    INTEGER NOT NULL,
+		relative_path TEXT NOT NULL,
+		plugin        TEXT NOT NULL,
+		key           TEXT NOT NULL,
+		value         TEXT NOT NULL,
+		UNIQUE (project_id, relative_path, plugin, key),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	-- Scans run by 'cache schedule', newest last.
+	CREATE TABLE IF NOT EXISTS scan_history (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id     INTEGER NOT NULL,
+		started_at     TEXT NOT NULL,
+		duration_ms    INTEGER NOT NULL,
+		files_added    INTEGER NOT NULL DEFAULT 0,
+		files_modified INTEGER NOT NULL DEFAULT 0,
+		files_deleted  INTEGER NOT NULL DEFAULT 0,
+		error          TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_scan_history_project ON scan_history(project_id, started_at);
+
+	-- Report sections cached by 'report generate', keyed by the scan state and the filter.
+	CREATE TABLE IF NOT EXISTS report_cache (
+		project_id     INTEGER NOT NULL,
+		cache_key      TEXT NOT NULL,
+		scan_timestamp TEXT NOT NULL,
+		sections       BLOB NOT NULL,
+		created_at     TEXT NOT NULL,
+		PRIMARY KEY (project_id, cache_key),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	-- Opt-in local usage statistics (--usage-stats); not tied to a project.
+	CREATE TABLE IF NOT EXISTS usage (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		command      TEXT NOT NULL,
+		started_at   TEXT NOT NULL,
+		duration_ms  INTEGER NOT NULL,
+		result_bytes INTEGER NOT NULL,
+		success      BOOLEAN NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_usage_started_at ON usage(started_at);
+
+	-- Summaries are keyed by content, not by project, so identical files share them.
+	CREATE TABLE IF NOT EXISTS summaries (
+		content_hash TEXT NOT NULL,
+		command      TEXT NOT NULL,
+		summary      TEXT NOT NULL,
+		created_at   TEXT NOT NULL,
+		PRIMARY KEY (content_hash, command)
+	);
+
+	-- Vectors are little-endian float32 values; model is "<provider>:<model>".
+	CREATE TABLE IF NOT EXISTS embeddings (
+		content_hash TEXT NOT NULL,
+		model        TEXT NOT NULL,
+		dimensions   INTEGER NOT NULL,
+		vector       BLOB NOT NULL,
+		created_at   TEXT NOT NULL,
+		PRIMARY KEY (content_hash, model)
+	);
+
+	-- Contents shown by reports written with --manifest, keyed by their SHA-256, so that
+	-- 'report replay' can regenerate them. Like summaries, they are not tied to a project;
+	-- created_at is refreshed whenever a manifest records the content again.
+	CREATE TABLE IF NOT EXISTS content_blobs (
+		hash       TEXT PRIMARY KEY NOT NULL,
+		content    BLOB NOT NULL,
+		created_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS scan_locks (
+		project_id  INTEGER PRIMARY KEY NOT NULL,
+		pid         INTEGER NOT NULL,
+		hostname    TEXT NOT NULL,
+		acquired_at TEXT NOT NULL,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
 	);
 	`
 	_, err = db.Exec(statement)
@@ -58,5 +246,202 @@ func InitializeDB(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
+
+// OpenReadOnly opens an existing database without write access: the file is opened with
+// mode=ro and every connection is query_only, so nothing can modify the cache. The schema is
+// never created or migrated; a database older than this binary must be opened once normally.
+func OpenReadOnly(dbPath string) (*sql.DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("cannot open database read-only: %w", err)
+	}
+	pragmas := []string{"busy_timeout(5000)", "query_only(1)"}
+	dsn := "file:" + dbPath + "?mode=ro&_pragma=" + strings.Join(pragmas, "&_pragma=")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(4)
+	db.SetMaxIdleConns(2)
+	db.SetConnMaxIdleTime(time.Minute)
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if version < schemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("database schema version %d is older than %d; open it once without --read-only to migrate it", version, schemaVersion)
+	}
+	return db, nil
+}
+
+// FileSchemaVersion reads the schema version of an existing database file without opening
+// it for use, so it neither migrates the file nor rejects an outdated one.
+func FileSchemaVersion(dbPath string) (int, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// migrate brings databases created by older versions up to date.
+// Columns added after a table was first released must be listed here, since
+// CREATE TABLE IF NOT EXISTS does not alter existing tables.
+func migrate(db *sql.DB) error {
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"projects", "scan_roots", "TEXT NOT NULL DEFAULT '[]'"},
+		{"projects", "default_profile", "TEXT NOT NULL DEFAULT ''"},
+		{"projects", "hash_algorithm", "TEXT NOT NULL DEFAULT 'sha256'"},
+		{"projects", "change_detection", "TEXT NOT NULL DEFAULT 'hash'"},
+		{"file_metadata", "is_generated", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"file_metadata", "is_minified", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"file_metadata", "mode", "INTEGER NOT NULL DEFAULT 0"},
+		{"file_metadata", "is_executable", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"file_metadata", "is_test", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"kv_store", "is_json", "BOOLEAN NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("error migrating column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	// Older versions did not enable foreign keys on every connection, so deleting a project
+	// could leave rows behind. Remove them before cascades are relied upon.
+	if _, err := RemoveOrphans(db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// projectTables are the tables whose rows belong to a project through project_id.
+var projectTables = []string{"file_metadata", "profiles", "profile_versions", "reports", "file_tags", "selections", "project_kv_store", "scan_locks", "file_churn", "file_attributes", "report_cache", "scan_history"}
+
+// RemoveOrphans deletes rows that reference a project that no longer exists and returns
+// the number of rows removed per table (tables without orphans are omitted).
+func RemoveOrphans(db *sql.DB) (map[string]int64, error) {
+	return orphans(db, true)
+}
+
+// CountOrphans reports the rows RemoveOrphans would delete, without deleting them.
+func CountOrphans(db *sql.DB) (map[string]int64, error) {
+	return orphans(db, false)
+}
+
+func orphans(db *sql.DB, remove bool) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, table := range projectTables {
+		where := fmt.Sprintf("FROM %s WHERE project_id NOT IN (SELECT id FROM projects)", table)
+		var n int64
+		if remove {
+			result, err := db.Exec("DELETE " + where)
+			if err != nil {
+				return counts, fmt.Errorf("error removing orphaned rows from %s: %w", table, err)
+			}
+			n, _ = result.RowsAffected()
+		} else if err := db.QueryRow("SELECT COUNT(*) " + where).Scan(&n); err != nil {
+			return counts, fmt.Errorf("error counting orphaned rows in %s: %w", table, err)
+		}
+		if n > 0 {
+			counts[table] = n
+		}
+	}
+	return counts, nil
+}
+
+// contentTables are the tables keyed by content rather than by project. Their rows are
+// aged out by created_at instead.
+var contentTables = []string{"content_blobs", "summaries", "embeddings"}
+
+// RemoveStaleContent deletes the rows of the content tables created before the given time
+// and returns the number of rows removed per table (tables without such rows are omitted).
+func RemoveStaleContent(db *sql.DB, before time.Time) (map[string]int64, error) {
+	return staleContent(db, before, true)
+}
+
+// CountStaleContent reports the rows RemoveStaleContent would delete, without deleting them.
+func CountStaleContent(db *sql.DB, before time.Time) (map[string]int64, error) {
+	return staleContent(db, before, false)
+}
+
+func staleContent(db *sql.DB, before time.Time, remove bool) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	cutoff := before.UTC().Format(time.RFC3339)
+	for _, table := range contentTables {
+		where := fmt.Sprintf("FROM %s WHERE created_at < ?", table)
+		var n int64
+		if remove {
+			result, err := db.Exec("DELETE "+where, cutoff)
+			if err != nil {
+				return counts, fmt.Errorf("error removing stale rows from %s: %w", table, err)
+			}
+			n, _ = result.RowsAffected()
+		} else if err := db.QueryRow("SELECT COUNT(*) "+where, cutoff).Scan(&n); err != nil {
+			return counts, fmt.Errorf("error counting stale rows in %s: %w", table, err)
+		}
+		if n > 0 {
+			counts[table] = n
+		}
+	}
+	return counts, nil
+}
+
+// SizeBytes returns the size of the database content (page count times page size).
+func SizeBytes(db *sql.DB) (int64, error) {
+	var pageCount, pageSize int64
+	if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
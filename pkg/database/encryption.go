@@ -0,0 +1,230 @@
+// File: pkg/database/encryption.go
+package database
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// encryptedMagic starts every database file written by OpenEncrypted.
+var encryptedMagic = []byte("CPCENC1\x00")
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// encryptedLockTimeout is how long OpenEncrypted waits for another process to release an
+// encrypted database before giving up.
+const encryptedLockTimeout = 10 * time.Second
+
+// KeyFromFile derives a 256-bit key from the contents of a key file.
+func KeyFromFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("key file '%s' is empty", path)
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// EncryptedDB is the decrypted working copy of a database encrypted at rest with AES-256-GCM.
+// It holds an exclusive lock on the database from OpenEncrypted until Seal, so that two
+// processes never work on copies of the same file and seal over each other's changes.
+type EncryptedDB struct {
+	dbPath   string
+	workDir  string
+	workPath string
+	gcm      cipher.AEAD
+	readOnly bool
+	lock     *os.File
+	// mu serializes Seal, which may be called by a signal handler while the command runs.
+	mu     sync.Mutex
+	sealed bool
+}
+
+// OpenEncrypted locks dbPath and decrypts it into a private temporary file that SQLite works
+// on through Open; Seal encrypts the working copy back over dbPath. The lock is taken on
+// dbPath + ".lock", which is left in place; while another process holds it, OpenEncrypted
+// retries for encryptedLockTimeout and then fails. A missing
+// file starts a new database, and an existing unencrypted database is encrypted by its first
+// Seal. With readOnly the working copy is opened through OpenReadOnly and Seal only discards
+// it, leaving dbPath untouched.
+func OpenEncrypted(dbPath string, key []byte, readOnly bool) (*EncryptedDB, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(dbPath+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database lock: %w", err)
+	}
+	for deadline := time.Now().Add(encryptedLockTimeout); ; time.Sleep(100 * time.Millisecond) {
+		locked, err := tryLockFile(lock)
+		if err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("error locking database: %w", err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			lock.Close()
+			return nil, fmt.Errorf("database '%s' is in use by another process (waited %s); retry when it has finished", dbPath, encryptedLockTimeout)
+		}
+	}
+	e := &EncryptedDB{dbPath: dbPath, gcm: gcm, readOnly: readOnly, lock: lock}
+	if err := e.decrypt(); err != nil {
+		e.release()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *EncryptedDB) decrypt() error {
+	workDir, err := os.MkdirTemp("", "code-prompt-core-db-")
+	if err != nil {
+		return fmt.Errorf("error creating working directory: %w", err)
+	}
+	e.workDir = workDir
+	e.workPath = filepath.Join(workDir, "cache.db")
+
+	data, err := os.ReadFile(e.dbPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		data = nil
+	case err != nil:
+		return fmt.Errorf("error reading database: %w", err)
+	case bytes.HasPrefix(data, encryptedMagic):
+		if data, err = decrypt(e.gcm, data[len(encryptedMagic):]); err != nil {
+			return fmt.Errorf("error decrypting database (wrong key?): %w", err)
+		}
+	case len(data) > 0 && !bytes.HasPrefix(data, sqliteMagic):
+		return fmt.Errorf("'%s' is neither an SQLite nor an encrypted database", e.dbPath)
+	}
+	if e.readOnly && data == nil {
+		return fmt.Errorf("cannot open database read-only: '%s' does not exist", e.dbPath)
+	}
+	if data != nil {
+		if err := os.WriteFile(e.workPath, data, 0600); err != nil {
+			return fmt.Errorf("error writing working copy: %w", err)
+		}
+	}
+	return nil
+}
+
+// Open opens a connection pool on the working copy. Pools should be closed before Seal;
+// changes committed through one that is still open are sealed all the same.
+func (e *EncryptedDB) Open() (*sql.DB, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sealed {
+		return nil, fmt.Errorf("encrypted database '%s' is already sealed", e.dbPath)
+	}
+	if e.readOnly {
+		return OpenReadOnly(e.workPath)
+	}
+	return InitializeDB(e.workPath)
+}
+
+// Seal encrypts the working copy back over dbPath, removes it and releases the lock. It is
+// safe to call more than once; only the first call does anything.
+func (e *EncryptedDB) Seal() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sealed {
+		return nil
+	}
+	e.sealed = true
+	defer e.release()
+	if e.readOnly {
+		return nil
+	}
+	if err := e.checkpoint(); err != nil {
+		return err
+	}
+	plain, err := os.ReadFile(e.workPath)
+	if err != nil {
+		return fmt.Errorf("error reading working copy: %w", err)
+	}
+	sealedData, err := encrypt(e.gcm, plain)
+	if err != nil {
+		return err
+	}
+	tmp := e.dbPath + ".tmp"
+	if err := os.WriteFile(tmp, append(append([]byte{}, encryptedMagic...), sealedData...), 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing encrypted database: %w", err)
+	}
+	if err := os.Rename(tmp, e.dbPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing encrypted database: %w", err)
+	}
+	return nil
+}
+
+// checkpoint moves every change of the write-ahead log into the working copy itself, which
+// is then all that needs encrypting.
+func (e *EncryptedDB) checkpoint() error {
+	db, err := InitializeDB(e.workPath)
+	if err != nil {
+		return err
+	}
+	var busy, logFrames, checkpointed int
+	err = db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error checkpointing working copy: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("error checkpointing working copy: database is still in use")
+	}
+	return nil
+}
+
+// release removes the working copy and unlocks the database.
+func (e *EncryptedDB) release() {
+	if e.workDir != "" {
+		os.RemoveAll(e.workDir)
+	}
+	unlockFile(e.lock)
+	e.lock.Close()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encrypt(gcm cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plain, encryptedMagic), nil
+}
+
+func decrypt(gcm cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted database is truncated")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, encryptedMagic)
+}
@@ -0,0 +1,89 @@
+// File: pkg/database/locks.go
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ScanLockedError is returned by AcquireScanLock when another process holds the lock.
+type ScanLockedError struct {
+	PID        int
+	Hostname   string
+	AcquiredAt string
+}
+
+func (e *ScanLockedError) Error() string {
+	return fmt.Sprintf("project is locked by another scan (pid %d on %s since %s); retry when it has finished, or run 'cache unlock' if that process is gone", e.PID, e.Hostname, e.AcquiredAt)
+}
+
+// AcquireScanLock takes the single-writer scan lock of a project. It fails fast with a
+// *ScanLockedError while another live process holds it; a lock left behind by a process
+// on this host that no longer runs is taken over. A lock left by a process on another host
+// cannot be checked and stays until ForceReleaseScanLock removes it. The returned release function is safe
+// to call more than once.
+//
+// The lock lives in the database, so processes only see each other's locks through a shared
+// file. An encrypted database (OpenEncrypted) gives each process a private working copy
+// instead; there the exclusive lock OpenEncrypted holds until Seal serializes the processes,
+// and the scan lock only guards against a second scan within the same process.
+func AcquireScanLock(db *sql.DB, projectID int64) (func() error, error) {
+	hostname, _ := os.Hostname()
+	pid := os.Getpid()
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := db.Exec("INSERT INTO scan_locks (project_id, pid, hostname, acquired_at) VALUES (?, ?, ?, ?) ON CONFLICT(project_id) DO NOTHING",
+			projectID, pid, hostname, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return nil, fmt.Errorf("error acquiring scan lock: %w", err)
+		}
+		var holder ScanLockedError
+		err = db.QueryRow("SELECT pid, hostname, acquired_at FROM scan_locks WHERE project_id = ?", projectID).Scan(&holder.PID, &holder.Hostname, &holder.AcquiredAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Released between the insert and the read; try again.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading scan lock: %w", err)
+		}
+		if holder.PID == pid && holder.Hostname == hostname {
+			return scanLockRelease(db, projectID, pid, hostname), nil
+		}
+		if holder.Hostname != hostname || processAlive(holder.PID) {
+			return nil, &holder
+		}
+		// The holder crashed without releasing the lock.
+		if _, err := db.Exec("DELETE FROM scan_locks WHERE project_id = ? AND pid = ? AND hostname = ?", projectID, holder.PID, holder.Hostname); err != nil {
+			return nil, fmt.Errorf("error removing stale scan lock: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("error acquiring scan lock: lock is changing hands too quickly")
+}
+
+// ForceReleaseScanLock removes the scan lock of a project, whoever holds it, and returns the
+// removed holder, or nil if the project was not locked.
+func ForceReleaseScanLock(db *sql.DB, projectID int64) (*ScanLockedError, error) {
+	var holder ScanLockedError
+	err := db.QueryRow("DELETE FROM scan_locks WHERE project_id = ? RETURNING pid, hostname, acquired_at", projectID).Scan(&holder.PID, &holder.Hostname, &holder.AcquiredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error removing scan lock: %w", err)
+	}
+	return &holder, nil
+}
+
+func scanLockRelease(db *sql.DB, projectID int64, pid int, hostname string) func() error {
+	released := false
+	return func() error {
+		if released {
+			return nil
+		}
+		released = true
+		_, err := db.Exec("DELETE FROM scan_locks WHERE project_id = ? AND pid = ? AND hostname = ?", projectID, pid, hostname)
+		return err
+	}
+}
@@ -0,0 +1,100 @@
+// File: pkg/database/repository.go
+package database
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Repository wraps a database handle with the queries shared by many commands.
+// Statements are prepared once per handle and reused until the handle is closed with Close.
+type Repository struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+var (
+	repositoriesMu sync.Mutex
+	repositories   = make(map[*sql.DB]*Repository)
+)
+
+// For returns the repository of a database handle opened with InitializeDB.
+func For(db *sql.DB) *Repository {
+	repositoriesMu.Lock()
+	defer repositoriesMu.Unlock()
+	repo, ok := repositories[db]
+	if !ok {
+		repo = &Repository{db: db, stmts: make(map[string]*sql.Stmt)}
+		repositories[db] = repo
+	}
+	return repo
+}
+
+// Close closes a database handle together with the statements prepared by its repository,
+// and forgets the repository. Handles passed to For must be closed with Close rather than
+// their own Close method, or the repository keeps them reachable for the life of the process.
+func Close(db *sql.DB) error {
+	repositoriesMu.Lock()
+	repo := repositories[db]
+	delete(repositories, db)
+	repositoriesMu.Unlock()
+	if repo != nil {
+		repo.mu.Lock()
+		for _, stmt := range repo.stmts {
+			stmt.Close()
+		}
+		repo.stmts = nil
+		repo.mu.Unlock()
+	}
+	return db.Close()
+}
+
+// Prepared returns a prepared statement for query, preparing it on first use.
+func (r *Repository) Prepared(query string) (*sql.Stmt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stmt, ok := r.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := r.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	r.stmts[query] = stmt
+	return stmt, nil
+}
+
+// ProjectID returns the id of the project registered under an absolute path.
+// It returns sql.ErrNoRows if the project is unknown.
+func (r *Repository) ProjectID(projectPath string) (int64, error) {
+	stmt, err := r.Prepared("SELECT id FROM projects WHERE project_path = ?")
+	if err != nil {
+		return 0, err
+	}
+	var projectID int64
+	err = stmt.QueryRow(projectPath).Scan(&projectID)
+	return projectID, err
+}
+
+// FileCached reports whether a relative path is present in the cache of a project.
+func (r *Repository) FileCached(projectID int64, relativePath string) (bool, error) {
+	stmt, err := r.Prepared("SELECT COUNT(*) FROM file_metadata WHERE project_id = ? AND relative_path = ?")
+	if err != nil {
+		return false, err
+	}
+	var count int
+	err = stmt.QueryRow(projectID, relativePath).Scan(&count)
+	return count > 0, err
+}
+
+// TouchLastScan records the current time as the last scan of a project.
+func (r *Repository) TouchLastScan(projectID int64) error {
+	stmt, err := r.Prepared("UPDATE projects SET last_scan_timestamp = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(time.Now().UTC().Format(time.RFC3339), projectID)
+	return err
+}
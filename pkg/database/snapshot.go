@@ -0,0 +1,19 @@
+// File: pkg/database/snapshot.go
+package database
+
+import "database/sql"
+
+// Querier is the read side shared by *sql.DB and *sql.Tx, so that query helpers can run
+// either directly or inside a read transaction.
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// BeginRead starts a read transaction. In WAL mode its first query pins a snapshot of the
+// database: every later query through the transaction sees the same state, even if a cache
+// update commits in between, and the writer is not blocked. Writes must not go through the
+// transaction; they use the database handle as usual. The caller rolls it back when done.
+func BeginRead(db *sql.DB) (*sql.Tx, error) {
+	return db.Begin()
+}
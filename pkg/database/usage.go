@@ -0,0 +1,22 @@
+// File: pkg/database/usage.go
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UsageTimeFormat is the format of usage.started_at. It is fixed-width UTC so that the
+// column sorts and compares chronologically as text.
+const UsageTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// RecordUsage stores one command invocation in the usage table.
+func RecordUsage(db *sql.DB, command string, startedAt time.Time, duration time.Duration, resultBytes int64, success bool) error {
+	_, err := db.Exec("INSERT INTO usage (command, started_at, duration_ms, result_bytes, success) VALUES (?, ?, ?, ?, ?)",
+		command, startedAt.UTC().Format(UsageTimeFormat), duration.Milliseconds(), resultBytes, success)
+	if err != nil {
+		return fmt.Errorf("error recording usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// File: pkg/depgraph/depgraph.go
+package depgraph
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Directions accepted by Expand.
+const (
+	Both         = "both"
+	Dependencies = "dependencies"
+	Dependents   = "dependents"
+)
+
+// SupportedExtensions are the source file extensions whose imports are parsed.
+var SupportedExtensions = map[string]bool{
+	"go": true, "py": true,
+	"js": true, "jsx": true, "mjs": true, "cjs": true, "ts": true, "tsx": true,
+}
+
+var jsResolveExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}
+
+var (
+	goImportBlock  = regexp.MustCompile(`(?s)\bimport\s*\((.*?)\)`)
+	goImportSingle = regexp.MustCompile(`\bimport\s+(?:[\w.]+\s+)?"([^"]+)"`)
+	goQuoted       = regexp.MustCompile(`"([^"]+)"`)
+
+	jsImports = []*regexp.Regexp{
+		regexp.MustCompile(`(?:import|export)\s[^'"]*?\bfrom\s*['"]([^'"]+)['"]`),
+		regexp.MustCompile(`\bimport\s*['"]([^'"]+)['"]`),
+		regexp.MustCompile(`\brequire\(\s*['"]([^'"]+)['"]\s*\)`),
+		regexp.MustCompile(`\bimport\(\s*['"]([^'"]+)['"]\s*\)`),
+	}
+
+	pyFrom   = regexp.MustCompile(`(?m)^\s*from\s+(\.*)([\w.]*)\s+import[ \t]+\(?([\w \t,.*]+)`)
+	pyImport = regexp.MustCompile(`(?m)^\s*import\s+([\w.]+(?:\s*,\s*[\w.]+)*)`)
+)
+
+// Graph is a file-level import graph of a project. Paths are relative and '/'-separated.
+type Graph struct {
+	deps  map[string]map[string]bool
+	rdeps map[string]map[string]bool
+}
+
+// Build parses the imports of the supported files among files and links them to the
+// project files they resolve to. read returns the content of a file; goModule is the
+// module path from the project's go.mod (empty if there is none). Imports that do not
+// resolve to a project file (standard library, third-party packages) are ignored.
+func Build(files []string, read func(relPath string) ([]byte, error), goModule string) *Graph {
+	g := &Graph{deps: make(map[string]map[string]bool), rdeps: make(map[string]map[string]bool)}
+	fileSet := make(map[string]bool, len(files))
+	goDirs := make(map[string][]string)
+	for _, f := range files {
+		fileSet[f] = true
+		if path.Ext(f) == ".go" && !strings.HasSuffix(f, "_test.go") {
+			goDirs[path.Dir(f)] = append(goDirs[path.Dir(f)], f)
+		}
+	}
+	for _, f := range files {
+		ext := strings.TrimPrefix(path.Ext(f), ".")
+		if !SupportedExtensions[ext] {
+			continue
+		}
+		data, err := read(f)
+		if err != nil {
+			continue
+		}
+		src := string(data)
+		var targets []string
+		switch ext {
+		case "go":
+			targets = resolveGo(goImports(src), goModule, goDirs)
+		case "py":
+			targets = resolvePython(f, src, fileSet)
+		default:
+			targets = resolveJS(f, src, fileSet)
+		}
+		for _, t := range targets {
+			if t != f {
+				g.addEdge(f, t)
+			}
+		}
+	}
+	return g
+}
+
+func (g *Graph) addEdge(from, to string) {
+	if g.deps[from] == nil {
+		g.deps[from] = make(map[string]bool)
+	}
+	g.deps[from][to] = true
+	if g.rdeps[to] == nil {
+		g.rdeps[to] = make(map[string]bool)
+	}
+	g.rdeps[to][from] = true
+}
+
+// Node is a file reached by Expand.
+type Node struct {
+	Path string `json:"path"`
+	// Distance is the number of import edges from the nearest seed (0 for seeds).
+	Distance int `json:"distance"`
+	// Relation is "seed", "dependency" or "dependent", relative to the node it was reached from.
+	Relation string `json:"relation"`
+	// Via is the file the node was reached from; empty for seeds.
+	Via string `json:"via,omitempty"`
+}
+
+// Expand returns the seeds and every file within hops import edges of them, following
+// imports (Dependencies), importers (Dependents) or both. Nodes are ordered by distance
+// and path.
+func (g *Graph) Expand(seeds []string, hops int, direction string) []Node {
+	visited := make(map[string]bool)
+	var nodes []Node
+	frontier := []string{}
+	for _, s := range seeds {
+		if !visited[s] {
+			visited[s] = true
+			nodes = append(nodes, Node{Path: s, Relation: "seed"})
+			frontier = append(frontier, s)
+		}
+	}
+	for distance := 1; distance <= hops && len(frontier) > 0; distance++ {
+		var next []string
+		var level []Node
+		visit := func(from string, edges map[string]bool, relation string) {
+			for _, to := range sortedKeys(edges) {
+				if visited[to] {
+					continue
+				}
+				visited[to] = true
+				level = append(level, Node{Path: to, Distance: distance, Relation: relation, Via: from})
+				next = append(next, to)
+			}
+		}
+		for _, f := range frontier {
+			if direction != Dependents {
+				visit(f, g.deps[f], "dependency")
+			}
+			if direction != Dependencies {
+				visit(f, g.rdeps[f], "dependent")
+			}
+		}
+		sort.Slice(level, func(i, j int) bool { return level[i].Path < level[j].Path })
+		nodes = append(nodes, level...)
+		frontier = next
+	}
+	return nodes
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GoModulePath extracts the module path from the content of a go.mod file.
+func GoModulePath(goMod []byte) string {
+	for _, line := range strings.Split(string(goMod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+func goImports(src string) []string {
+	var imports []string
+	for _, block := range goImportBlock.FindAllStringSubmatch(src, -1) {
+		for _, m := range goQuoted.FindAllStringSubmatch(block[1], -1) {
+			imports = append(imports, m[1])
+		}
+	}
+	for _, m := range goImportSingle.FindAllStringSubmatch(src, -1) {
+		imports = append(imports, m[1])
+	}
+	return imports
+}
+
+// resolveGo maps imports of packages inside the module to the non-test files of the package directory.
+func resolveGo(imports []string, module string, goDirs map[string][]string) []string {
+	if module == "" {
+		return nil
+	}
+	var targets []string
+	for _, imp := range imports {
+		var dir string
+		switch {
+		case imp == module:
+			dir = "."
+		case strings.HasPrefix(imp, module+"/"):
+			dir = strings.TrimPrefix(imp, module+"/")
+		default:
+			continue
+		}
+		targets = append(targets, goDirs[dir]...)
+	}
+	return targets
+}
+
+func resolveJS(file, src string, fileSet map[string]bool) []string {
+	var targets []string
+	for _, re := range jsImports {
+		for _, m := range re.FindAllStringSubmatch(src, -1) {
+			spec := m[1]
+			if !strings.HasPrefix(spec, ".") {
+				continue
+			}
+			base := path.Join(path.Dir(file), spec)
+			candidates := []string{base}
+			for _, ext := range jsResolveExtensions {
+				candidates = append(candidates, base+ext)
+			}
+			for _, ext := range jsResolveExtensions {
+				candidates = append(candidates, base+"/index"+ext)
+			}
+			for _, c := range candidates {
+				if fileSet[c] {
+					targets = append(targets, c)
+					break
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// resolvePython resolves relative imports against the importing file and absolute imports
+// against the project root.
+func resolvePython(file, src string, fileSet map[string]bool) []string {
+	var targets []string
+	resolve := func(modulePath string) {
+		for _, c := range []string{modulePath + ".py", modulePath + "/__init__.py"} {
+			if fileSet[c] {
+				targets = append(targets, c)
+				return
+			}
+		}
+	}
+	for _, m := range pyFrom.FindAllStringSubmatch(src, -1) {
+		dots, module, names := m[1], m[2], m[3]
+		base := "."
+		if dots != "" {
+			base = path.Dir(file)
+			for i := 1; i < len(dots); i++ {
+				base = path.Dir(base)
+			}
+		}
+		modulePath := path.Join(base, strings.ReplaceAll(module, ".", "/"))
+		if module != "" {
+			resolve(modulePath)
+		}
+		// "from pkg import mod" may name submodules rather than symbols.
+		for _, name := range strings.Split(names, ",") {
+			fields := strings.Fields(name)
+			if len(fields) > 0 && fields[0] != "*" {
+				resolve(path.Join(modulePath, fields[0]))
+			}
+		}
+	}
+	for _, m := range pyImport.FindAllStringSubmatch(src, -1) {
+		for _, module := range strings.Split(m[1], ",") {
+			resolve(strings.ReplaceAll(strings.TrimSpace(module), ".", "/"))
+		}
+	}
+	return targets
+}
@@ -0,0 +1,209 @@
+// File: pkg/detect/detect.go
+package detect
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Kinds of detections.
+const (
+	KindBuildSystem = "build-system"
+	KindFramework   = "framework"
+)
+
+// Detection is a build system or framework that a project uses.
+type Detection struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Evidence lists the relative paths of the marker files it was detected from.
+	Evidence []string `json:"evidence"`
+}
+
+// buildMarkers map the file names that mark a build system to its name.
+var buildMarkers = map[string]string{
+	"go.mod":              "Go modules",
+	"go.work":             "Go modules",
+	"package-lock.json":   "npm",
+	"npm-shrinkwrap.json": "npm",
+	"yarn.lock":           "Yarn",
+	"pnpm-lock.yaml":      "pnpm",
+	"pnpm-workspace.yaml": "pnpm",
+	"bun.lockb":           "Bun",
+	"bun.lock":            "Bun",
+	"poetry.lock":         "Poetry",
+	"uv.lock":             "uv",
+	"Pipfile":             "Pipenv",
+	"requirements.txt":    "pip",
+	"setup.py":            "setuptools",
+	"pom.xml":             "Maven",
+	"build.gradle":        "Gradle",
+	"build.gradle.kts":    "Gradle",
+	"settings.gradle":     "Gradle",
+	"settings.gradle.kts": "Gradle",
+	"Cargo.toml":          "Cargo",
+	"WORKSPACE":           "Bazel",
+	"WORKSPACE.bazel":     "Bazel",
+	"MODULE.bazel":        "Bazel",
+	"BUILD.bazel":         "Bazel",
+	"CMakeLists.txt":      "CMake",
+	"Makefile":            "Make",
+	"Gemfile":             "Bundler",
+	"composer.json":       "Composer",
+	"mix.exs":             "Mix",
+}
+
+// frameworkRule detects a framework from a dependency named in a manifest.
+type frameworkRule struct {
+	name string
+	// manifests are the file names searched for the pattern.
+	manifests []string
+	pattern   *regexp.Regexp
+}
+
+var (
+	pythonManifests = []string{"requirements.txt", "pyproject.toml", "Pipfile", "setup.py", "setup.cfg"}
+	jvmManifests    = []string{"pom.xml", "build.gradle", "build.gradle.kts"}
+)
+
+// pythonDep matches a Python requirement of the named distribution at the start of a line
+// or inside quotes (pyproject.toml, setup.py), case-insensitively.
+func pythonDep(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?im)(?:^|["'])\s*` + regexp.QuoteMeta(name) + `\s*(?:[<>=!~;\[,"' ]|$)`)
+}
+
+// goDep matches a module path in a go.mod.
+func goDep(module string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^\s*(?:require\s+)?` + regexp.QuoteMeta(module) + `(?:/v\d+)?\s`)
+}
+
+var frameworkRules = []frameworkRule{
+	{"Django", pythonManifests, pythonDep("django")},
+	{"Flask", pythonManifests, pythonDep("flask")},
+	{"FastAPI", pythonManifests, pythonDep("fastapi")},
+	{"Gin", []string{"go.mod"}, goDep("github.com/gin-gonic/gin")},
+	{"Echo", []string{"go.mod"}, goDep("github.com/labstack/echo")},
+	{"Fiber", []string{"go.mod"}, goDep("github.com/gofiber/fiber")},
+	{"Cobra", []string{"go.mod"}, goDep("github.com/spf13/cobra")},
+	{"Spring Boot", jvmManifests, regexp.MustCompile(`spring-boot`)},
+	{"Ruby on Rails", []string{"Gemfile"}, regexp.MustCompile(`(?m)^\s*gem\s+['"]rails['"]`)},
+	{"Laravel", []string{"composer.json"}, regexp.MustCompile(`"laravel/framework"`)},
+	{"Actix Web", []string{"Cargo.toml"}, regexp.MustCompile(`(?m)^\s*actix-web\s*=`)},
+	{"Axum", []string{"Cargo.toml"}, regexp.MustCompile(`(?m)^\s*axum\s*=`)},
+	{"Phoenix", []string{"mix.exs"}, regexp.MustCompile(`\{:phoenix,`)},
+}
+
+// npmFrameworks map package.json dependencies to the framework they stand for.
+var npmFrameworks = map[string]string{
+	"react":         "React",
+	"next":          "Next.js",
+	"vue":           "Vue",
+	"nuxt":          "Nuxt",
+	"@angular/core": "Angular",
+	"svelte":        "Svelte",
+	"@sveltejs/kit": "SvelteKit",
+	"express":       "Express",
+	"@nestjs/core":  "NestJS",
+	"electron":      "Electron",
+	"vite":          "Vite",
+	"webpack":       "webpack",
+}
+
+// Detect identifies the build systems and frameworks of a project from the marker files among
+// files, the relative paths of its files. read returns the content of a file; only manifests
+// are read, and files it fails to read are skipped. Detections are ordered by kind (build
+// systems first), then name.
+func Detect(files []string, read func(relPath string) ([]byte, error)) []Detection {
+	byName := map[string]*Detection{}
+	add := func(name, kind, evidence string) {
+		d, ok := byName[name]
+		if !ok {
+			d = &Detection{Name: name, Kind: kind}
+			byName[name] = d
+		}
+		if !slices.Contains(d.Evidence, evidence) {
+			d.Evidence = append(d.Evidence, evidence)
+		}
+	}
+	for _, relPath := range files {
+		name := path.Base(relPath)
+		if system, ok := buildMarkers[name]; ok {
+			add(system, KindBuildSystem, relPath)
+		}
+		if name == "manage.py" {
+			add("Django", KindFramework, relPath)
+		}
+		var data []byte
+		load := func() []byte {
+			if data == nil {
+				data, _ = read(relPath)
+			}
+			return data
+		}
+		if name == "pyproject.toml" {
+			if content := load(); bytes.Contains(content, []byte("[tool.poetry")) {
+				add("Poetry", KindBuildSystem, relPath)
+			} else if bytes.Contains(content, []byte("[build-system]")) || bytes.Contains(content, []byte("[project]")) {
+				add("Python packaging (pyproject)", KindBuildSystem, relPath)
+			}
+		}
+		if name == "package.json" {
+			for _, framework := range npmDependencies(load()) {
+				add(framework, KindFramework, relPath)
+			}
+		}
+		for _, rule := range frameworkRules {
+			if slices.Contains(rule.manifests, name) && rule.pattern.Match(load()) {
+				add(rule.name, KindFramework, relPath)
+			}
+		}
+	}
+	// A package.json without any lock file still means npm.
+	if byName["npm"] == nil && byName["Yarn"] == nil && byName["pnpm"] == nil && byName["Bun"] == nil {
+		for _, relPath := range files {
+			if path.Base(relPath) == "package.json" {
+				add("npm", KindBuildSystem, relPath)
+			}
+		}
+	}
+
+	detections := make([]Detection, 0, len(byName))
+	for _, d := range byName {
+		sort.Strings(d.Evidence)
+		detections = append(detections, *d)
+	}
+	sort.Slice(detections, func(i, j int) bool {
+		if detections[i].Kind != detections[j].Kind {
+			return detections[i].Kind == KindBuildSystem
+		}
+		return strings.ToLower(detections[i].Name) < strings.ToLower(detections[j].Name)
+	})
+	return detections
+}
+
+// npmDependencies returns the frameworks among the dependencies of a package.json.
+func npmDependencies(data []byte) []string {
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+		PeerDeps        map[string]string `json:"peerDependencies"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return nil
+	}
+	var frameworks []string
+	for dep, framework := range npmFrameworks {
+		_, a := pkg.Dependencies[dep]
+		_, b := pkg.DevDependencies[dep]
+		_, c := pkg.PeerDeps[dep]
+		if a || b || c {
+			frameworks = append(frameworks, framework)
+		}
+	}
+	return frameworks
+}
@@ -0,0 +1,118 @@
+// File: pkg/docextract/docextract.go
+package docextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// extractors maps a lower-case file extension (without the dot) to its text extractor.
+var extractors = map[string]func(data []byte) (string, error){
+	"pdf":  extractPDF,
+	"docx": extractDOCX,
+	"odt":  extractODT,
+}
+
+// IsDocument reports whether text can be extracted from files with the given extension.
+func IsDocument(ext string) bool {
+	_, ok := extractors[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	return ok
+}
+
+// ExtractText returns the plain text of a PDF, DOCX or ODT document.
+func ExtractText(ext string, data []byte) (string, error) {
+	extract, ok := extractors[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	if !ok {
+		return "", fmt.Errorf("unsupported document type '%s'", ext)
+	}
+	text, err := extract(data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text) + "\n", nil
+}
+
+func readZipEntry(data []byte, name string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid document archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("document archive has no '%s'", name)
+}
+
+// xmlText walks an XML document and collects its character data. Elements listed in
+// breaks end a line, elements in spaces insert the given text.
+func xmlText(data []byte, textElems map[string]bool, breaks map[string]bool, spaces map[string]string) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var sb strings.Builder
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid document xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if textElems[t.Name.Local] {
+				depth++
+			}
+			if s, ok := spaces[t.Name.Local]; ok {
+				sb.WriteString(s)
+			}
+		case xml.EndElement:
+			if textElems[t.Name.Local] {
+				depth--
+			}
+			if breaks[t.Name.Local] {
+				sb.WriteString("\n")
+			}
+		case xml.CharData:
+			if depth > 0 {
+				sb.Write(t)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+func extractDOCX(data []byte) (string, error) {
+	doc, err := readZipEntry(data, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	return xmlText(doc,
+		map[string]bool{"t": true},
+		map[string]bool{"p": true},
+		map[string]string{"tab": "\t", "br": "\n", "cr": "\n"},
+	)
+}
+
+func extractODT(data []byte) (string, error) {
+	content, err := readZipEntry(data, "content.xml")
+	if err != nil {
+		return "", err
+	}
+	return xmlText(content,
+		map[string]bool{"p": true, "h": true},
+		map[string]bool{"p": true, "h": true},
+		map[string]string{"s": " ", "tab": "\t", "line-break": "\n"},
+	)
+}
@@ -0,0 +1,241 @@
+// File: pkg/docextract/pdf.go
+package docextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This is a best-effort PDF text extractor: it decodes uncompressed and FlateDecode content
+// streams and collects the strings shown by the Tj, TJ, ' and " operators. Fonts with custom
+// encodings (common for CID fonts) are not mapped and may produce unreadable text.
+
+var pdfStreamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+func extractPDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return "", fmt.Errorf("not a PDF file")
+	}
+	var sb strings.Builder
+	for _, loc := range pdfStreamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		raw := data[start : start+end]
+		if bytes.Contains(dict, []byte("/Subtype/Image")) || bytes.Contains(dict, []byte("/Subtype /Image")) {
+			continue
+		}
+		var content []byte
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			// A truncated stream still yields the text decoded so far.
+			content, _ = io.ReadAll(zr)
+			zr.Close()
+		case bytes.Contains(dict, []byte("/Filter")):
+			// Other filters (DCT, LZW, ...) are not supported.
+			continue
+		default:
+			content = raw
+		}
+		sb.WriteString(pdfContentText(content))
+	}
+	return sb.String(), nil
+}
+
+// pdfContentText interprets the text-showing operators of a content stream.
+func pdfContentText(content []byte) string {
+	var out strings.Builder
+	var operands []string
+	var inArray bool
+	var array strings.Builder
+	newline := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			out.WriteString("\n")
+		}
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteralString(content[i:])
+			i += n
+			if inArray {
+				array.WriteString(s)
+			} else {
+				operands = append(operands, s)
+			}
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return out.String()
+			}
+			s := pdfHexString(content[i+1 : i+end])
+			i += end + 1
+			if inArray {
+				array.WriteString(s)
+			} else {
+				operands = append(operands, s)
+			}
+		case c == '[':
+			inArray = true
+			array.Reset()
+			i++
+		case c == ']':
+			inArray = false
+			operands = append(operands, array.String())
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFSpace(c) || c == '<' || c == '>' || c == '{' || c == '}' || c == '/' && i+1 >= len(content):
+			i++
+		default:
+			start := i
+			i++
+			for i < len(content) && !isPDFSpace(content[i]) && !bytes.ContainsRune([]byte("()<>[]{}/%"), rune(content[i])) {
+				i++
+			}
+			token := string(content[start:i])
+			if inArray {
+				// Large negative kerning in a TJ array usually separates words.
+				if n, err := strconv.ParseFloat(token, 64); err == nil && n < -200 {
+					array.WriteString(" ")
+				}
+				continue
+			}
+			switch token {
+			case "Tj", "TJ":
+				if len(operands) > 0 {
+					out.WriteString(operands[len(operands)-1])
+				}
+			case "'", "\"":
+				newline()
+				if len(operands) > 0 {
+					out.WriteString(operands[len(operands)-1])
+				}
+			case "T*", "Td", "TD", "ET":
+				newline()
+			}
+			if !strings.HasPrefix(token, "/") && !isPDFNumber(token) {
+				operands = operands[:0]
+			}
+		}
+	}
+	newline()
+	return out.String()
+}
+
+// pdfLiteralString decodes a "(...)" string starting at b[0] and returns it with the number of bytes consumed.
+func pdfLiteralString(b []byte) (string, int) {
+	var sb strings.Builder
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '(':
+			if depth > 0 {
+				sb.WriteByte(c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return sb.String(), i + 1
+			}
+			sb.WriteByte(c)
+		case c == '\\' && i+1 < len(b):
+			i++
+			switch e := b[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// Line continuation.
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(b) && j < i+3 && b[j] >= '0' && b[j] <= '7' {
+						j++
+					}
+					v, _ := strconv.ParseUint(string(b[i:j]), 8, 8)
+					sb.WriteByte(byte(v))
+					i = j - 1
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), len(b)
+}
+
+// pdfHexString decodes a "<...>" string. Two-byte (CID) strings are decoded as UTF-16 when
+// every code unit is printable ASCII; otherwise non-printable strings are dropped.
+func pdfHexString(hex []byte) string {
+	clean := make([]byte, 0, len(hex))
+	for _, c := range hex {
+		if !isPDFSpace(c) {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	decoded := make([]byte, 0, len(clean)/2)
+	for i := 0; i < len(clean); i += 2 {
+		v, err := strconv.ParseUint(string(clean[i:i+2]), 16, 8)
+		if err != nil {
+			return ""
+		}
+		decoded = append(decoded, byte(v))
+	}
+	if len(decoded)%2 == 0 {
+		var sb strings.Builder
+		utf16 := true
+		for i := 0; i < len(decoded); i += 2 {
+			if decoded[i] != 0 || decoded[i+1] < 0x20 || decoded[i+1] > 0x7e {
+				utf16 = false
+				break
+			}
+			sb.WriteByte(decoded[i+1])
+		}
+		if utf16 && sb.Len() > 0 {
+			return sb.String()
+		}
+	}
+	for _, c := range decoded {
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c > 0x7e {
+			return ""
+		}
+	}
+	return string(decoded)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isPDFNumber(token string) bool {
+	_, err := strconv.ParseFloat(token, 64)
+	return err == nil
+}
@@ -0,0 +1,129 @@
+// File: pkg/docfiles/docfiles.go
+package docfiles
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Kinds of documentation files, in the order they rank at the same distance.
+const (
+	KindReadme       = "readme"
+	KindContributing = "contributing"
+	KindArchitecture = "architecture"
+	KindADR          = "adr"
+	KindDocs         = "docs"
+)
+
+var kindRanks = map[string]int{KindReadme: 0, KindContributing: 1, KindArchitecture: 2, KindADR: 3, KindDocs: 4}
+
+// docExts are the extensions of the files under a docs directory that count as documentation.
+var docExts = map[string]bool{".md": true, ".markdown": true, ".mdx": true, ".rst": true, ".adoc": true, ".txt": true}
+
+// Doc is a documentation file of a project.
+type Doc struct {
+	// Path is the '/'-separated relative path of the file.
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	// Distance is the number of directory steps from the file's directory to the closest
+	// directory of the target files: 0 for a README next to them, 1 for one in their parent.
+	Distance int `json:"distance"`
+	// Covers is the number of target files in the file's directory or below it.
+	Covers int `json:"covers"`
+}
+
+// Classify returns the kind of a documentation file, or "" if relPath is not one. README,
+// CONTRIBUTING and ARCHITECTURE/DESIGN files are recognized by name in any directory; ADRs
+// are the files of an "adr", "adrs" or "decisions" directory; other files with a text
+// extension under a "doc" or "docs" directory are KindDocs.
+func Classify(relPath string) string {
+	name := strings.ToUpper(path.Base(relPath))
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	switch stem {
+	case "README":
+		return KindReadme
+	case "CONTRIBUTING":
+		return KindContributing
+	case "ARCHITECTURE", "DESIGN":
+		return KindArchitecture
+	}
+	if !docExts[strings.ToLower(path.Ext(relPath))] {
+		return ""
+	}
+	kind := ""
+	for _, dir := range strings.Split(path.Dir(relPath), "/") {
+		switch strings.ToLower(dir) {
+		case "adr", "adrs", "decisions":
+			return KindADR
+		case "doc", "docs":
+			kind = KindDocs
+		}
+	}
+	return kind
+}
+
+// Find returns the documentation files among files, the relative paths of all the files of a
+// project, ranked by their proximity to targets (the files a prompt is about): by ascending
+// Distance, then kind, then descending Covers, then path. Without targets, the distance is
+// measured from the project root.
+func Find(files, targets []string) []Doc {
+	targetDirs := map[string]int{}
+	for _, t := range targets {
+		targetDirs[path.Dir(t)]++
+	}
+	if len(targetDirs) == 0 {
+		targetDirs["."] = 0
+	}
+	found := []Doc{}
+	for _, relPath := range files {
+		kind := Classify(relPath)
+		if kind == "" {
+			continue
+		}
+		dir := path.Dir(relPath)
+		d := Doc{Path: relPath, Kind: kind, Distance: -1}
+		for targetDir, count := range targetDirs {
+			distance, below := dirDistance(dir, targetDir)
+			if d.Distance < 0 || distance < d.Distance {
+				d.Distance = distance
+			}
+			if below {
+				d.Covers += count
+			}
+		}
+		found = append(found, d)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if kindRanks[a.Kind] != kindRanks[b.Kind] {
+			return kindRanks[a.Kind] < kindRanks[b.Kind]
+		}
+		if a.Covers != b.Covers {
+			return a.Covers > b.Covers
+		}
+		return a.Path < b.Path
+	})
+	return found
+}
+
+// dirDistance returns the number of steps from directory from to directory to, going up
+// to their common ancestor and down again, and whether to is from itself or below it.
+func dirDistance(from, to string) (int, bool) {
+	a, b := splitDir(from), splitDir(to)
+	common := 0
+	for common < len(a) && common < len(b) && a[common] == b[common] {
+		common++
+	}
+	return len(a) - common + len(b) - common, common == len(a)
+}
+
+func splitDir(dir string) []string {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	return strings.Split(dir, "/")
+}
@@ -0,0 +1,182 @@
+// File: pkg/embeddings/embeddings.go
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Providers supported by New.
+const (
+	ProviderOpenAI = "openai"
+	ProviderOllama = "ollama"
+)
+
+// DefaultBaseURL returns the API endpoint used for a provider when none is configured.
+func DefaultBaseURL(provider string) string {
+	switch provider {
+	case ProviderOpenAI:
+		return "https://api.openai.com"
+	case ProviderOllama:
+		return "http://localhost:11434"
+	}
+	return ""
+}
+
+// Provider computes embedding vectors for texts.
+type Provider interface {
+	// Name identifies the provider and model, e.g. "ollama:nomic-embed-text". Stored
+	// vectors are keyed by it, since vectors of different models are not comparable.
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// New returns the provider for a name ("openai" or "ollama"). An empty baseURL uses
+// DefaultBaseURL; apiKey is only used by OpenAI.
+func New(provider, model, baseURL, apiKey string) (Provider, error) {
+	if model == "" {
+		return nil, fmt.Errorf("an embedding model is required")
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL(provider)
+	}
+	client := &client{model: model, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, http: &http.Client{Timeout: 5 * time.Minute}}
+	switch provider {
+	case ProviderOpenAI:
+		if apiKey == "" {
+			return nil, fmt.Errorf("the openai provider requires an API key")
+		}
+		return &openAI{client}, nil
+	case ProviderOllama:
+		return &ollama{client}, nil
+	}
+	return nil, fmt.Errorf("unknown embedding provider '%s' (expected %s or %s)", provider, ProviderOpenAI, ProviderOllama)
+}
+
+type client struct {
+	model   string
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func (c *client) post(ctx context.Context, endpoint string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("embedding request failed with %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, response)
+}
+
+type openAI struct{ *client }
+
+func (p *openAI) Name() string { return ProviderOpenAI + ":" + p.model }
+
+func (p *openAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := p.post(ctx, "/v1/embeddings", map[string]interface{}{"model": p.model, "input": texts}, &response); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding response has an invalid index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return checkVectors(vectors)
+}
+
+type ollama struct{ *client }
+
+func (p *ollama) Name() string { return ProviderOllama + ":" + p.model }
+
+func (p *ollama) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var response struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := p.post(ctx, "/api/embed", map[string]interface{}{"model": p.model, "input": texts}, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding response has %d vectors for %d inputs", len(response.Embeddings), len(texts))
+	}
+	return checkVectors(response.Embeddings)
+}
+
+func checkVectors(vectors [][]float32) ([][]float32, error) {
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("embedding response is missing the vector of input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// Encode serializes a vector as little-endian float32 values for storage in a BLOB.
+func Encode(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+// Decode reverses Encode.
+func Decode(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 if their dimensions differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
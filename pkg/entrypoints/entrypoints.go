@@ -0,0 +1,201 @@
+// File: pkg/entrypoints/entrypoints.go
+package entrypoints
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of entry points.
+const (
+	KindGoMain        = "go-main"
+	KindRustMain      = "rust-main"
+	KindPythonMain    = "python-main"
+	KindDjangoManage  = "django-manage"
+	KindPackageBin    = "package-bin"
+	KindPackageMain   = "package-main"
+	KindPackageScript = "package-script"
+	KindDockerfile    = "dockerfile"
+)
+
+// baseScores rank the kinds: a declared program beats a script, which beats a guess from
+// the content. Scores lose depthPenalty per directory level of the file.
+var baseScores = map[string]int{
+	KindGoMain:        90,
+	KindRustMain:      90,
+	KindDjangoManage:  90,
+	KindPackageBin:    85,
+	KindPackageMain:   70,
+	KindDockerfile:    70,
+	KindPythonMain:    60,
+	KindPackageScript: 40,
+}
+
+const depthPenalty = 5
+
+// scriptScores adjust the score of package.json scripts by name: the ones that run the
+// project rank above the ones that build, test or lint it.
+var scriptScores = map[string]int{
+	"start": 40, "dev": 35, "serve": 35, "main": 30,
+	"build": 10, "test": -10, "lint": -20, "format": -20,
+}
+
+// EntryPoint is a likely place to start reading a project.
+type EntryPoint struct {
+	// Path is the '/'-separated relative path of the file declaring the entry point.
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	// Name is the script name of a package.json script or the command name of a bin entry.
+	Name string `json:"name,omitempty"`
+	// Command is the command of a package.json script or a Dockerfile CMD/ENTRYPOINT.
+	Command string `json:"command,omitempty"`
+	// Target is the project file a package.json bin or main entry points to.
+	Target string `json:"target,omitempty"`
+	Score  int    `json:"score"`
+}
+
+var (
+	goPackageMain = regexp.MustCompile(`(?m)^package\s+main\b`)
+	goFuncMain    = regexp.MustCompile(`(?m)^func\s+main\s*\(\s*\)`)
+	pyMainGuard   = regexp.MustCompile(`(?m)^if\s+__name__\s*==\s*['"]__main__['"]\s*:`)
+	rustFnMain    = regexp.MustCompile(`(?m)^\s*(?:pub\s+)?(?:async\s+)?fn\s+main\s*\(`)
+)
+
+// Detect finds the entry points among files, the relative paths of the project's files.
+// read returns the content of a file; files it fails to read are skipped. Only files that
+// can declare an entry point are read. Entry points are ranked by descending score, then path.
+func Detect(files []string, read func(relPath string) ([]byte, error)) []EntryPoint {
+	var found []EntryPoint
+	add := func(e EntryPoint, bonus int) {
+		e.Score = baseScores[e.Kind] + bonus - depthPenalty*strings.Count(e.Path, "/")
+		found = append(found, e)
+	}
+	for _, relPath := range files {
+		name := path.Base(relPath)
+		switch {
+		case name == "manage.py":
+			add(EntryPoint{Path: relPath, Kind: KindDjangoManage}, 0)
+		case name == "package.json":
+			data, err := read(relPath)
+			if err != nil {
+				continue
+			}
+			for _, e := range packageEntryPoints(relPath, data) {
+				add(e, scriptScores[e.Name])
+			}
+		case name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".Dockerfile"):
+			data, err := read(relPath)
+			if err != nil {
+				continue
+			}
+			if command := dockerCommand(data); command != "" {
+				add(EntryPoint{Path: relPath, Kind: KindDockerfile, Command: command}, 0)
+			}
+		case strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go"):
+			if data, err := read(relPath); err == nil && goPackageMain.Match(data) && goFuncMain.Match(data) {
+				add(EntryPoint{Path: relPath, Kind: KindGoMain}, 0)
+			}
+		case strings.HasSuffix(name, ".rs"):
+			if name != "main.rs" && !strings.Contains(relPath, "src/bin/") {
+				continue
+			}
+			if data, err := read(relPath); err == nil && rustFnMain.Match(data) {
+				add(EntryPoint{Path: relPath, Kind: KindRustMain}, 0)
+			}
+		case strings.HasSuffix(name, ".py"):
+			if data, err := read(relPath); err == nil && pyMainGuard.Match(data) {
+				// __main__.py runs the package; other guarded modules are often just scripts.
+				bonus := 0
+				if name == "__main__.py" {
+					bonus = 20
+				}
+				add(EntryPoint{Path: relPath, Kind: KindPythonMain}, bonus)
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Score != found[j].Score {
+			return found[i].Score > found[j].Score
+		}
+		if found[i].Path != found[j].Path {
+			return found[i].Path < found[j].Path
+		}
+		return found[i].Name < found[j].Name
+	})
+	return found
+}
+
+// packageEntryPoints returns the "bin", "main" and "scripts" entries of a package.json.
+func packageEntryPoints(relPath string, data []byte) []EntryPoint {
+	var pkg struct {
+		Name    string            `json:"name"`
+		Main    string            `json:"main"`
+		Bin     json.RawMessage   `json:"bin"`
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil
+	}
+	dir := path.Dir(relPath)
+	var entries []EntryPoint
+	// "bin" is either one path, named after the package, or a map of command names to paths.
+	bins := map[string]string{}
+	var single string
+	if json.Unmarshal(pkg.Bin, &single) == nil && single != "" {
+		bins[path.Base(pkg.Name)] = single
+	} else {
+		json.Unmarshal(pkg.Bin, &bins)
+	}
+	for name, target := range bins {
+		entries = append(entries, EntryPoint{Path: relPath, Kind: KindPackageBin, Name: name, Target: path.Join(dir, target)})
+	}
+	if pkg.Main != "" {
+		entries = append(entries, EntryPoint{Path: relPath, Kind: KindPackageMain, Target: path.Join(dir, pkg.Main)})
+	}
+	for name, command := range pkg.Scripts {
+		entries = append(entries, EntryPoint{Path: relPath, Kind: KindPackageScript, Name: name, Command: command})
+	}
+	return entries
+}
+
+// dockerCommand returns the last ENTRYPOINT and CMD of a Dockerfile (the ones that take
+// effect), joined by a space, or "" if it has neither.
+func dockerCommand(data []byte) string {
+	var entrypoint, cmd string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var line string
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		// Instructions continue on the next line after a trailing backslash.
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		line += text
+		instruction, args, _ := strings.Cut(line, " ")
+		line = ""
+		switch strings.ToUpper(instruction) {
+		case "ENTRYPOINT":
+			entrypoint = dockerArgs(args)
+		case "CMD":
+			cmd = dockerArgs(args)
+		}
+	}
+	return strings.TrimSpace(entrypoint + " " + cmd)
+}
+
+// dockerArgs turns the exec form ["a", "b"] of an instruction into "a b"; the shell form
+// is returned as is.
+func dockerArgs(args string) string {
+	args = strings.TrimSpace(args)
+	var list []string
+	if strings.HasPrefix(args, "[") && json.Unmarshal([]byte(args), &list) == nil {
+		return strings.Join(list, " ")
+	}
+	return args
+}
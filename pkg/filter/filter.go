@@ -2,13 +2,26 @@
 package filter
 
 import (
-	"database/sql"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+
+	"code-prompt-core/pkg/database"
+	"code-prompt-core/pkg/transform"
 )
 
+// SortByChurn is the Filter.SortBy value that orders files by descending churn.
+const SortByChurn = "churn"
+
 type Filter struct {
 	IncludePaths    []string `json:"includePaths,omitempty"`
 	ExcludePaths    []string `json:"excludePaths,omitempty"`
@@ -20,13 +33,191 @@ type Filter struct {
 	IncludeRegex []string `json:"includeRegex,omitempty"`
 	ExcludeRegex []string `json:"excludeRegex,omitempty"`
 
+	IncludeTags []string `json:"includeTags,omitempty"`
+	ExcludeTags []string `json:"excludeTags,omitempty"`
+
+	// Subtree keeps only the files under this directory ('/'-separated, relative to the
+	// project), whatever the other rules say. The global '--package' flag sets it.
+	Subtree string `json:"subtree,omitempty"`
+
+	// ExcludeGenerated drops files marked linguist-generated/linguist-vendored. It defaults to true.
+	ExcludeGenerated *bool `json:"excludeGenerated,omitempty"`
+	// ExcludeMinified drops files detected as minified or carrying a generated-code header. It defaults to true.
+	ExcludeMinified *bool `json:"excludeMinified,omitempty"`
+	// IncludeExecutable set to true keeps only files with an execute bit (scripts, tooling);
+	// set to false it drops them. Unset, the execute bits are ignored.
+	IncludeExecutable *bool `json:"includeExecutable,omitempty"`
+	// IncludeTests keeps only test files, ExcludeTests drops them (see scanner.IsTestFile).
+	IncludeTests bool `json:"includeTests,omitempty"`
+	ExcludeTests bool `json:"excludeTests,omitempty"`
+
+	// MinChurn keeps only files with at least this many changed lines (added plus deleted)
+	// in the git history stored by 'analyze churn'. Zero disables the rule.
+	MinChurn int64 `json:"minChurn,omitempty"`
+	// SortBy orders the matching files: "churn" puts the most changed files first.
+	// By default files are returned in cache order.
+	SortBy string `json:"sortBy,omitempty"`
+	// Transform is applied to the contents of the matching files by the commands that return
+	// them ('content get', 'report generate'). It does not affect which files match.
+	Transform *transform.Options `json:"transform,omitempty"`
+
 	Priority string `json:"priority"`
 
 	compiledIncludeRegex []*regexp.Regexp `json:"-"`
 	compiledExcludeRegex []*regexp.Regexp `json:"-"`
 }
 
+// LegacyKeys maps filter JSON keys of older releases to the current keys they stand for.
+// Profiles saved with them still load: their values are added to the current fields.
+var LegacyKeys = map[string]string{
+	"includes": "includeRegex",
+	"excludes": "excludeRegex",
+}
+
+// UnmarshalJSON decodes a filter, accepting the LegacyKeys as aliases.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	type plain Filter
+	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
+		return err
+	}
+	var legacy struct {
+		Includes []string `json:"includes"`
+		Excludes []string `json:"excludes"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	f.IncludeRegex = append(f.IncludeRegex, legacy.Includes...)
+	f.ExcludeRegex = append(f.ExcludeRegex, legacy.Excludes...)
+	return nil
+}
+
+// ParseStrict decodes filter JSON like json.Unmarshal, but fails on keys that are neither
+// filter fields nor LegacyKeys, such as the typo "includeExt", naming the offending key.
+// Keys of the nested "transform" object are checked as well.
+func ParseStrict(data []byte) (Filter, error) {
+	var f Filter
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return f, err
+	}
+	known := map[string]bool{}
+	t := reflect.TypeOf(f)
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+	for key := range keys {
+		if !known[key] && LegacyKeys[key] == "" {
+			return f, fmt.Errorf("unknown filter key '%s'", key)
+		}
+	}
+	if raw, ok := keys["transform"]; ok && string(raw) != "null" {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&transform.Options{}); err != nil {
+			return f, fmt.Errorf("invalid transform: %w", err)
+		}
+	}
+	err := json.Unmarshal(data, &f)
+	return f, err
+}
+
+// Normalize returns the canonical form of the filter: rule lists sorted and without
+// duplicates, extensions without their dot, paths with forward slashes, and defaults
+// (priority "includes", excluding generated and minified files, an empty transform) left
+// implicit. Filters that select the same files with the same transform normalize equally.
+func (f Filter) Normalize() Filter {
+	n := Filter{
+		IncludePaths:    canonicalList(f.IncludePaths, filepath.ToSlash),
+		ExcludePaths:    canonicalList(f.ExcludePaths, filepath.ToSlash),
+		IncludeExts:     canonicalList(f.IncludeExts, trimDot),
+		ExcludeExts:     canonicalList(f.ExcludeExts, trimDot),
+		IncludePrefixes: canonicalList(f.IncludePrefixes, nil),
+		ExcludePrefixes: canonicalList(f.ExcludePrefixes, nil),
+		IncludeRegex:    canonicalList(f.IncludeRegex, nil),
+		ExcludeRegex:    canonicalList(f.ExcludeRegex, nil),
+		IncludeTags:     canonicalList(f.IncludeTags, nil),
+		ExcludeTags:     canonicalList(f.ExcludeTags, nil),
+		Subtree:         canonicalSubtree(f.Subtree),
+		IncludeTests:    f.IncludeTests,
+		ExcludeTests:    f.ExcludeTests,
+		MinChurn:        f.MinChurn,
+		SortBy:          f.SortBy,
+		Priority:        f.Priority,
+	}
+	if n.Priority == "" {
+		n.Priority = "includes"
+	}
+	if !f.ExcludesGenerated() {
+		n.ExcludeGenerated = f.ExcludeGenerated
+	}
+	if !f.ExcludesMinified() {
+		n.ExcludeMinified = f.ExcludeMinified
+	}
+	n.IncludeExecutable = f.IncludeExecutable
+	if f.Transform != nil && *f.Transform != (transform.Options{}) {
+		t := *f.Transform
+		if t.MaxFileTokens == 0 {
+			t.Truncate = ""
+		} else if t.Truncate == "" {
+			t.Truncate = transform.TruncateHead
+		}
+		n.Transform = &t
+	}
+	return n
+}
+
+// canonicalSubtree cleans a Subtree, with "" for the whole project.
+func canonicalSubtree(subtree string) string {
+	if subtree == "" {
+		return ""
+	}
+	if subtree = path.Clean(filepath.ToSlash(subtree)); subtree == "." {
+		return ""
+	}
+	return subtree
+}
+
+// canonicalList applies clean to the values (if not nil) and returns them sorted and
+// without duplicates, or nil if there are none.
+func canonicalList(values []string, clean func(string) string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if clean != nil {
+			v = clean(v)
+		}
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return slices.Compact(out)
+}
+
+func trimDot(ext string) string {
+	return strings.TrimPrefix(ext, ".")
+}
+
+// Hash returns the SHA-256 of the JSON encoding of the normalized filter, a stable key of
+// the rules independent of how they were given (profile, filter JSON, legacy keys, order).
+func (f Filter) Hash() string {
+	data, _ := json.Marshal(f.Normalize())
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func (f *Filter) Compile() error {
+	if f.SortBy != "" && f.SortBy != SortByChurn {
+		return fmt.Errorf("invalid sortBy '%s' (expected \"%s\")", f.SortBy, SortByChurn)
+	}
+	if f.Transform != nil {
+		if err := f.Transform.Validate(); err != nil {
+			return fmt.Errorf("invalid transform: %w", err)
+		}
+	}
 	var allIncludeRegex, allExcludeRegex []string
 
 	allIncludeRegex = append(allIncludeRegex, f.IncludeRegex...)
@@ -102,46 +293,189 @@ func (f *Filter) GetCompiledExcludeRegex() []*regexp.Regexp {
 	return f.compiledExcludeRegex
 }
 
-func GetFilteredFilePaths(db *sql.DB, projectID int64, filter Filter) ([]string, error) {
-	rows, err := db.Query("SELECT relative_path FROM file_metadata WHERE project_id = ?", projectID)
+// UsesTags reports whether the filter has tag rules, which require the file tags to be loaded.
+func (f *Filter) UsesTags() bool {
+	return len(f.IncludeTags) > 0 || len(f.ExcludeTags) > 0
+}
+
+// FileAttributes carries the cached per-file data that filter rules can match on besides the path.
+type FileAttributes struct {
+	Tags        []string
+	IsGenerated bool
+	IsMinified  bool
+	// IsExecutable is set for files with an execute bit.
+	IsExecutable bool
+	IsTest       bool
+	// Churn is the number of changed lines stored by 'analyze churn' (0 if unknown).
+	Churn int64
+}
+
+// ExcludesGenerated reports whether generated files are dropped, which is the default.
+func (f *Filter) ExcludesGenerated() bool {
+	return f.ExcludeGenerated == nil || *f.ExcludeGenerated
+}
+
+// ExcludesMinified reports whether minified files are dropped, which is the default.
+func (f *Filter) ExcludesMinified() bool {
+	return f.ExcludeMinified == nil || *f.ExcludeMinified
+}
+
+// Match reports whether a relative path passes the compiled filter.
+// attrs are only consulted for tag rules and the generated/minified/executable/test switches.
+func (f *Filter) Match(relativePath string, attrs FileAttributes) bool {
+	if attrs.IsGenerated && f.ExcludesGenerated() || attrs.IsMinified && f.ExcludesMinified() {
+		return false
+	}
+	if f.IncludeExecutable != nil && *f.IncludeExecutable != attrs.IsExecutable {
+		return false
+	}
+	if f.IncludeTests && !attrs.IsTest || f.ExcludeTests && attrs.IsTest {
+		return false
+	}
+	if subtree := canonicalSubtree(f.Subtree); subtree != "" && !strings.HasPrefix(relativePath, subtree+"/") {
+		return false
+	}
+	if f.MinChurn > 0 && attrs.Churn < f.MinChurn {
+		return false
+	}
+	hasIncludeRules := len(f.compiledIncludeRegex) > 0 || len(f.IncludeTags) > 0
+	matchInclude := !hasIncludeRules || MatchesAny(relativePath, f.compiledIncludeRegex) || hasAnyTag(attrs.Tags, f.IncludeTags)
+	matchExclude := MatchesAny(relativePath, f.compiledExcludeRegex) || hasAnyTag(attrs.Tags, f.ExcludeTags)
+
+	if matchInclude && matchExclude {
+		return f.Priority != "excludes"
+	}
+	return matchInclude
+}
+
+// LoadFileTags returns the tags of every tagged file in a project, keyed by relative path.
+func LoadFileTags(db database.Querier, projectID int64) (map[string][]string, error) {
+	rows, err := db.Query("SELECT relative_path, tag FROM file_tags WHERE project_id = ?", projectID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying file metadata: %w", err)
+		return nil, fmt.Errorf("error querying file tags: %w", err)
 	}
 	defer rows.Close()
-
-	var resultingPaths []string
+	tags := make(map[string][]string)
 	for rows.Next() {
-		var relativePath string
-		if err := rows.Scan(&relativePath); err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
+		var relativePath, tag string
+		if err := rows.Scan(&relativePath, &tag); err != nil {
+			return nil, fmt.Errorf("error scanning tag row: %w", err)
 		}
+		tags[relativePath] = append(tags[relativePath], tag)
+	}
+	return tags, rows.Err()
+}
 
-		matchInclude := len(filter.compiledIncludeRegex) == 0 || MatchesAny(relativePath, filter.compiledIncludeRegex)
-		matchExclude := len(filter.compiledExcludeRegex) > 0 && MatchesAny(relativePath, filter.compiledExcludeRegex)
+// FileMetadata is the cached metadata of one file, as passed to IterateFilteredFiles.
+type FileMetadata struct {
+	RelativePath string
+	Filename     string
+	Extension    string
+	SizeBytes    int64
+	LineCount    int
+	IsText       bool
+	LastModTime  string
+	ContentHash  string
+	IsGenerated  bool
+	IsMinified   bool
+	// Mode holds the permission bits of the file (0 if cached by an older version).
+	Mode         int64
+	IsExecutable bool
+	IsTest       bool
+	// Churn is the number of changed lines stored by 'analyze churn' (0 if unknown).
+	Churn int64
+}
 
-		shouldAdd := false
-		if matchInclude && matchExclude {
-			shouldAdd = (filter.Priority != "excludes")
-		} else if matchInclude {
-			shouldAdd = true
-		} else if matchExclude {
-			shouldAdd = false
-		} else {
-			shouldAdd = len(filter.compiledIncludeRegex) == 0
+// IterateFilteredFiles calls fn with the metadata of every cached file of a project that
+// passes the filter, in one pass over file_metadata, so callers need no second query with a
+// list of paths. An error returned by fn stops the iteration and is returned as is. With
+// "sortBy": "churn" the matching rows are collected and sorted before fn is called.
+func IterateFilteredFiles(db database.Querier, projectID int64, filter Filter, fn func(meta FileMetadata) error) error {
+	var fileTags map[string][]string
+	if filter.UsesTags() {
+		var err error
+		fileTags, err = LoadFileTags(db, projectID)
+		if err != nil {
+			return err
 		}
+	}
 
-		if shouldAdd {
-			resultingPaths = append(resultingPaths, relativePath)
-		}
+	rows, err := db.Query(`
+		SELECT m.relative_path, m.filename, COALESCE(m.extension, ''), m.size_bytes, m.line_count, m.is_text,
+		       m.last_mod_time, m.content_hash, m.is_generated, m.is_minified, m.mode, m.is_executable, m.is_test, COALESCE(c.lines_added + c.lines_deleted, 0)
+		FROM file_metadata m
+		LEFT JOIN file_churn c ON c.project_id = m.project_id AND c.relative_path = m.relative_path
+		WHERE m.project_id = ?`, projectID)
+	if err != nil {
+		return fmt.Errorf("error querying file metadata: %w", err)
 	}
+	defer rows.Close()
 
+	sortByChurn := filter.SortBy == SortByChurn
+	var sorted []FileMetadata
+	for rows.Next() {
+		var m FileMetadata
+		if err := rows.Scan(&m.RelativePath, &m.Filename, &m.Extension, &m.SizeBytes, &m.LineCount, &m.IsText,
+			&m.LastModTime, &m.ContentHash, &m.IsGenerated, &m.IsMinified, &m.Mode, &m.IsExecutable, &m.IsTest, &m.Churn); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if !filter.Match(m.RelativePath, FileAttributes{Tags: fileTags[m.RelativePath], IsGenerated: m.IsGenerated, IsMinified: m.IsMinified, IsExecutable: m.IsExecutable, IsTest: m.IsTest, Churn: m.Churn}) {
+			continue
+		}
+		if sortByChurn {
+			sorted = append(sorted, m)
+			continue
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error during row iteration: %w", err)
+		return fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	if sortByChurn {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := sorted[i], sorted[j]
+			if a.Churn != b.Churn {
+				return a.Churn > b.Churn
+			}
+			return a.RelativePath < b.RelativePath
+		})
+		for _, m := range sorted {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
+// GetFilteredFilePaths returns the relative paths of the files that pass the filter, in the
+// order of IterateFilteredFiles.
+func GetFilteredFilePaths(db database.Querier, projectID int64, filter Filter) ([]string, error) {
+	var resultingPaths []string
+	err := IterateFilteredFiles(db, projectID, filter, func(m FileMetadata) error {
+		resultingPaths = append(resultingPaths, m.RelativePath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return resultingPaths, nil
 }
 
+func hasAnyTag(tags, wanted []string) bool {
+	for _, t := range tags {
+		for _, w := range wanted {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func MatchesAny(path string, patterns []*regexp.Regexp) bool {
 	for _, re := range patterns {
 		if re.MatchString(path) {
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// GitignoreRules converts the lines of a .gitignore file into regexes for Filter.ExcludeRegex,
+// matched against slash-separated relative paths. Negated patterns ("!keep.txt") cannot be
+// expressed as exclusions and are returned as is in negated; comments and blank lines are dropped.
+func GitignoreRules(lines []string) (excludeRegex, negated []string) {
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		line = trimGitignoreSpaces(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			negated = append(negated, line)
+			continue
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if re := gitignoreRegex(line); re != "" {
+			excludeRegex = append(excludeRegex, re)
+		}
+	}
+	return excludeRegex, negated
+}
+
+// trimGitignoreSpaces removes trailing spaces unless they are escaped with a backslash.
+func trimGitignoreSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// gitignoreRegex translates one gitignore pattern. A pattern with a slash other than a trailing
+// one is anchored at the project root, otherwise it matches at any depth; a pattern naming a
+// directory also matches everything below it.
+func gitignoreRegex(pattern string) string {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return ""
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var sb strings.Builder
+	if anchored {
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("(^|/)")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern) && (i == 0 || pattern[i-1] == '/'):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("(/|$)")
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+// File: pkg/imageinfo/imageinfo.go
+package imageinfo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// imageExtensions are the binary image formats described by placeholders. SVG is text and is
+// returned as regular content.
+var imageExtensions = map[string]bool{
+	"png": true, "jpg": true, "jpeg": true, "gif": true, "webp": true, "bmp": true,
+	"ico": true, "tif": true, "tiff": true, "avif": true, "heic": true,
+}
+
+// Placeholder describes an image in place of its bytes. Width and height are only known for
+// PNG, JPEG and GIF files.
+type Placeholder struct {
+	Path     string `json:"path"`
+	MimeType string `json:"mime_type"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Size     int64  `json:"size"`
+	Base64   string `json:"base64,omitempty"`
+}
+
+// IsImage reports whether files with the given extension are described by a placeholder.
+func IsImage(ext string) bool {
+	return imageExtensions[strings.ToLower(strings.TrimPrefix(ext, "."))]
+}
+
+// Describe builds the placeholder of an image. The image is embedded as base64 when
+// base64MaxBytes is positive and the image is not larger than it.
+func Describe(relPath string, data []byte, base64MaxBytes int64) Placeholder {
+	p := Placeholder{
+		Path:     relPath,
+		MimeType: mime.TypeByExtension(strings.ToLower(path.Ext(relPath))),
+		Size:     int64(len(data)),
+	}
+	if p.MimeType == "" {
+		p.MimeType = http.DetectContentType(data)
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		p.Width, p.Height = cfg.Width, cfg.Height
+	}
+	if base64MaxBytes > 0 && p.Size <= base64MaxBytes {
+		p.Base64 = base64.StdEncoding.EncodeToString(data)
+	}
+	return p
+}
@@ -0,0 +1,168 @@
+// File: pkg/jsonschema/jsonschema.go
+package jsonschema
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Draft is the JSON Schema dialect of the generated documents.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document or subschema.
+type Schema map[string]interface{}
+
+// String, Integer, Number, Boolean and Any are the primitive schemas.
+func String() Schema  { return Schema{"type": "string"} }
+func Integer() Schema { return Schema{"type": "integer"} }
+func Number() Schema  { return Schema{"type": "number"} }
+func Boolean() Schema { return Schema{"type": "boolean"} }
+func Any() Schema     { return Schema{} }
+
+// Array is an array of items.
+func Array(items Schema) Schema {
+	return Schema{"type": "array", "items": items}
+}
+
+// Map is an object with arbitrary keys whose values follow values.
+func Map(values Schema) Schema {
+	return Schema{"type": "object", "additionalProperties": values}
+}
+
+// Object is an object with the given properties, all of which are required.
+func Object(properties map[string]Schema) Schema {
+	return ObjectWithOptional(properties, nil)
+}
+
+// ObjectWithOptional is an object whose properties are required unless listed in optional.
+func ObjectWithOptional(properties map[string]Schema, optional []string) Schema {
+	props := make(map[string]interface{}, len(properties))
+	required := []string{}
+	isOptional := make(map[string]bool, len(optional))
+	for _, name := range optional {
+		isOptional[name] = true
+	}
+	for name, schema := range properties {
+		props[name] = schema
+		if !isOptional[name] {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return Schema{"type": "object", "properties": props, "required": required}
+}
+
+// OneOf accepts a value matching exactly one of the schemas.
+func OneOf(schemas ...Schema) Schema {
+	return Schema{"oneOf": schemas}
+}
+
+// Nullable additionally accepts null.
+func Nullable(s Schema) Schema {
+	return OneOf(s, Schema{"type": "null"})
+}
+
+// Describe returns a copy of s with a description.
+func Describe(s Schema, description string) Schema {
+	c := make(Schema, len(s)+1)
+	for k, v := range s {
+		c[k] = v
+	}
+	c["description"] = description
+	return c
+}
+
+// Reflect derives the schema of a Go value from its type and json struct tags. Fields
+// tagged "omitempty" are optional; fields tagged "-" and unexported fields are skipped.
+// Recursive types (such as tree nodes) are emitted as "$defs" entries referenced by "$ref".
+func Reflect(v interface{}) Schema {
+	r := &reflector{visiting: make(map[reflect.Type]bool), defs: make(map[string]interface{})}
+	schema := r.reflectType(reflect.TypeOf(v))
+	if len(r.defs) > 0 {
+		schema["$defs"] = r.defs
+	}
+	return schema
+}
+
+type reflector struct {
+	visiting map[reflect.Type]bool
+	defs     map[string]interface{}
+}
+
+func (r *reflector) reflectType(t reflect.Type) Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return r.reflectType(t.Elem())
+	case reflect.String:
+		return String()
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer()
+	case reflect.Float32, reflect.Float64:
+		return Number()
+	case reflect.Slice, reflect.Array:
+		return Array(r.reflectType(t.Elem()))
+	case reflect.Map:
+		return Map(r.reflectType(t.Elem()))
+	case reflect.Struct:
+		if t.PkgPath() == "time" && t.Name() == "Time" {
+			return Schema{"type": "string", "format": "date-time"}
+		}
+		ref := Schema{"$ref": "#/$defs/" + t.Name()}
+		if r.visiting[t] {
+			r.defs[t.Name()] = nil
+			return ref
+		}
+		r.visiting[t] = true
+		properties := make(map[string]Schema)
+		var optional []string
+		r.collectFields(t, properties, &optional)
+		delete(r.visiting, t)
+		schema := ObjectWithOptional(properties, optional)
+		if _, recursive := r.defs[t.Name()]; recursive {
+			r.defs[t.Name()] = schema
+			return ref
+		}
+		return schema
+	}
+	return Any()
+}
+
+func (r *reflector) collectFields(t reflect.Type, properties map[string]Schema, optional *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.collectFields(ft, properties, optional)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := r.reflectType(field.Type)
+		// A nil slice or map is encoded as null.
+		if k := field.Type.Kind(); k == reflect.Slice || k == reflect.Map || k == reflect.Ptr {
+			schema = Nullable(schema)
+		}
+		properties[name] = schema
+		if strings.Contains(opts, "omitempty") {
+			*optional = append(*optional, name)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package markdown
+
+import "strings"
+
+// StripComments removes the comments from code in a language that Highlight knows; code in
+// other languages is returned as is. Lines left blank by a removed comment are dropped, and a
+// leading "#!" line is kept. Like Highlight, it is a lexical approximation.
+func StripComments(code, language string) string {
+	syn, ok := syntaxes[language]
+	if !ok || (len(syn.lineComments) == 0 && syn.blockComment[0] == "") {
+		return code
+	}
+	// removed marks where a comment was, so that the lines it leaves blank can be dropped.
+	const removed = '\x00'
+	var out strings.Builder
+	src := []rune(code)
+	i := 0
+	if strings.HasPrefix(code, "#!") {
+		i = indexFrom(src, 0, "\n")
+		out.WriteString(string(src[:i]))
+	}
+	for i < len(src) {
+		rest := string(src[i:min(len(src), i+3)])
+		if open := syn.blockComment[0]; open != "" && strings.HasPrefix(rest, open) {
+			i = indexFrom(src, i+len(open), syn.blockComment[1])
+			out.WriteRune(removed)
+			continue
+		}
+		if hasAnyPrefix(rest, syn.lineComments) {
+			end := indexFrom(src, i, "\n")
+			if end > i && src[end-1] == '\n' {
+				end--
+			}
+			i = end
+			out.WriteRune(removed)
+			continue
+		}
+		if strings.ContainsRune(syn.quotes, src[i]) {
+			end := stringEnd(src, i, syn.tripleQuotes)
+			out.WriteString(string(src[i:end]))
+			i = end
+			continue
+		}
+		out.WriteRune(src[i])
+		i++
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.ContainsRune(line, removed) {
+			line = strings.TrimRight(strings.ReplaceAll(line, string(removed), ""), " \t")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,189 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// syntax describes the lexical elements Highlight recognises in a language.
+type syntax struct {
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+	// tripleQuotes enables Python's """ and ''' strings.
+	tripleQuotes bool
+	keywords     map[string]bool
+}
+
+func keywordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+var (
+	cKeywords = keywordSet(`if else for while do switch case default break continue return goto struct union enum
+		typedef const static extern void int char long short float double unsigned signed sizeof true false null
+		class public private protected new delete this try catch throw namespace using template virtual override`)
+	goKeywords = keywordSet(`break case chan const continue default defer else fallthrough for func go goto if import
+		interface map package range return select struct switch type var nil true false iota`)
+	jsKeywords = keywordSet(`async await break case catch class const continue debugger default delete do else export
+		extends finally for from function if import in instanceof let new null of return static super switch this throw
+		true false try typeof undefined var void while yield interface type enum implements readonly as`)
+	javaKeywords = keywordSet(`abstract boolean break byte case catch char class const continue default do double else
+		enum extends final finally float for if implements import instanceof int interface long native new null package
+		private protected public return short static super switch synchronized this throw throws try void volatile while
+		true false var val fun object when override data sealed`)
+	rustKeywords = keywordSet(`as async await break const continue crate dyn else enum extern false fn for if impl in
+		let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while`)
+	pythonKeywords = keywordSet(`and as assert async await break class continue def del elif else except False finally
+		for from global if import in is lambda None nonlocal not or pass raise return True try while with yield self`)
+	shellKeywords = keywordSet(`if then else elif fi for while until do done case esac in function return export local
+		readonly set unset echo exit`)
+	sqlKeywords = keywordSet(`select from where insert into values update set delete create table index view drop alter
+		join left right inner outer on group by order having limit offset as and or not null is in exists primary key
+		foreign references default unique union all distinct case when then else end begin commit
+		SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX VIEW DROP ALTER JOIN LEFT RIGHT INNER
+		OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS AND OR NOT NULL IS IN EXISTS PRIMARY KEY FOREIGN REFERENCES
+		DEFAULT UNIQUE UNION ALL DISTINCT CASE WHEN THEN ELSE END BEGIN COMMIT`)
+)
+
+var syntaxes = map[string]syntax{
+	"go":         {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", keywords: goKeywords},
+	"c":          {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: cKeywords},
+	"cpp":        {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: cKeywords},
+	"csharp":     {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: cKeywords},
+	"java":       {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: javaKeywords},
+	"kotlin":     {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: javaKeywords},
+	"scala":      {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: javaKeywords},
+	"rust":       {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"`, keywords: rustKeywords},
+	"javascript": {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", keywords: jsKeywords},
+	"typescript": {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", keywords: jsKeywords},
+	"jsx":        {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", keywords: jsKeywords},
+	"tsx":        {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", keywords: jsKeywords},
+	"css":        {blockComment: [2]string{"/*", "*/"}, quotes: `"'`},
+	"scss":       {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`},
+	"less":       {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`},
+	"protobuf":   {lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"'`, keywords: keywordSet("syntax package import option message enum service rpc returns repeated optional map oneof")},
+	"python":     {lineComments: []string{"#"}, quotes: `"'`, tripleQuotes: true, keywords: pythonKeywords},
+	"ruby":       {lineComments: []string{"#"}, quotes: `"'`, keywords: keywordSet("def end class module if elsif else unless while until do return yield self nil true false require")},
+	"bash":       {lineComments: []string{"#"}, quotes: `"'`, keywords: shellKeywords},
+	"makefile":   {lineComments: []string{"#"}, quotes: `"'`},
+	"dockerfile": {lineComments: []string{"#"}, quotes: `"'`, keywords: keywordSet("FROM RUN CMD COPY ADD ENV ARG WORKDIR EXPOSE ENTRYPOINT USER VOLUME LABEL AS")},
+	"yaml":       {lineComments: []string{"#"}, quotes: `"'`, keywords: keywordSet("true false null yes no")},
+	"toml":       {lineComments: []string{"#"}, quotes: `"'`, keywords: keywordSet("true false")},
+	"hcl":        {lineComments: []string{"#", "//"}, blockComment: [2]string{"/*", "*/"}, quotes: `"`},
+	"sql":        {lineComments: []string{"--"}, blockComment: [2]string{"/*", "*/"}, quotes: `'"`, keywords: sqlKeywords},
+	"lua":        {lineComments: []string{"--"}, quotes: `"'`, keywords: keywordSet("and break do else elseif end false for function if in local nil not or repeat return then true until while")},
+	"json":       {quotes: `"`, keywords: keywordSet("true false null")},
+}
+
+// Highlight returns code as escaped HTML in which comments, strings, numbers and keywords are
+// wrapped in <span class="hl-com">, "hl-str", "hl-num" and "hl-kw". It is a lexical
+// approximation meant for reading, not a parser; code in other languages is only escaped.
+func Highlight(code, language string) string {
+	syn, ok := syntaxes[language]
+	if !ok {
+		return html.EscapeString(code)
+	}
+	var out strings.Builder
+	span := func(class, text string) {
+		out.WriteString(`<span class="` + class + `">` + html.EscapeString(text) + `</span>`)
+	}
+	src := []rune(code)
+	for i := 0; i < len(src); {
+		rest := string(src[i:min(len(src), i+3)])
+		if open := syn.blockComment[0]; open != "" && strings.HasPrefix(rest, open) {
+			end := indexFrom(src, i+len(open), syn.blockComment[1])
+			span("hl-com", string(src[i:end]))
+			i = end
+			continue
+		}
+		if hasAnyPrefix(rest, syn.lineComments) {
+			end := indexFrom(src, i, "\n")
+			if end > i && src[end-1] == '\n' {
+				end--
+			}
+			span("hl-com", string(src[i:end]))
+			i = end
+			continue
+		}
+		c := src[i]
+		if strings.ContainsRune(syn.quotes, c) {
+			end := stringEnd(src, i, syn.tripleQuotes)
+			span("hl-str", string(src[i:end]))
+			i = end
+			continue
+		}
+		if unicode.IsDigit(c) {
+			end := i
+			for end < len(src) && (unicode.IsLetter(src[end]) || unicode.IsDigit(src[end]) || src[end] == '.' || src[end] == '_') {
+				end++
+			}
+			span("hl-num", string(src[i:end]))
+			i = end
+			continue
+		}
+		if unicode.IsLetter(c) || c == '_' {
+			end := i
+			for end < len(src) && (unicode.IsLetter(src[end]) || unicode.IsDigit(src[end]) || src[end] == '_') {
+				end++
+			}
+			word := string(src[i:end])
+			if syn.keywords[word] {
+				span("hl-kw", word)
+			} else {
+				out.WriteString(html.EscapeString(word))
+			}
+			i = end
+			continue
+		}
+		out.WriteString(html.EscapeString(string(c)))
+		i++
+	}
+	return out.String()
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexFrom returns the index just after the first occurrence of sep at or after start,
+// or len(src) if there is none.
+func indexFrom(src []rune, start int, sep string) int {
+	sepRunes := []rune(sep)
+	for i := start; i+len(sepRunes) <= len(src); i++ {
+		if string(src[i:i+len(sepRunes)]) == sep {
+			return i + len(sepRunes)
+		}
+	}
+	return len(src)
+}
+
+// stringEnd returns the index just after the string literal starting at src[start]. Backslash
+// escapes are honoured, and a string quoted with ' or " ends at the end of its line at the latest.
+func stringEnd(src []rune, start int, tripleQuotes bool) int {
+	quote := src[start]
+	if tripleQuotes && start+2 < len(src) && src[start+1] == quote && src[start+2] == quote {
+		return indexFrom(src, start+3, strings.Repeat(string(quote), 3))
+	}
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case src[i] == '\\' && quote != '`':
+			i++
+		case src[i] == quote:
+			return i + 1
+		case src[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(src)
+}
@@ -0,0 +1,69 @@
+package markdown
+
+import (
+	"path"
+	"strings"
+)
+
+// languagesByExtension maps file extensions to the language identifiers used after a code fence.
+var languagesByExtension = map[string]string{
+	"go": "go", "py": "python", "ipynb": "python", "rb": "ruby", "rs": "rust", "java": "java",
+	"kt": "kotlin", "kts": "kotlin", "scala": "scala", "swift": "swift", "c": "c", "h": "c",
+	"cc": "cpp", "cpp": "cpp", "cxx": "cpp", "hpp": "cpp", "cs": "csharp", "php": "php",
+	"js": "javascript", "mjs": "javascript", "cjs": "javascript", "jsx": "jsx", "ts": "typescript",
+	"tsx": "tsx", "vue": "vue", "svelte": "svelte", "html": "html", "htm": "html", "css": "css",
+	"scss": "scss", "sass": "sass", "less": "less", "json": "json", "yaml": "yaml", "yml": "yaml",
+	"toml": "toml", "xml": "xml", "sql": "sql", "proto": "protobuf", "sh": "bash", "bash": "bash",
+	"zsh": "bash", "ps1": "powershell", "md": "markdown", "mdx": "markdown", "rst": "rst",
+	"lua": "lua", "dart": "dart", "ex": "elixir", "exs": "elixir", "erl": "erlang", "hs": "haskell",
+	"clj": "clojure", "r": "r", "pl": "perl", "tf": "hcl", "hcl": "hcl", "graphql": "graphql",
+	"gql": "graphql", "dockerfile": "dockerfile", "mk": "makefile",
+}
+
+// languagesByName covers files recognised by their name rather than their extension.
+var languagesByName = map[string]string{
+	"dockerfile": "dockerfile", "makefile": "makefile", "gnumakefile": "makefile",
+	"go.mod": "go", "go.sum": "text", "cmakelists.txt": "cmake",
+}
+
+// Language returns the code fence language of a file from its name or extension,
+// or "" when it is unknown.
+func Language(relPath string) string {
+	name := strings.ToLower(path.Base(relPath))
+	if lang, ok := languagesByName[name]; ok {
+		return lang
+	}
+	return languagesByExtension[strings.TrimPrefix(path.Ext(name), ".")]
+}
+
+// languageNames are the display names of the language identifiers, as GitHub shows them.
+var languageNames = map[string]string{
+	"go": "Go", "python": "Python", "ruby": "Ruby", "rust": "Rust", "java": "Java", "kotlin": "Kotlin",
+	"scala": "Scala", "swift": "Swift", "c": "C", "cpp": "C++", "csharp": "C#", "php": "PHP",
+	"javascript": "JavaScript", "jsx": "JavaScript", "typescript": "TypeScript", "tsx": "TypeScript",
+	"vue": "Vue", "svelte": "Svelte", "html": "HTML", "css": "CSS", "scss": "SCSS", "sass": "Sass",
+	"less": "Less", "json": "JSON", "yaml": "YAML", "toml": "TOML", "xml": "XML", "sql": "SQL",
+	"protobuf": "Protocol Buffer", "bash": "Shell", "powershell": "PowerShell", "markdown": "Markdown",
+	"rst": "reStructuredText", "lua": "Lua", "dart": "Dart", "elixir": "Elixir", "erlang": "Erlang",
+	"haskell": "Haskell", "clojure": "Clojure", "r": "R", "perl": "Perl", "hcl": "HCL",
+	"graphql": "GraphQL", "dockerfile": "Dockerfile", "makefile": "Makefile", "cmake": "CMake",
+}
+
+// manifestNames are dependency manifests and lock files. They get a code fence language
+// but are not source code of that language, so LanguageName leaves them out.
+var manifestNames = map[string]bool{
+	"go.mod": true, "go.sum": true, "go.work": true, "go.work.sum": true,
+	"package-lock.json": true, "npm-shrinkwrap.json": true, "yarn.lock": true, "pnpm-lock.yaml": true,
+	"cargo.lock": true, "poetry.lock": true, "pipfile.lock": true, "uv.lock": true,
+	"gemfile.lock": true, "composer.lock": true, "mix.lock": true,
+}
+
+// LanguageName returns the display name of a file's language, e.g. "TypeScript" for
+// "app.tsx", or "" when it is unknown or the file is a dependency manifest or lock file
+// such as go.mod or package-lock.json.
+func LanguageName(relPath string) string {
+	if manifestNames[strings.ToLower(path.Base(relPath))] {
+		return ""
+	}
+	return languageNames[Language(relPath)]
+}
@@ -0,0 +1,160 @@
+// File: pkg/markdown/markdown.go
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// ToHTML converts a pragmatic subset of Markdown into an HTML fragment.
+//
+// Supported block elements are ATX headings, fenced code blocks, unordered and
+// ordered lists, block quotes, horizontal rules and paragraphs. Inline code,
+// bold, italic and links are supported inside text. Everything else is escaped
+// and kept as plain text, which is what report templates mostly produce anyway.
+func ToHTML(src string) string {
+	var out strings.Builder
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var paragraph []string
+	listTag := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if fence := fenceMarker(trimmed); fence != "" {
+			flushParagraph()
+			closeList()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, fence))
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(lang))
+			}
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			out.WriteString(fmt.Sprintf("<h%d>%s</h%d>\n", level, renderInline(m[2]), level))
+		case rulePattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+		case unorderedPattern.MatchString(trimmed):
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + renderInline(unorderedPattern.FindStringSubmatch(trimmed)[1]) + "</li>\n")
+		case orderedPattern.MatchString(trimmed):
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + renderInline(orderedPattern.FindStringSubmatch(trimmed)[1]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			out.WriteString("<blockquote>" + renderInline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, line)
+		}
+	}
+	flushParagraph()
+	closeList()
+	return out.String()
+}
+
+// Document wraps an HTML fragment into a minimal standalone HTML page.
+func Document(title, body string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>` + html.EscapeString(title) + `</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+code { font-family: ui-monospace, Menlo, Consolas, monospace; }
+p { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+` + body + `</body>
+</html>
+`
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	rulePattern      = regexp.MustCompile(`^(-{3,}|\*{3,}|_{3,}|={3,})$`)
+	unorderedPattern = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	orderedPattern   = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+
+	inlineCodePattern = regexp.MustCompile("`([^`]+)`")
+	boldPattern       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicPattern     = regexp.MustCompile(`\*([^*]+)\*`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+func fenceMarker(line string) string {
+	for _, fence := range []string{"```", "~~~"} {
+		if strings.HasPrefix(line, fence) {
+			return fence
+		}
+	}
+	return ""
+}
+
+// renderInline escapes text and applies inline formatting. Code spans are
+// replaced by placeholders first so their content is not formatted further.
+func renderInline(text string) string {
+	var spans []string
+	text = inlineCodePattern.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	text = html.EscapeString(text)
+	text = linkPattern.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italicPattern.ReplaceAllString(text, "<em>$1</em>")
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return text
+}
@@ -0,0 +1,76 @@
+// File: pkg/notebook/notebook.go
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Extension is the file extension of Jupyter notebooks, without the leading dot.
+const Extension = "ipynb"
+
+type document struct {
+	Cells    []cell `json:"cells"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+type cell struct {
+	CellType string `json:"cell_type"`
+	Source   source `json:"source"`
+}
+
+// source is a cell source, stored by Jupyter either as one string or as a list of lines.
+type source string
+
+func (s *source) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = source(str)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	*s = source(strings.Join(lines, ""))
+	return nil
+}
+
+// ToText converts a notebook to plain Markdown: markdown and raw cells are kept as they are,
+// code cells are emitted as fenced blocks in the notebook language. Cell outputs (including
+// embedded base64 images) and metadata are dropped.
+func ToText(data []byte) (string, error) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("invalid notebook: %w", err)
+	}
+	language := doc.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = doc.Metadata.Kernelspec.Language
+	}
+
+	var sb strings.Builder
+	for _, c := range doc.Cells {
+		text := strings.TrimRight(string(c.Source), "\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		if c.CellType == "code" {
+			fmt.Fprintf(&sb, "```%s\n%s\n```\n", language, text)
+		} else {
+			sb.WriteString(text + "\n")
+		}
+	}
+	return sb.String(), nil
+}
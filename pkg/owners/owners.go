@@ -0,0 +1,201 @@
+// File: pkg/owners/owners.go
+package owners
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// CodeOwnersLocations are the places GitHub looks for a CODEOWNERS file, in order.
+var CodeOwnersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type codeOwnersRule struct {
+	matcher *gitignore.GitIgnore
+	owners  []string
+}
+
+// CodeOwners evaluates the rules of a CODEOWNERS file.
+type CodeOwners struct {
+	// Path is the '/'-separated location of the file inside the project; empty if there is none.
+	Path  string
+	rules []codeOwnersRule
+}
+
+// LoadCodeOwners reads the first CODEOWNERS file found in CodeOwnersLocations. A project
+// without one yields an empty set of rules.
+func LoadCodeOwners(projectPath string) (*CodeOwners, error) {
+	for _, location := range CodeOwnersLocations {
+		data, err := os.ReadFile(filepath.Join(projectPath, filepath.FromSlash(location)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		co := &CodeOwners{Path: location}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			line := sc.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			// CODEOWNERS patterns follow the .gitignore matching rules.
+			co.rules = append(co.rules, codeOwnersRule{
+				matcher: gitignore.CompileIgnoreLines(fields[0]),
+				owners:  fields[1:],
+			})
+		}
+		return co, sc.Err()
+	}
+	return &CodeOwners{}, nil
+}
+
+// Owners returns the owners of a '/'-separated relative path. The last matching rule wins;
+// a matching rule without owners makes the path unowned.
+func (co *CodeOwners) Owners(relPath string) []string {
+	for i := len(co.rules) - 1; i >= 0; i-- {
+		if co.rules[i].matcher.MatchesPath(relPath) {
+			return co.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// Authorship maps a relative file path to the hashes of the commits touching it, per author
+// ("Name <email>"). Keeping the hashes lets Build count a commit touching several files of a
+// directory once.
+type Authorship map[string]map[string][]string
+
+// GitAuthorship collects the non-merge commits touching each file below projectPath. since is
+// passed to 'git log --since' when not empty. Paths are relative to projectPath, which may
+// be a subdirectory of the repository.
+func GitAuthorship(projectPath, since string) (Authorship, error) {
+	args := []string{"-C", projectPath, "log", "--no-merges", "--relative", "--name-only", "--format=%x00%H %an <%ae>"}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	authorship := make(Authorship)
+	var hash, author string
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			hash, author, _ = strings.Cut(line[1:], " ")
+		case line != "" && author != "":
+			if authorship[line] == nil {
+				authorship[line] = make(map[string][]string)
+			}
+			authorship[line][author] = append(authorship[line][author], hash)
+		}
+	}
+	return authorship, nil
+}
+
+// AuthorCount is the number of distinct commits of an author.
+type AuthorCount struct {
+	Author  string `json:"author"`
+	Commits int    `json:"commits"`
+}
+
+// Entry describes the owners of a file or directory.
+type Entry struct {
+	Path       string        `json:"path"`
+	CodeOwners []string      `json:"codeowners"`
+	Authors    []AuthorCount `json:"authors"`
+	// LikelyOwners are the CODEOWNERS owners if there are any, else the top authors.
+	LikelyOwners []string `json:"likelyOwners"`
+}
+
+// Granularities accepted by Build.
+const (
+	ByFile      = "file"
+	ByDirectory = "directory"
+)
+
+// Build reports the owners of files, or of their directories, listing at most top authors
+// per entry. Directory entries count the distinct commits touching their direct files, so a
+// commit changing several of them counts once, and take the CODEOWNERS owners of the
+// directory itself.
+func Build(files []string, co *CodeOwners, authorship Authorship, by string, top int) []Entry {
+	groups := make(map[string][]string)
+	for _, f := range files {
+		key := f
+		if by == ByDirectory {
+			key = path.Dir(f)
+		}
+		groups[key] = append(groups[key], f)
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		commits := make(map[string]map[string]bool)
+		for _, f := range groups[key] {
+			for author, hashes := range authorship[f] {
+				if commits[author] == nil {
+					commits[author] = make(map[string]bool)
+				}
+				for _, h := range hashes {
+					commits[author][h] = true
+				}
+			}
+		}
+		authors := make([]AuthorCount, 0, len(commits))
+		for author, hashes := range commits {
+			authors = append(authors, AuthorCount{Author: author, Commits: len(hashes)})
+		}
+		sort.Slice(authors, func(i, j int) bool {
+			if authors[i].Commits != authors[j].Commits {
+				return authors[i].Commits > authors[j].Commits
+			}
+			return authors[i].Author < authors[j].Author
+		})
+		if top >= 0 && len(authors) > top {
+			authors = authors[:top]
+		}
+
+		ownerPath := key
+		if by == ByDirectory {
+			ownerPath = key + "/"
+			if key == "." {
+				ownerPath = "/"
+			}
+		}
+		entry := Entry{Path: key, CodeOwners: co.Owners(ownerPath), Authors: authors}
+		if entry.CodeOwners == nil {
+			entry.CodeOwners = []string{}
+		}
+		entry.LikelyOwners = entry.CodeOwners
+		if len(entry.LikelyOwners) == 0 {
+			entry.LikelyOwners = make([]string, 0, len(authors))
+			for _, a := range authors {
+				entry.LikelyOwners = append(entry.LikelyOwners, a.Author)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,143 @@
+// File: pkg/packages/packages.go
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"code-prompt-core/pkg/depgraph"
+)
+
+// Kinds of packages, named after their ecosystem.
+const (
+	KindGo     = "go"
+	KindNPM    = "npm"
+	KindPython = "python"
+	KindCargo  = "cargo"
+)
+
+// manifestKinds map the manifest file names to the kind of package they declare.
+var manifestKinds = map[string]string{
+	"go.mod":         KindGo,
+	"package.json":   KindNPM,
+	"pyproject.toml": KindPython,
+	"Cargo.toml":     KindCargo,
+}
+
+// Package is a subproject of a (mono)repository, declared by a manifest file.
+type Package struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Root is the '/'-separated directory of the manifest, relative to the project ("." for its root).
+	Root     string `json:"root"`
+	Manifest string `json:"manifest"`
+}
+
+// Find returns the packages declared by the manifests among files, the relative paths of a
+// project's files, ordered by root then kind. read returns the content of a file. A package
+// is named by its manifest (module path, "name" field); manifests without a name, or that
+// fail to read, name it after its directory.
+func Find(files []string, read func(relPath string) ([]byte, error)) []Package {
+	found := []Package{}
+	for _, relPath := range files {
+		kind, ok := manifestKinds[path.Base(relPath)]
+		if !ok {
+			continue
+		}
+		p := Package{Kind: kind, Root: path.Dir(relPath), Manifest: relPath}
+		if data, err := read(relPath); err == nil {
+			p.Name = manifestName(kind, data)
+		}
+		if p.Name == "" {
+			p.Name = path.Base(p.Root)
+		}
+		found = append(found, p)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Root != found[j].Root {
+			return found[i].Root < found[j].Root
+		}
+		return found[i].Kind < found[j].Kind
+	})
+	return found
+}
+
+// Lookup returns the package named name, or whose root is name. Packages of different
+// ecosystems sharing a root count as one.
+func Lookup(pkgs []Package, name string) (Package, error) {
+	var matches []Package
+	roots := map[string]bool{}
+	for _, p := range pkgs {
+		if (p.Name == name || p.Root == strings.TrimSuffix(name, "/")) && !roots[p.Root] {
+			roots[p.Root] = true
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		names := make([]string, 0, len(pkgs))
+		for _, p := range pkgs {
+			names = append(names, p.Name)
+		}
+		return Package{}, fmt.Errorf("package '%s' not found (known packages: %s)", name, strings.Join(names, ", "))
+	case 1:
+		return matches[0], nil
+	}
+	matchRoots := make([]string, 0, len(matches))
+	for _, p := range matches {
+		matchRoots = append(matchRoots, p.Root)
+	}
+	return Package{}, fmt.Errorf("package name '%s' is ambiguous (roots %s); pass the root instead", name, strings.Join(matchRoots, ", "))
+}
+
+// manifestName reads the package name of a manifest, or "" if it has none.
+func manifestName(kind string, data []byte) string {
+	switch kind {
+	case KindGo:
+		return depgraph.GoModulePath(data)
+	case KindNPM:
+		var pkg struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(data, &pkg)
+		return pkg.Name
+	case KindPython:
+		return tomlName(data, "project", "tool.poetry")
+	case KindCargo:
+		return tomlName(data, "package")
+	}
+	return ""
+}
+
+// tomlName returns the name = "..." key of the first of the given TOML tables that has one.
+// It reads just enough TOML for manifests: table headers and one-line string values.
+func tomlName(data []byte, tables ...string) string {
+	names := map[string]string{}
+	var table string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			table = strings.Trim(line, "[] ")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "name" {
+			continue
+		}
+		if _, seen := names[table]; !seen {
+			names[table] = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	for _, t := range tables {
+		if name := names[t]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+// File: pkg/plugins/plugins.go
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ScanPlugin is an external executable declared under 'plugins.scan' in the config file.
+// It runs after every cache update on the files that were added or changed.
+type ScanPlugin struct {
+	// Name namespaces the attributes of the plugin; it defaults to the command.
+	Name    string `mapstructure:"name"`
+	Command string `mapstructure:"command"`
+	// Extensions limits the plugin to files with these extensions (without the dot); empty means all files.
+	Extensions []string `mapstructure:"extensions"`
+	// Timeout bounds one run of the plugin over all files; zero means no limit.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Accepts reports whether the plugin wants files with the extension ext.
+func (p ScanPlugin) Accepts(ext string) bool {
+	if len(p.Extensions) == 0 {
+		return true
+	}
+	for _, e := range p.Extensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// File is the metadata of one file, written to the plugin's stdin as one JSON line.
+type File struct {
+	Path         string `json:"path"`
+	RelativePath string `json:"relative_path"`
+	Extension    string `json:"extension"`
+	SizeBytes    int64  `json:"size_bytes"`
+	LineCount    int    `json:"line_count"`
+	IsText       bool   `json:"is_text"`
+	IsGenerated  bool   `json:"is_generated"`
+	IsMinified   bool   `json:"is_minified"`
+	ContentHash  string `json:"content_hash"`
+}
+
+// result is one line of the plugin's stdout.
+type result struct {
+	RelativePath string                     `json:"relative_path"`
+	Attributes   map[string]json.RawMessage `json:"attributes"`
+}
+
+// maxLineBytes bounds one line of plugin output.
+const maxLineBytes = 4 << 20
+
+// Run starts c, writes files to its stdin as NDJSON and closes it, and collects the lines of
+// its stdout. Each output line is {"relative_path": "...", "attributes": {"key": "value"}};
+// lines may come in any order and files without attributes may be left out. Non-string
+// values are stored as their JSON text. The result maps relative paths to attributes.
+func Run(c *exec.Cmd, files []File) (map[string]map[string]string, error) {
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	for _, f := range files {
+		if err := encoder.Encode(f); err != nil {
+			return nil, err
+		}
+	}
+	c.Stdin = &input
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	attributes := make(map[string]map[string]string)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	var parseErr error
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 || parseErr != nil {
+			continue
+		}
+		var r result
+		if err := json.Unmarshal(text, &r); err != nil {
+			parseErr = fmt.Errorf("invalid output on line %d: %w", line, err)
+			continue
+		}
+		if r.RelativePath == "" {
+			parseErr = fmt.Errorf("invalid output on line %d: missing relative_path", line)
+			continue
+		}
+		if attributes[r.RelativePath] == nil {
+			attributes[r.RelativePath] = make(map[string]string, len(r.Attributes))
+		}
+		for k, v := range r.Attributes {
+			var s string
+			if json.Unmarshal(v, &s) != nil {
+				s = string(v)
+			}
+			attributes[r.RelativePath][k] = s
+		}
+	}
+	readErr := scanner.Err()
+	if readErr != nil {
+		// Keep the plugin from blocking on a full pipe so that Wait returns.
+		io.Copy(io.Discard, stdout)
+	}
+	if err := c.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("error reading output: %w", readErr)
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return attributes, nil
+}
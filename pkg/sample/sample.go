@@ -0,0 +1,210 @@
+// File: pkg/sample/sample.go
+package sample
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"code-prompt-core/pkg/tokens"
+)
+
+// Strategies supported by Sample.
+const (
+	// StrategyHead keeps the beginning of every file.
+	StrategyHead = "head"
+	// StrategyStratified splits the budget evenly between directories and takes evenly
+	// spaced chunks from every file.
+	StrategyStratified = "stratified"
+)
+
+// MinExcerptTokens is the smallest excerpt worth returning. When the budget cannot give
+// every file this much, only a representative subset of the files is sampled.
+const MinExcerptTokens = 32
+
+// chunksPerFile is the number of evenly spaced chunks the stratified strategy takes from a file.
+const chunksPerFile = 3
+
+// ChunkSeparator is placed between the chunks of a stratified excerpt.
+const ChunkSeparator = "\n...\n"
+
+// File is a file offered to Sample.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Excerpt is the part of a file kept by Sample.
+type Excerpt struct {
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Tokens      int64  `json:"tokens"`
+	TotalTokens int64  `json:"totalTokens"`
+	Truncated   bool   `json:"truncated"`
+}
+
+// Result is the outcome of Sample. Omitted lists the files left out entirely.
+type Result struct {
+	Excerpts []Excerpt `json:"files"`
+	Omitted  []string  `json:"omitted"`
+}
+
+// Sample reduces files to excerpts that fit into maxTokens. If all files fit, they are
+// returned whole. Files are returned in path order.
+func Sample(files []File, strategy string, maxTokens int64) (Result, error) {
+	if strategy != StrategyHead && strategy != StrategyStratified {
+		return Result{}, fmt.Errorf("unknown sampling strategy '%s' (expected %s or %s)", strategy, StrategyHead, StrategyStratified)
+	}
+	if maxTokens <= 0 {
+		return Result{}, fmt.Errorf("the token budget must be positive")
+	}
+	sorted := append([]File(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	var total int64
+	for _, f := range sorted {
+		total += tokens.Estimate(f.Content)
+	}
+	budgets := make(map[string]int64, len(sorted))
+	if total <= maxTokens {
+		for _, f := range sorted {
+			budgets[f.Path] = tokens.Estimate(f.Content)
+		}
+	} else if strategy == StrategyHead {
+		allocate(selectFiles(sorted, maxTokens), maxTokens, budgets)
+	} else {
+		allocateByDirectory(sorted, maxTokens, budgets)
+	}
+
+	result := Result{Excerpts: []Excerpt{}, Omitted: []string{}}
+	for _, f := range sorted {
+		budget, ok := budgets[f.Path]
+		if !ok || budget <= 0 {
+			result.Omitted = append(result.Omitted, f.Path)
+			continue
+		}
+		fileTokens := tokens.Estimate(f.Content)
+		excerpt := Excerpt{Path: f.Path, Content: f.Content, TotalTokens: fileTokens}
+		if budget < fileTokens {
+			if strategy == StrategyHead {
+				excerpt.Content = head(f.Content, budget*tokens.BytesPerToken)
+			} else {
+				excerpt.Content = chunks(f.Content, budget*tokens.BytesPerToken)
+			}
+			excerpt.Truncated = true
+		}
+		excerpt.Tokens = tokens.Estimate(excerpt.Content)
+		result.Excerpts = append(result.Excerpts, excerpt)
+	}
+	return result, nil
+}
+
+// selectFiles returns the first files of the list if the budget cannot give every file
+// MinExcerptTokens; the selection is spread evenly over the list.
+func selectFiles(files []File, budget int64) []File {
+	limit := int(budget / MinExcerptTokens)
+	if limit < 1 {
+		limit = 1
+	}
+	if len(files) <= limit {
+		return files
+	}
+	selected := make([]File, 0, limit)
+	for i := 0; i < limit; i++ {
+		selected = append(selected, files[i*len(files)/limit])
+	}
+	return selected
+}
+
+// allocate distributes budget over files so that small files are kept whole and the
+// remainder is shared equally by the larger ones.
+func allocate(files []File, budget int64, budgets map[string]int64) int64 {
+	bySize := append([]File(nil), files...)
+	sort.SliceStable(bySize, func(i, j int) bool { return len(bySize[i].Content) < len(bySize[j].Content) })
+	var used int64
+	for i, f := range bySize {
+		share := (budget - used) / int64(len(bySize)-i)
+		need := tokens.Estimate(f.Content)
+		if need < share {
+			share = need
+		}
+		budgets[f.Path] = share
+		used += share
+	}
+	return used
+}
+
+// allocateByDirectory shares the budget equally between directories (small directories
+// leave their unused share to the others) and then between the files of each directory.
+func allocateByDirectory(files []File, budget int64, budgets map[string]int64) {
+	byDir := make(map[string][]File)
+	var dirs []string
+	for _, f := range files {
+		dir := path.Dir(f.Path)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], f)
+	}
+	dirTokens := func(dir string) int64 {
+		var n int64
+		for _, f := range byDir[dir] {
+			n += tokens.Estimate(f.Content)
+		}
+		return n
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return dirTokens(dirs[i]) < dirTokens(dirs[j]) })
+
+	// With too many directories for the budget, sample evenly spaced directories.
+	if limit := int(budget / MinExcerptTokens); limit >= 1 && len(dirs) > limit {
+		sort.Strings(dirs)
+		picked := make([]string, 0, limit)
+		for i := 0; i < limit; i++ {
+			picked = append(picked, dirs[i*len(dirs)/limit])
+		}
+		dirs = picked
+	}
+
+	var used int64
+	for i, dir := range dirs {
+		share := (budget - used) / int64(len(dirs)-i)
+		used += allocate(selectFiles(byDir[dir], share), share, budgets)
+	}
+}
+
+// head returns the beginning of content up to maxBytes, cut at the last complete line
+// when there is one.
+func head(content string, maxBytes int64) string {
+	if int64(len(content)) <= maxBytes {
+		return content
+	}
+	cut := content[:maxBytes]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i+1]
+	}
+	return strings.ToValidUTF8(cut, "")
+}
+
+// chunks returns evenly spaced chunks of content (start, middle, end, ...) that together
+// stay within maxBytes, joined by ChunkSeparator.
+func chunks(content string, maxBytes int64) string {
+	n := int64(chunksPerFile)
+	chunkBytes := (maxBytes - (n-1)*int64(len(ChunkSeparator))) / n
+	if chunkBytes < MinExcerptTokens*tokens.BytesPerToken {
+		return head(content, maxBytes)
+	}
+	size := int64(len(content))
+	parts := make([]string, 0, n)
+	for i := int64(0); i < n; i++ {
+		start := (size - chunkBytes) * i / (n - 1)
+		// Align the chunk to the start of a line.
+		if start > 0 {
+			if j := strings.IndexByte(content[start:], '\n'); j >= 0 && int64(j) < chunkBytes/2 {
+				start += int64(j) + 1
+			}
+		}
+		parts = append(parts, head(content[start:], chunkBytes))
+	}
+	return strings.Join(parts, ChunkSeparator)
+}
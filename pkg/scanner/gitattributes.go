@@ -0,0 +1,119 @@
+// File: pkg/scanner/gitattributes.go
+package scanner
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// generatedAttributes are the .gitattributes attributes that mark a file as
+// generated or vendored for GitHub linguist.
+var generatedAttributes = []string{"linguist-generated", "linguist-vendored"}
+
+type attributeRule struct {
+	matcher *gitignore.GitIgnore
+	// values maps an attribute to whether it is set (true) or unset (false) by this rule.
+	values map[string]bool
+}
+
+// GitAttributes evaluates the linguist attributes of a .gitattributes file.
+type GitAttributes struct {
+	rules []attributeRule
+}
+
+// LoadGitAttributes parses a .gitattributes file. A missing file yields an empty set of rules.
+func LoadGitAttributes(path string) (*GitAttributes, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &GitAttributes{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseGitAttributes(file)
+}
+
+// loadGitAttributesFS is LoadGitAttributes for a file of a file system.
+func loadGitAttributesFS(fsys fs.FS, name string) (*GitAttributes, error) {
+	file, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &GitAttributes{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseGitAttributes(file)
+}
+
+func parseGitAttributes(r io.Reader) (*GitAttributes, error) {
+	ga := &GitAttributes{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		values := make(map[string]bool)
+		for _, attr := range fields[1:] {
+			name, set := parseAttribute(attr)
+			for _, wanted := range generatedAttributes {
+				if name == wanted {
+					values[name] = set
+				}
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		// .gitattributes patterns follow the same matching rules as .gitignore patterns.
+		ga.rules = append(ga.rules, attributeRule{
+			matcher: gitignore.CompileIgnoreLines(fields[0]),
+			values:  values,
+		})
+	}
+	return ga, sc.Err()
+}
+
+// parseAttribute interprets "attr", "attr=true", "-attr", "!attr" and "attr=false".
+func parseAttribute(attr string) (name string, set bool) {
+	switch {
+	case strings.HasPrefix(attr, "-"), strings.HasPrefix(attr, "!"):
+		return attr[1:], false
+	case strings.Contains(attr, "="):
+		parts := strings.SplitN(attr, "=", 2)
+		return parts[0], parts[1] != "false"
+	default:
+		return attr, true
+	}
+}
+
+// IsGenerated reports whether a '/'-separated relative path is marked as
+// linguist-generated or linguist-vendored. Later lines override earlier ones.
+func (ga *GitAttributes) IsGenerated(relPath string) bool {
+	if ga == nil {
+		return false
+	}
+	state := make(map[string]bool)
+	for _, rule := range ga.rules {
+		if !rule.matcher.MatchesPath(relPath) {
+			continue
+		}
+		for name, set := range rule.values {
+			state[name] = set
+		}
+	}
+	for _, set := range state {
+		if set {
+			return true
+		}
+	}
+	return false
+}
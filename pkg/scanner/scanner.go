@@ -3,19 +3,28 @@ package scanner
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	"code-prompt-core/pkg/docextract"
+
 	gitignore "github.com/sabhiram/go-gitignore"
 	"github.com/sourcegraph/conc/pool"
+	"github.com/zeebo/xxh3"
 )
 
 type FileMetadata struct {
@@ -27,12 +36,76 @@ type FileMetadata struct {
 	IsText       bool
 	LastModTime  time.Time
 	ContentHash  string
+	// IsGenerated is set for files marked linguist-generated or linguist-vendored in .gitattributes.
+	IsGenerated bool
+	// IsMinified is set by a content heuristic for minified files and files carrying a
+	// generated-code header ("DO NOT EDIT", "@generated").
+	IsMinified bool
+	// Mode holds the permission bits of the file.
+	Mode fs.FileMode
+	// IsExecutable is set for files with an execute bit for the owner, group or others.
+	IsExecutable bool
+	// IsTest is set for files following a test naming convention (see IsTestFile).
+	IsTest bool
+	// Unchanged is set for files that ScanOptions.Unchanged reported as unchanged. Only
+	// RelativePath, Filename, SizeBytes, LastModTime, IsGenerated, Mode, IsExecutable and
+	// IsTest are filled in.
+	Unchanged bool
 }
 
 type ScanOptions struct {
 	NoGitIgnores     bool
 	IncludeBinary    bool
 	NoPresetExcludes bool
+	// NoGitAttributes disables reading linguist markers from .gitattributes.
+	NoGitAttributes bool
+	// Roots restricts the scan to these subdirectories (relative, '/'-separated).
+	// An empty list scans the whole project. Relative paths are always computed
+	// against the project path, so cached paths do not depend on the roots.
+	Roots []string
+	// SkipDirsOverFiles skips directories with more than this many direct entries
+	// (files and subdirectories). Zero disables the check.
+	SkipDirsOverFiles int
+	// Hash is the algorithm of ContentHash, one of HashAlgorithms. Empty means HashSHA256.
+	Hash string
+	// Unchanged, if set, is called with the size, modification time and permission bits of
+	// every file before it is read. Files for which it returns true are not read, hashed or counted.
+	Unchanged func(relPath string, sizeBytes int64, modTime time.Time, mode fs.FileMode) bool
+}
+
+// Content hash algorithms. xxh3 is much faster than sha256 and good enough to detect
+// changes; with none, ContentHash is left empty.
+const (
+	HashSHA256 = "sha256"
+	HashXXH3   = "xxh3"
+	HashNone   = "none"
+)
+
+// HashAlgorithms are the valid values of ScanOptions.Hash.
+var HashAlgorithms = []string{HashSHA256, HashXXH3, HashNone}
+
+// newHash returns a hash of the algorithm, or nil for HashNone.
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "", HashSHA256:
+		return sha256.New(), nil
+	case HashXXH3:
+		return xxh3.New(), nil
+	case HashNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm '%s'", algorithm)
+}
+
+// SkippedDir is a directory left out of a scan by the volume heuristic.
+type SkippedDir struct {
+	Path       string `json:"path"`
+	EntryCount int    `json:"entry_count"`
+}
+
+// ScanReport describes what a scan deliberately left out.
+type ScanReport struct {
+	SkippedDirs []SkippedDir `json:"skipped_dirs"`
 }
 
 var presetExclusionPatterns = []string{
@@ -53,14 +126,26 @@ var presetExclusionPatterns = []string{
 	`\.vscode`,
 }
 
-func processFile(path, projectPath string, info os.FileInfo, options ScanOptions) (FileMetadata, error) {
+// processFile reads the file relPath of fsys. It returns an empty FileMetadata for files
+// that are left out of the scan.
+func processFile(fsys fs.FS, relPath string, info fs.FileInfo, options ScanOptions) (FileMetadata, error) {
 	var meta FileMetadata
 
-	file, err := os.Open(path)
+	file, err := fsys.Open(relPath)
 	if err != nil {
 		return meta, err
 	}
-	defer file.Close()
+	defer func() { file.Close() }()
+	// rewind starts reading the file again, reopening it if it cannot seek.
+	rewind := func() error {
+		if seeker, ok := file.(io.Seeker); ok {
+			_, err := seeker.Seek(0, io.SeekStart)
+			return err
+		}
+		file.Close()
+		file, err = fsys.Open(relPath)
+		return err
+	}
 
 	buffer := make([]byte, 512)
 	n, _ := file.Read(buffer)
@@ -72,36 +157,48 @@ func processFile(path, projectPath string, info os.FileInfo, options ScanOptions
 		}
 	}
 
-	if !isText && !options.IncludeBinary {
+	// Documents are kept so that their text can be extracted on demand (content get --extract-docs).
+	if !isText && !options.IncludeBinary && !docextract.IsDocument(filepath.Ext(info.Name())) {
 		return FileMetadata{}, nil
 	}
 
-	_, err = file.Seek(0, 0)
-	if err != nil {
+	if err := rewind(); err != nil {
 		return meta, err
 	}
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	var contentHash string
+	h, err := newHash(options.Hash)
+	if err != nil {
 		return meta, err
 	}
-	contentHash := hex.EncodeToString(hash.Sum(nil))
+	if h != nil {
+		if _, err := io.Copy(h, file); err != nil {
+			return meta, err
+		}
+		contentHash = hex.EncodeToString(h.Sum(nil))
+	}
 
 	lineCount := 0
+	isMinified := false
 	if isText {
-		_, err = file.Seek(0, 0)
-		if err != nil {
+		if err := rewind(); err != nil {
 			return meta, err
 		}
 		scanner := bufio.NewScanner(file)
 		for scanner.Scan() {
 			lineCount++
+			if lineCount <= generatedHeaderLines && hasGeneratedMarker(scanner.Bytes()) {
+				isMinified = true
+			}
+		}
+		// A line longer than the scanner buffer only occurs in minified or data files.
+		if scanner.Err() == bufio.ErrTooLong {
+			isMinified = true
+		}
+		if lineCount > 0 && info.Size() >= minifiedMinSize && info.Size()/int64(lineCount) > minifiedAvgLineLength {
+			isMinified = true
 		}
 	}
 
-	relPath, _ := filepath.Rel(projectPath, path)
-	// *** 核心修改点：统一路径分隔符为 '/' ***
-	relPath = filepath.ToSlash(relPath)
-
 	ext := filepath.Ext(info.Name())
 	if ext != "" {
 		ext = ext[1:]
@@ -116,14 +213,98 @@ func processFile(path, projectPath string, info os.FileInfo, options ScanOptions
 		IsText:       isText,
 		LastModTime:  info.ModTime().UTC(),
 		ContentHash:  contentHash,
+		IsMinified:   isMinified,
 	}
 	return meta, nil
 }
 
+const (
+	// generatedHeaderLines is how many leading lines are searched for a generated-code marker.
+	generatedHeaderLines = 10
+	// Files of at least minifiedMinSize bytes whose average line is longer than
+	// minifiedAvgLineLength bytes are considered minified.
+	minifiedMinSize       = 1024
+	minifiedAvgLineLength = 300
+)
+
+var generatedMarkers = [][]byte{[]byte("DO NOT EDIT"), []byte("@generated")}
+
+func hasGeneratedMarker(line []byte) bool {
+	for _, marker := range generatedMarkers {
+		if bytes.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
 func ScanProject(projectPath string, options ScanOptions) ([]FileMetadata, error) {
+	files, _, err := ScanProjectWithReport(projectPath, options)
+	return files, err
+}
+
+// ScanProjectWithReport scans a project like ScanProject and additionally reports
+// the directories skipped by the volume heuristic.
+func ScanProjectWithReport(projectPath string, options ScanOptions) ([]FileMetadata, ScanReport, error) {
+	return ScanFS(os.DirFS(projectPath), options)
+}
+
+// ScanFS scans a file system like ScanProjectWithReport scans a project directory, with
+// the root of fsys as the project root. It scans in-memory (testing/fstest.MapFS),
+// embedded or other virtual file systems the same way as directories on disk.
+func ScanFS(fsys fs.FS, options ScanOptions) ([]FileMetadata, ScanReport, error) {
+	out := make(chan FileMetadata, streamBufferSize)
+	var files []FileMetadata
+	done := make(chan struct{})
+	go func() {
+		for meta := range out {
+			files = append(files, meta)
+		}
+		close(done)
+	}()
+	report, err := ScanFSStream(context.Background(), fsys, options, out)
+	<-done
+	if err != nil {
+		return nil, report, err
+	}
+	if files == nil {
+		files = []FileMetadata{}
+	}
+	return files, report, nil
+}
+
+// streamBufferSize is the channel buffer ScanProjectWithReport uses; consumers of
+// ScanProjectStream can use it as a reasonable default too.
+const streamBufferSize = 256
+
+// ScanProjectStream scans a project and sends each file to out as soon as it has been
+// processed, so a consumer can write results while the walk is still running instead of
+// holding the whole project in memory. out is closed when the scan ends. Cancelling ctx
+// stops the scan; the consumer must keep receiving until out is closed.
+func ScanProjectStream(ctx context.Context, projectPath string, options ScanOptions, out chan<- FileMetadata) (ScanReport, error) {
+	return ScanFSStream(ctx, os.DirFS(projectPath), options, out)
+}
+
+// ScanFSStream is ScanProjectStream for a file system; see ScanFS.
+func ScanFSStream(ctx context.Context, fsys fs.FS, options ScanOptions, out chan<- FileMetadata) (ScanReport, error) {
+	defer close(out)
+	report := ScanReport{SkippedDirs: []SkippedDir{}}
+	if _, err := newHash(options.Hash); err != nil {
+		return report, err
+	}
 	var ignoreMatcher *gitignore.GitIgnore
 	if !options.NoGitIgnores {
-		ignoreMatcher, _ = gitignore.CompileIgnoreFile(filepath.Join(projectPath, ".gitignore"))
+		if data, err := fs.ReadFile(fsys, ".gitignore"); err == nil {
+			ignoreMatcher = gitignore.CompileIgnoreLines(strings.Split(string(data), "\n")...)
+		}
+	}
+
+	var attributes *GitAttributes
+	if !options.NoGitAttributes {
+		var err error
+		if attributes, err = loadGitAttributesFS(fsys, ".gitattributes"); err != nil {
+			return report, fmt.Errorf("error reading .gitattributes: %w", err)
+		}
 	}
 
 	var compiledPresetExcludes []*regexp.Regexp
@@ -131,28 +312,35 @@ func ScanProject(projectPath string, options ScanOptions) ([]FileMetadata, error
 		for _, p := range presetExclusionPatterns {
 			re, err := regexp.Compile(p)
 			if err != nil {
-				return nil, fmt.Errorf("invalid preset exclusion pattern '%s': %w", p, err)
+				return report, fmt.Errorf("invalid preset exclusion pattern '%s': %w", p, err)
 			}
 			compiledPresetExcludes = append(compiledPresetExcludes, re)
 		}
 	}
 
-	resultPool := pool.NewWithResults[FileMetadata]().WithErrors().WithContext(context.Background())
-	pathPool := pool.New().WithMaxGoroutines(runtime.NumCPU())
+	// Overlapping roots (e.g. "src" and "src/api") would report a file twice.
+	var seenMu sync.Mutex
+	var seen map[string]struct{}
+	if len(options.Roots) > 1 {
+		seen = make(map[string]struct{})
+	}
+
+	// A failing file cancels the walk and the remaining workers.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workers := pool.New().WithErrors().WithFirstError().WithMaxGoroutines(runtime.NumCPU())
 
-	walkErr := filepath.WalkDir(projectPath, func(path string, d os.DirEntry, err error) error {
+	// Paths in fsys are relative to the project root and always use '/'.
+	walkFn := func(relPath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if path == projectPath {
-			return nil
-		}
-		relPath, err := filepath.Rel(projectPath, path)
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		// *** 同样在这里统一分隔符，用于匹配规则 ***
-		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
 
 		for _, re := range compiledPresetExcludes {
 			if re.MatchString(relPath) {
@@ -171,6 +359,12 @@ func ScanProject(projectPath string, options ScanOptions) ([]FileMetadata, error
 		}
 
 		if d.IsDir() {
+			if options.SkipDirsOverFiles > 0 {
+				if count, err := countDirEntries(fsys, relPath); err == nil && count > options.SkipDirsOverFiles {
+					report.SkippedDirs = append(report.SkippedDirs, SkippedDir{Path: relPath, EntryCount: count})
+					return filepath.SkipDir
+				}
+			}
 			return nil
 		}
 
@@ -178,33 +372,72 @@ func ScanProject(projectPath string, options ScanOptions) ([]FileMetadata, error
 			return nil
 		}
 
-		pathPool.Go(func() {
+		workers.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
 			info, err := d.Info()
 			if err != nil {
-				return
+				return nil
+			}
+			var meta FileMetadata
+			if options.Unchanged != nil && options.Unchanged(relPath, info.Size(), info.ModTime().UTC(), info.Mode().Perm()) {
+				meta = FileMetadata{RelativePath: relPath, Filename: info.Name(), SizeBytes: info.Size(), LastModTime: info.ModTime().UTC(), Unchanged: true}
+			} else {
+				meta, err = processFile(fsys, relPath, info, options)
+			}
+			if err != nil {
+				cancel()
+				return err
+			}
+			if meta.RelativePath == "" {
+				return nil
+			}
+			if seen != nil {
+				seenMu.Lock()
+				_, dup := seen[meta.RelativePath]
+				seen[meta.RelativePath] = struct{}{}
+				seenMu.Unlock()
+				if dup {
+					return nil
+				}
+			}
+			meta.IsGenerated = attributes.IsGenerated(meta.RelativePath)
+			meta.Mode = info.Mode().Perm()
+			meta.IsExecutable = meta.Mode&0o111 != 0
+			meta.IsTest = IsTestFile(meta.RelativePath)
+			select {
+			case out <- meta:
+				return nil
+			case <-ctx.Done():
+				return nil
 			}
-			resultPool.Go(func(_ context.Context) (FileMetadata, error) {
-				return processFile(path, projectPath, info, options)
-			})
 		})
 		return nil
-	})
-
-	pathPool.Wait()
-	results, processErr := resultPool.Wait()
+	}
 
-	if walkErr != nil {
-		return nil, walkErr
+	walkRoots := []string{"."}
+	if len(options.Roots) > 0 {
+		walkRoots = walkRoots[:0]
+		for _, root := range options.Roots {
+			walkRoots = append(walkRoots, path.Clean(root))
+		}
 	}
-	if processErr != nil {
-		return nil, processErr
+	var walkErr error
+	for _, root := range walkRoots {
+		if walkErr = fs.WalkDir(fsys, root, walkFn); walkErr != nil {
+			break
+		}
 	}
 
-	finalResults := make([]FileMetadata, 0, len(results))
-	for _, res := range results {
-		if res.RelativePath != "" {
-			finalResults = append(finalResults, res)
-		}
+	// A failed worker cancels the walk, so its error is the more useful one.
+	if processErr := workers.Wait(); processErr != nil {
+		return report, processErr
 	}
-	return finalResults, nil
+	return report, walkErr
+}
+
+func countDirEntries(fsys fs.FS, dir string) (int, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	return len(entries), err
 }
@@ -0,0 +1,209 @@
+package scanner
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// scan runs ScanFS and returns the scanned files by relative path.
+func scan(t *testing.T, fsys fstest.MapFS, options ScanOptions) (map[string]FileMetadata, ScanReport) {
+	t.Helper()
+	files, report, err := ScanFS(fsys, options)
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+	byPath := make(map[string]FileMetadata, len(files))
+	for _, f := range files {
+		if _, dup := byPath[f.RelativePath]; dup {
+			t.Errorf("%s reported twice", f.RelativePath)
+		}
+		byPath[f.RelativePath] = f
+	}
+	return byPath, report
+}
+
+func sortedPaths(files map[string]FileMetadata) string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, " ")
+}
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content), Mode: 0o644}
+}
+
+func TestScanFSExcludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":              file("*.log\nsecret/\n"),
+		"main.go":                 file("package main\n"),
+		"debug.log":               file("log\n"),
+		"secret/key.go":           file("package secret\n"),
+		"node_modules/lib/x.js":   file("x\n"),
+		"build/out.js":            file("out\n"),
+		"src/.venv/lib/site.py":   file("site\n"),
+		"src/builder/builder.go":  file("package builder\n"),
+		"src/vendored/helpers.go": file("package vendored\n"),
+	}
+	tests := []struct {
+		name    string
+		options ScanOptions
+		want    string
+	}{
+		// Preset patterns are unanchored regular expressions, so they also exclude
+		// ".gitignore", "src/builder" and "src/vendored".
+		{"defaults", ScanOptions{}, "main.go"},
+		{"no gitignores", ScanOptions{NoGitIgnores: true}, "debug.log main.go secret/key.go"},
+		{"no preset excludes", ScanOptions{NoPresetExcludes: true},
+			".gitignore build/out.js main.go node_modules/lib/x.js src/.venv/lib/site.py src/builder/builder.go src/vendored/helpers.go"},
+		{"neither", ScanOptions{NoGitIgnores: true, NoPresetExcludes: true},
+			".gitignore build/out.js debug.log main.go node_modules/lib/x.js secret/key.go src/.venv/lib/site.py src/builder/builder.go src/vendored/helpers.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _ := scan(t, fsys, tt.options)
+			if got := sortedPaths(files); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFSRoots(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/a.go":     file("package src\n"),
+		"src/api/b.go": file("package api\n"),
+		"docs/c.md":    file("# C\n"),
+		"README.md":    file("# Readme\n"),
+	}
+	tests := []struct {
+		name  string
+		roots []string
+		want  string
+	}{
+		{"whole project", nil, "README.md docs/c.md src/a.go src/api/b.go"},
+		{"one root", []string{"src/api"}, "src/api/b.go"},
+		{"unclean root", []string{"./docs/"}, "docs/c.md"},
+		{"overlapping roots", []string{"src", "src/api"}, "src/a.go src/api/b.go"},
+		{"same root twice", []string{"docs", "docs"}, "docs/c.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _ := scan(t, fsys, ScanOptions{Roots: tt.roots})
+			if got := sortedPaths(files); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFSSkipDirsOverFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"big/a.txt":       file("a\n"),
+		"big/b.txt":       file("b\n"),
+		"big/sub/c.txt":   file("c\n"),
+		"small/d.txt":     file("d\n"),
+		"small/sub/e.txt": file("e\n"),
+	}
+	files, report := scan(t, fsys, ScanOptions{SkipDirsOverFiles: 2})
+	if got, want := sortedPaths(files), "small/d.txt small/sub/e.txt"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if len(report.SkippedDirs) != 1 || report.SkippedDirs[0] != (SkippedDir{Path: "big", EntryCount: 3}) {
+		t.Errorf("unexpected skipped dirs %+v", report.SkippedDirs)
+	}
+
+	files, report = scan(t, fsys, ScanOptions{})
+	if len(files) != 5 || len(report.SkippedDirs) != 0 {
+		t.Errorf("without the limit got %d files and skipped %+v", len(files), report.SkippedDirs)
+	}
+}
+
+func TestScanFSBinary(t *testing.T) {
+	fsys := fstest.MapFS{
+		"text.txt":  file("one\ntwo\n"),
+		"image.bin": file("\x89PNG\x00\x00\x01"),
+		"paper.pdf": file("%PDF-1.4\x00binary"),
+	}
+	tests := []struct {
+		name    string
+		options ScanOptions
+		want    string
+	}{
+		// Documents are kept for text extraction even without IncludeBinary.
+		{"defaults", ScanOptions{}, "paper.pdf text.txt"},
+		{"include binary", ScanOptions{IncludeBinary: true}, "image.bin paper.pdf text.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _ := scan(t, fsys, tt.options)
+			if got := sortedPaths(files); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			for p, f := range files {
+				if f.IsText != (p == "text.txt") {
+					t.Errorf("%s: IsText = %v", p, f.IsText)
+				}
+			}
+			if text := files["text.txt"]; text.LineCount != 2 || text.Extension != "txt" || text.SizeBytes != 8 {
+				t.Errorf("unexpected text file %+v", text)
+			}
+			if pdf := files["paper.pdf"]; pdf.LineCount != 0 {
+				t.Errorf("binary file has %d lines", pdf.LineCount)
+			}
+		})
+	}
+}
+
+func TestScanFSMinified(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"plain", "package a\n\nfunc A() {}\n", false},
+		{"short long line", strings.Repeat("x", 900) + "\n", false},
+		{"long average line", strings.Repeat("var a=1;", 200) + "\n", true},
+		{"long lines below the size limit", strings.Repeat("x", 400) + "\n" + strings.Repeat("y", 400) + "\n", false},
+		{"line over the scanner buffer", strings.Repeat("x", 70*1024) + "\nshort\n" + strings.Repeat("short\n", 300), true},
+		{"DO NOT EDIT header", "// Code generated by stringer. DO NOT EDIT.\n\npackage a\n", true},
+		{"@generated header", "/**\n * @generated\n */\nexport {}\n", true},
+		{"marker after the header", strings.Repeat("\n", 10) + "// DO NOT EDIT\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _ := scan(t, fstest.MapFS{"f.js": file(tt.content)}, ScanOptions{})
+			if got := files["f.js"].IsMinified; got != tt.want {
+				t.Errorf("IsMinified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFSHash(t *testing.T) {
+	fsys := fstest.MapFS{"hello.txt": file("hello\n")}
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{"", "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{HashSHA256, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{HashXXH3, "99fc819aaba2462a"},
+		{HashNone, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			files, _ := scan(t, fsys, ScanOptions{Hash: tt.algorithm})
+			if got := files["hello.txt"].ContentHash; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, _, err := ScanFS(fsys, ScanOptions{Hash: "md5"}); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
@@ -0,0 +1,50 @@
+// File: pkg/scanner/testfiles.go
+package scanner
+
+import (
+	"path"
+	"strings"
+)
+
+// testDirs are directory names whose files are all tests, fixtures and helpers included.
+var testDirs = map[string]bool{"__tests__": true, "test": true, "tests": true, "spec": true}
+
+// testSuffixes are file name endings of the test naming conventions of common languages.
+var testSuffixes = []string{
+	"_test.go",
+	"_test.py",
+	"_test.rb", "_spec.rb",
+	"Test.java", "Tests.java", "Test.kt", "Tests.kt",
+	"Tests.cs", "Test.cs",
+	"_test.exs",
+}
+
+// jsTestExts are the extensions of JavaScript and TypeScript files named like "x.test.ts" or "x.spec.js".
+var jsTestExts = map[string]bool{".js": true, ".jsx": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true, ".mts": true, ".cts": true}
+
+// IsTestFile reports whether a relative path ('/'-separated) follows a test convention:
+// "*_test.go", "test_*.py", "*.spec.ts"/"*.test.js", "*Test.java", "*_spec.rb", and so on,
+// or lies in a "__tests__", "test", "tests" or "spec" directory. Only the path is
+// considered, so the result of a file never changes without it being renamed.
+func IsTestFile(relPath string) bool {
+	dir, name := path.Split(relPath)
+	for _, d := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+		if testDirs[d] {
+			return true
+		}
+	}
+	for _, suffix := range testSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	ext := path.Ext(name)
+	if ext == ".py" && (strings.HasPrefix(name, "test_") || name == "conftest.py") {
+		return true
+	}
+	if jsTestExts[ext] {
+		base := strings.TrimSuffix(name, ext)
+		return strings.HasSuffix(base, ".test") || strings.HasSuffix(base, ".spec")
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// File: pkg/service/service.go
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Definition describes a long-running command to be started by the operating system.
+type Definition struct {
+	// Name is the systemd unit / Windows service name; Label is the launchd label.
+	Name        string
+	Label       string
+	Description string
+	Executable  string
+	Args        []string
+	WorkingDir  string
+	// LogPath receives stdout and stderr under launchd; systemd uses the journal.
+	LogPath string
+}
+
+// Systemd renders a systemd service unit. With user set, it is meant for the user manager
+// ('systemctl --user') and starts with the user's session; otherwise with the system.
+func Systemd(d Definition, user bool) string {
+	words := []string{systemdQuote(d.Executable)}
+	for _, a := range d.Args {
+		words = append(words, systemdQuote(a))
+	}
+	wantedBy := "multi-user.target"
+	if user {
+		wantedBy = "default.target"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=%s\nAfter=network.target\n\n", d.Description)
+	fmt.Fprintf(&b, "[Service]\nType=simple\nExecStart=%s\n", strings.Join(words, " "))
+	if d.WorkingDir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(d.WorkingDir))
+	}
+	fmt.Fprintf(&b, "Restart=on-failure\nRestartSec=30\n\n[Install]\nWantedBy=%s\n", wantedBy)
+	return b.String()
+}
+
+// systemdQuote quotes a word of ExecStart=; "%" starts a specifier and must be doubled.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;$") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$")
+	return `"` + r.Replace(s) + `"`
+}
+
+// Launchd renders a launchd property list that keeps the command running.
+func Launchd(d Definition) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", xmlEscape(d.Label))
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range append([]string{d.Executable}, d.Args...) {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(a))
+	}
+	b.WriteString("\t</array>\n")
+	if d.WorkingDir != "" {
+		fmt.Fprintf(&b, "\t<key>WorkingDirectory</key>\n\t<string>%s</string>\n", xmlEscape(d.WorkingDir))
+	}
+	if d.LogPath != "" {
+		fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", xmlEscape(d.LogPath))
+		fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", xmlEscape(d.LogPath))
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n\t<key>KeepAlive</key>\n\t<true/>\n</dict>\n</plist>\n")
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WindowsCommandLine renders the command line of a Windows service (the binPath of
+// 'sc.exe create'), quoting arguments as the Windows C runtime parses them.
+func WindowsCommandLine(d Definition) string {
+	words := []string{windowsQuote(d.Executable)}
+	for _, a := range d.Args {
+		words = append(words, windowsQuote(a))
+	}
+	return strings.Join(words, " ")
+}
+
+func windowsQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for _, c := range s {
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// Backslashes before a quote are escaped, and so is the quote.
+			b.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		b.WriteRune(c)
+	}
+	// Backslashes before the closing quote are escaped too.
+	b.WriteString(strings.Repeat(`\`, 2*backslashes))
+	b.WriteByte('"')
+	return b.String()
+}
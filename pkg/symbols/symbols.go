@@ -0,0 +1,218 @@
+// File: pkg/symbols/symbols.go
+package symbols
+
+import (
+	"bufio"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Symbol is a top-level declaration found in a source file.
+type Symbol struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Line     int    `json:"line"`
+	Exported bool   `json:"exported"`
+}
+
+// Annotation is a TODO-style marker found in a comment.
+type Annotation struct {
+	Tag  string `json:"tag"`
+	Text string `json:"text"`
+	Line int    `json:"line"`
+}
+
+// AnnotationTags are the markers recognised by ExtractAnnotations.
+var AnnotationTags = []string{"TODO", "FIXME", "HACK", "XXX", "BUG", "NOTE"}
+
+var annotationPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])(` + strings.Join(AnnotationTags, "|") + `)(?:\([^)]*\))?(?:\s*[:\-]\s+|\s*:|\s+|$)(.*)$`)
+
+// commentStarts are the line-comment and block-comment openers that an annotation must follow.
+var commentStarts = []string{"//", "#", "/*", "*", "--", ";", "<!--", "\"\"\"", "'''"}
+
+// ExtractAnnotations returns TODO/FIXME-style markers that appear inside comments.
+func ExtractAnnotations(content string) []Annotation {
+	var annotations []Annotation
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		idx := commentIndex(line)
+		if idx < 0 {
+			continue
+		}
+		m := annotationPattern.FindStringSubmatch(line[idx:])
+		if m == nil {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[2]), "*/"))
+		annotations = append(annotations, Annotation{Tag: m[1], Text: text, Line: lineNo})
+	}
+	return annotations
+}
+
+func commentIndex(line string) int {
+	best := -1
+	for _, start := range commentStarts {
+		if i := strings.Index(line, start); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
+	}
+	return best
+}
+
+// ExtractSymbols returns the top-level declarations of a source file.
+// Go files are parsed with go/parser; other languages use line-based patterns.
+// Files in unsupported languages yield no symbols.
+func ExtractSymbols(relPath, content string) []Symbol {
+	ext := strings.TrimPrefix(path.Ext(relPath), ".")
+	if ext == "go" {
+		return extractGoSymbols(content)
+	}
+	patterns, ok := languagePatterns[ext]
+	if !ok {
+		return nil
+	}
+	var symbols []Symbol
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		for _, p := range patterns {
+			if m := p.re.FindStringSubmatch(line); m != nil {
+				name := m[1]
+				symbols = append(symbols, Symbol{
+					Name:     name,
+					Kind:     p.kind,
+					Line:     lineNo,
+					Exported: p.exported(line, name),
+				})
+				break
+			}
+		}
+	}
+	return symbols
+}
+
+func extractGoSymbols(content string) []Symbol {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil && file == nil {
+		return nil
+	}
+	var symbols []Symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func"
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				kind = "method"
+				if recv := receiverName(d.Recv.List[0].Type); recv != "" {
+					name = recv + "." + name
+				}
+			}
+			symbols = append(symbols, Symbol{Name: name, Kind: kind, Line: fset.Position(d.Pos()).Line, Exported: d.Name.IsExported()})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					kind := "type"
+					switch s.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					symbols = append(symbols, Symbol{Name: s.Name.Name, Kind: kind, Line: fset.Position(s.Pos()).Line, Exported: s.Name.IsExported()})
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, n := range s.Names {
+						if n.Name == "_" {
+							continue
+						}
+						symbols = append(symbols, Symbol{Name: n.Name, Kind: kind, Line: fset.Position(n.Pos()).Line, Exported: n.IsExported()})
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	}
+	return ""
+}
+
+type linePattern struct {
+	re       *regexp.Regexp
+	kind     string
+	exported func(line, name string) bool
+}
+
+func notUnderscored(_, name string) bool { return !strings.HasPrefix(name, "_") }
+func hasExport(line, _ string) bool      { return strings.HasPrefix(strings.TrimSpace(line), "export") }
+func hasPublic(line, _ string) bool      { return strings.Contains(line, "public ") }
+func hasPub(line, _ string) bool         { return strings.HasPrefix(strings.TrimSpace(line), "pub") }
+
+var jsPatterns = []linePattern{
+	{regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)`), "function", hasExport},
+	{regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`), "class", hasExport},
+	{regexp.MustCompile(`^(?:export\s+)?interface\s+([A-Za-z_$][\w$]*)`), "interface", hasExport},
+	{regexp.MustCompile(`^(?:export\s+)?type\s+([A-Za-z_$][\w$]*)\s*(?:<[^=]*>)?\s*=`), "type", hasExport},
+	{regexp.MustCompile(`^(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*=\s*(?:async\s*)?(?:\([^)]*\)|[A-Za-z_$][\w$]*)\s*=>`), "function", hasExport},
+}
+
+var languagePatterns = map[string][]linePattern{
+	"py": {
+		{regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_]\w*)`), "function", notUnderscored},
+		{regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`), "class", notUnderscored},
+	},
+	"js":  jsPatterns,
+	"jsx": jsPatterns,
+	"mjs": jsPatterns,
+	"ts":  jsPatterns,
+	"tsx": jsPatterns,
+	"java": {
+		{regexp.MustCompile(`^(?:public\s+|protected\s+|private\s+)?(?:abstract\s+|final\s+|static\s+)*(?:class|interface|enum|record)\s+([A-Za-z_]\w*)`), "class", hasPublic},
+	},
+	"kt": {
+		{regexp.MustCompile(`^(?:public\s+|internal\s+|private\s+)?(?:data\s+|sealed\s+|abstract\s+|open\s+)*(?:class|interface|object)\s+([A-Za-z_]\w*)`), "class", func(line, _ string) bool { return !strings.Contains(line, "private ") }},
+		{regexp.MustCompile(`^(?:public\s+|internal\s+|private\s+)?fun\s+(?:<[^>]*>\s*)?([A-Za-z_]\w*)`), "function", func(line, _ string) bool { return !strings.Contains(line, "private ") }},
+	},
+	"rs": {
+		{regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+([A-Za-z_]\w*)`), "function", hasPub},
+		{regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?struct\s+([A-Za-z_]\w*)`), "struct", hasPub},
+		{regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?enum\s+([A-Za-z_]\w*)`), "enum", hasPub},
+		{regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?trait\s+([A-Za-z_]\w*)`), "trait", hasPub},
+	},
+	"rb": {
+		{regexp.MustCompile(`^\s*def\s+(?:self\.)?([A-Za-z_]\w*[?!=]?)`), "method", notUnderscored},
+		{regexp.MustCompile(`^\s*(?:class|module)\s+([A-Z]\w*(?:::\w+)*)`), "class", notUnderscored},
+	},
+	"php": {
+		{regexp.MustCompile(`^(?:abstract\s+|final\s+)?(?:class|interface|trait)\s+([A-Za-z_]\w*)`), "class", notUnderscored},
+		{regexp.MustCompile(`^function\s+([A-Za-z_]\w*)`), "function", notUnderscored},
+	},
+}
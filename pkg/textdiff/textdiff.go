@@ -0,0 +1,234 @@
+// Package textdiff computes line diffs and renders them in the unified format.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edit is one line of a diff: Kind is ' ' for a line kept, '-' for a line only in the old
+// text and '+' for a line only in the new one.
+type Edit struct {
+	Kind byte
+	Line string
+}
+
+// maxEditDistance bounds the work of Diff: beyond this many inserted and deleted lines between
+// the common prefix and suffix, the rest is reported as replaced rather than minimised.
+const maxEditDistance = 4000
+
+// SplitLines splits a text into lines without their line feeds. A final line feed does not
+// start an empty last line.
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Diff returns a shortest edit script turning a into b (Myers' algorithm).
+func Diff(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{' ', line})
+	}
+	edits = append(edits, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{' ', line})
+	}
+	return edits
+}
+
+func diffMiddle(a, b []string) []Edit {
+	// Lines are compared as integers.
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	x, y := intern(a), intern(b)
+	n, m := len(x), len(y)
+
+	// v[k+offset] is the furthest x reached on diagonal k; trace[d] keeps v[-d..d] after step d.
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && d <= maxEditDistance; d++ {
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				px = v[offset+k+1]
+			} else {
+				px = v[offset+k-1] + 1
+			}
+			py := px - k
+			for px < n && py < m && x[px] == y[py] {
+				px++
+				py++
+			}
+			v[offset+k] = px
+			if px >= n && py >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		if found {
+			break
+		}
+	}
+	if !found {
+		edits := make([]Edit, 0, n+m)
+		for _, line := range a {
+			edits = append(edits, Edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, Edit{'+', line})
+		}
+		return edits
+	}
+
+	// Walk back from (n, m), collecting the edits in reverse.
+	var rev []Edit
+	px, py := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := px - py
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for px > prevX && py > prevY {
+			px--
+			py--
+			rev = append(rev, Edit{' ', a[px]})
+		}
+		if px == prevX {
+			py--
+			rev = append(rev, Edit{'+', b[py]})
+		} else {
+			px--
+			rev = append(rev, Edit{'-', a[px]})
+		}
+	}
+	for px > 0 && py > 0 {
+		px--
+		py--
+		rev = append(rev, Edit{' ', a[px]})
+	}
+
+	edits := make([]Edit, len(rev))
+	for i, e := range rev {
+		edits[len(rev)-1-i] = e
+	}
+	return edits
+}
+
+// Changed reports whether the edits contain any insertion or deletion.
+func Changed(edits []Edit) bool {
+	for _, e := range edits {
+		if e.Kind != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// Unified renders the edits as a unified diff with the given number of context lines. If
+// heading is not nil, each hunk header ends with the last line before the hunk for which it
+// returns true, like the function names git shows after "@@". It returns "" without changes.
+func Unified(oldName, newName string, edits []Edit, context int, heading func(line string) bool) string {
+	if !Changed(edits) {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// oldLine[i] and newLine[i] are the 0-based line numbers in each text before edit i.
+	oldLine := make([]int, len(edits)+1)
+	newLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if e.Kind != '+' {
+			oldLine[i+1]++
+		}
+		if e.Kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].Kind == ' ' {
+			i++
+			continue
+		}
+		// A hunk runs from context lines before the change to context lines after the last
+		// change that is at most 2*context kept lines away from the previous one.
+		start := max(0, i-context)
+		end := i
+		for end < len(edits) {
+			if edits[end].Kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Kind == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(len(edits), end+context)
+				break
+			}
+			end = run
+		}
+
+		oldCount := oldLine[end] - oldLine[start]
+		newCount := newLine[end] - newLine[start]
+		oldStart, newStart := oldLine[start]+1, newLine[start]+1
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@", oldStart, oldCount, newStart, newCount)
+		if heading != nil {
+			for j := start - 1; j >= 0; j-- {
+				if edits[j].Kind != '-' && heading(edits[j].Line) {
+					sb.WriteString(" " + edits[j].Line)
+					break
+				}
+			}
+		}
+		sb.WriteString("\n")
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.Kind)
+			sb.WriteString(e.Line)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+	return sb.String()
+}
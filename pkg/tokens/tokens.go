@@ -0,0 +1,16 @@
+// File: pkg/tokens/tokens.go
+package tokens
+
+// BytesPerToken is the average number of bytes per token assumed by the estimates.
+// It is a model-agnostic approximation that is close for English text and source code.
+const BytesPerToken = 4
+
+// EstimateFromSize estimates the token count of a text file from its size in bytes.
+func EstimateFromSize(sizeBytes int64) int64 {
+	return (sizeBytes + BytesPerToken - 1) / BytesPerToken
+}
+
+// Estimate estimates the token count of a text.
+func Estimate(text string) int64 {
+	return EstimateFromSize(int64(len(text)))
+}
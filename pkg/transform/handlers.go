@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Handler actions of the 'content.handlers' config.
+const (
+	// HandlerSkip leaves the file out.
+	HandlerSkip = "skip"
+	// HandlerPlaceholder replaces the content with a one-line note of the file's size.
+	HandlerPlaceholder = "placeholder"
+	// HandlerExtract returns the text of documents (PDF, DOCX, ODT) and notebooks.
+	HandlerExtract = "extract"
+	// HandlerTruncate keeps the first lines that fit into Handler.Tokens.
+	HandlerTruncate = "truncate"
+)
+
+// Handler is the treatment of the files matching one entry of the 'content.handlers' config.
+type Handler struct {
+	Action string
+	// Tokens is the limit of HandlerTruncate.
+	Tokens int64
+}
+
+// Handlers maps file name patterns to handlers. A pattern starting with '.' matches the
+// names ending with it (".lock", ".min.js"); any other pattern matches a whole file name
+// ("package-lock.json"). Names are compared case-insensitively.
+type Handlers map[string]Handler
+
+// ParseHandlers reads handlers from config entries like ".lock: skip" or ".min.js: truncate 50".
+func ParseHandlers(config map[string]string) (Handlers, error) {
+	handlers := make(Handlers, len(config))
+	for pattern, spec := range config {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("handler for '%s' has no action", pattern)
+		}
+		h := Handler{Action: fields[0]}
+		switch {
+		case h.Action == HandlerTruncate && len(fields) == 2:
+			tokens, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || tokens <= 0 {
+				return nil, fmt.Errorf("handler for '%s': truncate needs a positive number of tokens, got '%s'", pattern, fields[1])
+			}
+			h.Tokens = tokens
+		case h.Action == HandlerTruncate:
+			return nil, fmt.Errorf("handler for '%s': expected 'truncate N'", pattern)
+		case len(fields) > 1:
+			return nil, fmt.Errorf("handler for '%s': unexpected '%s'", pattern, strings.Join(fields[1:], " "))
+		case h.Action != HandlerSkip && h.Action != HandlerPlaceholder && h.Action != HandlerExtract:
+			return nil, fmt.Errorf("handler for '%s': unknown action '%s' (expected %s, %s, %s or %s N)",
+				pattern, h.Action, HandlerSkip, HandlerPlaceholder, HandlerExtract, HandlerTruncate)
+		}
+		handlers[strings.ToLower(pattern)] = h
+	}
+	return handlers, nil
+}
+
+// For returns the handler of a file. When several patterns match, the longest wins, so
+// ".min.js" takes precedence over ".js".
+func (h Handlers) For(relPath string) (Handler, bool) {
+	name := strings.ToLower(path.Base(relPath))
+	var best string
+	var found Handler
+	for pattern, handler := range h {
+		matches := name == pattern || (strings.HasPrefix(pattern, ".") && strings.HasSuffix(name, pattern))
+		if matches && len(pattern) > len(best) {
+			best, found = pattern, handler
+		}
+	}
+	return found, best != ""
+}
+
+// Apply applies a handler's change of the content of a file: the note of HandlerPlaceholder
+// or the truncation of HandlerTruncate. Other actions leave the content as is.
+func (h Handler) Apply(relPath, content string) string {
+	switch h.Action {
+	case HandlerPlaceholder:
+		return Placeholder(relPath, int64(len(content)))
+	case HandlerTruncate:
+		return Truncate(content, h.Tokens, TruncateHead)
+	}
+	return content
+}
+
+// Placeholder is the note that stands for the content of a file.
+func Placeholder(relPath string, size int64) string {
+	return fmt.Sprintf("[%s: %s, content omitted]", path.Base(relPath), humanize.Bytes(uint64(size)))
+}
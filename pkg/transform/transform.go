@@ -0,0 +1,190 @@
+// Package transform turns file contents into prompt text through one pipeline of optional
+// steps, applied in a fixed order: strip comments, redact secrets, truncate, fence.
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"code-prompt-core/pkg/markdown"
+	"code-prompt-core/pkg/tokens"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Options selects the steps of a pipeline. The zero value changes nothing. Profiles store
+// it as the "transform" field of their filter.
+type Options struct {
+	// StripComments removes comments in the languages markdown.Highlight knows.
+	StripComments bool `json:"stripComments,omitempty"`
+	// RedactSecrets replaces likely secrets (private keys, access tokens, values assigned to
+	// keys named like passwords or API keys) with RedactedMarker.
+	RedactSecrets bool `json:"redactSecrets,omitempty"`
+	// MaxFileTokens truncates files estimated at more tokens to whole lines chosen by
+	// Truncate, marking what was cut. Zero disables truncation.
+	MaxFileTokens int64 `json:"maxFileTokens,omitempty"`
+	// Truncate is the part of a truncated file that is kept: TruncateHead (the default),
+	// TruncateTail or TruncateMiddle.
+	Truncate string `json:"truncate,omitempty"`
+	// Fence wraps every file in a Markdown code fence tagged with its language.
+	Fence bool `json:"fence,omitempty"`
+}
+
+// RedactedMarker replaces every redacted secret.
+const RedactedMarker = "[REDACTED]"
+
+// Truncation strategies of Options.Truncate.
+const (
+	// TruncateHead keeps the first lines of a file.
+	TruncateHead = "head"
+	// TruncateTail keeps the last lines, e.g. of logs and changelogs.
+	TruncateTail = "tail"
+	// TruncateMiddle keeps the first and the last lines and cuts the middle.
+	TruncateMiddle = "middle"
+)
+
+// Validate checks the truncation settings.
+func (o Options) Validate() error {
+	if o.MaxFileTokens < 0 {
+		return fmt.Errorf("maxFileTokens must not be negative")
+	}
+	switch o.Truncate {
+	case "", TruncateHead, TruncateTail, TruncateMiddle:
+		return nil
+	}
+	return fmt.Errorf("invalid truncate strategy '%s' (expected %s, %s or %s)", o.Truncate, TruncateHead, TruncateTail, TruncateMiddle)
+}
+
+// Step transforms the content of one file.
+type Step func(relPath, content string) string
+
+// Pipeline is a sequence of steps.
+type Pipeline []Step
+
+// New returns the pipeline of the steps enabled in o.
+func New(o Options) Pipeline {
+	var p Pipeline
+	if o.StripComments {
+		p = append(p, func(relPath, content string) string {
+			return markdown.StripComments(content, markdown.Language(relPath))
+		})
+	}
+	if o.RedactSecrets {
+		p = append(p, func(_, content string) string { return RedactSecrets(content) })
+	}
+	if o.MaxFileTokens > 0 {
+		p = append(p, func(_, content string) string { return Truncate(content, o.MaxFileTokens, o.Truncate) })
+	}
+	if o.Fence {
+		p = append(p, Fence)
+	}
+	return p
+}
+
+// Apply runs the steps of the pipeline on the content of a file.
+func (p Pipeline) Apply(relPath, content string) string {
+	for _, step := range p {
+		content = step(relPath, content)
+	}
+	return content
+}
+
+var (
+	// secretPatterns match well-known secret formats as a whole.
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+		regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+		regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+		regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`),
+	}
+	// quotedSecret matches a quoted value assigned to a key named like a secret, e.g.
+	// password = "hunter22" or "apiKey": "...".
+	quotedSecret = regexp.MustCompile(`(?i)((?:api[_-]?key|secret|token|passw(?:or)?d)[A-Za-z0-9_]*["']?\s*[:=]\s*["'])([^"'\s]{8,})(["'])`)
+	// envSecret matches an unquoted value on a KEY=value or key: value line, as in .env and
+	// YAML files. References like ${DB_PASSWORD} and calls are left alone.
+	envSecret = regexp.MustCompile(`(?im)^(\s*(?:export\s+)?[A-Za-z0-9_.-]*(?:api[_-]?key|secret|token|passw(?:or)?d)[A-Za-z0-9_.-]*\s*[:=]\s*)([^\s"'#()$][^\s"'#()]{7,})\s*$`)
+)
+
+// RedactSecrets replaces likely secrets in content with RedactedMarker.
+func RedactSecrets(content string) string {
+	for _, re := range secretPatterns {
+		content = re.ReplaceAllString(content, RedactedMarker)
+	}
+	content = quotedSecret.ReplaceAllString(content, "${1}"+RedactedMarker+"${3}")
+	return envSecret.ReplaceAllString(content, "${1}"+RedactedMarker)
+}
+
+// Truncate reduces content estimated at more than maxTokens to the whole lines that fit,
+// taken as the strategy says (TruncateHead if empty), and puts a line like
+// "[... truncated 1,234 lines ...]" where lines were cut. The marker counts towards maxTokens.
+func Truncate(content string, maxTokens int64, strategy string) string {
+	if tokens.Estimate(content) <= maxTokens {
+		return content
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	budget := int(maxTokens*tokens.BytesPerToken) - len(truncationMarker(len(lines))) - 1
+	// take returns how many of the lines, in order, fit into budget bytes.
+	take := func(lines []string, budget int, fromEnd bool) int {
+		n, size := 0, 0
+		for n < len(lines) {
+			line := lines[n]
+			if fromEnd {
+				line = lines[len(lines)-1-n]
+			}
+			if size+len(line) > budget {
+				break
+			}
+			size += len(line)
+			n++
+		}
+		return n
+	}
+
+	var head, tail int
+	switch strategy {
+	case TruncateTail:
+		tail = take(lines, budget, true)
+	case TruncateMiddle:
+		head = take(lines, budget/2, false)
+		tail = take(lines[head:], budget-len(strings.Join(lines[:head], "")), true)
+	default:
+		head = take(lines, budget, false)
+	}
+	kept := strings.Join(lines[:head], "")
+	if kept != "" && !strings.HasSuffix(kept, "\n") {
+		kept += "\n"
+	}
+	kept += truncationMarker(len(lines)-head-tail) + "\n"
+	return kept + strings.Join(lines[len(lines)-tail:], "")
+}
+
+func truncationMarker(lines int) string {
+	return "[... truncated " + humanize.Comma(int64(lines)) + " lines ...]"
+}
+
+// Fence wraps content in a Markdown code fence tagged with the language of relPath. The
+// fence is longer than any run of backticks in content.
+func Fence(relPath, content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fence + markdown.Language(relPath) + "\n" + content + fence + "\n"
+}
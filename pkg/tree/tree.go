@@ -0,0 +1,281 @@
+// File: pkg/tree/tree.go
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Node is a file or directory in a project tree. Paths always use '/' as separator.
+type Node struct {
+	Name           string  `json:"name"`
+	Path           string  `json:"path"`
+	IsDir          bool    `json:"is_dir"`
+	Status         string  `json:"status,omitempty"`
+	SizeBytes      int64   `json:"size_bytes,omitempty"`       // 用于文件
+	TotalSizeBytes int64   `json:"total_size_bytes,omitempty"` // 用于目录
+	TotalFileCount int     `json:"total_file_count,omitempty"` // 用于目录
+	Children       []*Node `json:"children"`
+
+	// tokens is the estimated prompt size of the file or directory, shown by RenderText and RenderHTML.
+	tokens int64
+}
+
+const (
+	StatusIncluded = "included"
+	StatusExcluded = "excluded"
+)
+
+// Builder assembles a tree from relative file paths as stored in the cache.
+type Builder struct {
+	root     *Node
+	nodes    map[string]*Node
+	included map[string]struct{}
+}
+
+// NewBuilder creates a builder whose root node is named rootName.
+// If included is not nil, every added file is annotated with StatusIncluded or StatusExcluded.
+func NewBuilder(rootName string, included map[string]struct{}) *Builder {
+	root := &Node{Name: rootName, Path: ".", IsDir: true, Children: []*Node{}}
+	return &Builder{
+		root:     root,
+		nodes:    map[string]*Node{".": root},
+		included: included,
+	}
+}
+
+// Add inserts a file and any missing parent directories. relPath must use '/' as separator,
+// so it is split and joined with the "path" package on every OS.
+func (b *Builder) Add(relPath string, sizeBytes int64) {
+	b.AddFile(relPath, sizeBytes, 0)
+}
+
+// AddFile is Add with the estimated prompt tokens of the file, which directories sum up.
+func (b *Builder) AddFile(relPath string, sizeBytes, tokens int64) {
+	parts := strings.Split(relPath, "/")
+	currentPath := ""
+
+	for i, part := range parts {
+		isDir := i < len(parts)-1
+		if i > 0 {
+			currentPath = path.Join(currentPath, part)
+		} else {
+			currentPath = part
+		}
+
+		if _, exists := b.nodes[currentPath]; exists {
+			continue
+		}
+		newNode := &Node{Name: part, Path: currentPath, IsDir: isDir, Children: []*Node{}}
+		if !isDir {
+			newNode.SizeBytes = sizeBytes
+			newNode.tokens = tokens
+			if b.included != nil {
+				if _, isIncluded := b.included[currentPath]; isIncluded {
+					newNode.Status = StatusIncluded
+				} else {
+					newNode.Status = StatusExcluded
+				}
+			}
+		}
+
+		parentPath := path.Dir(currentPath)
+		if parent, ok := b.nodes[parentPath]; ok {
+			parent.Children = append(parent.Children, newNode)
+		}
+		b.nodes[currentPath] = newNode
+	}
+}
+
+// Build calculates the directory aggregates, sorts the tree and returns its root.
+func (b *Builder) Build() *Node {
+	CalculateAggregates(b.root)
+	Sort(b.root)
+	return b.root
+}
+
+// CalculateAggregates recursively calculates the total size and file count of every directory,
+// aggregating from the leaves (files) up to the given node.
+func CalculateAggregates(node *Node) (size int64, count int) {
+	if !node.IsDir {
+		return node.SizeBytes, 1
+	}
+
+	var totalSize, totalTokens int64
+	var totalCount int
+	for _, child := range node.Children {
+		childSize, childCount := CalculateAggregates(child)
+		totalSize += childSize
+		totalCount += childCount
+		totalTokens += child.tokens
+	}
+
+	node.tokens = totalTokens
+
+	node.TotalSizeBytes = totalSize
+	node.TotalFileCount = totalCount
+	return totalSize, totalCount
+}
+
+// Sort orders children recursively: directories first, then by name.
+func Sort(node *Node) {
+	if !node.IsDir || len(node.Children) == 0 {
+		return
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		if node.Children[i].IsDir != node.Children[j].IsDir {
+			return node.Children[i].IsDir
+		}
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	for _, child := range node.Children {
+		Sort(child)
+	}
+}
+
+// CollapseSingleChild merges every chain of directories that each contain only one directory
+// into a single node named like "src/main/java", as IDEs show them. The root is kept as is.
+func CollapseSingleChild(node *Node) {
+	for _, child := range node.Children {
+		if !child.IsDir {
+			continue
+		}
+		for len(child.Children) == 1 && child.Children[0].IsDir {
+			only := child.Children[0]
+			child.Name += "/" + only.Name
+			child.Path = only.Path
+			child.Children = only.Children
+		}
+		CollapseSingleChild(child)
+	}
+}
+
+// RenderJSON writes the tree as indented JSON.
+func RenderJSON(w io.Writer, root *Node) error {
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// TextOptions controls RenderText.
+type TextOptions struct {
+	// NoSizes leaves out the sizes and file counts.
+	NoSizes bool
+	// Tokens shows the estimated prompt tokens of files and directories.
+	Tokens bool
+}
+
+// RenderText writes the tree using box-drawing connectors, one node per line. Sizes are
+// human-readable, and in an annotated tree files are marked ✓ (included) or ✗ (excluded).
+func RenderText(w io.Writer, root *Node, opts TextOptions) {
+	fmt.Fprintln(w, root.Name+textDetails(root, opts))
+	renderTextChildren(w, root, "", opts)
+}
+
+func renderTextChildren(w io.Writer, node *Node, prefix string, opts TextOptions) {
+	for i, child := range node.Children {
+		isLast := i == len(node.Children)-1
+		connector := "├── "
+		if isLast {
+			connector = "└── "
+		}
+		statusMarker := ""
+		switch child.Status {
+		case StatusIncluded:
+			statusMarker = "✓ "
+		case StatusExcluded:
+			statusMarker = "✗ "
+		}
+
+		fmt.Fprintln(w, prefix+connector+statusMarker+child.Name+textDetails(child, opts))
+
+		if child.IsDir {
+			newPrefix := prefix
+			if isLast {
+				newPrefix += "    "
+			} else {
+				newPrefix += "│   "
+			}
+			renderTextChildren(w, child, newPrefix, opts)
+		}
+	}
+}
+
+// textDetails returns the parenthesized sizes of a node, or "" if there is nothing to show.
+func textDetails(node *Node, opts TextOptions) string {
+	var details []string
+	if !opts.NoSizes {
+		if node.IsDir {
+			details = append(details, fmt.Sprintf("%d files", node.TotalFileCount), humanize.Bytes(uint64(node.TotalSizeBytes)))
+		} else {
+			details = append(details, humanize.Bytes(uint64(node.SizeBytes)))
+		}
+	}
+	if opts.Tokens {
+		details = append(details, fmt.Sprintf("~%s tokens", humanize.Comma(node.tokens)))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+// RenderMarkdown writes the tree as a nested Markdown list. Directories end with '/'.
+func RenderMarkdown(w io.Writer, root *Node) {
+	fmt.Fprintf(w, "- **%s/** (%d files, %d bytes)\n", root.Name, root.TotalFileCount, root.TotalSizeBytes)
+	renderMarkdownChildren(w, root, "  ")
+}
+
+func renderMarkdownChildren(w io.Writer, node *Node, indent string) {
+	for _, child := range node.Children {
+		statusMarker := ""
+		if child.Status == StatusExcluded {
+			statusMarker = " _(excluded)_"
+		}
+		if child.IsDir {
+			fmt.Fprintf(w, "%s- `%s/` (%d files, %d bytes)%s\n", indent, child.Name, child.TotalFileCount, child.TotalSizeBytes, statusMarker)
+			renderMarkdownChildren(w, child, indent+"  ")
+		} else {
+			fmt.Fprintf(w, "%s- `%s` (%d bytes)%s\n", indent, child.Name, child.SizeBytes, statusMarker)
+		}
+	}
+}
+
+// RenderHTML writes the tree as nested <details> elements that collapse and expand without
+// script, with sizes and estimated tokens. Files link to the fragment returned by anchor.
+func RenderHTML(w io.Writer, root *Node, anchor func(relPath string) string) {
+	fmt.Fprintf(w, "<details class=\"tree\" open><summary>%s/ <span class=\"meta\">(%s)</span></summary>\n", html.EscapeString(root.Name), htmlDetails(root))
+	renderHTMLChildren(w, root, anchor)
+	fmt.Fprintln(w, "</details>")
+}
+
+func renderHTMLChildren(w io.Writer, node *Node, anchor func(relPath string) string) {
+	fmt.Fprintln(w, "<ul>")
+	for _, child := range node.Children {
+		if child.IsDir {
+			fmt.Fprintf(w, "<li><details open><summary>%s/ <span class=\"meta\">(%s)</span></summary>\n", html.EscapeString(child.Name), htmlDetails(child))
+			renderHTMLChildren(w, child, anchor)
+			fmt.Fprintln(w, "</details></li>")
+		} else {
+			fmt.Fprintf(w, "<li><a href=\"#%s\">%s</a> <span class=\"meta\">(%s)</span></li>\n", html.EscapeString(anchor(child.Path)), html.EscapeString(child.Name), htmlDetails(child))
+		}
+	}
+	fmt.Fprintln(w, "</ul>")
+}
+
+func htmlDetails(node *Node) string {
+	if node.IsDir {
+		return fmt.Sprintf("%d files, %s, ~%s tokens", node.TotalFileCount, humanize.Bytes(uint64(node.TotalSizeBytes)), humanize.Comma(node.tokens))
+	}
+	return fmt.Sprintf("%s, ~%s tokens", humanize.Bytes(uint64(node.SizeBytes)), humanize.Comma(node.tokens))
+}
@@ -0,0 +1,246 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testFile struct {
+	path   string
+	size   int64
+	tokens int64
+}
+
+// sampleTree is the fixed tree of the render tests:
+//
+//	proj/
+//	  src/a.go      1500 bytes, 10 tokens, included
+//	  src/sub/b.go   500 bytes,  5 tokens, excluded
+//	  README.md     2000 bytes, 20 tokens, included
+func sampleTree() *Node {
+	b := NewBuilder("proj", map[string]struct{}{"src/a.go": {}, "README.md": {}})
+	for _, f := range []testFile{{"src/sub/b.go", 500, 5}, {"README.md", 2000, 20}, {"src/a.go", 1500, 10}} {
+		b.AddFile(f.path, f.size, f.tokens)
+	}
+	return b.Build()
+}
+
+// paths lists the path of every node below n, depth first, with a trailing '/' for directories.
+func paths(n *Node) []string {
+	var out []string
+	for _, child := range n.Children {
+		p := child.Path
+		if child.IsDir {
+			p += "/"
+		}
+		out = append(out, p)
+		out = append(out, paths(child)...)
+	}
+	return out
+}
+
+func find(n *Node, p string) *Node {
+	if n.Path == p {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := find(child, p); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestBuilderAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{"flat", []string{"b.go", "a.go"}, []string{"a.go", "b.go"}},
+		{"nested", []string{"a/b/c.go"}, []string{"a/", "a/b/", "a/b/c.go"}},
+		{"shared parents", []string{"a/x.go", "a/b/y.go", "a/b/z.go"}, []string{"a/", "a/b/", "a/b/y.go", "a/b/z.go", "a/x.go"}},
+		{"duplicate", []string{"a/x.go", "a/x.go"}, []string{"a/", "a/x.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder("root", nil)
+			for _, f := range tt.files {
+				b.Add(f, 1)
+			}
+			root := b.Build()
+			got := paths(root)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for _, p := range got {
+				if n := find(root, strings.TrimSuffix(p, "/")); n.Status != "" {
+					t.Errorf("%s: status %q set without an included set", p, n.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestAddFileNames(t *testing.T) {
+	b := NewBuilder("root", nil)
+	b.AddFile("pkg/tree/tree.go", 10, 3)
+	root := b.Build()
+	n := find(root, "pkg/tree/tree.go")
+	if n == nil || n.Name != "tree.go" || n.IsDir || n.SizeBytes != 10 || n.tokens != 3 {
+		t.Fatalf("unexpected file node %+v", n)
+	}
+	if dir := find(root, "pkg/tree"); dir == nil || dir.Name != "tree" || !dir.IsDir {
+		t.Fatalf("unexpected directory node %+v", dir)
+	}
+}
+
+func TestCalculateAggregates(t *testing.T) {
+	root := sampleTree()
+	tests := []struct {
+		path   string
+		size   int64
+		count  int
+		tokens int64
+	}{
+		{".", 4000, 3, 35},
+		{"src", 2000, 2, 15},
+		{"src/sub", 500, 1, 5},
+	}
+	for _, tt := range tests {
+		n := find(root, tt.path)
+		if n == nil {
+			t.Fatalf("%s not found", tt.path)
+		}
+		if n.TotalSizeBytes != tt.size || n.TotalFileCount != tt.count || n.tokens != tt.tokens {
+			t.Errorf("%s: got %d bytes, %d files, %d tokens; want %d, %d, %d",
+				tt.path, n.TotalSizeBytes, n.TotalFileCount, n.tokens, tt.size, tt.count, tt.tokens)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	b := NewBuilder("root", nil)
+	for _, f := range []string{"z.go", "b/x.go", "a.go", "a/y.go", "C.md"} {
+		b.Add(f, 1)
+	}
+	root := b.Build()
+	var got []string
+	for _, child := range root.Children {
+		got = append(got, child.Name)
+	}
+	// Directories first, then files, each by name (byte order, so upper case first).
+	want := []string{"a", "b", "C.md", "a.go", "z.go"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCollapseSingleChild(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{"chain", []string{"a/b/c/x.go", "a/b/c/y.go", "d/z.go"}, []string{"a/b/c/", "a/b/c/x.go", "a/b/c/y.go", "d/", "d/z.go"}},
+		{"stops at files", []string{"p/q/r.go", "p/q/s/t.go"}, []string{"p/q/", "p/q/s/", "p/q/s/t.go", "p/q/r.go"}},
+		{"nothing to collapse", []string{"a/x.go", "b.go"}, []string{"a/", "a/x.go", "b.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder("root", nil)
+			for _, f := range tt.files {
+				b.Add(f, 1)
+			}
+			root := b.Build()
+			CollapseSingleChild(root)
+			got := paths(root)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	b := NewBuilder("root", nil)
+	b.Add("a/b/c/x.go", 1)
+	root := b.Build()
+	CollapseSingleChild(root)
+	if root.Children[0].Name != "a/b/c" {
+		t.Errorf("collapsed name %q, want a/b/c", root.Children[0].Name)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderJSON(&buf, sampleTree()); err != nil {
+		t.Fatal(err)
+	}
+	var root Node
+	if err := json.Unmarshal(buf.Bytes(), &root); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if root.Name != "proj" || root.TotalSizeBytes != 4000 || root.TotalFileCount != 3 || len(root.Children) != 2 {
+		t.Errorf("unexpected root %+v", root)
+	}
+	b := find(&root, "src/sub/b.go")
+	if b == nil || b.SizeBytes != 500 || b.Status != StatusExcluded {
+		t.Errorf("unexpected file %+v", b)
+	}
+	if !strings.Contains(buf.String(), "\n  \"name\": \"proj\"") {
+		t.Errorf("JSON is not indented:\n%s", buf.String())
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TextOptions
+		want string
+	}{
+		{"sizes", TextOptions{}, `proj (3 files, 4.0 kB)
+├── src (2 files, 2.0 kB)
+│   ├── sub (1 files, 500 B)
+│   │   └── ✗ b.go (500 B)
+│   └── ✓ a.go (1.5 kB)
+└── ✓ README.md (2.0 kB)
+`},
+		{"no sizes", TextOptions{NoSizes: true}, `proj
+├── src
+│   ├── sub
+│   │   └── ✗ b.go
+│   └── ✓ a.go
+└── ✓ README.md
+`},
+		{"tokens only", TextOptions{NoSizes: true, Tokens: true}, `proj (~35 tokens)
+├── src (~15 tokens)
+│   ├── sub (~5 tokens)
+│   │   └── ✗ b.go (~5 tokens)
+│   └── ✓ a.go (~10 tokens)
+└── ✓ README.md (~20 tokens)
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			RenderText(&buf, sampleTree(), tt.opts)
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	want := "- **proj/** (3 files, 4000 bytes)\n" +
+		"  - `src/` (2 files, 2000 bytes)\n" +
+		"    - `sub/` (1 files, 500 bytes)\n" +
+		"      - `b.go` (500 bytes) _(excluded)_\n" +
+		"    - `a.go` (1500 bytes)\n" +
+		"  - `README.md` (2000 bytes)\n"
+	var buf bytes.Buffer
+	RenderMarkdown(&buf, sampleTree())
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,75 @@
+package profiles
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code-prompt-core/pkg/filter"
+)
+
+// FS holds the built-in starter profiles, one JSON file per profile.
+//
+//go:embed *.json
+var FS embed.FS
+
+// ProfileInfo is a built-in filter profile.
+type ProfileInfo struct {
+	Name        string          `json:"name"` // The file name without ".json", e.g. "backend-go"
+	Description string          `json:"description"`
+	Data        json.RawMessage `json:"data"` // The filter rules, as saved by 'profiles init'
+}
+
+// BuiltInProfiles is populated at program startup, sorted by name.
+var BuiltInProfiles []ProfileInfo
+
+func init() {
+	entries, err := FS.ReadDir(".")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read embedded profiles directory: %v", err))
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		content, err := FS.ReadFile(entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("failed to read embedded profile '%s': %v", entry.Name(), err))
+		}
+		var file struct {
+			Description string          `json:"description"`
+			Filter      json.RawMessage `json:"filter"`
+		}
+		if err := json.Unmarshal(content, &file); err != nil {
+			panic(fmt.Sprintf("invalid embedded profile '%s': %v", entry.Name(), err))
+		}
+		var f filter.Filter
+		if err := json.Unmarshal(file.Filter, &f); err != nil {
+			panic(fmt.Sprintf("invalid filter in embedded profile '%s': %v", entry.Name(), err))
+		}
+		if err := f.Compile(); err != nil {
+			panic(fmt.Sprintf("invalid filter in embedded profile '%s': %v", entry.Name(), err))
+		}
+		var data bytes.Buffer
+		json.Compact(&data, file.Filter)
+		BuiltInProfiles = append(BuiltInProfiles, ProfileInfo{
+			Name:        strings.TrimSuffix(entry.Name(), ".json"),
+			Description: file.Description,
+			Data:        data.Bytes(),
+		})
+	}
+	sort.Slice(BuiltInProfiles, func(i, j int) bool { return BuiltInProfiles[i].Name < BuiltInProfiles[j].Name })
+}
+
+// Lookup returns the built-in profile with the given name.
+func Lookup(name string) (ProfileInfo, bool) {
+	for _, p := range BuiltInProfiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ProfileInfo{}, false
+}